@@ -0,0 +1,292 @@
+package semtools
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+
+// AggregateFunction identifies the function an aggregate
+// computes over the nodes of a group.
+type AggregateFunction string
+
+const (
+	// CountAggregate counts the statements (or distinct nodes) of a group.
+	CountAggregate AggregateFunction = "count"
+
+	// MinAggregate and MaxAggregate return the smallest and largest node
+	// of a group, using the order of CompareNodes.
+	MinAggregate AggregateFunction = "min"
+	MaxAggregate AggregateFunction = "max"
+
+	// SumAggregate and AvgAggregate compute sum and average of numeric
+	// literals of a group.
+	SumAggregate AggregateFunction = "sum"
+	AvgAggregate AggregateFunction = "avg"
+
+	// GroupConcatAggregate joins the lexical forms of the nodes of a
+	// group using the separator.
+	GroupConcatAggregate AggregateFunction = "group_concat"
+)
+
+// Aggregate describes a single aggregate to compute over the
+// nodes at a position of the grouped query results.
+type Aggregate struct {
+
+	// Function is the aggregate function to compute.
+	Function AggregateFunction
+
+	// Position is the position of the nodes to aggregate. It is
+	// ignored when counting statements without Distinct.
+	Position Position
+
+	// Distinct removes duplicate nodes before aggregation.
+	Distinct bool
+
+	// Separator is used by GroupConcatAggregate, defaults to " ".
+	Separator string
+
+}
+
+// AggregateResult contains the aggregated values of a single
+// group of query results.
+type AggregateResult struct {
+
+	// Group contains the nodes the group was built from, in the
+	// order of the positions given to GroupBy().
+	Group []Node
+
+	// Values contains the results of the aggregates in the order
+	// they were requested. Counts, sums and averages are typed
+	// literals with a XSD numeric type, integer sums keep their
+	// exact lexical form as value. Counts and sums over empty groups
+	// are 0, minimum, maximum and average of empty groups are nil.
+	Values []Node
+
+}
+
+// aggregateGroup collects the statements of a group during
+// aggregation.
+type aggregateGroup struct {
+	group []Node
+	stmts []Statement
+}
+
+// aggregate groups the statements by the positions and computes
+// the aggregates for each group.
+func aggregate(stmts []Statement, groupBy []Position, aggregates []Aggregate) ([]AggregateResult, error) {
+
+	// group the statements, keeping the order of first appearance
+	groups := []*aggregateGroup{}
+	index := map[string]*aggregateGroup{}
+	for _, stmt := range stmts {
+		nodes := make([]Node, len(groupBy))
+		keys := make([]string, len(groupBy))
+		for idx, p := range groupBy {
+			nodes[idx] = p.Of(stmt)
+			keys[idx] = formatNode(nodes[idx])
+		}
+		key := strings.Join(keys, " ")
+		g, ok := index[key]
+		if !ok {
+			g = &aggregateGroup{group: nodes}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		g.stmts = append(g.stmts, stmt)
+	}
+
+	// without grouping there is always exactly one group
+	if len(groupBy) == 0 && len(groups) == 0 {
+		groups = append(groups, &aggregateGroup{group: []Node{}})
+	}
+
+	res := make([]AggregateResult, len(groups))
+	for gIdx, g := range groups {
+		values := make([]Node, len(aggregates))
+		for aIdx, a := range aggregates {
+			v, err := a.compute(g.stmts)
+			if err != nil {
+				return nil, err
+			}
+			values[aIdx] = v
+		}
+		res[gIdx] = AggregateResult{Group: g.group, Values: values}
+	}
+	return res, nil
+}
+
+// compute calculates the aggregate over the statements.
+func (a Aggregate) compute(stmts []Statement) (Node, error) {
+
+	// collect the nodes to aggregate
+	nodes := []Node{}
+	seen := map[string]bool{}
+	for _, stmt := range stmts {
+		n := a.Position.Of(stmt)
+		if a.Function == CountAggregate && !a.Distinct {
+			nodes = append(nodes, n)
+			continue
+		}
+		if n == nil {
+			continue
+		}
+		if a.Distinct {
+			if seen[formatNode(n)] {
+				continue
+			}
+			seen[formatNode(n)] = true
+		}
+		nodes = append(nodes, n)
+	}
+
+	switch a.Function {
+	case CountAggregate:
+		return NewTypedLiteral(int64(len(nodes)), NewNamedNode(xsdNamespace + "integer")), nil
+	case MinAggregate, MaxAggregate:
+		var res Node
+		for _, n := range nodes {
+			c := CompareNodes(n, res)
+			if res == nil || (a.Function == MinAggregate && c < 0) || (a.Function == MaxAggregate && c > 0) {
+				res = n
+			}
+		}
+		return res, nil
+	case SumAggregate, AvgAggregate:
+		return a.computeNumeric(nodes)
+	case GroupConcatAggregate:
+		separator := a.Separator
+		if separator == "" {
+			separator = " "
+		}
+		strs := make([]string, len(nodes))
+		for idx, n := range nodes {
+			if nn, ok := n.(NamedNode); ok {
+				strs[idx] = nn.Iri()
+			} else {
+				strs[idx] = n.String()
+			}
+		}
+		return NewTypedLiteral(strings.Join(strs, separator), NewNamedNode(xsdNamespace + "string")), nil
+	}
+	return nil, fmt.Errorf("Unknown aggregate function '%v'", a.Function)
+}
+
+// computeNumeric calculates sum or average of the nodes, the
+// resulting datatype is promoted from xsd:integer over xsd:decimal
+// and xsd:float to xsd:double as in XPath arithmetics. Integers
+// are summed exactly as long as no other type is involved, the
+// exact sum is returned in its lexical form regardless of its size.
+func (a Aggregate) computeNumeric(nodes []Node) (Node, error) {
+	sum := 0.0
+	integer := new(big.Int)
+	exact := true
+	rank := integerRank
+	for _, n := range nodes {
+		ln, ok := n.(LiteralNode)
+		if !ok {
+			return nil, fmt.Errorf("Unable to %v non literal node '%v'", a.Function, n)
+		}
+		v, kind := literalValue(ln)
+		if kind != numericValue {
+			return nil, fmt.Errorf("Unable to %v non numeric literal '%v'", a.Function, n)
+		}
+		sum += v.(float64)
+		if r := numericRank(ln); r > rank {
+			rank = r
+		}
+		if i, ok := integerValue(ln); ok && exact {
+			integer.Add(integer, i)
+		} else {
+			exact = false
+		}
+	}
+	exact = exact && rank == integerRank
+
+	if a.Function == AvgAggregate {
+		if len(nodes) == 0 {
+			return nil, nil
+		}
+		if exact {
+			sum, _ = new(big.Float).SetInt(integer).Float64()
+		}
+		if rank == integerRank {
+			rank = decimalRank
+		}
+		return numericLiteral(sum / float64(len(nodes)), rank), nil
+	}
+	if exact {
+		return NewTypedLiteral(integer.String(), NewNamedNode(xsdNamespace + "integer")), nil
+	}
+	return numericLiteral(sum, rank), nil
+}
+
+// integerValue returns the exact value of an integer literal,
+// given by its go value or its lexical form.
+func integerValue(ln LiteralNode) (*big.Int, bool) {
+	if tl, ok := ln.(TypedLiteral); ok {
+		switch v := tl.Value().(type) {
+		case int, int8, int16, int32, int64:
+			return big.NewInt(reflect.ValueOf(v).Int()), true
+		case uint, uint8, uint16, uint32, uint64:
+			return new(big.Int).SetUint64(reflect.ValueOf(v).Uint()), true
+		case float32, float64:
+			return nil, false
+		}
+	}
+	return new(big.Int).SetString(strings.TrimPrefix(strings.TrimSpace(ln.String()), "+"), 10)
+}
+
+// numeric ranks used for type promotion
+const (
+	integerRank = iota
+	decimalRank
+	floatRank
+	doubleRank
+)
+
+// numericRank determines the rank of a numeric literal for
+// type promotion.
+func numericRank(ln LiteralNode) int {
+	tl, ok := ln.(TypedLiteral)
+	if !ok {
+		return doubleRank
+	}
+	switch tl.Value().(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return integerRank
+	case float32:
+		return floatRank
+	case float64:
+		return doubleRank
+	}
+	if tl.Type() == nil {
+		return doubleRank
+	}
+	switch strings.TrimPrefix(tl.Type().Iri(), xsdNamespace) {
+	case "decimal":
+		return decimalRank
+	case "float":
+		return floatRank
+	case "double":
+		return doubleRank
+	}
+	return integerRank
+}
+
+// numericLiteral creates the typed literal of the value
+// for the rank.
+func numericLiteral(v float64, rank int) TypedLiteral {
+	switch rank {
+	case integerRank:
+		return NewTypedLiteral(int64(math.Round(v)), NewNamedNode(xsdNamespace + "integer"))
+	case decimalRank:
+		return NewTypedLiteral(v, NewNamedNode(xsdNamespace + "decimal"))
+	case floatRank:
+		return NewTypedLiteral(v, NewNamedNode(xsdNamespace + "float"))
+	}
+	return NewTypedLiteral(v, NewNamedNode(xsdNamespace + "double"))
+}
@@ -0,0 +1,114 @@
+package semtools
+
+import (
+	"math"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestQueryAggregate(t *testing.T) {
+
+	xsdInteger := NewNamedNode(xsdNamespace + "integer")
+	xsdDecimal := NewNamedNode(xsdNamespace + "decimal")
+	rdfType := NewNamedNode(rdfNamespace + "type")
+	age := NewNamedNode("age")
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("max"), rdfType, NewNamedNode("Person"), nil),
+		NewStatement(NewNamedNode("mara"), rdfType, NewNamedNode("Person"), nil),
+		NewStatement(NewNamedNode("rex"), rdfType, NewNamedNode("Dog"), nil),
+		NewStatement(NewNamedNode("max"), age, NewTypedLiteral("30", xsdInteger), nil),
+		NewStatement(NewNamedNode("mara"), age, NewTypedLiteral("25", xsdInteger), nil),
+		NewStatement(NewNamedNode("rex"), age, NewTypedLiteral("4.5", xsdDecimal), nil),
+	})
+
+	if c := kb.Select().Predicate(rdfType).Count(); c != 3 {
+		t.Errorf("Count() expected 3 but got %v", c)
+	}
+
+	res, err := kb.Select().Predicate(rdfType).GroupBy(ObjectPosition).Aggregate(Aggregate{Function: CountAggregate})
+	if err != nil || len(res) != 2 {
+		t.Fatalf("Aggregate() expected 2 groups but got %v (%v)", res, err)
+	}
+	if !res[0].Group[0].Equals(NewNamedNode("Person")) || res[0].Values[0].(TypedLiteral).Value().(int64) != 2 {
+		t.Errorf("Aggregate() fails to count instances per type: %v", res[0])
+	}
+	if !res[0].Values[0].(TypedLiteral).Type().Equals(xsdInteger) {
+		t.Errorf("Aggregate() fails to type count as xsd:integer")
+	}
+
+	res, err = kb.Select().GroupBy(PredicatePosition).OrderBy(PredicatePosition).Limit(1).Aggregate(
+		Aggregate{Function: CountAggregate},
+		Aggregate{Function: CountAggregate, Position: ObjectPosition, Distinct: true},
+	)
+	if err != nil || len(res) != 1 || !res[0].Group[0].Equals(age) {
+		t.Fatalf("Aggregate() fails to order and limit groups: %v (%v)", res, err)
+	}
+	if res[0].Values[0].(TypedLiteral).Value().(int64) != 3 || res[0].Values[1].(TypedLiteral).Value().(int64) != 3 {
+		t.Errorf("Aggregate() fails to count statements per predicate: %v", res[0])
+	}
+
+	res, err = kb.Select().Predicate(age).Aggregate(
+		Aggregate{Function: SumAggregate, Position: ObjectPosition},
+		Aggregate{Function: AvgAggregate, Position: ObjectPosition},
+		Aggregate{Function: MinAggregate, Position: ObjectPosition},
+		Aggregate{Function: MaxAggregate, Position: ObjectPosition},
+		Aggregate{Function: GroupConcatAggregate, Position: SubjectPosition, Separator: ","},
+	)
+	if err != nil || len(res) != 1 {
+		t.Fatalf("Aggregate() expected a single group but got %v (%v)", res, err)
+	}
+	sum := res[0].Values[0].(TypedLiteral)
+	if sum.Value().(float64) != 59.5 || !sum.Type().Equals(xsdDecimal) {
+		t.Errorf("Aggregate() fails to sum with type promotion: %v", sum)
+	}
+	if avg := res[0].Values[1].(TypedLiteral); avg.Value().(float64) != 59.5 / 3 {
+		t.Errorf("Aggregate() fails to average: %v", avg)
+	}
+	if res[0].Values[2].String() != "4.5" || res[0].Values[3].String() != "30" {
+		t.Errorf("Aggregate() fails to compute min/max: %v", res[0].Values)
+	}
+	if res[0].Values[4].String() != "max,mara,rex" {
+		t.Errorf("Aggregate() fails to concat group: %v", res[0].Values[4])
+	}
+
+	res, err = kb.Select().Predicate(NewNamedNode("unknown")).Aggregate(
+		Aggregate{Function: CountAggregate},
+		Aggregate{Function: AvgAggregate, Position: ObjectPosition},
+		Aggregate{Function: SumAggregate, Position: ObjectPosition},
+	)
+	if err != nil || len(res) != 1 || res[0].Values[0].(TypedLiteral).Value().(int64) != 0 || res[0].Values[1] != nil || res[0].Values[2].String() != "0" {
+		t.Errorf("Aggregate() fails to aggregate empty results: %v (%v)", res, err)
+	}
+
+	// integers are summed exactly
+	large := NewKnowledgeBase("large")
+	large.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), age, NewTypedLiteral(int64(1 << 53), xsdInteger), nil),
+		NewStatement(NewNamedNode("b"), age, NewTypedLiteral(1, xsdInteger), nil),
+		NewStatement(NewNamedNode("c"), age, NewTypedLiteral("1", xsdInteger), nil),
+	})
+	res, err = large.Select().Aggregate(Aggregate{Function: SumAggregate, Position: ObjectPosition})
+	if err != nil || res[0].Values[0].(TypedLiteral).Value() != "9007199254740994" || !res[0].Values[0].(TypedLiteral).Type().Equals(xsdInteger) {
+		t.Errorf("Aggregate() expected the exact integer sum %v but got %v (%v)", int64(1 << 53 + 2), res, err)
+	}
+	large.Insert([]Statement{NewStatement(NewNamedNode("d"), age, NewTypedLiteral(uint64(math.MaxUint64), xsdInteger), nil)})
+	res, err = large.Select().Aggregate(Aggregate{Function: SumAggregate, Position: ObjectPosition})
+	if err != nil || res[0].Values[0].(TypedLiteral).Value() != "18455751272964292609" || !res[0].Values[0].(TypedLiteral).Type().Equals(xsdInteger) {
+		t.Errorf("Aggregate() expected the exact integer sum beyond int64 but got %v (%v)", res, err)
+	}
+
+	if _, err = kb.Select().Aggregate(Aggregate{Function: SumAggregate, Position: ObjectPosition}); err == nil {
+		t.Errorf("Aggregate() fails to report non numeric sums")
+	}
+
+}
@@ -0,0 +1,585 @@
+package semtools
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+
+// BinaryFormatVersion is the version of the binary format written
+// by WriteBinary(). Readers reject data of newer versions. Version 2
+// added the kind of the go values of typed literals.
+const BinaryFormatVersion = 2
+
+// BinaryOptions are options that configure the binary format
+// written by WriteBinary().
+type BinaryOptions struct {
+
+	// Compress compresses the data with DEFLATE, which makes
+	// it smaller at the cost of writing and loading time.
+	Compress bool
+
+	// Checksums adds a CRC-32 checksum to every section of
+	// the data, which is verified while loading.
+	Checksums bool
+
+}
+
+// WriteBinary writes all statements of the knowledge base in a
+// compact binary format, which can be loaded much faster than
+// text formats. The format consists of a header with the format
+// version and sections of terms (each node is written once), of
+// quads referencing the terms by their ids and of the metadata of
+// annotated statements.
+func WriteBinary(w io.Writer, kb KnowledgeBase, opts *BinaryOptions) error {
+
+	// make sure things are initialized
+	if opts == nil {
+		opts = &BinaryOptions{}
+	}
+	var flags uint16
+	if opts.Compress {
+		flags |= binaryFlagCompressed
+	}
+	if opts.Checksums {
+		flags |= binaryFlagChecksums
+	}
+
+	buffered := bufio.NewWriter(w)
+	header := make([]byte, len(binaryMagic) + 4)
+	copy(header, binaryMagic)
+	binary.BigEndian.PutUint16(header[len(binaryMagic):], BinaryFormatVersion)
+	binary.BigEndian.PutUint16(header[len(binaryMagic) + 2:], flags)
+	if _, err := buffered.Write(header); err != nil {
+		return err
+	}
+
+	bw := &binaryWriter{
+		w: buffered,
+		checksums: opts.Checksums,
+		terms: NewTermDictionary(),
+	}
+	var compressor *flate.Writer
+	if opts.Compress {
+		compressor, _ = flate.NewWriter(buffered, flate.DefaultCompression)
+		bw.w = compressor
+	}
+
+	meta := appendUvarint(nil, kb.Sequence())
+	if err := bw.section(binarySectionMeta, meta); err != nil {
+		return err
+	}
+
+	// the statements are written in chunks, each one preceded
+	// by the terms first used in it
+	it := kb.Iterate()
+	defer it.Close()
+	chunk := []Statement{}
+	for it.Next() {
+		chunk = append(chunk, it.Statement())
+		if len(chunk) == binaryChunkSize {
+			if err := bw.statements(chunk); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	if err := bw.statements(chunk); err != nil {
+		return err
+	}
+	if err := bw.section(binarySectionEnd, nil); err != nil {
+		return err
+	}
+
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+
+}
+
+// ReadBinary loads the statements written by WriteBinary() into
+// the knowledge base and returns the sequence number the written
+// knowledge base had. All data is verified before the statements
+// are inserted in a single change, so nothing is inserted if the
+// data is invalid, incomplete or of a newer version.
+func ReadBinary(r io.Reader, kb KnowledgeBase) (uint64, error) {
+
+	buffered := bufio.NewReader(r)
+	header := make([]byte, len(binaryMagic) + 4)
+	if _, err := io.ReadFull(buffered, header); err != nil {
+		return 0, fmt.Errorf("Unable to read binary header: %v", err)
+	}
+	if string(header[:len(binaryMagic)]) != binaryMagic {
+		return 0, fmt.Errorf("Unable to read binary data, missing header")
+	}
+	version := binary.BigEndian.Uint16(header[len(binaryMagic):])
+	if version > BinaryFormatVersion {
+		return 0, fmt.Errorf("Unable to read binary format version '%v', supported up to '%v'", version, BinaryFormatVersion)
+	}
+	flags := binary.BigEndian.Uint16(header[len(binaryMagic) + 2:])
+	if flags &^ (binaryFlagCompressed | binaryFlagChecksums) != 0 {
+		return 0, fmt.Errorf("Unable to read binary data with unknown flags '%b'", flags)
+	}
+
+	br := &binaryReader{
+		r: buffered,
+		version: version,
+		checksums: flags & binaryFlagChecksums != 0,
+		nodes: []Node{},
+		stmts: []Statement{},
+	}
+	if flags & binaryFlagCompressed != 0 {
+		decompressor := flate.NewReader(buffered)
+		defer decompressor.Close()
+		br.r = bufio.NewReader(decompressor)
+	}
+	// share the nodes with the dictionary of the knowledge base
+	if d, ok := kb.(interface{ dictionary() TermDictionary }); ok {
+		br.terms = d.dictionary()
+	}
+
+	var sequence uint64
+	for {
+		kind, payload, err := br.section()
+		if err != nil {
+			return 0, err
+		}
+		switch kind {
+		case binarySectionEnd:
+			kb.Insert(br.stmts)
+			return sequence, nil
+		case binarySectionMeta:
+			sequence, err = binary.ReadUvarint(bytes.NewReader(payload))
+		case binarySectionTerms:
+			err = br.readTerms(bytes.NewReader(payload))
+		case binarySectionQuads:
+			err = br.readQuads(bytes.NewReader(payload))
+		case binarySectionMetadata:
+			err = br.readMetadata(bytes.NewReader(payload))
+		default:
+			// newer writers may add optional sections
+			if kind & binarySectionOptional == 0 {
+				err = fmt.Errorf("Unable to read binary section '%v', it requires a newer version", kind)
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+}
+
+// WriteBinaryFile writes the knowledge base in the binary format
+// to a new file, which atomically replaces the file at the path.
+func WriteBinaryFile(path string, kb KnowledgeBase, opts *BinaryOptions) error {
+	tmp, err := os.OpenFile(path + ".tmp", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	err = WriteBinary(tmp, kb, opts)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// ReadBinaryFile loads the file written by WriteBinaryFile() into
+// the knowledge base, see ReadBinary().
+func ReadBinaryFile(path string, kb KnowledgeBase) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return ReadBinary(file, kb)
+}
+
+
+
+// binaryMagic starts all data of the binary format.
+const binaryMagic = "SEMTOOLS"
+
+// Flags of the binary header.
+const (
+	binaryFlagCompressed uint16 = 1 << iota
+	binaryFlagChecksums
+)
+
+// Kinds of sections, readers skip unknown sections with the
+// optional bit set and reject any other unknown section.
+const (
+	binarySectionEnd byte = iota
+	binarySectionMeta
+	binarySectionTerms
+	binarySectionQuads
+	binarySectionOptional byte = 0x80
+	binarySectionMetadata byte = binarySectionOptional | 1
+)
+
+// Kinds of terms within a terms section.
+const (
+	binaryTermIri byte = iota + 1
+	binaryTermLiteral
+	binaryTermTypedLiteral
+	binaryTermTriple
+)
+
+// binaryChunkSize is the number of statements written per
+// quads section.
+const binaryChunkSize = 65536
+
+var binaryChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+type binaryWriter struct {
+	w io.Writer
+	checksums bool
+	// terms assigns the ids of the written terms, of which
+	// the first written are already known to the reader
+	terms TermDictionary
+	written int
+}
+
+// section writes the kind, length, payload and checksum of
+// a section.
+func (bw *binaryWriter) section(kind byte, payload []byte) error {
+	header := append([]byte{kind}, appendUvarint(nil, uint64(len(payload)))...)
+	if _, err := bw.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := bw.w.Write(payload); err != nil {
+		return err
+	}
+	if bw.checksums {
+		checksum := make([]byte, 4)
+		binary.BigEndian.PutUint32(checksum, crc32.Checksum(payload, binaryChecksumTable))
+		_, err := bw.w.Write(checksum)
+		return err
+	}
+	return nil
+}
+
+// statements writes the terms not yet written followed by the
+// quads of the statements.
+func (bw *binaryWriter) statements(stmts []Statement) error {
+	if len(stmts) == 0 {
+		return nil
+	}
+	quads := appendUvarint(nil, uint64(len(stmts)))
+	for _, stmt := range stmts {
+		for _, p := range []Position{SubjectPosition, PredicatePosition, ObjectPosition, GraphPosition} {
+			if _, ok := p.Of(stmt).(Parameter); ok {
+				return fmt.Errorf("Unable to encode Node '%v'", p.Of(stmt))
+			}
+			quads = appendUvarint(quads, uint64(bw.terms.Encode(p.Of(stmt))))
+		}
+	}
+
+	// metadata refers to the statements by their index
+	// within the chunk
+	entries := 0
+	metadata := []byte{}
+	for idx, stmt := range stmts {
+		m := MetadataOf(stmt)
+		if m == nil {
+			continue
+		}
+		entries++
+		metadata = appendUvarint(metadata, uint64(idx))
+		metadata = appendUvarint(metadata, uint64(len(m)))
+		for _, k := range m.Keys() {
+			metadata = appendUvarint(metadata, uint64(bw.terms.Encode(NewNamedNode(k))))
+			metadata = appendUvarint(metadata, uint64(bw.terms.Encode(m[k])))
+		}
+	}
+
+	terms := appendUvarint(nil, uint64(bw.terms.Len() - bw.written))
+	for id := bw.written + 1; id <= bw.terms.Len(); id++ {
+		switch v := bw.terms.Decode(TermID(id)).(type) {
+		case QuotedTriple:
+			// the nodes of a quoted triple are encoded before
+			// the triple
+			terms = append(terms, binaryTermTriple)
+			for _, n := range []Node{v.Subject(), v.Predicate(), v.Object()} {
+				nodeID, _ := bw.terms.ID(n)
+				terms = appendUvarint(terms, uint64(nodeID))
+			}
+		case NamedNode:
+			terms = append(terms, binaryTermIri)
+			terms = appendBinaryString(terms, v.Iri())
+		case LocalizedLiteral:
+			terms = append(terms, binaryTermLiteral)
+			terms = appendBinaryString(terms, v.Language())
+			terms = appendBinaryString(terms, v.String())
+		case TypedLiteral:
+			// types are encoded before the literals using them
+			typeID, _ := bw.terms.ID(nodeOrNil(v.Type()))
+			kind, lexical := literalValueKind(v.Value())
+			terms = append(terms, binaryTermTypedLiteral)
+			terms = appendUvarint(terms, uint64(typeID))
+			terms = appendBinaryString(terms, kind)
+			terms = appendBinaryString(terms, lexical)
+		default:
+			return fmt.Errorf("Unable to encode Node '%v'", v)
+		}
+	}
+	bw.written = bw.terms.Len()
+
+	if err := bw.section(binarySectionTerms, terms); err != nil {
+		return err
+	}
+	if err := bw.section(binarySectionQuads, quads); err != nil {
+		return err
+	}
+	if entries == 0 {
+		return nil
+	}
+	return bw.section(binarySectionMetadata, append(appendUvarint(nil, uint64(entries)), metadata...))
+}
+
+// appendUvarint appends the varint encoded number.
+func appendUvarint(buf []byte, x uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	return append(buf, tmp[:binary.PutUvarint(tmp, x)]...)
+}
+
+// appendBinaryString appends the length prefixed string.
+func appendBinaryString(buf []byte, str string) []byte {
+	return append(appendUvarint(buf, uint64(len(str))), str...)
+}
+
+
+
+type binaryReader struct {
+	r *bufio.Reader
+	version uint16
+	checksums bool
+	// terms is the optional dictionary the nodes are interned
+	// with, nodes holds the node of id n at index n-1
+	terms TermDictionary
+	nodes []Node
+	// chunk is the index of the first statement of the
+	// last quads section
+	stmts []Statement
+	chunk int
+}
+
+// section reads the next section and verifies its checksum.
+func (br *binaryReader) section() (byte, []byte, error) {
+	kind, err := br.r.ReadByte()
+	if err != nil {
+		return 0, nil, br.unexpected(err)
+	}
+	length, err := binary.ReadUvarint(br.r)
+	if err != nil {
+		return 0, nil, br.unexpected(err)
+	}
+	// copy instead of allocating the length at once, which
+	// might be garbage
+	payload := &bytes.Buffer{}
+	if _, err := io.CopyN(payload, br.r, int64(length)); err != nil {
+		return 0, nil, br.unexpected(err)
+	}
+	if br.checksums {
+		checksum := make([]byte, 4)
+		if _, err := io.ReadFull(br.r, checksum); err != nil {
+			return 0, nil, br.unexpected(err)
+		}
+		if binary.BigEndian.Uint32(checksum) != crc32.Checksum(payload.Bytes(), binaryChecksumTable) {
+			return 0, nil, fmt.Errorf("Unable to read binary section '%v', checksum mismatch", kind)
+		}
+	}
+	return kind, payload.Bytes(), nil
+}
+
+func (br *binaryReader) unexpected(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("Unable to read binary data, it is incomplete")
+	}
+	return err
+}
+
+// readTerms decodes the nodes of a terms section.
+func (br *binaryReader) readTerms(r *bytes.Reader) error {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return br.invalid(err)
+	}
+	for idx := uint64(0); idx < count; idx++ {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return br.invalid(err)
+		}
+		var node Node
+		switch kind {
+		case binaryTermIri:
+			var iri string
+			if iri, err = readBinaryString(r); err == nil {
+				node = NewNamedNode(iri)
+			}
+		case binaryTermLiteral:
+			var language, value string
+			if language, err = readBinaryString(r); err == nil {
+				if value, err = readBinaryString(r); err == nil {
+					node = NewLocalizedLiteral(value, language)
+				}
+			}
+		case binaryTermTypedLiteral:
+			// version 1 has no kinds, all values are strings
+			var typeID uint64
+			var kind, lexical string
+			if typeID, err = binary.ReadUvarint(r); err == nil && br.version >= 2 {
+				kind, err = readBinaryString(r)
+			}
+			if err == nil {
+				if lexical, err = readBinaryString(r); err == nil {
+					typeNode, ok := br.node(typeID).(NamedNode)
+					if !ok && typeID != 0 {
+						return fmt.Errorf("Unable to decode Node with type '%v'", typeID)
+					}
+					value, err := parseLiteralValue(kind, lexical)
+					if err != nil {
+						return err
+					}
+					node = NewTypedLiteral(value, typeNode)
+				}
+			}
+		case binaryTermTriple:
+			ids := make([]uint64, 3)
+			for p := 0; p < len(ids) && err == nil; p++ {
+				ids[p], err = binary.ReadUvarint(r)
+			}
+			if err == nil {
+				subject, sok := br.node(ids[0]).(NamedNode)
+				predicate, pok := br.node(ids[1]).(NamedNode)
+				if !sok || !pok || br.node(ids[2]) == nil {
+					return fmt.Errorf("Unable to decode quoted triple of terms '%v'", ids)
+				}
+				node = NewQuotedTriple(subject, predicate, br.node(ids[2]))
+			}
+		default:
+			return fmt.Errorf("Unable to decode Node of kind '%v'", kind)
+		}
+		if err != nil {
+			return br.invalid(err)
+		}
+		if br.terms != nil {
+			node = br.terms.Intern(node)
+		}
+		br.nodes = append(br.nodes, node)
+	}
+	return nil
+}
+
+// readQuads decodes the statements of a quads section.
+func (br *binaryReader) readQuads(r *bytes.Reader) error {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return br.invalid(err)
+	}
+	br.chunk = len(br.stmts)
+	ids := make([]uint64, 4)
+	for idx := uint64(0); idx < count; idx++ {
+		for p := range ids {
+			if ids[p], err = binary.ReadUvarint(r); err != nil {
+				return br.invalid(err)
+			}
+		}
+		subject, sok := br.node(ids[0]).(NamedNode)
+		predicate, pok := br.node(ids[1]).(NamedNode)
+		object := br.node(ids[2])
+		graph, gok := br.node(ids[3]).(NamedNode)
+		if !sok || !pok || object == nil || !gok && ids[3] != 0 {
+			return fmt.Errorf("Unable to decode Statement of terms '%v'", ids)
+		}
+		br.stmts = append(br.stmts, NewStatement(subject, predicate, object, graph))
+	}
+	return nil
+}
+
+// readMetadata decodes the metadata of the statements of the
+// last quads section.
+func (br *binaryReader) readMetadata(r *bytes.Reader) error {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return br.invalid(err)
+	}
+	for idx := uint64(0); idx < count; idx++ {
+		var index, pairs uint64
+		if index, err = binary.ReadUvarint(r); err == nil {
+			pairs, err = binary.ReadUvarint(r)
+		}
+		if err != nil {
+			return br.invalid(err)
+		}
+		if uint64(br.chunk) + index >= uint64(len(br.stmts)) {
+			return fmt.Errorf("Unable to decode metadata of unknown Statement '%v'", index)
+		}
+		metadata := Metadata{}
+		for p := uint64(0); p < pairs; p++ {
+			var key, value uint64
+			if key, err = binary.ReadUvarint(r); err == nil {
+				value, err = binary.ReadUvarint(r)
+			}
+			if err != nil {
+				return br.invalid(err)
+			}
+			predicate, ok := br.node(key).(NamedNode)
+			if !ok || br.node(value) == nil {
+				return fmt.Errorf("Unable to decode metadata of terms '%v' and '%v'", key, value)
+			}
+			metadata[predicate.Iri()] = br.node(value)
+		}
+		pos := br.chunk + int(index)
+		br.stmts[pos] = withMetadata(br.stmts[pos], metadata)
+	}
+	return nil
+}
+
+// node returns the node of the id or nil if it is unknown.
+func (br *binaryReader) node(id uint64) Node {
+	if id == 0 || id > uint64(len(br.nodes)) {
+		return nil
+	}
+	return br.nodes[id - 1]
+}
+
+func (br *binaryReader) invalid(err error) error {
+	return fmt.Errorf("Unable to read binary data, invalid section: %v", err)
+}
+
+// readBinaryString reads a length prefixed string.
+func readBinaryString(r *bytes.Reader) (string, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if length > uint64(r.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, length)
+	_, err = io.ReadFull(r, buf)
+	return string(buf), err
+}
@@ -0,0 +1,176 @@
+package semtools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestBinary(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	integer := NewNamedNode(xsdNamespace + "integer")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("1", integer), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("plain", nil), NewNamedNode("g")),
+		NewStatement(NewNamedNode("a"), NewNamedNode("q"), NewLocalizedLiteral("Hallo \"Welt\"", "de"), NewNamedNode("g")),
+		NewStatement(NewNamedNode("b"), NewNamedNode("q"), NewNamedNode("a"), NewNamedNode("g")),
+	})
+	kb.Delete([]Statement{NewStatement(NewNamedNode("b"), NewNamedNode("q"), NewNamedNode("a"), nil)})
+
+	for _, opts := range []*BinaryOptions{nil, {Compress: true}, {Checksums: true}, {Compress: true, Checksums: true}} {
+		buf := &bytes.Buffer{}
+		if err := WriteBinary(buf, kb, opts); err != nil {
+			t.Fatalf("WriteBinary() failed: %v", err)
+		}
+		loaded := NewKnowledgeBase("loaded")
+		sequence, err := ReadBinary(buf, loaded)
+		if err != nil {
+			t.Fatalf("ReadBinary() failed: %v", err)
+		}
+		if sequence != 2 || fmt.Sprint(sortedStatementKeys(loaded.Statements())) != fmt.Sprint(sortedStatementKeys(kb.Statements())) {
+			t.Errorf("ReadBinary() expected the statements at 2 but got %v at %v", loaded.Statements(), sequence)
+		}
+		if stmts := loaded.Statements(); stmts[0].Subject() != stmts[2].Subject() || loaded.Sequence() != 1 {
+			t.Errorf("ReadBinary() expected interned nodes inserted in one change")
+		}
+	}
+
+}
+
+
+func TestBinaryCompatibility(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewLocalizedLiteral("A", "en"), nil)})
+	buf := &bytes.Buffer{}
+	if err := WriteBinary(buf, kb, &BinaryOptions{Checksums: true}); err != nil {
+		t.Fatalf("WriteBinary() failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	// the end section is followed by its checksum
+	withSection := func(section ...byte) []byte {
+		res := append([]byte{}, data[:len(data) - 6]...)
+		res = append(res, section...)
+		return append(res, data[len(data) - 6:]...)
+	}
+	// sections with the single byte 0xff and its checksum
+	optional := []byte{0x8f, 0x01, 0xff, 0x00, 0x00, 0x00, 0x00}
+	binary.BigEndian.PutUint32(optional[3:], crc32.Checksum([]byte{0xff}, binaryChecksumTable))
+	required := append([]byte{0x04}, optional[1:]...)
+
+	cases := map[string][]byte{
+		"newer version": append(append(append([]byte{}, data[:8]...), 0x00, 0x03), data[10:]...),
+		"version 1": append(append(append([]byte{}, data[:8]...), 0x00, 0x01), data[10:]...),
+		"unknown flag": append(append(append([]byte{}, data[:10]...), 0x00, 0x04), data[12:]...),
+		"missing header": []byte("<a> <p> <b> ."),
+		"truncated": data[:len(data) - 8],
+		"corrupted": append(append(append([]byte{}, data[:len(data) - 10]...), data[len(data) - 10] ^ 0x01), data[len(data) - 9:]...),
+		"required section": withSection(required...),
+		"optional section": withSection(optional...),
+	}
+	for name, encoded := range cases {
+		loaded := NewKnowledgeBase("loaded")
+		_, err := ReadBinary(bytes.NewReader(encoded), loaded)
+		if name == "optional section" || name == "version 1" {
+			if err != nil || len(loaded.Statements()) != 1 {
+				t.Errorf("%v: ReadBinary() expected to skip the section but got %v (%v)", name, loaded.Statements(), err)
+			}
+		} else if err == nil || len(loaded.Statements()) != 0 {
+			t.Errorf("%v: ReadBinary() expected to fail without inserting but got %v", name, loaded.Statements())
+		}
+	}
+
+}
+
+
+func TestBinaryTypedLiterals(t *testing.T) {
+
+	integer := NewNamedNode(xsdNamespace + "integer")
+	boolean := NewNamedNode(xsdNamespace + "boolean")
+	kb := NewKnowledgeBase("kb")
+	stmts := []Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("age"), NewTypedLiteral(30, integer), nil),
+		NewStatement(NewNamedNode("b"), NewNamedNode("age"), NewTypedLiteral("30", integer), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("active"), NewTypedLiteral(true, boolean), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("ratio"), NewTypedLiteral(0.5, NewNamedNode(xsdNamespace + "double")), nil),
+	}
+	kb.Insert(stmts)
+	buf := &bytes.Buffer{}
+	if err := WriteBinary(buf, kb, nil); err != nil {
+		t.Fatalf("WriteBinary() failed: %v", err)
+	}
+
+	loaded := NewKnowledgeBase("loaded")
+	if _, err := ReadBinary(buf, loaded); err != nil {
+		t.Fatalf("ReadBinary() failed: %v", err)
+	}
+	loaded.Insert(stmts)
+	if len(loaded.Statements()) != 4 || loaded.Sequence() != 1 {
+		t.Errorf("Insert() expected the loaded literals to be equal but got %v at %v", loaded.Statements(), loaded.Sequence())
+	}
+	loaded.Delete(stmts[:1])
+	if res := loaded.Select().Predicate(NewNamedNode("age")).Results(); len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("b")) {
+		t.Errorf("Delete() expected to remove the integer literal only but got %v", res)
+	}
+
+	// version 1 has no kinds and reads the values as strings
+	br := &binaryReader{version: 1, nodes: []Node{integer}}
+	terms := appendUvarint(nil, 1)
+	terms = append(terms, binaryTermTypedLiteral)
+	terms = appendUvarint(terms, 1)
+	terms = appendBinaryString(terms, "30")
+	if err := br.readTerms(bytes.NewReader(terms)); err != nil || !br.nodes[1].Equals(NewTypedLiteral("30", integer)) {
+		t.Errorf("readTerms() expected the string literal of version 1 but got %v (%v)", br.nodes, err)
+	}
+
+}
+
+
+func TestBinaryFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kb.bin")
+
+	// more statements than fit into a chunk
+	kb := NewKnowledgeBase("kb")
+	stmts := []Statement{}
+	for idx := 0; idx < binaryChunkSize + 100; idx++ {
+		stmts = append(stmts, NewStatement(NewNamedNode(fmt.Sprintf("s%v", idx % 1000)), NewNamedNode(fmt.Sprintf("p%v", idx / 1000)), NewTypedLiteral(fmt.Sprintf("%v", idx), NewNamedNode(xsdNamespace + "integer")), nil))
+	}
+	kb.Insert(stmts)
+	if err := WriteBinaryFile(path, kb, &BinaryOptions{Compress: true, Checksums: true}); err != nil {
+		t.Fatalf("WriteBinaryFile() failed: %v", err)
+	}
+
+	loaded := NewKnowledgeBase("loaded")
+	if _, err := ReadBinaryFile(path, loaded); err != nil {
+		t.Fatalf("ReadBinaryFile() failed: %v", err)
+	}
+	if res := loaded.Select().Subject(NewNamedNode("s42")).Results(); len(loaded.Statements()) != len(stmts) || len(res) != 66 {
+		t.Errorf("ReadBinaryFile() expected %v statements but got %v (%v)", len(stmts), len(loaded.Statements()), len(res))
+	}
+	if _, err := ReadBinaryFile(filepath.Join(dir, "missing.bin"), loaded); err == nil {
+		t.Errorf("ReadBinaryFile() expected to fail for a missing file")
+	}
+
+}
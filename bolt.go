@@ -0,0 +1,821 @@
+package semtools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+
+// boltIteratorChunk is the number of statements iterators read
+// within a single transaction, so long iterations don't block the
+// database from growing.
+const boltIteratorChunk = 1024
+
+// boltTermCacheSize is the number of decoded terms cached by a
+// knowledge base stored in bbolt.
+const boltTermCacheSize = 65536
+
+// Buckets and keys of a knowledge base stored in bbolt. Terms are
+// numbered starting at 1, 0 stands for nil nodes.
+var (
+	// boltMetaBucket holds the sequence and the size.
+	boltMetaBucket = []byte("meta")
+	boltSequenceKey = []byte("sequence")
+	boltSizeKey = []byte("size")
+
+	// boltTermsBucket maps ids to the JSON of their terms.
+	boltTermsBucket = []byte("terms")
+
+	// boltIdsBucket maps formatted terms to their ids.
+	boltIdsBucket = []byte("ids")
+
+	// boltCountsBucket maps positions and ids to the number
+	// of statements with the term at the position.
+	boltCountsBucket = []byte("counts")
+
+	// boltMetadataBucket maps the SPOG keys of annotated
+	// statements to the JSON of their metadata.
+	boltMetadataBucket = []byte("metadata")
+)
+
+// boltIndex is a key layout of the statements, the ids of the
+// nodes at its positions concatenated.
+type boltIndex struct {
+	bucket []byte
+	positions [4]Position
+}
+
+// boltIndexes are the layouts of the statements by the position
+// they are looked up by.
+var boltIndexes = map[Position]*boltIndex{
+	SubjectPosition: {[]byte("spog"), [4]Position{SubjectPosition, PredicatePosition, ObjectPosition, GraphPosition}},
+	PredicatePosition: {[]byte("posg"), [4]Position{PredicatePosition, ObjectPosition, SubjectPosition, GraphPosition}},
+	ObjectPosition: {[]byte("ospg"), [4]Position{ObjectPosition, SubjectPosition, PredicatePosition, GraphPosition}},
+	GraphPosition: {[]byte("gspo"), [4]Position{GraphPosition, SubjectPosition, PredicatePosition, ObjectPosition}},
+}
+
+// BoltKnowledgeBaseOptions are options that configure a knowledge
+// base stored in bbolt.
+type BoltKnowledgeBaseOptions struct {
+
+	// KnowledgeBaseOptions configure the knowledge base, ChangeLog
+	// and FullTextIndex are not supported.
+	KnowledgeBaseOptions
+
+	// Sync is the policy for flushing modifications to stable
+	// storage. Defaults to SyncAlways.
+	Sync SyncPolicy
+
+	// SyncInterval is the interval of SyncInterval. Defaults
+	// to one second.
+	SyncInterval time.Duration
+
+	// Timeout is the time to wait for the lock of a database
+	// file that is opened by another process. Defaults to
+	// waiting indefinitely.
+	Timeout time.Duration
+
+}
+
+// NewBoltKnowledgeBase opens or creates the knowledge base stored
+// in the bbolt database file, for graphs that don't fit in memory.
+// Terms are numbered in a dictionary and statements are kept in
+// SPOG, POSG, OSPG and GSPO key layouts, so queries use prefix scans
+// for lookups. Iterators read the statements in chunks and might
+// observe modifications made during the iteration.
+func NewBoltKnowledgeBase(name string, path string, opts *BoltKnowledgeBaseOptions) (PersistentKnowledgeBase, error) {
+
+	// make sure things are initialized
+	if name == "" {
+		name = "kb"
+	}
+	if opts == nil {
+		opts = &BoltKnowledgeBaseOptions{}
+	}
+	if opts.ChangeLog != nil || opts.FullTextIndex {
+		return nil, fmt.Errorf("Bolt knowledge bases don't support a ChangeLog or FullTextIndex")
+	}
+	policy := opts.Sync
+	if policy == "" {
+		policy = SyncAlways
+	}
+	if policy != SyncAlways && policy != SyncInterval && policy != SyncNever {
+		return nil, fmt.Errorf("Unknown sync policy '%v'", policy)
+	}
+	syncInterval := opts.SyncInterval
+	if syncInterval <= 0 || policy != SyncInterval {
+		syncInterval = defaultSyncInterval
+	}
+	defaultGraph := opts.DefaultGraph
+	if defaultGraph == nil {
+		defaultGraph = NewNamedNode("default-graph")
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: opts.Timeout})
+	if err != nil {
+		return nil, err
+	}
+	db.NoSync = policy != SyncAlways
+	err = db.Update(func(tx *bolt.Tx) error {
+		buckets := [][]byte{boltMetaBucket, boltTermsBucket, boltIdsBucket, boltCountsBucket, boltMetadataBucket}
+		for _, index := range boltIndexes {
+			buckets = append(buckets, index.bucket)
+		}
+		for _, b := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	kb := &boltKnowledgeBase{
+		name: name,
+		db: db,
+		defaultGraph: defaultGraph,
+		unionDefaultGraph: opts.UnionDefaultGraph,
+		prepared: newPreparedQueryCache(preparedQueryCacheSize),
+		terms: map[uint64]Node{},
+		done: make(chan struct{}),
+	}
+	if policy == SyncInterval {
+		kb.wg.Add(1)
+		go kb.run(syncInterval)
+	}
+	return kb, nil
+
+}
+
+
+
+type boltKnowledgeBase struct {
+	// mutex serializes modifications so their changes are
+	// delivered in order, reads use transactions of the db
+	mutex sync.Mutex
+	name string
+	db *bolt.DB
+	defaultGraph NamedNode
+	unionDefaultGraph bool
+	prepared *preparedQueryCache
+	observers observers
+	// termsMutex guards the cache of decoded terms, ids
+	// are never reused so cached terms don't get stale
+	termsMutex sync.RWMutex
+	terms map[uint64]Node
+	errs firstError
+	done chan struct{}
+	wg sync.WaitGroup
+	once sync.Once
+}
+
+func (kb *boltKnowledgeBase) Name() string {
+	return kb.name
+}
+
+func (kb *boltKnowledgeBase) Statements() []Statement {
+	return kb.collect(kb.Iterate())
+}
+
+func (kb *boltKnowledgeBase) Iterate() StatementIterator {
+	return kb.scan(boltIndexes[SubjectPosition], []byte{})
+}
+
+func (kb *boltKnowledgeBase) Insert(stmts []Statement) {
+	kb.mutex.Lock()
+	change := Change{}
+	err := kb.db.Update(func(tx *bolt.Tx) error {
+		change.Added = []Statement{}
+		spog := boltIndexes[SubjectPosition]
+		for _, stmt := range stmts {
+
+			// make copy of statement and
+			// ensure graph is set
+			graph := stmt.Graph()
+			if graph == nil {
+				graph = kb.defaultGraph
+			}
+			s := NewStatement(stmt.Subject(), stmt.Predicate(), stmt.Object(), graph)
+
+			// insert only if not already existing
+			var ids [4]uint64
+			for _, p := range spog.positions {
+				var err error
+				if ids[p], _, err = boltTermID(tx, p.Of(s), true); err != nil {
+					return err
+				}
+			}
+			if boltHas(tx.Bucket(spog.bucket), spog.key(ids)) {
+				continue
+			}
+			if err := boltWrite(tx, ids, 1); err != nil {
+				return err
+			}
+			if err := boltPutMetadata(tx, ids, MetadataOf(stmt)); err != nil {
+				return err
+			}
+
+			// report the statement as stored
+			added, err := kb.statement(tx, ids)
+			if err != nil {
+				return err
+			}
+			change.Added = append(change.Added, added)
+
+		}
+		return boltSequence(tx, &change)
+	})
+	kb.commit(change, err)
+}
+
+func (kb *boltKnowledgeBase) Delete(stmts []Statement) {
+	kb.mutex.Lock()
+	change := Change{}
+	err := kb.db.Update(func(tx *bolt.Tx) error {
+		change.Removed = []Statement{}
+		spog := boltIndexes[SubjectPosition]
+		for _, stmt := range stmts {
+
+			// match the statements of any graph
+			// unless the graph is set
+			positions := spog.positions[:3]
+			if stmt.Graph() != nil {
+				positions = spog.positions[:]
+			}
+			var ids [4]uint64
+			known := true
+			for _, p := range positions {
+				var err error
+				var ok bool
+				if ids[p], ok, err = boltTermID(tx, p.Of(stmt), false); err != nil {
+					return err
+				}
+				known = known && ok
+			}
+			if !known {
+				continue
+			}
+
+			// collect matches before removing them as the
+			// cursor can't be used while modifying
+			prefix := spog.key(ids)[:len(positions) * 8]
+			matches := [][4]uint64{}
+			c := tx.Bucket(spog.bucket).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				matches = append(matches, spog.ids(k))
+			}
+			for _, m := range matches {
+				s, err := kb.statement(tx, m)
+				if err != nil {
+					return err
+				}
+				if err := boltWrite(tx, m, -1); err != nil {
+					return err
+				}
+				change.Removed = append(change.Removed, s)
+			}
+
+		}
+		return boltSequence(tx, &change)
+	})
+	kb.commit(change, err)
+}
+
+// commit queues the change for the observers and releases the
+// mutex before delivering it, so changes are delivered in order
+// without holding the mutex.
+func (kb *boltKnowledgeBase) commit(change Change, err error) {
+	if err != nil {
+		kb.mutex.Unlock()
+		kb.fail(err)
+		return
+	}
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		kb.mutex.Unlock()
+		return
+	}
+
+	kb.observers.enqueue(change)
+	kb.mutex.Unlock()
+	kb.observers.deliver()
+}
+
+func (kb *boltKnowledgeBase) Listen(listener ChangeListener) func() {
+	return kb.observers.listen(listener)
+}
+
+func (kb *boltKnowledgeBase) Sequence() uint64 {
+	var sequence uint64
+	kb.view(func(tx *bolt.Tx) error {
+		sequence = boltUint64(tx.Bucket(boltMetaBucket).Get(boltSequenceKey))
+		return nil
+	})
+	return sequence
+}
+
+func (kb *boltKnowledgeBase) Subscribe(q Query, opts *SubscriptionOptions) (Subscription, error) {
+	s, err := newSubscription(q, kb, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// register and collect the initial results atomically,
+	// using the index for the candidates
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	candidates, err := CollectStatements(newPlan(s.expr, kb, 0).candidates(kb.Iterate))
+	if err != nil {
+		return nil, err
+	}
+	s.results = s.filter(candidates)
+	kb.observers.subscribe(s, kb.Sequence())
+	return s, nil
+}
+
+func (kb *boltKnowledgeBase) Select() Query {
+	return NewQuery().Bind(kb)
+}
+
+func (kb *boltKnowledgeBase) Prepare(q Query) (PreparedQuery, error) {
+	r, ok := q.(*query)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported query implementation %T", q)
+	}
+	return kb.prepared.prepare(r.root(), kb)
+}
+
+func (kb *boltKnowledgeBase) Cardinality(position Position, node Node) int {
+	var count uint64
+	kb.view(func(tx *bolt.Tx) error {
+		id, ok, err := boltTermID(tx, node, false)
+		if ok {
+			count = boltUint64(tx.Bucket(boltCountsBucket).Get(boltCountKey(position, id)))
+		}
+		return err
+	})
+	return int(count)
+}
+
+func (kb *boltKnowledgeBase) Lookup(position Position, node Node) []Statement {
+	return kb.collect(kb.IterateLookup(position, node))
+}
+
+func (kb *boltKnowledgeBase) IterateLookup(position Position, node Node) StatementIterator {
+	var prefix []byte
+	err := kb.db.View(func(tx *bolt.Tx) error {
+		id, ok, err := boltTermID(tx, node, false)
+		if ok {
+			prefix = boltKey(id)
+		}
+		return err
+	})
+	if err != nil {
+		return &errorIterator{err: err}
+	}
+	if prefix == nil {
+		return NewSliceIterator([]Statement{})
+	}
+	return kb.scan(boltIndexes[position], prefix)
+}
+
+func (kb *boltKnowledgeBase) Size() int {
+	var size uint64
+	kb.view(func(tx *bolt.Tx) error {
+		size = boltUint64(tx.Bucket(boltMetaBucket).Get(boltSizeKey))
+		return nil
+	})
+	return int(size)
+}
+
+func (kb *boltKnowledgeBase) DefaultGraph() NamedNode {
+	return kb.defaultGraph
+}
+
+func (kb *boltKnowledgeBase) UnionDefaultGraph() bool {
+	return kb.unionDefaultGraph
+}
+
+func (kb *boltKnowledgeBase) Graphs() []NamedNode {
+	graphs := []NamedNode{}
+	kb.view(func(tx *bolt.Tx) error {
+		// skip to the next graph after the first key of a graph
+		c := tx.Bucket(boltIndexes[GraphPosition].bucket).Cursor()
+		for k, _ := c.First(); k != nil; {
+			id := binary.BigEndian.Uint64(k)
+			node, err := kb.term(tx, id)
+			if err != nil {
+				return err
+			}
+			if graph, ok := node.(NamedNode); ok {
+				graphs = append(graphs, graph)
+			}
+			k, _ = c.Seek(boltKey(id + 1))
+		}
+		return nil
+	})
+	return graphs
+}
+
+func (kb *boltKnowledgeBase) Graph(graph NamedNode) KnowledgeBase {
+	return &graphView{
+		base: kb,
+		graph: graphOrDefault(kb, graph),
+	}
+}
+
+func (kb *boltKnowledgeBase) DropGraph(graph NamedNode) {
+	graph = graphOrDefault(kb, graph)
+	kb.Delete(kb.Lookup(GraphPosition, graph))
+}
+
+func (kb *boltKnowledgeBase) CopyGraph(source NamedNode, target NamedNode) {
+	source, target = graphOrDefault(kb, source), graphOrDefault(kb, target)
+	if source.Equals(target) {
+		return
+	}
+	kb.DropGraph(target)
+	kb.AddGraph(source, target)
+}
+
+func (kb *boltKnowledgeBase) MoveGraph(source NamedNode, target NamedNode) {
+	source, target = graphOrDefault(kb, source), graphOrDefault(kb, target)
+	if source.Equals(target) {
+		return
+	}
+	kb.CopyGraph(source, target)
+	kb.DropGraph(source)
+}
+
+func (kb *boltKnowledgeBase) AddGraph(source NamedNode, target NamedNode) {
+	source, target = graphOrDefault(kb, source), graphOrDefault(kb, target)
+	kb.Insert(withGraph(kb.Lookup(GraphPosition, source), target))
+}
+
+func (kb *boltKnowledgeBase) Err() error {
+	return kb.errs.get()
+}
+
+func (kb *boltKnowledgeBase) Close() error {
+	var err error
+	kb.once.Do(func() {
+		close(kb.done)
+		kb.wg.Wait()
+		if kb.db.NoSync {
+			err = kb.db.Sync()
+		}
+		if cerr := kb.db.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// run flushes the modifications every interval until the
+// knowledge base is closed.
+func (kb *boltKnowledgeBase) run(interval time.Duration) {
+	defer kb.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-kb.done:
+			return
+		case <-ticker.C:
+			if err := kb.db.Sync(); err != nil {
+				kb.fail(err)
+			}
+		}
+	}
+}
+
+// fail records and logs an error accessing the database.
+func (kb *boltKnowledgeBase) fail(err error) {
+	kb.errs.record(err)
+	GetLogger("knowledge-base").Errorf("Failed to access the database of '%v': %v", kb.name, err)
+}
+
+// view runs the read transaction, recording its error.
+func (kb *boltKnowledgeBase) view(fn func(tx *bolt.Tx) error) {
+	if err := kb.db.View(fn); err != nil {
+		kb.fail(err)
+	}
+}
+
+// collect reads the statements of the iterator, recording its
+// error.
+func (kb *boltKnowledgeBase) collect(it StatementIterator) []Statement {
+	stmts, err := CollectStatements(it)
+	if err != nil {
+		kb.fail(err)
+		return []Statement{}
+	}
+	return stmts
+}
+
+// scan returns an iterator over the keys of the index starting
+// with the prefix.
+func (kb *boltKnowledgeBase) scan(index *boltIndex, prefix []byte) StatementIterator {
+	return &boltIterator{
+		kb: kb,
+		index: index,
+		prefix: prefix,
+		seek: prefix,
+	}
+}
+
+// term decodes the term of the id.
+func (kb *boltKnowledgeBase) term(tx *bolt.Tx, id uint64) (Node, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	kb.termsMutex.RLock()
+	node, ok := kb.terms[id]
+	kb.termsMutex.RUnlock()
+	if ok {
+		return node, nil
+	}
+
+	data := tx.Bucket(boltTermsBucket).Get(boltKey(id))
+	if data == nil {
+		return nil, fmt.Errorf("Unknown term %v", id)
+	}
+	encoded := &nodeJSON{}
+	if err := json.Unmarshal(data, encoded); err != nil {
+		return nil, err
+	}
+	node, err := nodeFromJSON(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	kb.termsMutex.Lock()
+	defer kb.termsMutex.Unlock()
+	if len(kb.terms) >= boltTermCacheSize {
+		kb.terms = map[uint64]Node{}
+	}
+	kb.terms[id] = node
+	return node, nil
+}
+
+// statement decodes the statement of the ids, indexed by
+// their positions.
+func (kb *boltKnowledgeBase) statement(tx *bolt.Tx, ids [4]uint64) (Statement, error) {
+	nodes := make([]Node, 4)
+	for p, id := range ids {
+		var err error
+		if nodes[p], err = kb.term(tx, id); err != nil {
+			return nil, err
+		}
+	}
+	subject, sok := nodes[SubjectPosition].(NamedNode)
+	predicate, pok := nodes[PredicatePosition].(NamedNode)
+	graph, gok := nodes[GraphPosition].(NamedNode)
+	if !sok || !pok || !gok {
+		return nil, fmt.Errorf("Invalid statement of terms %v", ids)
+	}
+	stmt := NewStatement(subject, predicate, nodes[ObjectPosition], graph)
+
+	data := tx.Bucket(boltMetadataBucket).Get(boltIndexes[SubjectPosition].key(ids))
+	if data == nil {
+		return stmt, nil
+	}
+	encoded := &nodeJSON{}
+	if err := json.Unmarshal(data, encoded); err != nil {
+		return nil, err
+	}
+	metadata, err := metadataFromJSON(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return withMetadata(stmt, metadata), nil
+}
+
+
+
+// boltIterator reads the statements of an index in chunks,
+// each within its own transaction.
+type boltIterator struct {
+	kb *boltKnowledgeBase
+	index *boltIndex
+	prefix []byte
+	// seek is the key to continue with, nil once all
+	// keys are read
+	seek []byte
+	buffer []Statement
+	current Statement
+	err error
+	closed bool
+}
+
+func (it *boltIterator) Next() bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+	if len(it.buffer) == 0 && it.seek != nil {
+		if it.err = it.kb.db.View(it.read); it.err != nil {
+			return false
+		}
+	}
+	if len(it.buffer) == 0 {
+		it.current = nil
+		return false
+	}
+	it.current, it.buffer = it.buffer[0], it.buffer[1:]
+	return true
+}
+
+func (it *boltIterator) Statement() Statement {
+	return it.current
+}
+
+func (it *boltIterator) Err() error {
+	return it.err
+}
+
+func (it *boltIterator) Close() error {
+	it.closed = true
+	it.buffer = nil
+	return nil
+}
+
+// read decodes the next chunk of statements.
+func (it *boltIterator) read(tx *bolt.Tx) error {
+	c := tx.Bucket(it.index.bucket).Cursor()
+	for k, _ := c.Seek(it.seek); k != nil && bytes.HasPrefix(k, it.prefix); k, _ = c.Next() {
+		stmt, err := it.kb.statement(tx, it.index.ids(k))
+		if err != nil {
+			return err
+		}
+		it.buffer = append(it.buffer, stmt)
+		if len(it.buffer) == boltIteratorChunk {
+			// keys have a fixed length, so the next
+			// larger key is the current one plus 0
+			it.seek = append(append([]byte{}, k...), 0)
+			return nil
+		}
+	}
+	it.seek = nil
+	return nil
+}
+
+
+
+// key returns the key of the ids, indexed by their positions.
+func (i *boltIndex) key(ids [4]uint64) []byte {
+	key := make([]byte, 32)
+	for idx, p := range i.positions {
+		binary.BigEndian.PutUint64(key[idx * 8:], ids[p])
+	}
+	return key
+}
+
+// ids returns the ids of the key, indexed by their positions.
+func (i *boltIndex) ids(key []byte) [4]uint64 {
+	var ids [4]uint64
+	for idx, p := range i.positions {
+		ids[p] = binary.BigEndian.Uint64(key[idx * 8:])
+	}
+	return ids
+}
+
+// boltTermID returns the id of the node and whether it is known,
+// creating ids for unknown nodes if requested.
+func boltTermID(tx *bolt.Tx, node Node, create bool) (uint64, bool, error) {
+	if node == nil {
+		return 0, true, nil
+	}
+	key := []byte(termKey(node))
+	ids := tx.Bucket(boltIdsBucket)
+	if data := ids.Get(key); data != nil {
+		return boltUint64(data), true, nil
+	}
+	if !create {
+		return 0, false, nil
+	}
+
+	encoded, err := nodeToJSON(node)
+	if err != nil {
+		return 0, false, err
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return 0, false, err
+	}
+	terms := tx.Bucket(boltTermsBucket)
+	id, err := terms.NextSequence()
+	if err != nil {
+		return 0, false, err
+	}
+	if err := terms.Put(boltKey(id), data); err != nil {
+		return 0, false, err
+	}
+	return id, true, ids.Put(key, boltKey(id))
+}
+
+// boltWrite adds (delta 1) or removes (delta -1) the statement
+// of the ids from the indexes and updates the counts, removing
+// a statement removes its metadata as well.
+func boltWrite(tx *bolt.Tx, ids [4]uint64, delta int64) error {
+	for _, index := range boltIndexes {
+		b := tx.Bucket(index.bucket)
+		var err error
+		if delta > 0 {
+			err = b.Put(index.key(ids), []byte{})
+		} else {
+			err = b.Delete(index.key(ids))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if delta < 0 {
+		if err := tx.Bucket(boltMetadataBucket).Delete(boltIndexes[SubjectPosition].key(ids)); err != nil {
+			return err
+		}
+	}
+	counts := tx.Bucket(boltCountsBucket)
+	for p, id := range ids {
+		if err := boltAdd(counts, boltCountKey(Position(p), id), delta); err != nil {
+			return err
+		}
+	}
+	return boltAdd(tx.Bucket(boltMetaBucket), boltSizeKey, delta)
+}
+
+// boltPutMetadata stores the metadata of the statement of the
+// ids, if there is any.
+func boltPutMetadata(tx *bolt.Tx, ids [4]uint64, metadata Metadata) error {
+	if metadata == nil {
+		return nil
+	}
+	encoded, err := metadataToJSON(metadata)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltMetadataBucket).Put(boltIndexes[SubjectPosition].key(ids), data)
+}
+
+// boltSequence assigns the next sequence number to the change,
+// unless it is empty.
+func boltSequence(tx *bolt.Tx, change *Change) error {
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return nil
+	}
+	meta := tx.Bucket(boltMetaBucket)
+	if err := boltAdd(meta, boltSequenceKey, 1); err != nil {
+		return err
+	}
+	change.Sequence = boltUint64(meta.Get(boltSequenceKey))
+	return nil
+}
+
+// boltAdd adds the delta to the counter of the key, which is
+// removed once it drops to 0.
+func boltAdd(b *bolt.Bucket, key []byte, delta int64) error {
+	value := int64(boltUint64(b.Get(key))) + delta
+	if value <= 0 {
+		return b.Delete(key)
+	}
+	return b.Put(key, boltKey(uint64(value)))
+}
+
+// boltHas checks if the bucket contains the key, regardless
+// of its value.
+func boltHas(b *bolt.Bucket, key []byte) bool {
+	k, _ := b.Cursor().Seek(key)
+	return bytes.Equal(k, key)
+}
+
+// boltCountKey returns the key of the count of the id at
+// the position.
+func boltCountKey(position Position, id uint64) []byte {
+	return append([]byte{byte(position)}, boltKey(id)...)
+}
+
+// boltKey encodes the number as big endian key, so keys are
+// ordered numerically.
+func boltKey(n uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	return key
+}
+
+func boltUint64(data []byte) uint64 {
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
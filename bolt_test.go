@@ -0,0 +1,285 @@
+package semtools
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func sortedStatementKeys(stmts []Statement) []string {
+	keys := []string{}
+	for _, stmt := range stmts {
+		keys = append(keys, statementKey(stmt))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+
+func TestBoltKnowledgeBase(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kb.db")
+
+	kb, err := NewBoltKnowledgeBase("kb", path, nil)
+	if err != nil {
+		t.Fatalf("NewBoltKnowledgeBase() failed: %v", err)
+	}
+	indexed := kb.(IndexedKnowledgeBase)
+	changes := []Change{}
+	kb.Listen(ChangeListenerFunc(func(change Change) {
+		changes = append(changes, change)
+	}))
+
+	a := NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer")), nil)
+	b := NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewLocalizedLiteral("B", "en"), NewNamedNode("g"))
+	c := NewStatement(NewNamedNode("a"), NewNamedNode("q"), NewNamedNode("b"), NewNamedNode("g"))
+	kb.Insert([]Statement{a, b, b, c})
+	kb.Insert([]Statement{a})
+	if indexed.Size() != 3 || len(changes) != 1 || len(changes[0].Added) != 3 || kb.Sequence() != 1 {
+		t.Errorf("Insert() expected 3 statements in one change but got %v (%v)", kb.Statements(), changes)
+	}
+	if indexed.Cardinality(SubjectPosition, NewNamedNode("a")) != 2 || indexed.Cardinality(GraphPosition, NewNamedNode("g")) != 2 || indexed.Cardinality(SubjectPosition, NewNamedNode("x")) != 0 {
+		t.Errorf("Cardinality() returns unexpected counts")
+	}
+	if res := indexed.Lookup(ObjectPosition, NewLocalizedLiteral("B", "en")); len(res) != 1 || !res[0].Equals(b) {
+		t.Errorf("Lookup() expected the statement with the literal but got %v", res)
+	}
+	if graphs := kb.Graphs(); len(graphs) != 2 {
+		t.Errorf("Graphs() expected 2 graphs but got %v", graphs)
+	}
+
+	// deleting without graph matches all graphs
+	kb.Delete([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("q"), NewNamedNode("b"), nil)})
+	kb.Delete([]Statement{NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewLocalizedLiteral("B", "en"), NewNamedNode("h"))})
+	if indexed.Size() != 2 || len(changes) != 2 || len(changes[1].Removed) != 1 || !changes[1].Removed[0].Equals(c) {
+		t.Errorf("Delete() expected to remove one statement but got %v (%v)", kb.Statements(), changes)
+	}
+
+	kb.CopyGraph(NewNamedNode("g"), NewNamedNode("h"))
+	if res := kb.Graph(NewNamedNode("h")).Statements(); len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("b")) {
+		t.Errorf("CopyGraph() expected the statement in the target graph but got %v", res)
+	}
+	if err := kb.Close(); err != nil || kb.Err() != nil {
+		t.Fatalf("Close() failed: %v (%v)", err, kb.Err())
+	}
+
+	kb, err = NewBoltKnowledgeBase("kb", path, &BoltKnowledgeBaseOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("NewBoltKnowledgeBase() failed to reopen: %v", err)
+	}
+	defer kb.Close()
+	if kb.(IndexedKnowledgeBase).Size() != 3 || kb.Sequence() != 3 {
+		t.Errorf("NewBoltKnowledgeBase() expected 3 statements at 3 but got %v at %v", kb.Statements(), kb.Sequence())
+	}
+	if res := kb.Select().Object(NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer"))).Results(); len(res) != 1 || !res[0].Graph().Equals(kb.DefaultGraph()) {
+		t.Errorf("Select() expected the typed literal in the default graph but got %v", res)
+	}
+	kb.AddGraph(nil, NewNamedNode("i"))
+	if res := kb.Graph(NewNamedNode("i")).Statements(); len(res) != 1 || len(kb.Graph(nil).Statements()) != 1 {
+		t.Errorf("AddGraph() expected the statement of the default graph for nil but got %v", res)
+	}
+
+	if _, err := NewBoltKnowledgeBase("kb", filepath.Join(dir, "other.db"), &BoltKnowledgeBaseOptions{KnowledgeBaseOptions: KnowledgeBaseOptions{FullTextIndex: true}}); err == nil {
+		t.Errorf("NewBoltKnowledgeBase() expected to fail with FullTextIndex")
+	}
+
+}
+
+
+func TestBoltKnowledgeBaseQueries(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	kb, err := NewBoltKnowledgeBase("kb", filepath.Join(dir, "kb.db"), &BoltKnowledgeBaseOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("NewBoltKnowledgeBase() failed: %v", err)
+	}
+	defer kb.Close()
+	reference := NewKnowledgeBase("reference")
+
+	// more statements than fit into a chunk of an iterator
+	stmts := []Statement{}
+	for idx := 0; idx < 2500; idx++ {
+		stmts = append(stmts,
+			NewStatement(NewNamedNode(fmt.Sprintf("s%v", idx)), NewNamedNode(fmt.Sprintf("p%v", idx % 7)), NewTypedLiteral(fmt.Sprintf("%v", idx), NewNamedNode(xsdNamespace + "integer")), nil),
+			NewStatement(NewNamedNode(fmt.Sprintf("s%v", idx)), NewNamedNode("label"), NewLocalizedLiteral(fmt.Sprintf("label %v", idx), "en"), NewNamedNode(fmt.Sprintf("g%v", idx % 3))),
+		)
+	}
+	kb.Insert(stmts)
+	reference.Insert(stmts)
+
+	queries := map[string]Query{
+		"all": NewQuery(),
+		"subject": NewQuery().Subject(NewNamedNode("s42")),
+		"predicate": NewQuery().Predicate(NewNamedNode("p3")).ObjectGreaterThan(NewTypedLiteral("2000", NewNamedNode(xsdNamespace + "integer"))),
+		"graph": NewQuery().Graph(NewNamedNode("g1")).ObjectStartsWith("label 12"),
+		"or": NewQuery().Subject(NewNamedNode("s1")).Or().Object(NewLocalizedLiteral("label 7", "en")),
+		"unknown": NewQuery().Predicate(NewNamedNode("unknown")),
+	}
+	for name, q := range queries {
+		expected := sortedStatementKeys(q.Bind(reference).Results())
+		actual := sortedStatementKeys(q.Bind(kb).Results())
+		if fmt.Sprint(expected) != fmt.Sprint(actual) {
+			t.Errorf("%v: Results() expected %v statements but got %v", name, len(expected), len(actual))
+		}
+	}
+	if res := kb.Select().Predicate(NewNamedNode("label")).OrderByDescending(ObjectPosition).Limit(2).Results(); len(res) != 2 || res[0].Object().String() != "label 999" {
+		t.Errorf("Select() expected ordered results but got %v", res)
+	}
+	if plan, err := kb.Select().Subject(NewNamedNode("s42")).Plan(); err != nil || plan.Index == nil || plan.EstimatedCandidates != 2 {
+		t.Errorf("Plan() expected an index lookup of 2 candidates but got %v (%v)", plan, err)
+	}
+
+	sub, err := kb.Subscribe(NewQuery().Subject(NewNamedNode("s42")), nil)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	defer sub.Close()
+	if len(sub.Results()) != 2 {
+		t.Errorf("Subscribe() expected 2 initial results but got %v", sub.Results())
+	}
+	kb.DropGraph(NewNamedNode("g0"))
+	if change := <-sub.Changes(); len(change.Removed) != 1 {
+		t.Errorf("Changes() expected the label to be removed but got %v", change)
+	}
+	if kb.(IndexedKnowledgeBase).Size() != 5000 - 834 {
+		t.Errorf("DropGraph() expected %v statements but got %v", 5000 - 834, kb.(IndexedKnowledgeBase).Size())
+	}
+
+}
+
+
+func TestBoltKnowledgeBaseTypedLiterals(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kb.db")
+
+	kb, err := NewBoltKnowledgeBase("kb", path, nil)
+	if err != nil {
+		t.Fatalf("NewBoltKnowledgeBase() failed: %v", err)
+	}
+	changes := []Change{}
+	kb.Listen(ChangeListenerFunc(func(change Change) {
+		changes = append(changes, change)
+	}))
+	integer := NewNamedNode(xsdNamespace + "integer")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("age"), NewTypedLiteral(30, integer), nil),
+		NewStatement(NewNamedNode("b"), NewNamedNode("age"), NewTypedLiteral("30", integer), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("active"), NewTypedLiteral(true, NewNamedNode(xsdNamespace + "boolean")), nil),
+	})
+	if len(changes) != 1 || len(changes[0].Added) != 3 || !changes[0].Added[0].Graph().Equals(kb.DefaultGraph()) {
+		t.Fatalf("Insert() expected 3 added statements but got %v", changes)
+	}
+	if stmts := kb.Statements(); !changes[0].Added[0].Equals(stmts[0]) {
+		t.Errorf("Insert() expected the added statements as stored but got %v", changes[0].Added)
+	}
+
+	// including values within nested quoted triples
+	nested := func(value interface{}) Statement {
+		inner := NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral(value, integer))
+		return NewStatement(NewQuotedTriple(inner, NewNamedNode("p"), NewNamedNode("a")), NewNamedNode("q"), NewNamedNode("b"), nil)
+	}
+	kb.Insert([]Statement{nested(1), nested("1")})
+	if res := kb.Select().Predicate(NewNamedNode("q")).Results(); len(res) != 2 {
+		t.Errorf("Insert() expected quoted triples with values of different kinds but got %v", res)
+	}
+	kb.Delete([]Statement{nested(1), nested("1")})
+
+	// values of different kinds are different terms
+	if res := kb.Select().Object(NewTypedLiteral(30, integer)).Results(); len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("a")) {
+		t.Errorf("Select() expected the integer literal but got %v", res)
+	}
+	if res := kb.Select().Object(NewTypedLiteral("30", integer)).Results(); len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("b")) {
+		t.Errorf("Select() expected the string literal but got %v", res)
+	}
+	kb.Close()
+
+	kb, err = NewBoltKnowledgeBase("kb", path, nil)
+	if err != nil {
+		t.Fatalf("NewBoltKnowledgeBase() failed to reopen: %v", err)
+	}
+	defer kb.Close()
+	if res := kb.Select().Object(NewTypedLiteral(true, NewNamedNode(xsdNamespace + "boolean"))).Results(); len(res) != 1 {
+		t.Errorf("Select() expected the boolean literal after reopening but got %v", res)
+	}
+	kb.Delete([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("age"), NewTypedLiteral(30, integer), nil)})
+	if size := kb.(IndexedKnowledgeBase).Size(); size != 2 {
+		t.Errorf("Delete() expected 2 remaining statements but got %v", kb.Statements())
+	}
+
+}
+
+
+func TestBoltKnowledgeBaseMetadata(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kb.db")
+
+	kb, err := NewBoltKnowledgeBase("kb", path, nil)
+	if err != nil {
+		t.Fatalf("NewBoltKnowledgeBase() failed: %v", err)
+	}
+	changes := []Change{}
+	kb.Listen(ChangeListenerFunc(func(change Change) {
+		changes = append(changes, change)
+	}))
+	kb.Insert(annotatedTestStatements())
+
+	// the metadata of the first insert is kept
+	kb.Insert([]Statement{NewAnnotatedStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"), nil, Metadata{MetadataSource: NewNamedNode("other")})})
+	if len(changes) != 1 || len(MetadataOf(changes[0].Added[0])) != 3 {
+		t.Errorf("Insert() expected the added statements with metadata but got %v", changes)
+	}
+	kb.Close()
+
+	kb, err = NewBoltKnowledgeBase("kb", path, nil)
+	if err != nil {
+		t.Fatalf("NewBoltKnowledgeBase() failed to reopen: %v", err)
+	}
+	defer kb.Close()
+	if res := kb.Select().Metadata(NewNamedNode(MetadataSource), NewNamedNode("file:///a.ttl")).Results(); len(res) != 1 || !res[0].Object().Equals(NewNamedNode("b")) || len(MetadataOf(res[0])) != 3 {
+		t.Errorf("Select() expected the statement by its metadata but got %v", res)
+	}
+	if res := kb.Select().Predicate(NewNamedNode("q")).Results(); len(res) != 1 || MetadataOf(res[0]) != nil {
+		t.Errorf("Select() expected the statement without metadata but got %v", res)
+	}
+
+	// deleting removes the metadata
+	b := NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"), nil)
+	kb.Delete([]Statement{b})
+	kb.Insert([]Statement{b})
+	if res := kb.Select().Object(NewNamedNode("b")).Results(); len(res) != 1 || MetadataOf(res[0]) != nil {
+		t.Errorf("Delete() expected to remove the metadata but got %v", res)
+	}
+
+}
@@ -0,0 +1,438 @@
+package semtools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+
+// canonicalMaxWork limits the hashes and permutations computed
+// for the blank nodes of a dataset, which grow exponentially for
+// specially crafted datasets.
+const canonicalMaxWork = 1 << 20
+
+// Canonicalize relabels the blank nodes (see IsBlankNode()) of the
+// statements with the W3C RDF Dataset Canonicalization algorithm
+// RDFC-1.0 using SHA-256 and returns the distinct statements in
+// canonical order. Datasets that only differ in the labels of their
+// blank nodes result in the same statements. Statements without graph
+// are in the default graph of the dataset, the default graph of a
+// knowledge base is a named graph like any other. Quoted triples
+// must not contain blank nodes.
+func Canonicalize(stmts []Statement) ([]Statement, error) {
+	c, err := newCanonicalizer(stmts)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.run(); err != nil {
+		return nil, err
+	}
+	labels := map[string]string{}
+	for _, label := range c.canonical.order {
+		labels[label] = "_:" + c.canonical.ids[label]
+	}
+
+	// the quads are distinct already, relabeling keeps them
+	// distinct
+	res := make([]Statement, len(c.quads))
+	lines := make([]string, len(c.quads))
+	for idx, stmt := range c.quads {
+		res[idx] = relabelStatement(stmt, labels)
+		if lines[idx], err = c.nquad(res[idx], ""); err != nil {
+			return nil, err
+		}
+	}
+	sort.Sort(canonicalOrder{res, lines})
+	return res, nil
+}
+
+// CanonicalNQuads returns the canonical N-Quads of the statements,
+// see Canonicalize().
+func CanonicalNQuads(stmts []Statement) (string, error) {
+	canonical, err := Canonicalize(stmts)
+	if err != nil {
+		return "", err
+	}
+	return NewNTriplesParser(&NTriplesParserOptions{Quads: true}).Marshal(canonical)
+}
+
+// CanonicalHash returns the hex encoded SHA-256 hash of the
+// canonical N-Quads of the statements, which is stable for a
+// dataset and can be used to sign or deduplicate it.
+func CanonicalHash(stmts []Statement) (string, error) {
+	nquads, err := CanonicalNQuads(stmts)
+	if err != nil {
+		return "", err
+	}
+	return canonicalHash(nquads), nil
+}
+
+// Isomorphic returns if the datasets of the statements are equal
+// except for the labels of their blank nodes.
+func Isomorphic(a []Statement, b []Statement) (bool, error) {
+	ca, err := CanonicalNQuads(a)
+	if err != nil {
+		return false, err
+	}
+	cb, err := CanonicalNQuads(b)
+	if err != nil {
+		return false, err
+	}
+	return ca == cb, nil
+}
+
+// canonicalHash returns the hex encoded SHA-256 hash of the string.
+func canonicalHash(str string) string {
+	hash := sha256.Sum256([]byte(str))
+	return hex.EncodeToString(hash[:])
+}
+
+
+
+// canonicalOrder sorts statements by their N-Quads.
+type canonicalOrder struct {
+	stmts []Statement
+	lines []string
+}
+
+func (o canonicalOrder) Len() int {
+	return len(o.stmts)
+}
+
+func (o canonicalOrder) Less(i, j int) bool {
+	return o.lines[i] < o.lines[j]
+}
+
+func (o canonicalOrder) Swap(i, j int) {
+	o.stmts[i], o.stmts[j] = o.stmts[j], o.stmts[i]
+	o.lines[i], o.lines[j] = o.lines[j], o.lines[i]
+}
+
+
+
+// identifierIssuer issues identifiers with a prefix and
+// a counter, remembering the order they were issued in.
+type identifierIssuer struct {
+	prefix string
+	ids map[string]string
+	order []string
+}
+
+func newIdentifierIssuer(prefix string) *identifierIssuer {
+	return &identifierIssuer{prefix: prefix, ids: map[string]string{}, order: []string{}}
+}
+
+// issue returns the identifier of the label, issuing a new one
+// if the label has none yet.
+func (ii *identifierIssuer) issue(label string) string {
+	if id, ok := ii.ids[label]; ok {
+		return id
+	}
+	id := ii.prefix + strconv.Itoa(len(ii.order))
+	ii.ids[label] = id
+	ii.order = append(ii.order, label)
+	return id
+}
+
+func (ii *identifierIssuer) copy() *identifierIssuer {
+	c := newIdentifierIssuer(ii.prefix)
+	for _, label := range ii.order {
+		c.issue(label)
+	}
+	return c
+}
+
+
+
+// canonicalizer holds the state of the canonicalization of
+// a dataset, the blank nodes are identified by their labels.
+type canonicalizer struct {
+	parser *NTriplesParser
+	quads []Statement
+	blankQuads map[string][]Statement
+	canonical *identifierIssuer
+	firstDegree map[string]string
+	work int
+}
+
+func newCanonicalizer(stmts []Statement) (*canonicalizer, error) {
+	c := &canonicalizer{
+		parser: NewNTriplesParser(&NTriplesParserOptions{Quads: true}),
+		quads: []Statement{},
+		blankQuads: map[string][]Statement{},
+		canonical: newIdentifierIssuer("c14n"),
+		firstDegree: map[string]string{},
+	}
+
+	// the dataset is a set of quads
+	lines := map[string]bool{}
+	for _, stmt := range stmts {
+		if qt, ok := stmt.Subject().(QuotedTriple); ok && len(blankNodeLabels(qt)) > 0 {
+			return nil, fmt.Errorf("Unable to canonicalize blank nodes within quoted triple '%v'", qt)
+		}
+		if qt, ok := stmt.Object().(QuotedTriple); ok && len(blankNodeLabels(qt)) > 0 {
+			return nil, fmt.Errorf("Unable to canonicalize blank nodes within quoted triple '%v'", qt)
+		}
+		line, err := c.nquad(stmt, "")
+		if err != nil {
+			return nil, err
+		}
+		if lines[line] {
+			continue
+		}
+		lines[line] = true
+		c.quads = append(c.quads, stmt)
+		for _, n := range []Node{stmt.Subject(), stmt.Object(), stmt.Graph()} {
+			if IsBlankNode(n) {
+				label := n.(NamedNode).Iri()
+				if q := c.blankQuads[label]; len(q) == 0 || q[len(q) - 1] != stmt {
+					c.blankQuads[label] = append(q, stmt)
+				}
+			}
+		}
+	}
+	return c, nil
+}
+
+// run issues the canonical identifiers of all blank nodes.
+func (c *canonicalizer) run() error {
+
+	// blank nodes with unique first degree hashes are
+	// issued their identifiers in the order of the hashes
+	hashes := map[string][]string{}
+	for label := range c.blankQuads {
+		hash, err := c.hashFirstDegreeQuads(label)
+		if err != nil {
+			return err
+		}
+		hashes[hash] = append(hashes[hash], label)
+	}
+	sorted := []string{}
+	for hash, labels := range hashes {
+		sort.Strings(labels)
+		sorted = append(sorted, hash)
+	}
+	sort.Strings(sorted)
+	for _, hash := range sorted {
+		if len(hashes[hash]) == 1 {
+			c.canonical.issue(hashes[hash][0])
+		}
+	}
+
+	// the others are distinguished by the blank nodes
+	// they are connected to
+	for _, hash := range sorted {
+		if len(hashes[hash]) == 1 {
+			continue
+		}
+		results := []*nDegreeResult{}
+		for _, label := range hashes[hash] {
+			if _, ok := c.canonical.ids[label]; ok {
+				continue
+			}
+			issuer := newIdentifierIssuer("b")
+			issuer.issue(label)
+			result, err := c.hashNDegreeQuads(label, issuer)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].hash < results[j].hash
+		})
+		for _, result := range results {
+			for _, label := range result.issuer.order {
+				c.canonical.issue(label)
+			}
+		}
+	}
+	return nil
+
+}
+
+// nquad serializes the quad as canonical N-Quad. If a reference
+// label is given, its blank node is written as `_:a` and the other
+// blank nodes as `_:z`.
+func (c *canonicalizer) nquad(stmt Statement, reference string) (string, error) {
+	parts := []string{}
+	for _, n := range []Node{stmt.Subject(), stmt.Predicate(), stmt.Object(), stmt.Graph()} {
+		switch {
+		case n == nil:
+			continue
+		case reference != "" && IsBlankNode(n) && n.(NamedNode).Iri() == reference:
+			parts = append(parts, "_:a")
+		case reference != "" && IsBlankNode(n):
+			parts = append(parts, "_:z")
+		default:
+			s, err := c.parser.marshalNode(n)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " ") + " .\n", nil
+}
+
+// hashFirstDegreeQuads hashes the quads of the blank node
+// without taking into account the other blank nodes.
+func (c *canonicalizer) hashFirstDegreeQuads(label string) (string, error) {
+	if hash, ok := c.firstDegree[label]; ok {
+		return hash, nil
+	}
+	nquads := []string{}
+	for _, stmt := range c.blankQuads[label] {
+		line, err := c.nquad(stmt, label)
+		if err != nil {
+			return "", err
+		}
+		nquads = append(nquads, line)
+	}
+	sort.Strings(nquads)
+	c.firstDegree[label] = canonicalHash(strings.Join(nquads, ""))
+	return c.firstDegree[label], nil
+}
+
+// hashRelatedBlankNode hashes the blank node related to
+// another one by the quad at the position.
+func (c *canonicalizer) hashRelatedBlankNode(related string, stmt Statement, issuer *identifierIssuer, position string) (string, error) {
+	input := position
+	if position != "g" {
+		input += "<" + stmt.Predicate().Iri() + ">"
+	}
+	if id, ok := c.canonical.ids[related]; ok {
+		input += "_:" + id
+	} else if id, ok := issuer.ids[related]; ok {
+		input += "_:" + id
+	} else {
+		hash, err := c.hashFirstDegreeQuads(related)
+		if err != nil {
+			return "", err
+		}
+		input += hash
+	}
+	return canonicalHash(input), nil
+}
+
+// nDegreeResult is the hash of a blank node together with the
+// identifiers issued to the blank nodes related to it.
+type nDegreeResult struct {
+	hash string
+	issuer *identifierIssuer
+}
+
+// hashNDegreeQuads hashes the blank node with the paths to the
+// blank nodes related to it, choosing the smallest path among all
+// permutations of related blank nodes with the same hash.
+func (c *canonicalizer) hashNDegreeQuads(label string, issuer *identifierIssuer) (*nDegreeResult, error) {
+	if c.work++; c.work > canonicalMaxWork {
+		return nil, fmt.Errorf("Unable to canonicalize, the blank nodes require too many computations")
+	}
+
+	related := map[string][]string{}
+	for _, stmt := range c.blankQuads[label] {
+		for idx, n := range []Node{stmt.Subject(), stmt.Object(), stmt.Graph()} {
+			if !IsBlankNode(n) || n.(NamedNode).Iri() == label {
+				continue
+			}
+			hash, err := c.hashRelatedBlankNode(n.(NamedNode).Iri(), stmt, issuer, []string{"s", "o", "g"}[idx])
+			if err != nil {
+				return nil, err
+			}
+			related[hash] = append(related[hash], n.(NamedNode).Iri())
+		}
+	}
+	hashes := []string{}
+	for hash := range related {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	data := ""
+	for _, hash := range hashes {
+		data += hash
+		chosenPath := ""
+		var chosenIssuer *identifierIssuer
+		var err error
+		permute(related[hash], func(permutation []string) bool {
+			if c.work++; c.work > canonicalMaxWork {
+				err = fmt.Errorf("Unable to canonicalize, the blank nodes require too many computations")
+				return false
+			}
+			issuerCopy := issuer.copy()
+			path := ""
+			recursion := []string{}
+			skip := func() bool {
+				return chosenPath != "" && len(path) >= len(chosenPath) && path > chosenPath
+			}
+			for _, r := range permutation {
+				if id, ok := c.canonical.ids[r]; ok {
+					path += "_:" + id
+				} else {
+					if _, ok := issuerCopy.ids[r]; !ok {
+						recursion = append(recursion, r)
+					}
+					path += "_:" + issuerCopy.issue(r)
+				}
+				if skip() {
+					return true
+				}
+			}
+			for _, r := range recursion {
+				var result *nDegreeResult
+				if result, err = c.hashNDegreeQuads(r, issuerCopy); err != nil {
+					return false
+				}
+				path += "_:" + issuerCopy.issue(r) + "<" + result.hash + ">"
+				issuerCopy = result.issuer
+				if skip() {
+					return true
+				}
+			}
+			if chosenPath == "" || path < chosenPath {
+				chosenPath = path
+				chosenIssuer = issuerCopy
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		data += chosenPath
+		issuer = chosenIssuer
+	}
+	return &nDegreeResult{hash: canonicalHash(data), issuer: issuer}, nil
+}
+
+// permute calls the function with all permutations of the
+// items, until it returns false.
+func permute(items []string, fn func([]string) bool) {
+	p := append([]string{}, items...)
+	sort.Strings(p)
+	for {
+		if !fn(p) {
+			return
+		}
+		// advance to the next permutation in lexicographic order
+		i := len(p) - 2
+		for i >= 0 && p[i] >= p[i + 1] {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+		j := len(p) - 1
+		for p[j] <= p[i] {
+			j--
+		}
+		p[i], p[j] = p[j], p[i]
+		for l, r := i + 1, len(p) - 1; l < r; l, r = l + 1, r - 1 {
+			p[l], p[r] = p[r], p[l]
+		}
+	}
+}
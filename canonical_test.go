@@ -0,0 +1,126 @@
+package semtools
+
+import (
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestCanonicalize(t *testing.T) {
+
+	// examples of the RDFC-1.0 specification
+	cases := map[string][]string{
+		"unique hashes": {`<http://example.com/#p> <http://example.com/#q> _:e0 .
+<http://example.com/#p> <http://example.com/#r> _:e1 .
+_:e0 <http://example.com/#s> <http://example.com/#u> .
+_:e1 <http://example.com/#t> <http://example.com/#u> .
+`, `<http://example.com/#p> <http://example.com/#q> _:c14n0 .
+<http://example.com/#p> <http://example.com/#r> _:c14n1 .
+_:c14n0 <http://example.com/#s> <http://example.com/#u> .
+_:c14n1 <http://example.com/#t> <http://example.com/#u> .
+`},
+		"shared hashes": {`<http://example.com/#p> <http://example.com/#q> _:e0 .
+<http://example.com/#p> <http://example.com/#q> _:e1 .
+_:e0 <http://example.com/#p> _:e2 .
+_:e1 <http://example.com/#p> _:e3 .
+_:e2 <http://example.com/#r> _:e3 .
+`, `<http://example.com/#p> <http://example.com/#q> _:c14n2 .
+<http://example.com/#p> <http://example.com/#q> _:c14n3 .
+_:c14n0 <http://example.com/#r> _:c14n1 .
+_:c14n2 <http://example.com/#p> _:c14n1 .
+_:c14n3 <http://example.com/#p> _:c14n0 .
+`},
+		"graphs and literals": {`_:g <http://example.com/#p> "tab\there"@en _:g .
+<http://example.com/#s> <http://example.com/#p> "1"^^<http://www.w3.org/2001/XMLSchema#integer> .
+<http://example.com/#s> <http://example.com/#p> "1"^^<http://www.w3.org/2001/XMLSchema#integer> .
+<http://example.com/#s> <http://example.com/#p> "x"^^<http://www.w3.org/2001/XMLSchema#string> <http://example.com/#g> .
+`, `<http://example.com/#s> <http://example.com/#p> "1"^^<http://www.w3.org/2001/XMLSchema#integer> .
+<http://example.com/#s> <http://example.com/#p> "x" <http://example.com/#g> .
+_:c14n0 <http://example.com/#p> "tab\there"@en _:c14n0 .
+`},
+	}
+	p := NewNTriplesParser(&NTriplesParserOptions{Quads: true})
+	for name, c := range cases {
+		stmts, err := p.Unmarshal(c[0])
+		if err != nil {
+			t.Fatalf("%v: Unmarshal() failed: %v", name, err)
+		}
+		if res, err := CanonicalNQuads(stmts); err != nil || res != c[1] {
+			t.Errorf("%v: CanonicalNQuads() expected %v but got %v (%v)", name, c[1], res, err)
+		}
+	}
+
+}
+
+
+func TestCanonicalHash(t *testing.T) {
+
+	// a cycle of blank nodes, relabeled and reordered
+	a := []Statement{
+		NewStatement(NewNamedNode("_:a"), NewNamedNode("next"), NewNamedNode("_:b"), nil),
+		NewStatement(NewNamedNode("_:b"), NewNamedNode("next"), NewNamedNode("_:c"), nil),
+		NewStatement(NewNamedNode("_:c"), NewNamedNode("next"), NewNamedNode("_:a"), nil),
+		NewStatement(NewNamedNode("_:a"), NewNamedNode("label"), NewLocalizedLiteral("start", "en"), nil),
+	}
+	b := []Statement{
+		NewStatement(NewNamedNode("_:x"), NewNamedNode("label"), NewLocalizedLiteral("start", "en"), nil),
+		NewStatement(NewNamedNode("_:z"), NewNamedNode("next"), NewNamedNode("_:x"), nil),
+		NewStatement(NewNamedNode("_:y"), NewNamedNode("next"), NewNamedNode("_:z"), nil),
+		NewStatement(NewNamedNode("_:x"), NewNamedNode("next"), NewNamedNode("_:y"), nil),
+	}
+	ha, err := CanonicalHash(a)
+	if err != nil {
+		t.Fatalf("CanonicalHash() failed: %v", err)
+	}
+	if hb, err := CanonicalHash(b); err != nil || ha != hb || len(ha) != 64 {
+		t.Errorf("CanonicalHash() expected equal hashes but got %v and %v (%v)", ha, hb, err)
+	}
+	if ok, err := Isomorphic(a, b); err != nil || !ok {
+		t.Errorf("Isomorphic() expected relabeled statements to be isomorphic (%v)", err)
+	}
+
+	// the label moves to another node of the cycle
+	b[0] = NewStatement(NewNamedNode("_:y"), NewNamedNode("label"), NewLocalizedLiteral("start", "en"), nil)
+	if ok, err := Isomorphic(a, b); err != nil || !ok {
+		t.Errorf("Isomorphic() expected a rotated cycle to be isomorphic (%v)", err)
+	}
+	b[0] = NewStatement(NewNamedNode("_:y"), NewNamedNode("label"), NewLocalizedLiteral("end", "en"), nil)
+	if ok, err := Isomorphic(a, b); err != nil || ok {
+		t.Errorf("Isomorphic() expected different statements not to be isomorphic (%v)", err)
+	}
+
+	// two cycles of two nodes differ from one cycle of four
+	cycles := []Statement{
+		NewStatement(NewNamedNode("_:a"), NewNamedNode("next"), NewNamedNode("_:b"), nil),
+		NewStatement(NewNamedNode("_:b"), NewNamedNode("next"), NewNamedNode("_:a"), nil),
+		NewStatement(NewNamedNode("_:c"), NewNamedNode("next"), NewNamedNode("_:d"), nil),
+		NewStatement(NewNamedNode("_:d"), NewNamedNode("next"), NewNamedNode("_:c"), nil),
+	}
+	cycle := []Statement{
+		NewStatement(NewNamedNode("_:a"), NewNamedNode("next"), NewNamedNode("_:b"), nil),
+		NewStatement(NewNamedNode("_:b"), NewNamedNode("next"), NewNamedNode("_:c"), nil),
+		NewStatement(NewNamedNode("_:c"), NewNamedNode("next"), NewNamedNode("_:d"), nil),
+		NewStatement(NewNamedNode("_:d"), NewNamedNode("next"), NewNamedNode("_:a"), nil),
+	}
+	if ok, err := Isomorphic(cycles, cycle); err != nil || ok {
+		t.Errorf("Isomorphic() expected different cycles not to be isomorphic (%v)", err)
+	}
+
+	canonical, err := Canonicalize(cycle)
+	if err != nil || len(canonical) != 4 || !IsBlankNode(canonical[0].Subject()) || canonical[0].Subject().Iri() != "_:c14n0" {
+		t.Errorf("Canonicalize() expected relabeled statements but got %v (%v)", canonical, err)
+	}
+
+	quoted := []Statement{NewStatement(NewQuotedTriple(NewNamedNode("_:a"), NewNamedNode("p"), NewNamedNode("b")), NewNamedNode("q"), NewNamedNode("c"), nil)}
+	if _, err := CanonicalHash(quoted); err == nil {
+		t.Errorf("CanonicalHash() expected to fail for blank nodes within quoted triples")
+	}
+
+}
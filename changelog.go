@@ -0,0 +1,480 @@
+package semtools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+
+// Change describes the statements that were actually added or
+// removed by a single modification of a knowledge base, ie. after
+// suppressing duplicates and statements that didn't exist.
+type Change struct {
+
+	// Sequence is the number of the change within the knowledge
+	// base, starting at 1 and increasing without gaps.
+	Sequence uint64
+
+	// Added are the statements inserted by the modification.
+	Added []Statement
+
+	// Removed are the statements deleted by the modification.
+	Removed []Statement
+
+}
+
+// ChangeListener observes the changes of a knowledge base, see
+// KnowledgeBase.Listen().
+type ChangeListener interface {
+
+	// Changed is called after every modification that added or
+	// removed statements, in the order of the modifications.
+	Changed(change Change)
+
+}
+
+// ChangeListenerFunc is a function that observes changes.
+type ChangeListenerFunc func(change Change)
+
+// Changed calls the function.
+func (f ChangeListenerFunc) Changed(change Change) {
+	f(change)
+}
+
+// ChangeLog stores the changes of a knowledge base in order of
+// their sequence numbers, so they can be replayed later on, see
+// KnowledgeBaseOptions and ReplayChanges().
+type ChangeLog interface {
+
+	// Append stores the change, its sequence number has to be
+	// greater than the one of the last change.
+	Append(change Change) error
+
+	// LastSequence returns the sequence number of the last change
+	// stored, or 0 for an empty log.
+	LastSequence() uint64
+
+	// Replay calls the function for every change with a sequence
+	// number of at least from, in order. Replay stops at the first
+	// error of the function and returns it.
+	Replay(from uint64, fn func(change Change) error) error
+
+	// Close releases the resources of the log.
+	Close() error
+
+}
+
+// ChangeLoggingKnowledgeBase is a knowledge base that appends its
+// changes to a ChangeLog, see KnowledgeBaseOptions.
+type ChangeLoggingKnowledgeBase interface {
+
+	KnowledgeBase
+
+	// Err returns the first error appending a change to the log,
+	// as the methods of KnowledgeBase don't report errors.
+	Err() error
+
+}
+
+// FileChangeLogOptions are options that configure a file based
+// change log.
+type FileChangeLogOptions struct {
+
+	// Sync flushes every change to stable storage before Append()
+	// returns, otherwise this is left to the operating system.
+	Sync bool
+
+}
+
+// NewMemoryChangeLog creates a change log that keeps the changes
+// in memory.
+func NewMemoryChangeLog() ChangeLog {
+	return &memoryChangeLog{changes: []Change{}}
+}
+
+// NewFileChangeLog opens or creates the change log in the file,
+// changes are appended as JSON lines. An incomplete last line, as
+// left behind by a crash during Append(), is ignored and replaced
+// by the next change.
+func NewFileChangeLog(path string, opts *FileChangeLogOptions) (ChangeLog, error) {
+	if opts == nil {
+		opts = &FileChangeLogOptions{}
+	}
+	file, err := os.OpenFile(path, os.O_RDWR | os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the last complete change and drop anything after it
+	l := &fileChangeLog{path: path, file: file, sync: opts.Sync}
+	var end int64
+	err = l.read(func(change Change, offset int64) error {
+		l.last, end = change.Sequence, offset
+		return nil
+	})
+	if err == nil {
+		err = file.Truncate(end)
+	}
+	if err == nil {
+		_, err = file.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// ReplayChanges applies the changes of the log with a sequence
+// number of at least from to the knowledge base. Mind that the
+// knowledge base appends the changes to its own log, if any.
+func ReplayChanges(kb KnowledgeBase, log ChangeLog, from uint64) error {
+	return log.Replay(from, func(change Change) error {
+		if len(change.Removed) > 0 {
+			kb.Delete(change.Removed)
+		}
+		if len(change.Added) > 0 {
+			kb.Insert(change.Added)
+		}
+		return nil
+	})
+}
+
+
+
+// observers manages the listeners and subscriptions of a
+// knowledge base. Changes are queued while holding the write lock
+// of the knowledge base and delivered in order after it has been
+// released, so observers can read the knowledge base and other
+// modifications aren't blocked by slow subscribers.
+type observers struct {
+	// mutex guards the registrations and the queue, delivery
+	// serializes delivering the queued changes
+	mutex sync.Mutex
+	delivery sync.Mutex
+	listeners []*listenerEntry
+	subscriptions []*subscription
+	queue []Change
+}
+
+// listenerEntry identifies a registered listener, as listeners
+// themselves might not be comparable.
+type listenerEntry struct {
+	listener ChangeListener
+	removed int32
+}
+
+// listen registers the listener and returns the function
+// removing it.
+func (o *observers) listen(listener ChangeListener) func() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	entry := &listenerEntry{listener: listener}
+	o.listeners = append(o.listeners, entry)
+	return func() {
+		atomic.StoreInt32(&entry.removed, 1)
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		for idx, l := range o.listeners {
+			if l == entry {
+				o.listeners = append(o.listeners[:idx:idx], o.listeners[idx+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// subscribe registers the subscription, whose results contain
+// the changes up to the sequence number.
+func (o *observers) subscribe(s *subscription, sequence uint64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	s.sequence = sequence
+	s.unsubscribe = o.unsubscribe
+	o.subscriptions = append(o.subscriptions, s)
+}
+
+func (o *observers) unsubscribe(s *subscription) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for idx, a := range o.subscriptions {
+		if a == s {
+			o.subscriptions = append(o.subscriptions[:idx:idx], o.subscriptions[idx+1:]...)
+			break
+		}
+	}
+}
+
+// enqueue queues the change for delivery, the caller holds the
+// write lock of the knowledge base so changes are queued in order.
+func (o *observers) enqueue(change Change) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.queue = append(o.queue, change)
+}
+
+// deliver notifies the listeners and subscriptions of the queued
+// changes in order, the caller must not hold the write lock of
+// the knowledge base. It returns once the changes queued before
+// are delivered, no matter which modification delivers them.
+func (o *observers) deliver() {
+	o.delivery.Lock()
+	defer o.delivery.Unlock()
+	for {
+		o.mutex.Lock()
+		if len(o.queue) == 0 {
+			o.mutex.Unlock()
+			return
+		}
+		change := o.queue[0]
+		o.queue = o.queue[1:]
+		listeners, subscriptions := o.listeners, o.subscriptions
+		o.mutex.Unlock()
+
+		for _, l := range listeners {
+			if atomic.LoadInt32(&l.removed) == 0 {
+				l.listener.Changed(change)
+			}
+		}
+		for _, s := range subscriptions {
+			s.deliver(change)
+		}
+	}
+}
+
+
+
+type memoryChangeLog struct {
+	mutex sync.RWMutex
+	changes []Change
+}
+
+func (l *memoryChangeLog) Append(change Change) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if n := len(l.changes); n > 0 && change.Sequence <= l.changes[n - 1].Sequence {
+		return fmt.Errorf("Change %v is out of sequence", change.Sequence)
+	}
+	l.changes = append(l.changes, change)
+	return nil
+}
+
+func (l *memoryChangeLog) LastSequence() uint64 {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if n := len(l.changes); n > 0 {
+		return l.changes[n - 1].Sequence
+	}
+	return 0
+}
+
+func (l *memoryChangeLog) Replay(from uint64, fn func(change Change) error) error {
+	l.mutex.RLock()
+	changes := l.changes
+	l.mutex.RUnlock()
+	for _, change := range changes {
+		if change.Sequence < from {
+			continue
+		}
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *memoryChangeLog) Close() error {
+	return nil
+}
+
+
+
+// changeJSON is the JSON representation of a change.
+type changeJSON struct {
+	Sequence uint64 `json:"sequence"`
+	Added [][]*nodeJSON `json:"added,omitempty"`
+	Removed [][]*nodeJSON `json:"removed,omitempty"`
+}
+
+type fileChangeLog struct {
+	mutex sync.Mutex
+	path string
+	file *os.File
+	sync bool
+	last uint64
+}
+
+func (l *fileChangeLog) Append(change Change) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if change.Sequence <= l.last {
+		return fmt.Errorf("Change %v is out of sequence", change.Sequence)
+	}
+
+	data, err := encodeChange(change)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(data); err != nil {
+		return err
+	}
+	if l.sync {
+		if err := l.file.Sync(); err != nil {
+			return err
+		}
+	}
+	l.last = change.Sequence
+	return nil
+}
+
+func (l *fileChangeLog) LastSequence() uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.last
+}
+
+func (l *fileChangeLog) Replay(from uint64, fn func(change Change) error) error {
+	l.mutex.Lock()
+	changes := []Change{}
+	err := l.read(func(change Change, offset int64) error {
+		if change.Sequence >= from {
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	l.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *fileChangeLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+// flush writes the appended changes to stable storage.
+func (l *fileChangeLog) flush() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Sync()
+}
+
+// compact drops the changes with a sequence number up to through
+// by rewriting the remaining ones to a new file, which atomically
+// replaces the log.
+func (l *fileChangeLog) compact(through uint64) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	tmp, err := os.OpenFile(l.path + ".tmp", os.O_RDWR | os.O_CREATE | os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	err = l.read(func(change Change, offset int64) error {
+		if change.Sequence <= through {
+			return nil
+		}
+		data, err := encodeChange(change)
+		if err == nil {
+			_, err = writer.Write(data)
+		}
+		return err
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), l.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// continue appending to the new file
+	if _, err := tmp.Seek(0, io.SeekEnd); err != nil {
+		tmp.Close()
+		return err
+	}
+	l.file.Close()
+	l.file = tmp
+	return syncDir(filepath.Dir(l.path))
+}
+
+// read decodes the complete changes of the file from the start,
+// calling the function with every change and the offset after
+// it. The caller holds the mutex.
+func (l *fileChangeLog) read(fn func(change Change, offset int64) error) error {
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	defer l.file.Seek(0, io.SeekEnd)
+
+	reader := bufio.NewReader(l.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// incomplete last line
+			return nil
+		} else if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		cj := &changeJSON{}
+		if err := json.Unmarshal(line, cj); err != nil {
+			return fmt.Errorf("Invalid change log entry at offset %v: %v", offset - int64(len(line)), err)
+		}
+		change := Change{Sequence: cj.Sequence}
+		if change.Added, err = statementsFromJSON(cj.Added); err != nil {
+			return err
+		}
+		if change.Removed, err = statementsFromJSON(cj.Removed); err != nil {
+			return err
+		}
+		if err := fn(change, offset); err != nil {
+			return err
+		}
+	}
+}
+
+// encodeChange encodes the change as JSON line.
+func encodeChange(change Change) ([]byte, error) {
+	cj := &changeJSON{Sequence: change.Sequence}
+	var err error
+	if cj.Added, err = statementsToJSON(change.Added); err != nil {
+		return nil, err
+	}
+	if cj.Removed, err = statementsToJSON(change.Removed); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(cj)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
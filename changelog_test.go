@@ -0,0 +1,153 @@
+package semtools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestKnowledgeBaseListen(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	a := NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("o"), nil)
+	b := NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewLocalizedLiteral("B", "en"), nil)
+	kb.Insert([]Statement{a})
+
+	changes := []Change{}
+	unlisten := kb.Listen(ChangeListenerFunc(func(change Change) {
+		changes = append(changes, change)
+	}))
+
+	kb.Insert([]Statement{a, b, b})
+	kb.Delete([]Statement{NewStatement(NewNamedNode("x"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	kb.Delete([]Statement{a})
+	if len(changes) != 2 {
+		t.Fatalf("Listen() expected 2 changes but got %v", changes)
+	}
+	if changes[0].Sequence != 2 || len(changes[0].Added) != 1 || !changes[0].Added[0].Subject().Equals(NewNamedNode("b")) || len(changes[0].Removed) != 0 {
+		t.Errorf("Listen() expected only the new statement to be added but got %v", changes[0])
+	}
+	if changes[1].Sequence != 3 || len(changes[1].Removed) != 1 || !changes[1].Removed[0].Graph().Equals(kb.DefaultGraph()) {
+		t.Errorf("Listen() expected the removed statement but got %v", changes[1])
+	}
+	if kb.Sequence() != 3 {
+		t.Errorf("Sequence() expected 3 but got %v", kb.Sequence())
+	}
+
+	unlisten()
+	kb.Insert([]Statement{a})
+	if len(changes) != 2 {
+		t.Errorf("Listen() expected no changes after removing the listener")
+	}
+
+}
+
+
+func TestChangeLog(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "changes.log")
+
+	for name, open := range map[string]func() (ChangeLog, error){
+		"memory": func() (ChangeLog, error) { return NewMemoryChangeLog(), nil },
+		"file": func() (ChangeLog, error) { return NewFileChangeLog(path, &FileChangeLogOptions{Sync: true}) },
+	} {
+		log, err := open()
+		if err != nil {
+			t.Fatalf("%v: opening change log failed: %v", name, err)
+		}
+		kb := NewKnowledgeBaseWithOptions("kb", &KnowledgeBaseOptions{ChangeLog: log})
+		kb.Insert([]Statement{
+			NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer")), nil),
+			NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewLocalizedLiteral("B", "en"), NewNamedNode("g")),
+		})
+		kb.Delete([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer")), nil)})
+		if log.LastSequence() != 2 {
+			t.Errorf("%v: LastSequence() expected 2 but got %v", name, log.LastSequence())
+		}
+		if err := log.Append(Change{Sequence: 2}); err == nil {
+			t.Errorf("%v: Append() expected to fail for out of sequence change", name)
+		}
+
+		replayed := NewKnowledgeBase("replayed")
+		if err := ReplayChanges(replayed, log, 0); err != nil || len(replayed.Statements()) != 1 || !replayed.Statements()[0].Graph().Equals(NewNamedNode("g")) {
+			t.Errorf("%v: ReplayChanges() expected 1 statement but got %v (%v)", name, replayed.Statements(), err)
+		}
+		replayed = NewKnowledgeBase("replayed")
+		if err := ReplayChanges(replayed, log, 2); err != nil || len(replayed.Statements()) != 0 {
+			t.Errorf("%v: ReplayChanges() from 2 expected no statements but got %v (%v)", name, replayed.Statements(), err)
+		}
+		log.Close()
+	}
+
+	// reopening continues the sequence and drops incomplete changes
+	file, _ := os.OpenFile(path, os.O_WRONLY | os.O_APPEND, 0644)
+	file.WriteString(`{"sequence": 3, "added": [[{"type": "iri", "val`)
+	file.Close()
+	log, err := NewFileChangeLog(path, nil)
+	if err != nil {
+		t.Fatalf("NewFileChangeLog() failed: %v", err)
+	}
+	defer log.Close()
+	kb := NewKnowledgeBaseWithOptions("kb", &KnowledgeBaseOptions{ChangeLog: log})
+	if kb.Sequence() != 2 {
+		t.Errorf("Sequence() expected to continue the log but got %v", kb.Sequence())
+	}
+	kb.Insert([]Statement{NewStatement(NewNamedNode("c"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	sequences := []uint64{}
+	log.Replay(0, func(change Change) error {
+		sequences = append(sequences, change.Sequence)
+		return nil
+	})
+	if len(sequences) != 3 || sequences[2] != 3 {
+		t.Errorf("Replay() expected sequences 1 to 3 but got %v", sequences)
+	}
+
+	ioutil.WriteFile(path, []byte("{invalid}\n"), 0644)
+	if _, err := NewFileChangeLog(path, nil); err == nil {
+		t.Errorf("NewFileChangeLog() expected to fail for corrupt log")
+	}
+
+}
+
+
+func TestKnowledgeBaseChangeLogErrors(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	log, err := NewFileChangeLog(filepath.Join(dir, "changes.log"), nil)
+	if err != nil {
+		t.Fatalf("NewFileChangeLog() failed: %v", err)
+	}
+	kb := NewKnowledgeBaseWithOptions("kb", &KnowledgeBaseOptions{ChangeLog: log}).(ChangeLoggingKnowledgeBase)
+	kb.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	if kb.Err() != nil {
+		t.Errorf("Err() expected no error but got %v", kb.Err())
+	}
+
+	// changes are applied even if the log fails
+	log.Close()
+	kb.Insert([]Statement{NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	if kb.Err() == nil || len(kb.Statements()) != 2 || kb.Sequence() != 2 {
+		t.Errorf("Err() expected the error of the closed log but got %v (%v)", kb.Err(), kb.Statements())
+	}
+
+}
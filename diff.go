@@ -0,0 +1,233 @@
+package semtools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+
+// Diff returns the statements that have to be added to and removed
+// from the knowledge base a to obtain the knowledge base b. The
+// statements of the default graphs are compared with each other,
+// blank nodes are matched as by DiffStatements().
+//
+// Usage
+//
+//     change := Diff(before, after)
+//     err := ApplyPatch(other, NewPatch(change))
+func Diff(a KnowledgeBase, b KnowledgeBase) Change {
+	to := []Statement{}
+	for _, stmt := range b.Statements() {
+		if stmt.Graph() != nil && stmt.Graph().Equals(b.DefaultGraph()) {
+			stmt = withGraph([]Statement{stmt}, a.DefaultGraph())[0]
+		}
+		to = append(to, stmt)
+	}
+	return DiffStatements(a.Statements(), to)
+}
+
+// DiffStatements returns the statements that have to be added to
+// and removed from the statements from to obtain the statements to,
+// in the order of the statements. The labels of blank nodes are
+// ignored: blank nodes of both sides are matched by the statements
+// they occur in (including the blank nodes they are connected to),
+// so relabeled but otherwise equal statements have no differences.
+// The statements of a blank node that changed are all removed and
+// added again. Added statements use the labels of the matching blank
+// nodes of from, the labels of new blank nodes are changed if they
+// are used by from already.
+func DiffStatements(from []Statement, to []Statement) Change {
+
+	// pair the blank nodes of equal signatures, automorphic
+	// blank nodes are paired by their labels
+	fromSignatures := blankNodeSignatures(from)
+	toSignatures := blankNodeSignatures(to)
+	candidates := map[string][]string{}
+	used := map[string]bool{}
+	for _, label := range sortedKeys(fromSignatures) {
+		candidates[fromSignatures[label]] = append(candidates[fromSignatures[label]], label)
+		used[label] = true
+	}
+	labels := map[string]string{}
+	unmatched := []string{}
+	for _, label := range sortedKeys(toSignatures) {
+		if c := candidates[toSignatures[label]]; len(c) > 0 {
+			labels[label] = c[0]
+			candidates[toSignatures[label]] = c[1:]
+		} else {
+			unmatched = append(unmatched, label)
+		}
+	}
+	counter := 0
+	for _, label := range unmatched {
+		relabeled := label
+		for used[relabeled] {
+			counter++
+			relabeled = "_:d" + strconv.Itoa(counter)
+		}
+		labels[label] = relabeled
+		used[relabeled] = true
+	}
+
+	relabeled := make([]Statement, len(to))
+	for idx, stmt := range to {
+		relabeled[idx] = relabelStatement(stmt, labels)
+	}
+	return compareStatements(from, relabeled)
+
+}
+
+// compareStatements returns the statements that have to be added
+// and removed to get from the statements from to the statements to,
+// comparing them by their keys as they are.
+func compareStatements(from []Statement, to []Statement) Change {
+	fromKeys := map[string]bool{}
+	for _, stmt := range from {
+		fromKeys[statementKey(stmt)] = true
+	}
+	toKeys := map[string]bool{}
+	change := Change{Added: []Statement{}, Removed: []Statement{}}
+	for _, stmt := range to {
+		key := statementKey(stmt)
+		if !toKeys[key] && !fromKeys[key] {
+			change.Added = append(change.Added, stmt)
+		}
+		toKeys[key] = true
+	}
+	for _, stmt := range from {
+		key := statementKey(stmt)
+		if !toKeys[key] {
+			change.Removed = append(change.Removed, stmt)
+			toKeys[key] = true
+		}
+	}
+	return change
+}
+
+// blankNodeSignatures assigns the blank nodes of the statements a
+// signature that is independent of their labels. The signatures are
+// derived from the statements a blank node occurs in and refined with
+// the signatures of the blank nodes it is connected to, until they
+// don't distinguish further blank nodes.
+func blankNodeSignatures(stmts []Statement) map[string]string {
+	occurrences := map[string][]Statement{}
+	for _, stmt := range stmts {
+		seen := map[string]bool{}
+		for _, n := range []Node{stmt.Subject(), stmt.Object(), stmt.Graph()} {
+			for _, label := range blankNodeLabels(n) {
+				if !seen[label] {
+					occurrences[label] = append(occurrences[label], stmt)
+					seen[label] = true
+				}
+			}
+		}
+	}
+
+	signatures := map[string]string{}
+	for label := range occurrences {
+		signatures[label] = ""
+	}
+	classes := 0
+	for round := 0; round <= len(signatures); round++ {
+		refined := map[string]string{}
+		distinct := map[string]bool{}
+		for label, stmts := range occurrences {
+			keys := []string{}
+			for _, stmt := range stmts {
+				key := []string{}
+				for _, n := range []Node{stmt.Subject(), stmt.Predicate(), stmt.Object(), stmt.Graph()} {
+					key = append(key, formatBlankNode(n, label, signatures))
+				}
+				keys = append(keys, strings.Join(key, " "))
+			}
+			sort.Strings(keys)
+			hash := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+			refined[label] = hex.EncodeToString(hash[:])
+			distinct[refined[label]] = true
+		}
+		signatures = refined
+		if len(distinct) == classes {
+			break
+		}
+		classes = len(distinct)
+	}
+	return signatures
+}
+
+// blankNodeLabels returns the labels of the blank nodes of the
+// node, including the ones within quoted triples.
+func blankNodeLabels(n Node) []string {
+	if qt, ok := n.(QuotedTriple); ok {
+		return append(append(blankNodeLabels(qt.Subject()), blankNodeLabels(qt.Predicate())...), blankNodeLabels(qt.Object())...)
+	}
+	if IsBlankNode(n) {
+		return []string{n.(NamedNode).Iri()}
+	}
+	return nil
+}
+
+// formatBlankNode formats the node as seen from the blank node of
+// the label, with other blank nodes replaced by their signatures.
+func formatBlankNode(n Node, label string, signatures map[string]string) string {
+	if qt, ok := n.(QuotedTriple); ok {
+		return "<< " + formatBlankNode(qt.Subject(), label, signatures) + " " + formatBlankNode(qt.Predicate(), label, signatures) + " " + formatBlankNode(qt.Object(), label, signatures) + " >>"
+	}
+	if !IsBlankNode(n) {
+		return termKey(n)
+	}
+	if n.(NamedNode).Iri() == label {
+		return "_:self"
+	}
+	return "_:" + signatures[n.(NamedNode).Iri()]
+}
+
+// relabelStatement returns the statement with its blank nodes
+// relabeled, the statement is returned as it is if no blank node
+// has a new label.
+func relabelStatement(stmt Statement, labels map[string]string) Statement {
+	nodes := []Node{stmt.Subject(), stmt.Predicate(), stmt.Object(), stmt.Graph()}
+	changed := false
+	for idx, n := range nodes {
+		if relabeled := relabelNode(n, labels); relabeled != n {
+			nodes[idx] = relabeled
+			changed = true
+		}
+	}
+	if !changed {
+		return stmt
+	}
+	graph, _ := nodes[3].(NamedNode)
+	return withMetadata(NewStatement(nodes[0].(NamedNode), nodes[1].(NamedNode), nodes[2], graph), MetadataOf(stmt))
+}
+
+// relabelNode returns the node with its blank nodes relabeled, or
+// the node itself if nothing changed.
+func relabelNode(n Node, labels map[string]string) Node {
+	if qt, ok := n.(QuotedTriple); ok {
+		s, p, o := relabelNode(qt.Subject(), labels), relabelNode(qt.Predicate(), labels), relabelNode(qt.Object(), labels)
+		if s == Node(qt.Subject()) && p == Node(qt.Predicate()) && o == qt.Object() {
+			return n
+		}
+		return NewQuotedTriple(s.(NamedNode), p.(NamedNode), o)
+	}
+	if !IsBlankNode(n) {
+		return n
+	}
+	if label, ok := labels[n.(NamedNode).Iri()]; ok && label != n.(NamedNode).Iri() {
+		return NewNamedNode(label)
+	}
+	return n
+}
+
+// sortedKeys returns the sorted keys of the map.
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
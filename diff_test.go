@@ -0,0 +1,103 @@
+package semtools
+
+import (
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestDiff(t *testing.T) {
+
+	a := NewKnowledgeBase("a")
+	a.Insert([]Statement{
+		NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewNamedNode("o"), nil),
+		NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewNamedNode("removed"), nil),
+		NewStatement(NewNamedNode("s"), NewNamedNode("address"), NewNamedNode("_:a1"), nil),
+		NewStatement(NewNamedNode("_:a1"), NewNamedNode("city"), NewLocalizedLiteral("Berlin", "de"), nil),
+		NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewNamedNode("o"), NewNamedNode("g")),
+	})
+	b := NewKnowledgeBaseWithOptions("b", &KnowledgeBaseOptions{DefaultGraph: NewNamedNode("other-default")})
+	b.Insert([]Statement{
+		NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewNamedNode("o"), nil),
+		NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewNamedNode("added"), nil),
+		NewStatement(NewNamedNode("s"), NewNamedNode("address"), NewNamedNode("_:x"), nil),
+		NewStatement(NewNamedNode("_:x"), NewNamedNode("city"), NewLocalizedLiteral("Berlin", "de"), nil),
+		NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewNamedNode("o"), NewNamedNode("g")),
+	})
+
+	change := Diff(a, b)
+	if len(change.Added) != 1 || !change.Added[0].Equals(NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewNamedNode("added"), a.DefaultGraph())) {
+		t.Errorf("Diff() expected the added statement in the default graph but got %v", change.Added)
+	}
+	if len(change.Removed) != 1 || !change.Removed[0].Object().Equals(NewNamedNode("removed")) {
+		t.Errorf("Diff() expected the removed statement but got %v", change.Removed)
+	}
+	if change := Diff(a, a); len(change.Added) != 0 || len(change.Removed) != 0 {
+		t.Errorf("Diff() expected no differences of equal knowledge bases but got %v", change)
+	}
+
+	// literals with values of different kinds differ
+	integer := NewNamedNode(xsdNamespace + "integer")
+	c := NewKnowledgeBase("c")
+	c.Insert([]Statement{NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewTypedLiteral(1, integer), nil)})
+	d := NewKnowledgeBase("d")
+	d.Insert([]Statement{NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewTypedLiteral("1", integer), nil)})
+	if change := Diff(c, d); len(change.Added) != 1 || len(change.Removed) != 1 {
+		t.Errorf("Diff() expected values of different kinds to differ but got %v", change)
+	}
+
+}
+
+
+func TestDiffStatementsBlankNodes(t *testing.T) {
+
+	// two blank nodes, which are only distinguished by
+	// the blank nodes they are connected to
+	from := []Statement{
+		NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewNamedNode("_:a"), nil),
+		NewStatement(NewNamedNode("_:a"), NewNamedNode("next"), NewNamedNode("_:b"), nil),
+		NewStatement(NewNamedNode("_:b"), NewNamedNode("value"), NewLocalizedLiteral("1", "en"), nil),
+		NewStatement(NewNamedNode("_:c"), NewNamedNode("next"), NewNamedNode("_:d"), nil),
+		NewStatement(NewNamedNode("_:d"), NewNamedNode("value"), NewLocalizedLiteral("2", "en"), nil),
+		NewStatement(NewQuotedTriple(NewNamedNode("_:a"), NewNamedNode("next"), NewNamedNode("_:b")), NewNamedNode("certainty"), NewLocalizedLiteral("high", "en"), nil),
+	}
+	to := []Statement{
+		NewStatement(NewNamedNode("_:c"), NewNamedNode("next"), NewNamedNode("_:a"), nil),
+		NewStatement(NewNamedNode("_:a"), NewNamedNode("value"), NewLocalizedLiteral("1", "en"), nil),
+		NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewNamedNode("_:c"), nil),
+		NewStatement(NewNamedNode("_:b"), NewNamedNode("next"), NewNamedNode("_:d"), nil),
+		NewStatement(NewNamedNode("_:d"), NewNamedNode("value"), NewLocalizedLiteral("2", "en"), nil),
+		NewStatement(NewQuotedTriple(NewNamedNode("_:c"), NewNamedNode("next"), NewNamedNode("_:a")), NewNamedNode("certainty"), NewLocalizedLiteral("high", "en"), nil),
+	}
+	if change := DiffStatements(from, to); len(change.Added) != 0 || len(change.Removed) != 0 {
+		t.Errorf("DiffStatements() expected relabeled blank nodes to be equal but got %v", change)
+	}
+
+	// a changed blank node (and the one connected to it) is
+	// removed and added, the new blank nodes mustn't reuse the
+	// labels of the old statements
+	to[4] = NewStatement(NewNamedNode("_:d"), NewNamedNode("value"), NewLocalizedLiteral("3", "en"), nil)
+	change := DiffStatements(from, to)
+	if len(change.Added) != 2 || len(change.Removed) != 2 {
+		t.Fatalf("DiffStatements() expected the statements of the changed blank node but got %v", change)
+	}
+	if !change.Removed[0].Equals(from[3]) || !change.Removed[1].Equals(from[4]) {
+		t.Errorf("DiffStatements() expected to remove %v but got %v", from[3:5], change.Removed)
+	}
+	added := change.Added[1].Subject()
+	if !IsBlankNode(added) || added.Iri() == "_:d" || change.Added[0].Subject().Iri() == "_:c" || !change.Added[0].Object().Equals(added) {
+		t.Errorf("DiffStatements() expected the blank nodes to be relabeled but got %v", change.Added)
+	}
+
+	if IsBlankNode(NewNamedNode("http://example.com/a")) || IsBlankNode(NewLocalizedLiteral("_:a", "en")) || !IsBlankNode(NewNamedNode("_:a")) {
+		t.Errorf("IsBlankNode() expected only named nodes with blank node labels to be blank nodes")
+	}
+
+}
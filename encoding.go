@@ -0,0 +1,603 @@
+package semtools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// nodeJSON is the JSON representation of a node, it is used
+// wherever nodes have to be encoded into a portable format.
+type nodeJSON struct {
+	Type string `json:"type"`
+	Value string `json:"value"`
+	Language string `json:"language,omitempty"`
+	Datatype string `json:"datatype,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	Metadata map[string]*nodeJSON `json:"metadata,omitempty"`
+	Triple []*nodeJSON `json:"triple,omitempty"`
+}
+
+// nodeToJSON creates the JSON representation of a node. Typed
+// literals are encoded by their lexical form and the kind of
+// their go value.
+func nodeToJSON(n Node) (*nodeJSON, error) {
+	switch v := n.(type) {
+	case nil:
+		return nil, nil
+	case Parameter:
+		return &nodeJSON{Type: nodeParameterType, Value: v.Name()}, nil
+	case QuotedTriple:
+		triple := []*nodeJSON{}
+		for _, n := range []Node{v.Subject(), v.Predicate(), v.Object()} {
+			encoded, err := nodeToJSON(n)
+			if err != nil {
+				return nil, err
+			}
+			triple = append(triple, encoded)
+		}
+		return &nodeJSON{Type: "triple", Triple: triple}, nil
+	case NamedNode:
+		return &nodeJSON{Type: "iri", Value: v.Iri()}, nil
+	case LocalizedLiteral:
+		return &nodeJSON{Type: "literal", Value: v.String(), Language: v.Language()}, nil
+	case TypedLiteral:
+		datatype := ""
+		if v.Type() != nil {
+			datatype = v.Type().Iri()
+		}
+		kind, lexical := literalValueKind(v.Value())
+		return &nodeJSON{Type: "typed-literal", Value: lexical, Datatype: datatype, Kind: kind}, nil
+	}
+	return nil, fmt.Errorf("Unable to encode Node '%v'", n)
+}
+
+// nodeFromJSON creates the node from its JSON representation.
+func nodeFromJSON(n *nodeJSON) (Node, error) {
+	if n == nil {
+		return nil, nil
+	}
+	switch n.Type {
+	case "iri":
+		return NewNamedNode(n.Value), nil
+	case nodeParameterType:
+		return NewParameter(n.Value), nil
+	case "triple":
+		if len(n.Triple) != 3 {
+			return nil, fmt.Errorf("Unable to decode quoted triple of %v nodes", len(n.Triple))
+		}
+		nodes := make([]Node, 3)
+		for idx, t := range n.Triple {
+			var err error
+			if nodes[idx], err = nodeFromJSON(t); err != nil {
+				return nil, err
+			}
+		}
+		subject, sok := nodes[0].(NamedNode)
+		predicate, pok := nodes[1].(NamedNode)
+		if !sok || !pok || nodes[2] == nil {
+			return nil, fmt.Errorf("Unable to decode quoted triple, subject and predicate have to be named nodes")
+		}
+		return NewQuotedTriple(subject, predicate, nodes[2]), nil
+	case "literal":
+		return NewLocalizedLiteral(n.Value, n.Language), nil
+	case "typed-literal":
+		var datatype NamedNode
+		if n.Datatype != "" {
+			datatype = NewNamedNode(n.Datatype)
+		}
+		value, err := parseLiteralValue(n.Kind, n.Value)
+		if err != nil {
+			return nil, err
+		}
+		return NewTypedLiteral(value, datatype), nil
+	}
+	return nil, fmt.Errorf("Unable to decode Node of type '%v'", n.Type)
+}
+
+// literalValueKind returns the kind of the go value of a typed
+// literal and its lexical form, from which parseLiteralValue()
+// recreates the value. Strings and values of other types have
+// no kind, the latter are recreated as strings.
+func literalValueKind(value interface{}) (string, string) {
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64:
+		return fmt.Sprintf("%T", v), fmt.Sprintf("%d", v)
+	case uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%T", v), fmt.Sprintf("%d", v)
+	case float32:
+		return "float32", strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return "float64", strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return "bool", strconv.FormatBool(v)
+	case time.Time:
+		return "time", v.Format(time.RFC3339Nano)
+	case string:
+		return "", v
+	}
+	return "", fmt.Sprintf("%v", value)
+}
+
+// termKey returns the key of the node in the term dictionaries
+// of the stores, which extends formatNode() by the kind of the go
+// value of typed literals, so literals with the same lexical form
+// but values of different kinds get their own terms.
+func termKey(n Node) string {
+	key := formatNode(n)
+	if kind := nodeValueKind(n); kind != "" {
+		key += "/" + kind
+	}
+	return key
+}
+
+// nodeValueKind returns the kind of the go value of typed literals,
+// quoted triples have the kinds of their nodes if there are any.
+func nodeValueKind(n Node) string {
+	switch v := n.(type) {
+	case QuotedTriple:
+		kinds := []string{nodeValueKind(v.Subject()), nodeValueKind(v.Predicate()), nodeValueKind(v.Object())}
+		if kinds[0] == "" && kinds[1] == "" && kinds[2] == "" {
+			return ""
+		}
+		return "(" + strings.Join(kinds, ",") + ")"
+	case TypedLiteral:
+		kind, _ := literalValueKind(v.Value())
+		return kind
+	}
+	return ""
+}
+
+// parseLiteralValue creates the go value of the kind from its
+// lexical form, see literalValueKind().
+func parseLiteralValue(kind string, lexical string) (interface{}, error) {
+	var value interface{}
+	var err error
+	var i int64
+	var u uint64
+	var f float64
+	switch kind {
+	case "":
+		return lexical, nil
+	case "int":
+		i, err = strconv.ParseInt(lexical, 10, strconv.IntSize)
+		value = int(i)
+	case "int8":
+		i, err = strconv.ParseInt(lexical, 10, 8)
+		value = int8(i)
+	case "int16":
+		i, err = strconv.ParseInt(lexical, 10, 16)
+		value = int16(i)
+	case "int32":
+		i, err = strconv.ParseInt(lexical, 10, 32)
+		value = int32(i)
+	case "int64":
+		value, err = strconv.ParseInt(lexical, 10, 64)
+	case "uint":
+		u, err = strconv.ParseUint(lexical, 10, strconv.IntSize)
+		value = uint(u)
+	case "uint8":
+		u, err = strconv.ParseUint(lexical, 10, 8)
+		value = uint8(u)
+	case "uint16":
+		u, err = strconv.ParseUint(lexical, 10, 16)
+		value = uint16(u)
+	case "uint32":
+		u, err = strconv.ParseUint(lexical, 10, 32)
+		value = uint32(u)
+	case "uint64":
+		value, err = strconv.ParseUint(lexical, 10, 64)
+	case "float32":
+		f, err = strconv.ParseFloat(lexical, 32)
+		value = float32(f)
+	case "float64":
+		value, err = strconv.ParseFloat(lexical, 64)
+	case "bool":
+		value, err = strconv.ParseBool(lexical)
+	case "time":
+		value, err = time.Parse(time.RFC3339Nano, lexical)
+	default:
+		return nil, fmt.Errorf("Unable to decode literal value of kind '%v'", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode literal value '%v' of kind '%v'", lexical, kind)
+	}
+	return value, nil
+}
+
+// statementToJSON creates the JSON representation of a statement,
+// the nodes of its subject, predicate, object and graph followed
+// by its metadata if there is any.
+func statementToJSON(stmt Statement) ([]*nodeJSON, error) {
+	nodes := []*nodeJSON{}
+	for _, p := range []Position{SubjectPosition, PredicatePosition, ObjectPosition, GraphPosition} {
+		n, err := nodeToJSON(p.Of(stmt))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if metadata := MetadataOf(stmt); metadata != nil {
+		encoded, err := metadataToJSON(metadata)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, encoded)
+	}
+	return nodes, nil
+}
+
+// statementFromJSON creates the statement from its JSON
+// representation.
+func statementFromJSON(encoded []*nodeJSON) (Statement, error) {
+	if len(encoded) == 5 && encoded[4] != nil && encoded[4].Type == nodeMetadataType {
+		stmt, err := statementFromJSON(encoded[:4])
+		if err != nil {
+			return nil, err
+		}
+		metadata, err := metadataFromJSON(encoded[4])
+		if err != nil {
+			return nil, err
+		}
+		return withMetadata(stmt, metadata), nil
+	}
+	if len(encoded) != 4 {
+		return nil, fmt.Errorf("Unable to decode Statement of %v nodes", len(encoded))
+	}
+	nodes := make([]Node, 4)
+	for idx, n := range encoded {
+		var err error
+		if nodes[idx], err = nodeFromJSON(n); err != nil {
+			return nil, err
+		}
+	}
+	subject, sok := nodes[0].(NamedNode)
+	predicate, pok := nodes[1].(NamedNode)
+	graph, gok := nodes[3].(NamedNode)
+	if !sok || !pok || (!gok && nodes[3] != nil) {
+		return nil, fmt.Errorf("Unable to decode Statement, subject, predicate and graph have to be named nodes")
+	}
+	return NewStatement(subject, predicate, nodes[2], graph), nil
+}
+
+// metadataToJSON creates the JSON representation of the metadata
+// of a statement.
+func metadataToJSON(metadata Metadata) (*nodeJSON, error) {
+	encoded := &nodeJSON{Type: nodeMetadataType, Metadata: map[string]*nodeJSON{}}
+	for k, v := range metadata {
+		n, err := nodeToJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Metadata[k] = n
+	}
+	return encoded, nil
+}
+
+// metadataFromJSON creates the metadata of a statement from its
+// JSON representation.
+func metadataFromJSON(encoded *nodeJSON) (Metadata, error) {
+	metadata := Metadata{}
+	for k, v := range encoded.Metadata {
+		var err error
+		if metadata[k], err = nodeFromJSON(v); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// statementsToJSON creates the JSON representation of the
+// statements.
+func statementsToJSON(stmts []Statement) ([][]*nodeJSON, error) {
+	res := make([][]*nodeJSON, len(stmts))
+	for idx, stmt := range stmts {
+		var err error
+		if res[idx], err = statementToJSON(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// statementsFromJSON creates the statements from their JSON
+// representation.
+func statementsFromJSON(encoded [][]*nodeJSON) ([]Statement, error) {
+	res := make([]Statement, len(encoded))
+	for idx, e := range encoded {
+		var err error
+		if res[idx], err = statementFromJSON(e); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// nodeParameterType is the JSON type of parameters.
+const nodeParameterType = "parameter"
+
+// nodeMetadataType is the JSON type of the metadata following
+// the nodes of a statement.
+const nodeMetadataType = "metadata"
+
+// expressionJSON is the JSON representation of an expression.
+type expressionJSON struct {
+	Type string `json:"type"`
+	Position string `json:"position,omitempty"`
+	Node *nodeJSON `json:"node,omitempty"`
+	Operator FilterOperator `json:"operator,omitempty"`
+	Argument *nodeJSON `json:"argument,omitempty"`
+	Operands []*expressionJSON `json:"operands,omitempty"`
+	Operand *expressionJSON `json:"operand,omitempty"`
+}
+
+// orderingJSON is the JSON representation of an ordering.
+type orderingJSON struct {
+	Position string `json:"position"`
+	Descending bool `json:"descending,omitempty"`
+}
+
+// queryJSON is the JSON representation of a query, the
+// expression and its solution modifiers.
+type queryJSON struct {
+	Where *expressionJSON `json:"where"`
+	OrderBy []orderingJSON `json:"orderBy,omitempty"`
+	GroupBy []string `json:"groupBy,omitempty"`
+	Limit *int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
+	After string `json:"after,omitempty"`
+	MaxResults int `json:"maxResults,omitempty"`
+	MaxScanned int `json:"maxScanned,omitempty"`
+}
+
+// MarshalExpression encodes the expression tree as JSON.
+func MarshalExpression(expr Expression) ([]byte, error) {
+	e, err := expressionToJSON(expr)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// UnmarshalExpression decodes an expression tree from the JSON
+// created by MarshalExpression().
+func UnmarshalExpression(data []byte) (Expression, error) {
+	e := &expressionJSON{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	return expressionFromJSON(e)
+}
+
+// NewQueryFromJSON creates a new query from the JSON created by
+// marshalling a Query. The query can be extended and bound like
+// any other query.
+func NewQueryFromJSON(data []byte) (Query, error) {
+	qj := &queryJSON{}
+	if err := json.Unmarshal(data, qj); err != nil {
+		return nil, err
+	}
+	if qj.Where == nil {
+		return nil, fmt.Errorf("Query requires an expression")
+	}
+	expr, err := expressionFromJSON(qj.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	q := newExpressionQuery(expr)
+	for _, o := range qj.OrderBy {
+		position, err := positionFromString(o.Position)
+		if err != nil {
+			return nil, err
+		}
+		q.orderings = append(q.orderings, Ordering{Position: position, Descending: o.Descending})
+	}
+	for _, g := range qj.GroupBy {
+		position, err := positionFromString(g)
+		if err != nil {
+			return nil, err
+		}
+		q.groupBy = append(q.groupBy, position)
+	}
+	if qj.Limit != nil {
+		q.Limit(*qj.Limit)
+	}
+	q.Offset(qj.Offset)
+	if qj.After != "" {
+		q.After(qj.After)
+	}
+	q.MaxResults(qj.MaxResults)
+	q.MaxScanned(qj.MaxScanned)
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// queryToJSON creates the JSON representation of the root query.
+func queryToJSON(q *query) (*queryJSON, error) {
+	expr, err := q.build()
+	if err != nil {
+		return nil, err
+	}
+	where, err := expressionToJSON(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	qj := &queryJSON{
+		Where: where,
+		Offset: q.offset,
+		MaxResults: q.maxResults,
+		MaxScanned: q.maxScanned,
+	}
+	for _, o := range q.orderings {
+		qj.OrderBy = append(qj.OrderBy, orderingJSON{Position: o.Position.String(), Descending: o.Descending})
+	}
+	for _, g := range q.groupBy {
+		qj.GroupBy = append(qj.GroupBy, g.String())
+	}
+	if q.limit >= 0 {
+		limit := q.limit
+		qj.Limit = &limit
+	}
+	if q.after != nil {
+		qj.After = CursorOf(q.after)
+	}
+	return qj, nil
+}
+
+// expressionToJSON creates the JSON representation of an
+// expression, plan nodes are encoded by their expression.
+func expressionToJSON(expr Expression) (*expressionJSON, error) {
+	switch e := expr.(type) {
+	case *TrueExpression:
+		return &expressionJSON{Type: "true"}, nil
+	case *PatternExpression:
+		n, err := nodeToJSON(e.Node)
+		if err != nil {
+			return nil, err
+		}
+		return &expressionJSON{Type: "pattern", Position: e.Position.String(), Node: n}, nil
+	case *FilterExpression:
+		n, err := nodeToJSON(e.Argument)
+		if err != nil {
+			return nil, err
+		}
+		return &expressionJSON{Type: "filter", Position: e.Position.String(), Operator: e.Operator, Argument: n}, nil
+	case *AndExpression:
+		operands, err := expressionsToJSON(e.Operands)
+		return &expressionJSON{Type: "and", Operands: operands}, err
+	case *OrExpression:
+		operands, err := expressionsToJSON(e.Operands)
+		return &expressionJSON{Type: "or", Operands: operands}, err
+	case *NotExpression:
+		operand, err := expressionToJSON(e.Operand)
+		return &expressionJSON{Type: "not", Operand: operand}, err
+	case *QuotedExpression:
+		operand, err := expressionToJSON(e.Expression)
+		return &expressionJSON{Type: "quoted", Position: e.Position.String(), Operand: operand}, err
+	case *MetadataExpression:
+		n, err := nodeToJSON(e.Predicate)
+		if err != nil {
+			return nil, err
+		}
+		operand, err := expressionToJSON(e.Expression)
+		return &expressionJSON{Type: "metadata", Node: n, Operand: operand}, err
+	case *PlanNode:
+		return expressionToJSON(e.Expression)
+	}
+	return nil, fmt.Errorf("Unable to encode Expression '%v'", expr)
+}
+
+func expressionsToJSON(exprs []Expression) ([]*expressionJSON, error) {
+	res := make([]*expressionJSON, len(exprs))
+	for idx, e := range exprs {
+		var err error
+		if res[idx], err = expressionToJSON(e); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// expressionFromJSON creates the expression from its JSON
+// representation, validating filters.
+func expressionFromJSON(e *expressionJSON) (Expression, error) {
+	if e == nil {
+		return nil, fmt.Errorf("Missing expression")
+	}
+	switch e.Type {
+	case "true":
+		return &TrueExpression{}, nil
+	case "pattern":
+		position, err := positionFromString(e.Position)
+		if err != nil {
+			return nil, err
+		}
+		n, err := nodeFromJSON(e.Node)
+		if err != nil {
+			return nil, err
+		}
+		return &PatternExpression{Position: position, Node: n}, nil
+	case "filter":
+		position, err := positionFromString(e.Position)
+		if err != nil {
+			return nil, err
+		}
+		n, err := nodeFromJSON(e.Argument)
+		if err != nil {
+			return nil, err
+		}
+		return NewFilterExpression(position, e.Operator, n)
+	case "and":
+		operands, err := expressionsFromJSON(e.Operands)
+		if err != nil {
+			return nil, err
+		}
+		return &AndExpression{Operands: operands}, nil
+	case "or":
+		operands, err := expressionsFromJSON(e.Operands)
+		if err != nil {
+			return nil, err
+		}
+		return &OrExpression{Operands: operands}, nil
+	case "not":
+		operand, err := expressionFromJSON(e.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpression{Operand: operand}, nil
+	case "quoted":
+		position, err := positionFromString(e.Position)
+		if err != nil {
+			return nil, err
+		}
+		operand, err := expressionFromJSON(e.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return &QuotedExpression{Position: position, Expression: operand}, nil
+	case "metadata":
+		n, err := nodeFromJSON(e.Node)
+		if err != nil {
+			return nil, err
+		}
+		predicate, ok := n.(NamedNode)
+		if !ok {
+			return nil, fmt.Errorf("Unable to decode Expression, metadata requires a named node as predicate")
+		}
+		operand, err := expressionFromJSON(e.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return &MetadataExpression{Predicate: predicate, Expression: operand}, nil
+	}
+	return nil, fmt.Errorf("Unable to decode Expression of type '%v'", e.Type)
+}
+
+func expressionsFromJSON(exprs []*expressionJSON) ([]Expression, error) {
+	res := make([]Expression, len(exprs))
+	for idx, e := range exprs {
+		var err error
+		if res[idx], err = expressionFromJSON(e); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// positionFromString returns the position of the name
+// created by Position.String().
+func positionFromString(str string) (Position, error) {
+	for _, p := range []Position{SubjectPosition, PredicatePosition, ObjectPosition, GraphPosition} {
+		if p.String() == str {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown position '%v'", str)
+}
@@ -0,0 +1,142 @@
+package semtools
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestQueryJSON(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("label"), NewLocalizedLiteral("Alpha", "en"), nil),
+		NewStatement(NewNamedNode("b"), NewNamedNode("label"), NewLocalizedLiteral("Beta", "de"), nil),
+		NewStatement(NewNamedNode("c"), NewNamedNode("label"), NewLocalizedLiteral("Gamma", "en"), nil),
+		NewStatement(NewNamedNode("c"), NewNamedNode("other"), NewNamedNode("x"), nil),
+	})
+
+	q := NewQuery().
+		Predicate(NewNamedNode("label")).
+		Group().ObjectLanguage("en").Or().Not().ObjectContains("et").EndGroup().
+		OrderByDescending(SubjectPosition).
+		Limit(5).
+		Offset(1)
+
+	str := `(predicate = <label> AND (langMatches(object, "en"^^<http://www.w3.org/2001/XMLSchema#string>) OR NOT contains(object, "et"^^<http://www.w3.org/2001/XMLSchema#string>))) ORDER BY DESC(subject) LIMIT 5 OFFSET 1`
+	if q.String() != str {
+		t.Errorf("String() expected %v but got %v", str, q.String())
+	}
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		t.Fatalf("MarshalJSON() failed: %v", err)
+	}
+	parsed, err := NewQueryFromJSON(data)
+	if err != nil {
+		t.Fatalf("NewQueryFromJSON() failed: %v", err)
+	}
+	if parsed.String() != q.String() {
+		t.Errorf("NewQueryFromJSON() expected %v but got %v", q, parsed)
+	}
+	res := parsed.Bind(kb).Results()
+	if len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("a")) {
+		t.Errorf("Results() of parsed query expected [a] but got %v", res)
+	}
+
+	// parsed queries can be extended
+	if n := parsed.Limit(-1).Offset(0).Not().Subject(NewNamedNode("c")).Count(); n != 1 {
+		t.Errorf("Count() of extended query expected 1 but got %v", n)
+	}
+
+	// parameters and cursors
+	q = NewQuery().Subject(NewParameter("s")).OrderBy(ObjectPosition).After(CursorOf(res[0]))
+	data, _ = json.Marshal(q)
+	if parsed, err = NewQueryFromJSON(data); err != nil || parsed.String() != q.String() {
+		t.Errorf("NewQueryFromJSON() fails to decode parameters and cursors: %v (%v)", parsed, err)
+	}
+
+	for _, invalid := range []string{
+		`{}`,
+		`{"where": {"type": "unknown"}}`,
+		`{"where": {"type": "pattern", "position": "nowhere"}}`,
+		`{"where": {"type": "filter", "position": "object", "operator": "<", "argument": {"type": "iri", "value": "a"}}}`,
+		`{"where": {"type": "true"}, "after": "???"}`,
+	} {
+		if _, err := NewQueryFromJSON([]byte(invalid)); err == nil {
+			t.Errorf("NewQueryFromJSON() expected to fail for %v", invalid)
+		}
+	}
+	if _, err := json.Marshal(NewQuery().Group()); err == nil {
+		t.Errorf("MarshalJSON() expected to fail for malformed query")
+	}
+
+	expr, _ := q.Expression()
+	data, err = MarshalExpression(expr)
+	if err != nil {
+		t.Fatalf("MarshalExpression() failed: %v", err)
+	}
+	if e, err := UnmarshalExpression(data); err != nil || e.String() != expr.String() {
+		t.Errorf("UnmarshalExpression() expected %v but got %v (%v)", expr, e, err)
+	}
+
+}
+
+
+func TestQueryJSONTypedLiterals(t *testing.T) {
+
+	xsdInteger := NewNamedNode(xsdNamespace + "integer")
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("age"), NewTypedLiteral(30, xsdInteger), nil),
+		NewStatement(NewNamedNode("b"), NewNamedNode("age"), NewTypedLiteral("30", xsdInteger), nil),
+		NewStatement(NewNamedNode("c"), NewNamedNode("active"), NewTypedLiteral(true, NewNamedNode(xsdNamespace + "boolean")), nil),
+		NewStatement(NewNamedNode("d"), NewNamedNode("created"), NewTypedLiteral(now, NewNamedNode(xsdNamespace + "dateTime")), nil),
+	})
+
+	for _, object := range []Node{
+		NewTypedLiteral(30, xsdInteger),
+		NewTypedLiteral("30", xsdInteger),
+		NewTypedLiteral(true, NewNamedNode(xsdNamespace + "boolean")),
+		NewTypedLiteral(now, NewNamedNode(xsdNamespace + "dateTime")),
+	} {
+		q := kb.Select().Object(object)
+		data, err := json.Marshal(q)
+		if err != nil {
+			t.Fatalf("MarshalJSON() failed: %v", err)
+		}
+		parsed, err := NewQueryFromJSON(data)
+		if err != nil {
+			t.Fatalf("NewQueryFromJSON() failed: %v", err)
+		}
+		expected := q.Results()
+		res := parsed.Bind(kb).Results()
+		if len(expected) != 1 || len(res) != 1 || !res[0].Equals(expected[0]) {
+			t.Errorf("Results() of parsed query expected %v but got %v", expected, res)
+		}
+	}
+
+	for _, value := range []interface{}{int8(-3), uint64(1 << 63), float32(0.1), 0.1, "text", false} {
+		encoded, err := nodeToJSON(NewTypedLiteral(value, nil))
+		if err != nil {
+			t.Fatalf("nodeToJSON() failed: %v", err)
+		}
+		if node, err := nodeFromJSON(encoded); err != nil || node.(TypedLiteral).Value() != value {
+			t.Errorf("nodeFromJSON() expected %T %v but got %v (%v)", value, value, node, err)
+		}
+	}
+	if _, err := nodeFromJSON(&nodeJSON{Type: "typed-literal", Value: "x", Kind: "int"}); err == nil {
+		t.Errorf("nodeFromJSON() expected an error for an invalid value")
+	}
+
+}
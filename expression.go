@@ -0,0 +1,225 @@
+package semtools
+
+import (
+	"fmt"
+	"strings"
+)
+
+
+// Position identifies one of the nodes within
+// a statement.
+type Position int
+
+const (
+	SubjectPosition Position = iota
+	PredicatePosition
+	ObjectPosition
+	GraphPosition
+)
+
+// Of returns the node of the statement at the position.
+func (p Position) Of(stmt Statement) Node {
+	switch p {
+	case SubjectPosition:
+		return nodeOrNil(stmt.Subject())
+	case PredicatePosition:
+		return nodeOrNil(stmt.Predicate())
+	case ObjectPosition:
+		return stmt.Object()
+	case GraphPosition:
+		return nodeOrNil(stmt.Graph())
+	}
+	return nil
+}
+
+// String returns the name of the position.
+func (p Position) String() string {
+	switch p {
+	case SubjectPosition:
+		return "subject"
+	case PredicatePosition:
+		return "predicate"
+	case ObjectPosition:
+		return "object"
+	case GraphPosition:
+		return "graph"
+	}
+	return fmt.Sprintf("position(%d)", int(p))
+}
+
+
+// Expression is a node of the boolean expression tree
+// that makes up a query. The tree can be inspected by
+// type switching on the concrete expression types.
+type Expression interface {
+
+	// Evaluate returns true if the statement is matched
+	// by the expression.
+	Evaluate(stmt Statement) bool
+
+	// String returns a readable version of the expression,
+	// this is meant for display/logging only.
+	String() string
+
+}
+
+// TrueExpression matches every statement, it is the
+// expression of an empty query.
+type TrueExpression struct {}
+
+func (e *TrueExpression) Evaluate(stmt Statement) bool {
+	return true
+}
+
+func (e *TrueExpression) String() string {
+	return "TRUE"
+}
+
+// PatternExpression matches statements whose node at
+// the position equals the node of the expression.
+type PatternExpression struct {
+
+	// Position is the position within the statement to match.
+	Position Position
+
+	// Node is the node to match, nil only matches statements
+	// without a node at the position (ie. without graph).
+	Node Node
+
+}
+
+func (e *PatternExpression) Evaluate(stmt Statement) bool {
+	n := e.Position.Of(stmt)
+	if n == nil || e.Node == nil {
+		return n == nil && e.Node == nil
+	}
+	return n.Equals(e.Node)
+}
+
+func (e *PatternExpression) String() string {
+	return e.Position.String() + " = " + formatNode(e.Node)
+}
+
+// AndExpression matches statements that are matched
+// by all of its operands.
+type AndExpression struct {
+	Operands []Expression
+}
+
+func (e *AndExpression) Evaluate(stmt Statement) bool {
+	for _, o := range e.Operands {
+		if !o.Evaluate(stmt) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *AndExpression) String() string {
+	return joinExpressions(e.Operands, " AND ")
+}
+
+// OrExpression matches statements that are matched
+// by at least one of its operands.
+type OrExpression struct {
+	Operands []Expression
+}
+
+func (e *OrExpression) Evaluate(stmt Statement) bool {
+	for _, o := range e.Operands {
+		if o.Evaluate(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *OrExpression) String() string {
+	return joinExpressions(e.Operands, " OR ")
+}
+
+// NotExpression negates its operand.
+type NotExpression struct {
+	Operand Expression
+}
+
+func (e *NotExpression) Evaluate(stmt Statement) bool {
+	return !e.Operand.Evaluate(stmt)
+}
+
+func (e *NotExpression) String() string {
+	return "NOT " + e.Operand.String()
+}
+
+// RewriteExpression creates a copy of the expression tree
+// replacing every expression for which the rewrite function
+// returns a non nil expression. Operands of replaced expressions
+// are not visited.
+func RewriteExpression(expr Expression, rewrite func(Expression) Expression) Expression {
+	if r := rewrite(expr); r != nil {
+		return r
+	}
+	switch e := expr.(type) {
+	case *AndExpression:
+		return &AndExpression{Operands: rewriteOperands(e.Operands, rewrite)}
+	case *OrExpression:
+		return &OrExpression{Operands: rewriteOperands(e.Operands, rewrite)}
+	case *NotExpression:
+		return &NotExpression{Operand: RewriteExpression(e.Operand, rewrite)}
+	case *MetadataExpression:
+		return &MetadataExpression{Predicate: e.Predicate, Expression: RewriteExpression(e.Expression, rewrite)}
+	case *QuotedExpression:
+		return &QuotedExpression{Position: e.Position, Expression: RewriteExpression(e.Expression, rewrite)}
+	}
+	return expr
+}
+
+func rewriteOperands(operands []Expression, rewrite func(Expression) Expression) []Expression {
+	res := make([]Expression, len(operands))
+	for idx, o := range operands {
+		res[idx] = RewriteExpression(o, rewrite)
+	}
+	return res
+}
+
+// joinExpressions creates the parenthesized string of the
+// operands joined with the operator.
+func joinExpressions(operands []Expression, op string) string {
+	strs := make([]string, len(operands))
+	for idx, o := range operands {
+		strs[idx] = o.String()
+	}
+	return "(" + strings.Join(strs, op) + ")"
+}
+
+// formatNode creates a turtle like string of the node
+// for display purposes.
+func formatNode(n Node) string {
+	switch v := n.(type) {
+	case nil:
+		return "nil"
+	case Parameter:
+		return "?" + v.Name()
+	case QuotedTriple:
+		return v.Iri()
+	case NamedNode:
+		return "<" + v.Iri() + ">"
+	case LocalizedLiteral:
+		return fmt.Sprintf("%q@%v", v.String(), v.Language())
+	case TypedLiteral:
+		if v.Type() == nil {
+			return fmt.Sprintf("%q", v.String())
+		}
+		return fmt.Sprintf("%q^^<%v>", v.String(), v.Type().Iri())
+	}
+	return n.String()
+}
+
+// nodeOrNil converts a named node into a node, keeping
+// nil interfaces nil.
+func nodeOrNil(n NamedNode) Node {
+	if n == nil {
+		return nil
+	}
+	return n
+}
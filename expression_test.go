@@ -0,0 +1,69 @@
+package semtools
+
+import (
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestPosition(t *testing.T) {
+
+	s := NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil)
+	if !SubjectPosition.Of(s).Equals(NewNamedNode("a")) || !PredicatePosition.Of(s).Equals(NewNamedNode("b")) || !ObjectPosition.Of(s).Equals(NewNamedNode("c")) {
+		t.Errorf("Of() fails to return node at position")
+	}
+	if GraphPosition.Of(s) != nil {
+		t.Errorf("Of() fails to return nil for missing graph")
+	}
+
+}
+
+
+func TestExpressionEvaluate(t *testing.T) {
+
+	s := NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil)
+	a := &PatternExpression{Position: SubjectPosition, Node: NewNamedNode("a")}
+	x := &PatternExpression{Position: SubjectPosition, Node: NewNamedNode("x")}
+
+	if !(&PatternExpression{Position: GraphPosition}).Evaluate(s) {
+		t.Errorf("PatternExpression fails to match nil graph")
+	}
+	if (&AndExpression{Operands: []Expression{a, x}}).Evaluate(s) {
+		t.Errorf("AndExpression fails to require all operands")
+	}
+	if !(&OrExpression{Operands: []Expression{a, x}}).Evaluate(s) {
+		t.Errorf("OrExpression fails to require any operand")
+	}
+	if !(&NotExpression{Operand: x}).Evaluate(s) {
+		t.Errorf("NotExpression fails to negate operand")
+	}
+
+}
+
+
+func TestRewriteExpression(t *testing.T) {
+
+	a := &PatternExpression{Position: SubjectPosition, Node: NewNamedNode("a")}
+	expr := &NotExpression{Operand: &AndExpression{Operands: []Expression{a, a}}}
+
+	res := RewriteExpression(expr, func(e Expression) Expression {
+		if _, ok := e.(*PatternExpression); ok {
+			return &TrueExpression{}
+		}
+		return nil
+	})
+	if res.String() != "NOT (TRUE AND TRUE)" {
+		t.Errorf("RewriteExpression() returned unexpected expression %v", res)
+	}
+	if expr.String() != "NOT (subject = <a> AND subject = <a>)" {
+		t.Errorf("RewriteExpression() modified the original expression")
+	}
+
+}
@@ -0,0 +1,244 @@
+package semtools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+
+// FederationSource is a store taking part in a federation. Local
+// knowledge bases take part via NewKnowledgeBaseSource, remote
+// stores can implement the interface by sending the serialized
+// query (see Query.MarshalJSON) to the remote side.
+type FederationSource interface {
+
+	// Name returns the name of the source, used as provenance
+	// of the matches.
+	Name() string
+
+	// Ask returns true if any statement of the source matches
+	// the query. It is used for source selection.
+	Ask(ctx context.Context, q Query) (bool, error)
+
+	// Select returns an iterator over the statements of the
+	// source matching the query, including its orderings, cursor
+	// and limit.
+	Select(ctx context.Context, q Query) StatementIterator
+
+}
+
+// FederatedMatch is a statement matched within a federation
+// together with the sources it was found in.
+type FederatedMatch struct {
+
+	// Statement is the matched statement.
+	Statement Statement
+
+	// Sources are the names of the sources containing the
+	// statement, in the order of the federation.
+	Sources []string
+
+}
+
+// Federation evaluates queries across several sources, merging
+// and de-duplicating their results.
+//
+// Usage
+//
+//     f := NewFederation(NewKnowledgeBaseSource(reference), NewKnowledgeBaseSource(tenant))
+//     matches, err := f.Results(ctx, NewQuery().Subject(node))
+type Federation interface {
+
+	// Sources returns the sources of the federation.
+	Sources() []FederationSource
+
+	// SelectSources returns the sources that are relevant for the
+	// query. Every pattern of the top level conjunction of the query
+	// is asked separately, a source is skipped if it lacks matches
+	// for any of them.
+	SelectSources(ctx context.Context, q Query) ([]FederationSource, error)
+
+	// Results evaluates the query on the relevant sources in
+	// parallel. Statements found in several sources are returned
+	// once with all sources as provenance. Unordered results are
+	// returned in the order of the sources, orderings, cursor,
+	// offset and limit of the query apply to the merged results.
+	Results(ctx context.Context, q Query) ([]FederatedMatch, error)
+
+}
+
+// NewFederation creates a federation of the sources.
+func NewFederation(sources ...FederationSource) Federation {
+	return &federation{sources: sources}
+}
+
+// NewKnowledgeBaseSource creates a federation source evaluating
+// queries on the knowledge base.
+func NewKnowledgeBaseSource(kb KnowledgeBase) FederationSource {
+	return &knowledgeBaseSource{kb: kb}
+}
+
+
+
+type knowledgeBaseSource struct {
+	kb KnowledgeBase
+}
+
+func (s *knowledgeBaseSource) Name() string {
+	return s.kb.Name()
+}
+
+func (s *knowledgeBaseSource) Ask(ctx context.Context, q Query) (bool, error) {
+	it := q.Bind(s.kb).Limit(1).IterateContext(ctx)
+	defer it.Close()
+	found := it.Next()
+	return found, it.Err()
+}
+
+func (s *knowledgeBaseSource) Select(ctx context.Context, q Query) StatementIterator {
+	return q.Bind(s.kb).IterateContext(ctx)
+}
+
+
+
+type federation struct {
+	sources []FederationSource
+}
+
+func (f *federation) Sources() []FederationSource {
+	return append([]FederationSource{}, f.sources...)
+}
+
+func (f *federation) SelectSources(ctx context.Context, q Query) ([]FederationSource, error) {
+	expr, err := q.Expression()
+	if err != nil {
+		return nil, err
+	}
+	return f.selectSources(ctx, expr)
+}
+
+func (f *federation) Results(ctx context.Context, q Query) ([]FederatedMatch, error) {
+	r, ok := q.(*query)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported query implementation %T", q)
+	}
+	r = r.root()
+	expr, err := r.build()
+	if err != nil {
+		return nil, err
+	}
+	sources, err := f.selectSources(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+
+	// evaluate on all sources in parallel, every source only
+	// has to deliver the results up to the end of the page
+	results := make([][]Statement, len(sources))
+	errs := make([]error, len(sources))
+	var wg sync.WaitGroup
+	for idx, s := range sources {
+		wg.Add(1)
+		go func(idx int, s FederationSource) {
+			defer wg.Done()
+			sq := newExpressionQuery(expr)
+			sq.orderings = r.orderings
+			sq.after = r.after
+			sq.maxResults = r.maxResults
+			sq.maxScanned = r.maxScanned
+			if r.limit >= 0 {
+				sq.limit = r.offset + r.limit
+			}
+			results[idx], errs[idx] = CollectStatements(s.Select(ctx, sq))
+		}(idx, s)
+	}
+	wg.Wait()
+	for idx, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("Source '%v' failed: %v", sources[idx].Name(), err)
+		}
+	}
+
+	// merge and de-duplicate
+	res := []FederatedMatch{}
+	seen := map[string]int{}
+	for idx, stmts := range results {
+		for _, stmt := range stmts {
+			k := statementKey(stmt)
+			if m, ok := seen[k]; ok {
+				res[m].Sources = append(res[m].Sources, sources[idx].Name())
+				continue
+			}
+			seen[k] = len(res)
+			res = append(res, FederatedMatch{Statement: stmt, Sources: []string{sources[idx].Name()}})
+		}
+	}
+	if r.maxResults > 0 && len(res) > r.maxResults {
+		return nil, &QueryLimitError{Limit: ResultsLimit, Max: r.maxResults}
+	}
+
+	if len(r.orderings) > 0 || r.after != nil {
+		sort.SliceStable(res, func(i, j int) bool {
+			return compareByOrderings(res[i].Statement, res[j].Statement, r.orderings) < 0
+		})
+	}
+	start, end := pageBounds(len(res), r.offset, r.limit)
+	return res[start:end], nil
+}
+
+// selectSources asks the sources for every pattern of the top
+// level conjunction of the expression.
+func (f *federation) selectSources(ctx context.Context, expr Expression) ([]FederationSource, error) {
+	patterns := []Expression{}
+	operands := []Expression{expr}
+	if and, ok := expr.(*AndExpression); ok {
+		operands = and.Operands
+	}
+	for _, o := range operands {
+		if _, ok := o.(*PatternExpression); ok {
+			patterns = append(patterns, o)
+		}
+	}
+
+	res := []FederationSource{}
+	for _, s := range f.sources {
+		relevant := true
+		for _, p := range patterns {
+			found, err := s.Ask(ctx, newExpressionQuery(p))
+			if err != nil {
+				return nil, fmt.Errorf("Source '%v' failed: %v", s.Name(), err)
+			}
+			if !found {
+				relevant = false
+				break
+			}
+		}
+		if relevant {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+// newExpressionQuery creates an unbound query matching
+// the expression.
+func newExpressionQuery(expr Expression) *query {
+	q := NewQuery().(*query)
+	if _, ok := expr.(*TrueExpression); !ok {
+		q.add(expr)
+	}
+	return q
+}
+
+// statementKey identifies a statement by the term keys of its
+// nodes, see termKey().
+func statementKey(stmt Statement) string {
+	keys := []string{}
+	for _, p := range []Position{SubjectPosition, PredicatePosition, ObjectPosition, GraphPosition} {
+		keys = append(keys, termKey(p.Of(stmt)))
+	}
+	return strings.Join(keys, " ")
+}
@@ -0,0 +1,92 @@
+package semtools
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+// failingSource is a federation source that fails every request.
+type failingSource struct {}
+
+func (s *failingSource) Name() string {
+	return "failing"
+}
+
+func (s *failingSource) Ask(ctx context.Context, q Query) (bool, error) {
+	return true, nil
+}
+
+func (s *failingSource) Select(ctx context.Context, q Query) StatementIterator {
+	return &errorIterator{err: fmt.Errorf("unavailable")}
+}
+
+
+func TestFederation(t *testing.T) {
+
+	label := NewNamedNode("label")
+	reference := NewKnowledgeBase("reference")
+	reference.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), label, NewLocalizedLiteral("A", "en"), nil),
+		NewStatement(NewNamedNode("b"), label, NewLocalizedLiteral("B", "en"), nil),
+	})
+	tenant := NewKnowledgeBase("tenant")
+	tenant.Insert([]Statement{
+		NewStatement(NewNamedNode("b"), label, NewLocalizedLiteral("B", "en"), nil),
+		NewStatement(NewNamedNode("c"), label, NewLocalizedLiteral("C", "en"), nil),
+		NewStatement(NewNamedNode("c"), NewNamedNode("owner"), NewNamedNode("t1"), nil),
+	})
+	f := NewFederation(NewKnowledgeBaseSource(reference), NewKnowledgeBaseSource(tenant))
+
+	matches, err := f.Results(context.Background(), NewQuery().Predicate(label))
+	if err != nil || len(matches) != 3 {
+		t.Fatalf("Results() expected 3 matches but got %v (%v)", matches, err)
+	}
+	if len(matches[1].Sources) != 2 || matches[1].Sources[0] != "reference" || matches[1].Sources[1] != "tenant" {
+		t.Errorf("Results() expected provenance of both sources but got %v", matches[1].Sources)
+	}
+
+	// source selection per pattern
+	q := NewQuery().Predicate(NewNamedNode("owner"))
+	if sources, err := f.SelectSources(context.Background(), q); err != nil || len(sources) != 1 || sources[0].Name() != "tenant" {
+		t.Errorf("SelectSources() expected [tenant] but got %v (%v)", sources, err)
+	}
+	if sources, _ := f.SelectSources(context.Background(), NewQuery().Subject(NewNamedNode("a")).Or().Subject(NewNamedNode("c"))); len(sources) != 2 {
+		t.Errorf("SelectSources() expected all sources for disjunctions but got %v", sources)
+	}
+
+	// ordering and paging of merged results
+	matches, err = f.Results(context.Background(), NewQuery().Predicate(label).OrderByDescending(SubjectPosition).Offset(1).Limit(1))
+	if err != nil || len(matches) != 1 || !matches[0].Statement.Subject().Equals(NewNamedNode("b")) {
+		t.Errorf("Results() fails to order and page merged results: %v (%v)", matches, err)
+	}
+	if _, err := f.Results(context.Background(), NewQuery().MaxResults(2)); err == nil {
+		t.Errorf("Results() expected to fail when exceeding MaxResults()")
+	}
+
+	// literals with values of different kinds aren't merged
+	integer := NewNamedNode(xsdNamespace + "integer")
+	reference.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("rank"), NewTypedLiteral(1, integer), nil)})
+	tenant.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("rank"), NewTypedLiteral("1", integer), nil)})
+	if matches, err := f.Results(context.Background(), NewQuery().Predicate(NewNamedNode("rank"))); err != nil || len(matches) != 2 {
+		t.Errorf("Results() expected 2 matches of different kinds but got %v (%v)", matches, err)
+	}
+
+	f = NewFederation(NewKnowledgeBaseSource(reference), &failingSource{})
+	if _, err := f.Results(context.Background(), NewQuery()); err == nil {
+		t.Errorf("Results() expected to fail for failing source")
+	}
+	if _, err := f.Results(context.Background(), NewQuery().Group()); err == nil {
+		t.Errorf("Results() expected to fail for malformed query")
+	}
+
+}
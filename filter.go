@@ -0,0 +1,372 @@
+package semtools
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// xsdNamespace and rdfNamespace are the iri prefixes of the
+// XML schema datatypes and rdf vocabulary.
+const xsdNamespace = "http://www.w3.org/2001/XMLSchema#"
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// FilterOperator identifies the kind of comparison a
+// FilterExpression applies.
+type FilterOperator string
+
+const (
+	// RegexFilter matches the lexical form of literals against
+	// a regular expression.
+	RegexFilter FilterOperator = "regex"
+
+	// ContainsFilter matches literals whose lexical form contains
+	// the argument.
+	ContainsFilter FilterOperator = "contains"
+
+	// PrefixFilter matches literals whose lexical form starts with
+	// the argument.
+	PrefixFilter FilterOperator = "strstarts"
+
+	// LessThanFilter, LessOrEqualFilter, GreaterThanFilter and
+	// GreaterOrEqualFilter compare literal values using XSD value
+	// semantics, ie. numbers numerically and dates chronologically.
+	LessThanFilter FilterOperator = "<"
+	LessOrEqualFilter FilterOperator = "<="
+	GreaterThanFilter FilterOperator = ">"
+	GreaterOrEqualFilter FilterOperator = ">="
+
+	// LanguageFilter matches localized literals whose language tag
+	// matches the language range given as argument (RFC 4647 basic
+	// filtering, "*" matches any language).
+	LanguageFilter FilterOperator = "langMatches"
+
+	// DatatypeFilter matches literals with the datatype given as
+	// argument.
+	DatatypeFilter FilterOperator = "datatype"
+
+	// TextFilter matches literals containing all words, "quoted
+	// phrases" and prefixes (ending with *) of the full-text search
+	// given as argument. Words are compared by their stems within
+	// the language of the literal.
+	TextFilter FilterOperator = "text"
+)
+
+// FilterExpression matches statements whose node at the position
+// is a literal that satisfies the operator and argument.
+type FilterExpression struct {
+
+	// Position is the position within the statement to filter.
+	Position Position
+
+	// Operator is the filter to apply.
+	Operator FilterOperator
+
+	// Argument is the right hand side of the filter. String filters
+	// and the language filter use the lexical form of the argument,
+	// comparisons use its value and the datatype filter expects a
+	// NamedNode.
+	Argument Node
+
+	// re caches the compiled regular expression of regex filters.
+	re *regexp.Regexp
+
+	// text caches the parsed search of text filters.
+	text []textClause
+
+}
+
+// NewFilterExpression creates a filter expression, validating the
+// argument for the operator.
+func NewFilterExpression(position Position, operator FilterOperator, argument Node) (*FilterExpression, error) {
+	e := &FilterExpression{
+		Position: position,
+		Operator: operator,
+		Argument: argument,
+	}
+	if argument == nil {
+		return nil, fmt.Errorf("Filter '%v' requires an argument", operator)
+	}
+	// arguments that are parameters are validated when
+	// the parameter is bound
+	_, param := argument.(Parameter)
+	switch operator {
+	case RegexFilter:
+		if param {
+			break
+		}
+		re, err := regexp.Compile(argument.String())
+		if err != nil {
+			return nil, err
+		}
+		e.re = re
+	case ContainsFilter, PrefixFilter, LanguageFilter:
+	case TextFilter:
+		if param {
+			break
+		}
+		text, err := parseTextSearch(argument.String())
+		if err != nil {
+			return nil, err
+		}
+		e.text = text
+	case LessThanFilter, LessOrEqualFilter, GreaterThanFilter, GreaterOrEqualFilter:
+		if _, ok := argument.(LiteralNode); !ok && !param {
+			return nil, fmt.Errorf("Filter '%v' requires a literal argument", operator)
+		}
+	case DatatypeFilter:
+		if _, ok := argument.(NamedNode); !ok {
+			return nil, fmt.Errorf("Filter '%v' requires a named node argument", operator)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown filter operator '%v'", operator)
+	}
+	return e, nil
+}
+
+func (e *FilterExpression) Evaluate(stmt Statement) bool {
+	ln, ok := e.Position.Of(stmt).(LiteralNode)
+	if !ok || e.Argument == nil {
+		return false
+	}
+
+	switch e.Operator {
+	case RegexFilter:
+		re := e.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(e.Argument.String()); err != nil {
+				return false
+			}
+		}
+		return re.MatchString(ln.String())
+	case ContainsFilter:
+		return strings.Contains(ln.String(), e.Argument.String())
+	case PrefixFilter:
+		return strings.HasPrefix(ln.String(), e.Argument.String())
+	case LessThanFilter, LessOrEqualFilter, GreaterThanFilter, GreaterOrEqualFilter:
+		arg, ok := e.Argument.(LiteralNode)
+		if !ok {
+			return false
+		}
+		cmp, ok := CompareLiterals(ln, arg)
+		if !ok {
+			return false
+		}
+		switch e.Operator {
+		case LessThanFilter:
+			return cmp < 0
+		case LessOrEqualFilter:
+			return cmp <= 0
+		case GreaterThanFilter:
+			return cmp > 0
+		}
+		return cmp >= 0
+	case LanguageFilter:
+		l, ok := ln.(LocalizedLiteral)
+		return ok && LanguageMatches(l.Language(), e.Argument.String())
+	case DatatypeFilter:
+		return LiteralDatatype(ln).Equals(e.Argument)
+	case TextFilter:
+		text := e.text
+		if text == nil {
+			var err error
+			if text, err = parseTextSearch(e.Argument.String()); err != nil {
+				return false
+			}
+		}
+		return matchesText(ln, text)
+	}
+	return false
+}
+
+func (e *FilterExpression) String() string {
+	return fmt.Sprintf("%v(%v, %v)", e.Operator, e.Position, formatNode(e.Argument))
+}
+
+
+// LiteralDatatype returns the datatype of a literal, which is the
+// type of typed literals, rdf:langString for localized literals
+// with a language and xsd:string otherwise.
+func LiteralDatatype(ln LiteralNode) NamedNode {
+	switch v := ln.(type) {
+	case TypedLiteral:
+		if v.Type() != nil {
+			return v.Type()
+		}
+	case LocalizedLiteral:
+		if v.Language() != "" && v.Language() != "default" {
+			return NewNamedNode(rdfNamespace + "langString")
+		}
+	}
+	return NewNamedNode(xsdNamespace + "string")
+}
+
+// LanguageMatches checks if the language tag matches the language
+// range using basic filtering as defined in RFC 4647. The range "*"
+// matches every language, the "default" language of literals without
+// a language tag is only matched by "default".
+func LanguageMatches(tag string, languageRange string) bool {
+	tag = strings.ToLower(tag)
+	languageRange = strings.ToLower(languageRange)
+	if tag == "" || tag == "default" {
+		return languageRange == "default" || languageRange == ""
+	}
+	if languageRange == "*" {
+		return true
+	}
+	return tag == languageRange || strings.HasPrefix(tag, languageRange + "-")
+}
+
+// CompareLiterals compares the values of two literals using XSD value
+// semantics. It returns -1, 0 or 1 and true if the values are
+// comparable, ie. both numeric, both dates, both booleans or both
+// strings.
+func CompareLiterals(a LiteralNode, b LiteralNode) (int, bool) {
+	av, ak := literalValue(a)
+	bv, bk := literalValue(b)
+	if ak != bk || ak == invalidValue {
+		return 0, false
+	}
+	switch ak {
+	case numericValue:
+		// integers are compared exactly, beyond the precision
+		// of floats
+		if numericRank(a) == integerRank && numericRank(b) == integerRank {
+			x, xok := integerValue(a)
+			y, yok := integerValue(b)
+			if xok && yok {
+				return x.Cmp(y), true
+			}
+		}
+		x, y := av.(float64), bv.(float64)
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return 0, false
+		}
+		return compareOrdered(x < y, x > y), true
+	case dateValue:
+		x, y := av.(time.Time), bv.(time.Time)
+		return compareOrdered(x.Before(y), x.After(y)), true
+	case booleanValue:
+		x, y := av.(bool), bv.(bool)
+		return compareOrdered(!x && y, x && !y), true
+	}
+	x, y := av.(string), bv.(string)
+	return compareOrdered(x < y, x > y), true
+}
+
+func compareOrdered(less bool, greater bool) int {
+	if less {
+		return -1
+	} else if greater {
+		return 1
+	}
+	return 0
+}
+
+// valueKind classifies literal values into the groups that
+// can be compared with each other.
+type valueKind int
+
+const (
+	invalidValue valueKind = iota
+	stringValue
+	numericValue
+	dateValue
+	booleanValue
+)
+
+// xsdNumericTypes lists the local names of the numeric XSD datatypes.
+var xsdNumericTypes = map[string]bool{
+	"decimal": true, "integer": true, "double": true, "float": true,
+	"long": true, "int": true, "short": true, "byte": true,
+	"nonNegativeInteger": true, "nonPositiveInteger": true,
+	"positiveInteger": true, "negativeInteger": true,
+	"unsignedLong": true, "unsignedInt": true, "unsignedShort": true, "unsignedByte": true,
+}
+
+// xsdDateLayouts are the layouts tried when parsing xsd:date and
+// xsd:dateTime values.
+var xsdDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02Z07:00",
+	"2006-01-02",
+}
+
+// literalValue returns the value of a literal converted into a
+// comparable go value, determined by its datatype or, for typed
+// literals with unknown datatypes, by the go type of the value.
+func literalValue(ln LiteralNode) (interface{}, valueKind) {
+	tl, ok := ln.(TypedLiteral)
+	if !ok {
+		return ln.String(), stringValue
+	}
+
+	// go values carry their own semantics
+	switch v := tl.Value().(type) {
+	case int:
+		return float64(v), numericValue
+	case int8:
+		return float64(v), numericValue
+	case int16:
+		return float64(v), numericValue
+	case int32:
+		return float64(v), numericValue
+	case int64:
+		return float64(v), numericValue
+	case uint:
+		return float64(v), numericValue
+	case uint8:
+		return float64(v), numericValue
+	case uint16:
+		return float64(v), numericValue
+	case uint32:
+		return float64(v), numericValue
+	case uint64:
+		return float64(v), numericValue
+	case float32:
+		return float64(v), numericValue
+	case float64:
+		return v, numericValue
+	case bool:
+		return v, booleanValue
+	case time.Time:
+		return v, dateValue
+	}
+
+	// otherwise interpret the lexical form using the datatype
+	lexical := strings.TrimSpace(tl.String())
+	datatype := ""
+	if tl.Type() != nil && strings.HasPrefix(tl.Type().Iri(), xsdNamespace) {
+		datatype = strings.TrimPrefix(tl.Type().Iri(), xsdNamespace)
+	}
+	switch {
+	case xsdNumericTypes[datatype]:
+		f, err := strconv.ParseFloat(lexical, 64)
+		if err != nil {
+			return nil, invalidValue
+		}
+		return f, numericValue
+	case datatype == "date" || datatype == "dateTime":
+		for _, layout := range xsdDateLayouts {
+			if t, err := time.Parse(layout, lexical); err == nil {
+				return t, dateValue
+			}
+		}
+		return nil, invalidValue
+	case datatype == "boolean":
+		switch lexical {
+		case "true", "1":
+			return true, booleanValue
+		case "false", "0":
+			return false, booleanValue
+		}
+		return nil, invalidValue
+	}
+	return tl.String(), stringValue
+}
@@ -0,0 +1,155 @@
+package semtools
+
+import (
+	"testing"
+	"time"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestLanguageMatches(t *testing.T) {
+
+	cases := []struct{
+		tag string
+		languageRange string
+		expected bool
+	}{
+		{"en", "en", true},
+		{"en-US", "en", true},
+		{"en-US", "EN-us", true},
+		{"eng", "en", false},
+		{"de", "en", false},
+		{"de", "*", true},
+		{"default", "*", false},
+		{"default", "default", true},
+	}
+	for _, c := range cases {
+		if LanguageMatches(c.tag, c.languageRange) != c.expected {
+			t.Errorf("LanguageMatches(%v, %v) expected %v", c.tag, c.languageRange, c.expected)
+		}
+	}
+
+}
+
+
+func TestCompareLiterals(t *testing.T) {
+
+	xsdInteger := NewNamedNode(xsdNamespace + "integer")
+	xsdDouble := NewNamedNode(xsdNamespace + "double")
+	xsdDate := NewNamedNode(xsdNamespace + "date")
+	xsdDateTime := NewNamedNode(xsdNamespace + "dateTime")
+	xsdBoolean := NewNamedNode(xsdNamespace + "boolean")
+
+	cases := []struct{
+		a LiteralNode
+		b LiteralNode
+		expected int
+		ok bool
+	}{
+		{NewTypedLiteral("9", xsdInteger), NewTypedLiteral("10", xsdInteger), -1, true},
+		{NewTypedLiteral("10.0", xsdDouble), NewTypedLiteral("10", xsdInteger), 0, true},
+		{NewTypedLiteral(30, nil), NewTypedLiteral("29", xsdInteger), 1, true},
+		{NewTypedLiteral("2019-05-01", xsdDate), NewTypedLiteral("2019-01-01T10:00:00Z", xsdDateTime), 1, true},
+		{NewTypedLiteral(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), nil), NewTypedLiteral("2019-01-01", xsdDate), 0, true},
+		{NewLocalizedLiteral("a", "en"), NewLocalizedLiteral("b", "de"), -1, true},
+		{NewTypedLiteral("10", xsdInteger), NewLocalizedLiteral("10", ""), 0, false},
+		{NewTypedLiteral("abc", xsdInteger), NewTypedLiteral("10", xsdInteger), 0, false},
+		{NewTypedLiteral("9007199254740993", xsdInteger), NewTypedLiteral("9007199254740992", xsdInteger), 1, true},
+		{NewTypedLiteral(int64(9007199254740992), nil), NewTypedLiteral(uint64(9007199254740993), nil), -1, true},
+		{NewTypedLiteral("9007199254740993", xsdInteger), NewTypedLiteral("9007199254740992", xsdDouble), 0, true},
+		{NewTypedLiteral("1", xsdBoolean), NewTypedLiteral(true, nil), 0, true},
+		{NewTypedLiteral("false", xsdBoolean), NewTypedLiteral("true", xsdBoolean), -1, true},
+		{NewTypedLiteral("TRUE", xsdBoolean), NewTypedLiteral(true, nil), 0, false},
+		{NewTypedLiteral("t", xsdBoolean), NewTypedLiteral(true, nil), 0, false},
+	}
+	for _, c := range cases {
+		cmp, ok := CompareLiterals(c.a, c.b)
+		if ok != c.ok || cmp != c.expected {
+			t.Errorf("CompareLiterals(%v, %v) expected %v, %v but got %v, %v", c.a, c.b, c.expected, c.ok, cmp, ok)
+		}
+	}
+
+}
+
+
+func TestNewFilterExpression(t *testing.T) {
+
+	if _, err := NewFilterExpression(ObjectPosition, RegexFilter, stringLiteral("(")); err == nil {
+		t.Errorf("NewFilterExpression() fails to validate regex")
+	}
+	if _, err := NewFilterExpression(ObjectPosition, LessThanFilter, NewNamedNode("a")); err == nil {
+		t.Errorf("NewFilterExpression() fails to require literal for comparisons")
+	}
+	if _, err := NewFilterExpression(ObjectPosition, DatatypeFilter, stringLiteral("a")); err == nil {
+		t.Errorf("NewFilterExpression() fails to require named node for datatype")
+	}
+	if _, err := NewFilterExpression(ObjectPosition, FilterOperator("unknown"), stringLiteral("a")); err == nil {
+		t.Errorf("NewFilterExpression() fails to reject unknown operators")
+	}
+
+}
+
+
+func TestQueryFilters(t *testing.T) {
+
+	xsdInteger := NewNamedNode(xsdNamespace + "integer")
+	xsdDate := NewNamedNode(xsdNamespace + "date")
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("max"), NewNamedNode("label"), NewLocalizedLiteral("Max Mustermann", "de"), nil),
+		NewStatement(NewNamedNode("max"), NewNamedNode("label"), NewLocalizedLiteral("Max Sample", "en-US"), nil),
+		NewStatement(NewNamedNode("max"), NewNamedNode("age"), NewTypedLiteral("34", xsdInteger), nil),
+		NewStatement(NewNamedNode("max"), NewNamedNode("born"), NewTypedLiteral("1985-03-01", xsdDate), nil),
+		NewStatement(NewNamedNode("mara"), NewNamedNode("label"), NewLocalizedLiteral("Mara", "en"), nil),
+		NewStatement(NewNamedNode("mara"), NewNamedNode("age"), NewTypedLiteral("28", xsdInteger), nil),
+		NewStatement(NewNamedNode("mara"), NewNamedNode("born"), NewTypedLiteral("1991-07-12", xsdDate), nil),
+		NewStatement(NewNamedNode("mara"), NewNamedNode("knows"), NewNamedNode("max"), nil),
+	})
+
+	if res := kb.Select().ObjectStartsWith("Max").Results(); len(res) != 2 {
+		t.Errorf("ObjectStartsWith() expected 2 statements but got %v", len(res))
+	}
+	if res := kb.Select().ObjectContains("ar").Results(); len(res) != 1 {
+		t.Errorf("ObjectContains() expected 1 statement but got %v", len(res))
+	}
+	if res := kb.Select().ObjectMatches(`^Ma(x|ra)$`).Results(); len(res) != 1 {
+		t.Errorf("ObjectMatches() expected 1 statement but got %v", len(res))
+	}
+	if res := kb.Select().ObjectLanguage("en").Results(); len(res) != 2 {
+		t.Errorf("ObjectLanguage() expected 2 statements but got %v", len(res))
+	}
+	if res := kb.Select().ObjectDatatype(xsdInteger).Results(); len(res) != 2 {
+		t.Errorf("ObjectDatatype() expected 2 statements but got %v", len(res))
+	}
+	if res := kb.Select().ObjectGreaterThan(NewTypedLiteral(30, nil)).Results(); len(res) != 1 {
+		t.Errorf("ObjectGreaterThan() expected 1 statement but got %v", len(res))
+	}
+	if res := kb.Select().ObjectLessOrEqual(NewTypedLiteral("34", xsdInteger)).Results(); len(res) != 2 {
+		t.Errorf("ObjectLessOrEqual() expected 2 statements but got %v", len(res))
+	}
+
+	res := kb.Select().
+		ObjectGreaterOrEqual(NewTypedLiteral("1991-01-01", xsdDate)).
+		ObjectLessThan(NewTypedLiteral("1992-01-01", xsdDate)).
+		Or().
+		Group().
+			Predicate(NewNamedNode("label")).
+			Not().ObjectLanguage("de").
+		EndGroup().Results()
+	if len(res) != 3 {
+		t.Errorf("Filters expected to combine within groups but got %v statements", len(res))
+	}
+
+	if err := kb.Select().ObjectMatches("(").Err(); err == nil {
+		t.Errorf("ObjectMatches() fails to report invalid regular expression")
+	}
+
+}
@@ -2,4 +2,8 @@ module github.com/PaulEnglert/go-semtools
 
 go 1.12
 
-require github.com/sirupsen/logrus v1.4.2
+require (
+	github.com/sirupsen/logrus v1.4.2
+	go.etcd.io/bbolt v1.3.6
+	modernc.org/sqlite v1.10.8
+)
@@ -0,0 +1,110 @@
+package semtools
+
+
+// StatementIterator streams statements one at a time, e.g.
+// the results of a query, so callers don't have to hold all
+// of them in memory and can stop early.
+//
+// Usage
+//
+//     it := kb.Select().Subject(node).Iterate()
+//     defer it.Close()
+//     for it.Next() {
+//         fmt.Println(it.Statement())
+//     }
+//     if err := it.Err(); err != nil {
+//         ...
+//     }
+type StatementIterator interface {
+
+	// Next advances the iterator to the next statement and
+	// returns false when there are no more statements or an
+	// error occured.
+	Next() bool
+
+	// Statement returns the current statement, it is only
+	// valid after Next() returned true.
+	Statement() Statement
+
+	// Err returns the error that stopped the iteration.
+	Err() error
+
+	// Close releases the resources of the iterator, further
+	// calls to Next() return false.
+	Close() error
+
+}
+
+// NewSliceIterator creates an iterator over the statements.
+func NewSliceIterator(stmts []Statement) StatementIterator {
+	return &sliceIterator{stmts: stmts, idx: -1}
+}
+
+// CollectStatements reads all remaining statements from the
+// iterator into a slice and closes it.
+func CollectStatements(it StatementIterator) ([]Statement, error) {
+	defer it.Close()
+	res := []Statement{}
+	for it.Next() {
+		res = append(res, it.Statement())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+
+
+type sliceIterator struct {
+	stmts []Statement
+	idx int
+	closed bool
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.closed || it.idx + 1 >= len(it.stmts) {
+		return false
+	}
+	it.idx++
+	return true
+}
+
+func (it *sliceIterator) Statement() Statement {
+	if it.idx < 0 || it.idx >= len(it.stmts) {
+		return nil
+	}
+	return it.stmts[it.idx]
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+
+
+// errorIterator is an empty iterator reporting an error.
+type errorIterator struct {
+	err error
+}
+
+func (it *errorIterator) Next() bool {
+	return false
+}
+
+func (it *errorIterator) Statement() Statement {
+	return nil
+}
+
+func (it *errorIterator) Err() error {
+	return it.err
+}
+
+func (it *errorIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,104 @@
+package semtools
+
+import (
+	"fmt"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestSliceIterator(t *testing.T) {
+
+	stmts := []Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("d"), nil),
+	}
+
+	it := NewSliceIterator(stmts)
+	if it.Statement() != nil {
+		t.Errorf("Statement() expected nil before Next()")
+	}
+	if !it.Next() || it.Statement() != stmts[0] || !it.Next() || it.Statement() != stmts[1] {
+		t.Errorf("Next() fails to iterate statements in order")
+	}
+	if it.Next() || it.Err() != nil {
+		t.Errorf("Next() expected to end without error")
+	}
+
+	it = NewSliceIterator(stmts)
+	it.Close()
+	if it.Next() {
+		t.Errorf("Next() expected to return false after Close()")
+	}
+
+	res, err := CollectStatements(NewSliceIterator(stmts))
+	if err != nil || len(res) != 2 {
+		t.Errorf("CollectStatements() fails to collect statements")
+	}
+	if _, err := CollectStatements(&errorIterator{err: fmt.Errorf("failed")}); err == nil {
+		t.Errorf("CollectStatements() fails to return error of iterator")
+	}
+
+}
+
+
+func TestQueryIterate(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	stmts := []Statement{}
+	for i := 0; i < 100; i++ {
+		stmts = append(stmts, NewStatement(NewNamedNode(fmt.Sprintf("s%02d", i)), NewNamedNode("p"), NewNamedNode("o"), nil))
+	}
+	kb.Insert(stmts)
+
+	it := kb.Select().Predicate(NewNamedNode("p")).Iterate()
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if count != 100 || it.Err() != nil {
+		t.Errorf("Iterate() expected 100 statements but got %v (%v)", count, it.Err())
+	}
+
+	// lazy evaluation stops scanning with the limit
+	res, err := CollectStatements(kb.Select().Offset(2).Limit(3).MaxScanned(5).Iterate())
+	if err != nil || len(res) != 3 || !res[0].Subject().Equals(NewNamedNode("s02")) {
+		t.Errorf("Iterate() fails to stream lazily: %v (%v)", res, err)
+	}
+
+	it = kb.Select().OrderByDescending(SubjectPosition).Limit(2).Iterate()
+	if !it.Next() || !it.Statement().Subject().Equals(NewNamedNode("s99")) {
+		t.Errorf("Iterate() fails to order statements")
+	}
+	it.Close()
+	if it.Next() {
+		t.Errorf("Next() expected to return false after Close()")
+	}
+
+	it = kb.Select().Group().Iterate()
+	if it.Next() || it.Err() == nil {
+		t.Errorf("Iterate() fails to report malformed query")
+	}
+
+	// the store iterator is not affected by deletes
+	it = kb.Iterate()
+	it.Next()
+	kb.Delete(stmts[1:3])
+	it.Next()
+	if !it.Statement().Subject().Equals(NewNamedNode("s01")) || len(kb.Statements()) != 98 {
+		t.Errorf("Iterate() expected to iterate snapshot of statements")
+	}
+
+	view := kb.Graph(kb.DefaultGraph())
+	if res, _ := CollectStatements(view.Iterate()); len(res) != 98 {
+		t.Errorf("Iterate() of graph view expected 98 statements but got %v", len(res))
+	}
+
+}
@@ -2,7 +2,8 @@ package semtools
 
 import (
 	"fmt"
-	"sort"
+	"strings"
+	"sync"
 )
 
 
@@ -25,6 +26,10 @@ type KnowledgeBase interface {
 	// the knowledge base.
 	Statements() []Statement
 
+	// Iterate returns an iterator over the statements in the
+	// knowledge base, in the order of Statements().
+	Iterate() StatementIterator
+
 	// Insert adds the given statements into the base,
 	// ignoring duplicates and already existing ones.
 	Insert(stmts []Statement)
@@ -36,20 +41,204 @@ type KnowledgeBase interface {
 	// base.
 	Select() Query
 
+	// Prepare compiles the query into a PreparedQuery bound to
+	// the knowledge base, see Query.Prepare(). Prepared queries
+	// are cached, so preparing a query of the same shape again
+	// returns the cached one.
+	Prepare(q Query) (PreparedQuery, error)
+
+	// Subscribe registers the query for changes of its results,
+	// which are delivered incrementally whenever Insert() or Delete()
+	// change them. Orderings, cursors, offset and limit are not
+	// supported. Mind that slow subscribers block modifications
+	// once their buffer is full, see SubscriptionOptions.
+	Subscribe(q Query, opts *SubscriptionOptions) (Subscription, error)
+
+	// Listen registers the listener for the changes of the knowledge
+	// base and returns a function that removes it again. Listeners
+	// are called synchronously after every Insert() or Delete() that
+	// changed statements, outside of the knowledge base lock. They may
+	// read the knowledge base but must not modify it.
+	Listen(listener ChangeListener) func()
+
+	// Sequence returns the sequence number of the last change.
+	Sequence() uint64
+
+	// DefaultGraph returns the graph that statements without
+	// a graph are assigned to during Insert().
+	DefaultGraph() NamedNode
+
+	// UnionDefaultGraph returns true if queries bound to the
+	// knowledge base treat the default graph as the union of
+	// all graphs.
+	UnionDefaultGraph() bool
+
+	// Graphs returns the list of graphs that contain at least
+	// one statement, in order of their first appearance.
+	Graphs() []NamedNode
+
+	// Graph returns a view on the knowledge base that is scoped
+	// to the given graph. Statements inserted through the view
+	// are placed into the graph, deletes and queries only affect
+	// the statements of the graph, even for the default graph in
+	// union mode. A nil graph refers to the default graph, also
+	// for the other graph management methods below.
+	Graph(graph NamedNode) KnowledgeBase
+
+	// DropGraph removes all statements of the given graph.
+	DropGraph(graph NamedNode)
+
+	// CopyGraph replaces the content of the target graph with
+	// the statements of the source graph.
+	CopyGraph(source NamedNode, target NamedNode)
+
+	// MoveGraph replaces the content of the target graph with
+	// the statements of the source graph and drops the source
+	// graph afterwards.
+	MoveGraph(source NamedNode, target NamedNode)
+
+	// AddGraph inserts the statements of the source graph into
+	// the target graph, keeping the existing statements of the
+	// target graph.
+	AddGraph(source NamedNode, target NamedNode)
+
+}
+
+// IndexedKnowledgeBase is a knowledge base that maintains
+// indexes on the nodes of its statements. Queries bound to
+// such a knowledge base use the indexes to estimate
+// cardinalities and to avoid full scans.
+type IndexedKnowledgeBase interface {
+
+	KnowledgeBase
+
+	// Cardinality returns the number of statements with
+	// the node at the position.
+	Cardinality(position Position, node Node) int
+
+	// Lookup returns the statements with the node at the
+	// position, in the order of the index.
+	Lookup(position Position, node Node) []Statement
+
+	// IterateLookup returns an iterator over the statements
+	// of Lookup().
+	IterateLookup(position Position, node Node) StatementIterator
+
+	// Size returns the number of statements.
+	Size() int
+
+}
+
+// TextIndexedKnowledgeBase is a knowledge base that can maintain
+// a full-text index over its literal objects. Queries bound to
+// such a knowledge base use the index for text filters.
+type TextIndexedKnowledgeBase interface {
+
+	KnowledgeBase
+
+	// Search returns the statements whose literal object matches
+	// the full-text search (see TextFilter), ordered by descending
+	// relevance. An error is returned if the index is not enabled.
+	Search(search string) ([]TextMatch, error)
+
+}
+
+// FilteringKnowledgeBase is a knowledge base that retrieves the
+// candidates of queries itself, e.g. by translating expressions
+// into the queries of a database. Queries bound to such a knowledge
+// base use Filter() instead of index lookups or full scans.
+type FilteringKnowledgeBase interface {
+
+	KnowledgeBase
+
+	// Filter returns an iterator over the statements that might
+	// match the expression, including all matching ones. The
+	// expression is evaluated on them afterwards.
+	Filter(expr Expression) StatementIterator
+
+}
+
+// KnowledgeBaseOptions are options that configure
+// a knowledge base with some settings.
+type KnowledgeBaseOptions struct {
+
+	// DefaultGraph is the graph statements without a graph
+	// are assigned to. Defaults to "default-graph".
+	DefaultGraph NamedNode
+
+	// UnionDefaultGraph will configure queries bound to the
+	// knowledge base to match any graph when filtering for the
+	// default graph. Inserts and deletes are not affected.
+	UnionDefaultGraph bool
+
+	// FullTextIndex enables the full-text index over literal
+	// objects, see TextIndexedKnowledgeBase.
+	FullTextIndex bool
+
+	// ChangeLog receives every change of the knowledge base. The
+	// sequence numbers of the changes continue after the last
+	// change of the log, which is not replayed automatically
+	// (see ReplayChanges()). Changes are applied even if they
+	// can't be appended, the first error is reported by Err()
+	// of the knowledge base (see ChangeLoggingKnowledgeBase).
+	ChangeLog ChangeLog
+
+	// Terms is the dictionary the nodes of inserted statements
+	// are interned with, it can be shared with other knowledge
+	// bases and parsers. Defaults to a new dictionary.
+	Terms TermDictionary
+
 }
 
 // NewKnowledgeBase will create a new basic knowledge
 // base with the given name.
 func NewKnowledgeBase(name string) KnowledgeBase {
+	return NewKnowledgeBaseWithOptions(name, nil)
+}
+
+// NewKnowledgeBaseWithOptions will create a new basic knowledge
+// base with the given name and options.
+func NewKnowledgeBaseWithOptions(name string, opts *KnowledgeBaseOptions) KnowledgeBase {
 
 	if name == "" {
 		name = "kb"
 	}
 
+	// make sure things are initialized
+	if opts == nil {
+		opts = &KnowledgeBaseOptions{}
+	}
+	defaultGraph := opts.DefaultGraph
+	if defaultGraph == nil {
+		defaultGraph = NewNamedNode("default-graph")
+	}
+
+	var sequence uint64
+	if opts.ChangeLog != nil {
+		sequence = opts.ChangeLog.LastSequence()
+	}
+
+	terms := opts.Terms
+	if terms == nil {
+		terms = NewTermDictionary()
+	}
+
+	var text *textIndex
+	if opts.FullTextIndex {
+		text = newTextIndex()
+	}
+
 	return &knowledgeBase{
 		name: name,
 		statements: []Statement{},
-		defaultGraph: NewNamedNode("default-graph"),
+		index: newStatementIndex(terms),
+		terms: terms,
+		defaultGraph: defaultGraph,
+		unionDefaultGraph: opts.UnionDefaultGraph,
+		prepared: newPreparedQueryCache(preparedQueryCacheSize),
+		text: text,
+		changeLog: opts.ChangeLog,
+		sequence: sequence,
 	}
 
 }
@@ -89,6 +278,18 @@ func NewNamedNode(iri string) NamedNode {
 	}
 }
 
+// IsBlankNode returns if the node is a blank node, ie. a named
+// node with an iri of the form `_:label`. Blank nodes are local
+// to the statements they occur in, so their labels don't take part
+// in Diff() and canonicalization.
+func IsBlankNode(node Node) bool {
+	if _, ok := node.(QuotedTriple); ok {
+		return false
+	}
+	n, ok := node.(NamedNode)
+	return ok && strings.HasPrefix(n.Iri(), "_:")
+}
+
 
 
 // LiteralNode is a generic container for literal
@@ -193,10 +394,28 @@ func NewStatement(subject NamedNode, predicate NamedNode, object Node, graph Nam
 
 
 
+// preparedQueryCacheSize is the number of prepared queries
+// cached by a knowledge base.
+const preparedQueryCacheSize = 256
+
 type knowledgeBase struct {
+	// mutex guards statements and index, statements is
+	// never modified in place so it can be read without
+	// holding the lock once retrieved.
+	mutex sync.RWMutex
 	name string
 	statements []Statement
+	index *statementIndex
+	terms TermDictionary
 	defaultGraph NamedNode
+	unionDefaultGraph bool
+	prepared *preparedQueryCache
+	text *textIndex
+	observers observers
+	changeLog ChangeLog
+	// errs records the first error of the change log
+	errs firstError
+	sequence uint64
 }
 
 func (kb *knowledgeBase) Name() string {
@@ -204,43 +423,51 @@ func (kb *knowledgeBase) Name() string {
 }
 
 func (kb *knowledgeBase) Statements() []Statement {
+	kb.mutex.RLock()
+	defer kb.mutex.RUnlock()
 	return kb.statements
 }
 
+func (kb *knowledgeBase) Iterate() StatementIterator {
+	return NewSliceIterator(kb.Statements())
+}
+
 func (kb *knowledgeBase) Insert(stmts []Statement) {
+	kb.mutex.Lock()
+	added := []Statement{}
 	for _, stmt := range stmts {
 
-		// make copy of statement and
-		// ensure graph is set
-		subj := stmt.Subject()
-		pred := stmt.Predicate()
-		obj := stmt.Object()
+		// make copy of statement with interned
+		// nodes and ensure graph is set
 		graph := stmt.Graph()
 		if graph == nil {
 			graph = kb.defaultGraph
 		}
-
-		// check if already exists
-		matches := kb.Select().
-			Graph(graph).
-			Subject(subj).
-			Predicate(pred).
-			Object(obj).
-			Results();
-
-		// insert only if no matches
-		if len(matches) == 0 {
-			kb.statements = append(kb.statements, NewStatement(subj, pred, obj, graph))
+		s := internStatement(kb.terms, stmt, graph)
+
+		// insert only if not already existing
+		if !kb.index.contains(s) {
+			kb.statements = append(kb.statements, s)
+			kb.index.add(s)
+			if kb.text != nil {
+				kb.text.add(s)
+			}
+			added = append(added, s)
 		}
 
 	}
+	kb.commit(added, nil)
 }
 
 func (kb *knowledgeBase) Delete(stmts []Statement) {
+	kb.mutex.Lock()
+	removed := []Statement{}
 	for _, stmt := range stmts {
 
-		// query matches
-		q := kb.Select()
+		// query matches among the statements of the
+		// subject (using an unbound query so the
+		// union default graph doesn't apply)
+		q := NewQuery()
 		if stmt.Graph() != nil {
 			q = q.Graph(stmt.Graph())
 		}
@@ -248,22 +475,390 @@ func (kb *knowledgeBase) Delete(stmts []Statement) {
 			Subject(stmt.Subject()).
 			Predicate(stmt.Predicate()).
 			Object(stmt.Object()).
-			ResultIndexes();
+			ResultsFrom(kb.index.lookup(SubjectPosition, stmt.Subject()));
+
+		// remove matches
+		for _, m := range matches {
+			kb.index.remove(m)
+			if kb.text != nil {
+				kb.text.remove(m)
+			}
+			for idx, s := range kb.statements {
+				if s == m {
+					// copy so running iterators are not affected
+					kb.statements = append(kb.statements[:idx:idx], kb.statements[idx+1:]...)
+					break
+				}
+			}
+			removed = append(removed, m)
+		}
 
-		sort.Sort(sort.Reverse(sort.IntSlice(matches)))
+	}
+	kb.commit(nil, removed)
+}
 
-		// insert only if no matches
-		for _, idx := range matches {
-			kb.statements = append(kb.statements[:idx], kb.statements[idx+1:]...)
+// commit records the modification as change and releases the
+// write lock before delivering it to the observers. The change is
+// queued before the write lock is released, so changes are delivered
+// in order while readers and writers can continue.
+func (kb *knowledgeBase) commit(added []Statement, removed []Statement) {
+	if len(added) == 0 && len(removed) == 0 {
+		kb.mutex.Unlock()
+		return
+	}
+	kb.sequence++
+	change := Change{Sequence: kb.sequence, Added: added, Removed: removed}
+	if kb.changeLog != nil {
+		if err := kb.changeLog.Append(change); err != nil {
+			GetLogger("knowledge-base").Errorf("Failed to append change %v of '%v' to the change log: %v", change.Sequence, kb.name, err)
+			kb.errs.record(err)
 		}
+	}
+
+	kb.observers.enqueue(change)
+	kb.mutex.Unlock()
+	kb.observers.deliver()
+}
+
+// Err returns the first error appending a change to the
+// change log.
+func (kb *knowledgeBase) Err() error {
+	return kb.errs.get()
+}
+
+func (kb *knowledgeBase) Listen(listener ChangeListener) func() {
+	return kb.observers.listen(listener)
+}
 
-	}	
+func (kb *knowledgeBase) Sequence() uint64 {
+	kb.mutex.RLock()
+	defer kb.mutex.RUnlock()
+	return kb.sequence
+}
+
+func (kb *knowledgeBase) Subscribe(q Query, opts *SubscriptionOptions) (Subscription, error) {
+	s, err := newSubscription(q, kb, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// register and collect the initial results atomically
+	kb.mutex.RLock()
+	defer kb.mutex.RUnlock()
+	s.results = s.filter(kb.statements)
+	kb.observers.subscribe(s, kb.sequence)
+	return s, nil
 }
 
 func (kb *knowledgeBase) Select() Query {
 	return NewQuery().Bind(kb)
 }
 
+func (kb *knowledgeBase) Prepare(q Query) (PreparedQuery, error) {
+	r, ok := q.(*query)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported query implementation %T", q)
+	}
+	return kb.prepared.prepare(r.root(), kb)
+}
+
+func (kb *knowledgeBase) Cardinality(position Position, node Node) int {
+	kb.mutex.RLock()
+	defer kb.mutex.RUnlock()
+	return len(kb.index.lookup(position, node))
+}
+
+func (kb *knowledgeBase) Lookup(position Position, node Node) []Statement {
+	kb.mutex.RLock()
+	defer kb.mutex.RUnlock()
+	pattern := &PatternExpression{Position: position, Node: node}
+	res := []Statement{}
+	for _, stmt := range kb.index.lookup(position, node) {
+		if pattern.Evaluate(stmt) {
+			res = append(res, stmt)
+		}
+	}
+	return res
+}
+
+func (kb *knowledgeBase) IterateLookup(position Position, node Node) StatementIterator {
+	return NewSliceIterator(kb.Lookup(position, node))
+}
+
+// dictionary returns the term dictionary the nodes of the
+// knowledge base are interned with.
+func (kb *knowledgeBase) dictionary() TermDictionary {
+	return kb.terms
+}
+
+func (kb *knowledgeBase) Size() int {
+	kb.mutex.RLock()
+	defer kb.mutex.RUnlock()
+	return len(kb.statements)
+}
+
+func (kb *knowledgeBase) Search(search string) ([]TextMatch, error) {
+	clauses, err := parseTextSearch(search)
+	if err != nil {
+		return nil, err
+	}
+	kb.mutex.RLock()
+	defer kb.mutex.RUnlock()
+	if kb.text == nil {
+		return nil, fmt.Errorf("Full-text index of knowledge base '%v' is not enabled", kb.name)
+	}
+	return kb.text.search(clauses), nil
+}
+
+func (kb *knowledgeBase) DefaultGraph() NamedNode {
+	return kb.defaultGraph
+}
+
+func (kb *knowledgeBase) UnionDefaultGraph() bool {
+	return kb.unionDefaultGraph
+}
+
+func (kb *knowledgeBase) Graphs() []NamedNode {
+	return graphsOf(kb.Statements())
+}
+
+func (kb *knowledgeBase) Graph(graph NamedNode) KnowledgeBase {
+	return &graphView{
+		base: kb,
+		graph: graphOrDefault(kb, graph),
+	}
+}
+
+func (kb *knowledgeBase) DropGraph(graph NamedNode) {
+	graph = graphOrDefault(kb, graph)
+	kb.Delete(NewQuery().Graph(graph).ResultsFrom(kb.Statements()))
+}
+
+func (kb *knowledgeBase) CopyGraph(source NamedNode, target NamedNode) {
+	source, target = graphOrDefault(kb, source), graphOrDefault(kb, target)
+	if source.Equals(target) {
+		return
+	}
+	kb.DropGraph(target)
+	kb.AddGraph(source, target)
+}
+
+func (kb *knowledgeBase) MoveGraph(source NamedNode, target NamedNode) {
+	source, target = graphOrDefault(kb, source), graphOrDefault(kb, target)
+	if source.Equals(target) {
+		return
+	}
+	kb.CopyGraph(source, target)
+	kb.DropGraph(source)
+}
+
+func (kb *knowledgeBase) AddGraph(source NamedNode, target NamedNode) {
+	source, target = graphOrDefault(kb, source), graphOrDefault(kb, target)
+	kb.Insert(withGraph(NewQuery().Graph(source).ResultsFrom(kb.Statements()), target))
+}
+
+
+
+// graphView is a knowledge base that is scoped to a single
+// graph of an underlying knowledge base.
+type graphView struct {
+	base KnowledgeBase
+	graph NamedNode
+}
+
+func (gv *graphView) Name() string {
+	return gv.base.Name() + "#" + gv.graph.Iri()
+}
+
+func (gv *graphView) Statements() []Statement {
+	return gv.scope(nil).Results()
+}
+
+func (gv *graphView) Iterate() StatementIterator {
+	return gv.scope(nil).Iterate()
+}
+
+func (gv *graphView) Insert(stmts []Statement) {
+	gv.base.Insert(withGraph(stmts, gv.graph))
+}
+
+func (gv *graphView) Delete(stmts []Statement) {
+	gv.base.Delete(withGraph(stmts, gv.graph))
+}
+
+func (gv *graphView) Select() Query {
+	return NewQuery().Bind(gv)
+}
+
+func (gv *graphView) Subscribe(q Query, opts *SubscriptionOptions) (Subscription, error) {
+	expr, err := subscribedExpression(q)
+	if err != nil {
+		return nil, err
+	}
+	return gv.base.Subscribe(gv.scope(expr), opts)
+}
+
+// Listen reports the changes of the whole knowledge base.
+func (gv *graphView) Listen(listener ChangeListener) func() {
+	return gv.base.Listen(listener)
+}
+
+func (gv *graphView) Sequence() uint64 {
+	return gv.base.Sequence()
+}
+
+func (gv *graphView) Prepare(q Query) (PreparedQuery, error) {
+	r, ok := q.(*query)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported query implementation %T", q)
+	}
+	return newPreparedQuery(r.root(), gv)
+}
+
+func (gv *graphView) DefaultGraph() NamedNode {
+	return gv.graph
+}
+
+func (gv *graphView) UnionDefaultGraph() bool {
+	return false
+}
+
+func (gv *graphView) Graphs() []NamedNode {
+	return graphsOf(gv.Statements())
+}
+
+func (gv *graphView) Graph(graph NamedNode) KnowledgeBase {
+	return gv.base.Graph(graph)
+}
+
+func (gv *graphView) DropGraph(graph NamedNode) {
+	gv.base.DropGraph(graph)
+}
+
+func (gv *graphView) CopyGraph(source NamedNode, target NamedNode) {
+	gv.base.CopyGraph(source, target)
+}
+
+func (gv *graphView) MoveGraph(source NamedNode, target NamedNode) {
+	gv.base.MoveGraph(source, target)
+}
+
+func (gv *graphView) AddGraph(source NamedNode, target NamedNode) {
+	gv.base.AddGraph(source, target)
+}
+
+// scope creates the query of the expression restricted to the
+// statements of the graph, which doesn't match other graphs even
+// if the graph is the union default graph of the base.
+func (gv *graphView) scope(expr Expression) *query {
+	var scoped Expression = &PatternExpression{Position: GraphPosition, Node: gv.graph}
+	if expr != nil {
+		scoped = &AndExpression{Operands: []Expression{scoped, expr}}
+	}
+	q := newExpressionQuery(scoped)
+	q.Bind(gv.base)
+	q.exactGraphs = true
+	return q
+}
+
+// statementIndex indexes statements by the ids of the
+// nodes at their positions, keeping the order of insertion.
+type statementIndex struct {
+	terms TermDictionary
+	positions map[Position]map[TermID][]Statement
+}
+
+func newStatementIndex(terms TermDictionary) *statementIndex {
+	return &statementIndex{
+		terms: terms,
+		positions: map[Position]map[TermID][]Statement{
+			SubjectPosition: {},
+			PredicatePosition: {},
+			ObjectPosition: {},
+			GraphPosition: {},
+		},
+	}
+}
+
+func (si *statementIndex) add(stmt Statement) {
+	for p, idx := range si.positions {
+		k := si.terms.Encode(p.Of(stmt))
+		idx[k] = append(idx[k], stmt)
+	}
+}
+
+func (si *statementIndex) remove(stmt Statement) {
+	for p, idx := range si.positions {
+		k, ok := si.terms.ID(p.Of(stmt))
+		if !ok {
+			continue
+		}
+		for i, s := range idx[k] {
+			if s == stmt {
+				idx[k] = append(idx[k][:i:i], idx[k][i+1:]...)
+				break
+			}
+		}
+		if len(idx[k]) == 0 {
+			delete(idx, k)
+		}
+	}
+}
+
+// lookup returns the statements with the node at the
+// position.
+func (si *statementIndex) lookup(position Position, node Node) []Statement {
+	k, ok := si.terms.ID(node)
+	if !ok {
+		return nil
+	}
+	return si.positions[position][k]
+}
+
+// contains checks if an equal statement is indexed.
+func (si *statementIndex) contains(stmt Statement) bool {
+	for _, s := range si.lookup(SubjectPosition, stmt.Subject()) {
+		if s.Equals(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// graphsOf returns the unique graphs of the statements in
+// order of their first appearance.
+func graphsOf(stmts []Statement) []NamedNode {
+	graphs := []NamedNode{}
+	seen := map[string]bool{}
+	for _, stmt := range stmts {
+		if stmt.Graph() == nil || seen[stmt.Graph().Iri()] {
+			continue
+		}
+		seen[stmt.Graph().Iri()] = true
+		graphs = append(graphs, stmt.Graph())
+	}
+	return graphs
+}
+
+// graphOrDefault returns the graph or the default graph of
+// the knowledge base if it is nil.
+func graphOrDefault(kb KnowledgeBase, graph NamedNode) NamedNode {
+	if graph == nil {
+		return kb.DefaultGraph()
+	}
+	return graph
+}
+
+// withGraph returns copies of the statements placed into
+// the given graph, keeping their metadata.
+func withGraph(stmts []Statement, graph NamedNode) []Statement {
+	res := make([]Statement, len(stmts))
+	for idx, stmt := range stmts {
+		res[idx] = withMetadata(NewStatement(stmt.Subject(), stmt.Predicate(), stmt.Object(), graph), MetadataOf(stmt))
+	}
+	return res
+}
+
 
 
 type namedNode struct {
@@ -275,6 +870,9 @@ func (nn *namedNode) Iri() string {
 }
 
 func (nn *namedNode) Equals(other interface{}) bool {
+	if _, ok := other.(QuotedTriple); ok {
+		return false
+	}
 	if v, ok := other.(NamedNode); ok {
 		return nn.Iri() == v.Iri()
 	}
@@ -328,6 +926,9 @@ func (tn *typedLiteral) Type() NamedNode {
 
 func (tn *typedLiteral) Equals(other interface{}) bool {
 	if v, ok := other.(TypedLiteral); ok {
+		if tn.Type() == nil || v.Type() == nil {
+			return tn.Type() == nil && v.Type() == nil && tn.Value() == v.Value()
+		}
 		return tn.Type().Equals(v.Type()) && tn.Value() == v.Value()
 	}
 	return false
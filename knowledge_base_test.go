@@ -114,3 +114,152 @@ func TestKnowledgeBase(t *testing.T) {
 
 
 }
+
+
+func TestKnowledgeBaseGraphs(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+
+	g1 := NewNamedNode("g1")
+	g2 := NewNamedNode("g2")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), g1),
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("d"), g1),
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("e"), g2),
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("f"), nil),
+	})
+
+	graphs := kb.Graphs()
+	if len(graphs) != 3 || !graphs[0].Equals(g1) || !graphs[1].Equals(g2) || !graphs[2].Equals(kb.DefaultGraph()) {
+		t.Errorf("Graphs() returns unexpected graphs: %v", graphs)
+	}
+
+	view := kb.Graph(g1)
+	if len(view.Statements()) != 2 {
+		t.Errorf("Graph() fails to scope statements to graph")
+	}
+	if len(view.Select().Object(NewNamedNode("e")).Results()) != 0 {
+		t.Errorf("Graph() fails to scope queries to graph")
+	}
+	view.Insert([]Statement{
+		NewStatement(NewNamedNode("x"), NewNamedNode("y"), NewNamedNode("z"), g2),
+	})
+	if len(kb.Select().Graph(g1).Subject(NewNamedNode("x")).Results()) != 1 {
+		t.Errorf("Graph() fails to insert statements into graph")
+	}
+	view.Delete([]Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil),
+	})
+	if len(view.Statements()) != 2 || len(kb.Statements()) != 4 {
+		t.Errorf("Graph() fails to delete statements from graph")
+	}
+
+	kb.AddGraph(g2, g1)
+	if len(view.Statements()) != 3 || len(kb.Graph(g2).Statements()) != 1 {
+		t.Errorf("AddGraph() fails to add statements to graph")
+	}
+
+	kb.CopyGraph(g2, g1)
+	if len(view.Statements()) != 1 || len(kb.Graph(g2).Statements()) != 1 {
+		t.Errorf("CopyGraph() fails to replace statements of graph")
+	}
+
+	kb.MoveGraph(g1, g2)
+	if len(view.Statements()) != 0 || len(kb.Graph(g2).Statements()) != 1 {
+		t.Errorf("MoveGraph() fails to move statements of graph")
+	}
+
+	kb.DropGraph(g2)
+	if len(kb.Graphs()) != 1 || len(kb.Statements()) != 1 {
+		t.Errorf("DropGraph() fails to remove statements of graph")
+	}
+
+}
+
+
+func TestKnowledgeBaseUnionDefaultGraph(t *testing.T) {
+
+	g := NewNamedNode("g")
+	stmts := []Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), g),
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil),
+	}
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert(stmts)
+	if len(kb.Select().Graph(kb.DefaultGraph()).Results()) != 1 {
+		t.Errorf("Select() fails to match only the default graph")
+	}
+
+	kb = NewKnowledgeBaseWithOptions("kb", &KnowledgeBaseOptions{
+		DefaultGraph: NewNamedNode("my-default"),
+		UnionDefaultGraph: true,
+	})
+	kb.Insert(stmts)
+	if len(kb.Statements()) != 2 || !kb.Statements()[1].Graph().Equals(NewNamedNode("my-default")) {
+		t.Errorf("Insert() fails to use configured default graph")
+	}
+	if len(kb.Select().Graph(kb.DefaultGraph()).Results()) != 2 {
+		t.Errorf("Select() fails to match union default graph")
+	}
+	view := kb.Graph(kb.DefaultGraph())
+	if len(view.Statements()) != 1 || len(view.Select().Subject(NewNamedNode("a")).Results()) != 1 {
+		t.Errorf("Graph() expected the view to be scoped to the actual default graph but got %v", view.Statements())
+	}
+	sub, err := view.Subscribe(NewQuery().Subject(NewNamedNode("a")), nil)
+	if err != nil || len(sub.Results()) != 1 {
+		t.Fatalf("Subscribe() expected the subscription to be scoped to the actual default graph but got %v (%v)", sub, err)
+	}
+	sub.Close()
+	if len(kb.Graph(nil).Statements()) != 1 {
+		t.Errorf("Graph() fails to return the default graph for nil")
+	}
+
+	kb.CopyGraph(nil, NewNamedNode("h"))
+	if len(kb.Graph(NewNamedNode("h")).Statements()) != 1 {
+		t.Errorf("CopyGraph() fails to copy the default graph for nil")
+	}
+	kb.MoveGraph(NewNamedNode("h"), nil)
+	if len(kb.Statements()) != 2 || len(kb.Graph(NewNamedNode("h")).Statements()) != 0 {
+		t.Errorf("MoveGraph() fails to move to the default graph for nil: %v", kb.Statements())
+	}
+	kb.AddGraph(g, nil)
+	kb.DropGraph(g)
+	if len(kb.Statements()) != 1 || len(view.Statements()) != 1 {
+		t.Errorf("AddGraph() fails to add to the default graph for nil: %v", kb.Statements())
+	}
+	kb.Insert(stmts[:1])
+
+	kb.Delete([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), kb.DefaultGraph())})
+	if len(kb.Statements()) != 1 {
+		t.Errorf("Delete() fails to ignore union default graph")
+	}
+
+}
+
+
+func TestKnowledgeBaseIndex(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb").(IndexedKnowledgeBase)
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("d"), nil),
+		NewStatement(NewNamedNode("x"), NewNamedNode("b"), NewNamedNode("c"), nil),
+	})
+
+	if kb.Cardinality(SubjectPosition, NewNamedNode("a")) != 2 || kb.Cardinality(ObjectPosition, NewNamedNode("c")) != 2 {
+		t.Errorf("Cardinality() returns unexpected counts")
+	}
+	if res := kb.Lookup(PredicatePosition, NewNamedNode("b")); len(res) != 3 || !res[2].Subject().Equals(NewNamedNode("x")) {
+		t.Errorf("Lookup() fails to return statements in order")
+	}
+
+	kb.Delete([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil)})
+	if kb.Cardinality(SubjectPosition, NewNamedNode("a")) != 1 || len(kb.Lookup(ObjectPosition, NewNamedNode("c"))) != 1 {
+		t.Errorf("Delete() fails to update index")
+	}
+	if kb.Cardinality(GraphPosition, kb.DefaultGraph()) != 2 {
+		t.Errorf("Insert() fails to index default graph")
+	}
+
+}
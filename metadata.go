@@ -0,0 +1,178 @@
+package semtools
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+)
+
+
+// provNamespace is the iri prefix of the W3C provenance
+// ontology.
+const provNamespace = "http://www.w3.org/ns/prov#"
+
+// Well known keys of statement metadata, taken from the W3C
+// provenance ontology. Any other iri can be used as key as well.
+const (
+
+	// MetadataSource is the key of the source a statement was
+	// derived from, e.g. a file.
+	MetadataSource = provNamespace + "wasDerivedFrom"
+
+	// MetadataActivity is the key of the activity that generated
+	// a statement, e.g. an import job.
+	MetadataActivity = provNamespace + "wasGeneratedBy"
+
+	// MetadataTimestamp is the key of the time a statement was
+	// generated at, typically a xsd:dateTime literal.
+	MetadataTimestamp = provNamespace + "generatedAtTime"
+
+)
+
+// Metadata describes a statement, e.g. its provenance. It maps
+// the iris of predicates to the values describing the statement,
+// which makes it exportable as RDF-star annotations or reified
+// statements.
+type Metadata map[string]Node
+
+// Keys returns the sorted keys of the metadata.
+func (m Metadata) Keys() []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AnnotatedStatement is a statement carrying metadata. The metadata
+// doesn't take part in comparing statements, knowledge bases keep
+// the metadata a statement was first inserted with.
+type AnnotatedStatement interface {
+
+	Statement
+
+	// Metadata returns the metadata of the statement, which must
+	// not be modified.
+	Metadata() Metadata
+
+}
+
+// NewAnnotatedStatement creates a new statement with the given
+// metadata.
+func NewAnnotatedStatement(subject NamedNode, predicate NamedNode, object Node, graph NamedNode, metadata Metadata) AnnotatedStatement {
+	copied := Metadata{}
+	for k, v := range metadata {
+		copied[k] = v
+	}
+	return &annotatedStatement{
+		statement: statement{
+			subject: subject,
+			predicate: predicate,
+			object: object,
+			graph: graph,
+		},
+		metadata: copied,
+	}
+}
+
+// MetadataOf returns the metadata of the statement or nil if
+// the statement has no metadata.
+func MetadataOf(stmt Statement) Metadata {
+	if a, ok := stmt.(AnnotatedStatement); ok && len(a.Metadata()) > 0 {
+		return a.Metadata()
+	}
+	return nil
+}
+
+// ReifyStatements returns the statements followed by reified
+// statements describing their metadata. Every annotated statement
+// is reified as a node of type rdf:Statement with the rdf:subject,
+// rdf:predicate and rdf:object of the statement, and the metadata
+// as further properties, within the graph of the statement. The
+// iris of the nodes are derived from the statements.
+func ReifyStatements(stmts []Statement) []Statement {
+	res := []Statement{}
+	reifications := []Statement{}
+	for _, stmt := range stmts {
+		metadata := MetadataOf(stmt)
+		res = append(res, withMetadata(stmt, nil))
+		if metadata == nil {
+			continue
+		}
+
+		r := NewNamedNode(reificationIri(stmt))
+		graph := stmt.Graph()
+		reifications = append(reifications,
+			NewStatement(r, NewNamedNode(rdfNamespace + "type"), NewNamedNode(rdfNamespace + "Statement"), graph),
+			NewStatement(r, NewNamedNode(rdfNamespace + "subject"), stmt.Subject(), graph),
+			NewStatement(r, NewNamedNode(rdfNamespace + "predicate"), stmt.Predicate(), graph),
+			NewStatement(r, NewNamedNode(rdfNamespace + "object"), stmt.Object(), graph),
+		)
+		for _, k := range metadata.Keys() {
+			reifications = append(reifications, NewStatement(r, NewNamedNode(k), metadata[k], graph))
+		}
+	}
+	return append(res, reifications...)
+}
+
+// reificationIri derives the iri of the reification of the
+// statement from its key, so literals with values of different
+// kinds get their own reifications.
+func reificationIri(stmt Statement) string {
+	hash := sha1.Sum([]byte(statementKey(stmt)))
+	return "urn:semtools:statement:" + hex.EncodeToString(hash[:])
+}
+
+// withMetadata returns a copy of the statement with the metadata,
+// or without metadata if it is empty. Statements without metadata
+// are returned as they are if the metadata is empty.
+func withMetadata(stmt Statement, metadata Metadata) Statement {
+	current := MetadataOf(stmt)
+	if len(current) == 0 && len(metadata) == 0 {
+		return stmt
+	}
+	if len(metadata) == 0 {
+		return NewStatement(stmt.Subject(), stmt.Predicate(), stmt.Object(), stmt.Graph())
+	}
+	return NewAnnotatedStatement(stmt.Subject(), stmt.Predicate(), stmt.Object(), stmt.Graph(), metadata)
+}
+
+
+
+// MetadataExpression matches statements whose metadata value for
+// the predicate satisfies the expression. The expression is evaluated
+// on a statement with the value as object, ie. patterns and filters
+// at the ObjectPosition apply to the value.
+type MetadataExpression struct {
+
+	// Predicate is the key of the metadata value.
+	Predicate NamedNode
+
+	// Expression is evaluated on the value.
+	Expression Expression
+
+}
+
+func (e *MetadataExpression) Evaluate(stmt Statement) bool {
+	value := MetadataOf(stmt)[e.Predicate.Iri()]
+	if value == nil {
+		return false
+	}
+	return e.Expression.Evaluate(NewStatement(stmt.Subject(), e.Predicate, value, stmt.Graph()))
+}
+
+func (e *MetadataExpression) String() string {
+	return "metadata " + formatNode(e.Predicate) + " (" + e.Expression.String() + ")"
+}
+
+
+
+type annotatedStatement struct {
+	statement
+	metadata Metadata
+}
+
+func (s *annotatedStatement) Metadata() Metadata {
+	return s.metadata
+}
@@ -0,0 +1,194 @@
+package semtools
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func annotatedTestStatements() []Statement {
+	confidence := "http://example.com/confidence"
+	dateTime := NewNamedNode(xsdNamespace + "dateTime")
+	decimal := NewNamedNode(xsdNamespace + "decimal")
+	return []Statement{
+		NewAnnotatedStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"), nil, Metadata{
+			MetadataSource: NewNamedNode("file:///a.ttl"),
+			MetadataTimestamp: NewTypedLiteral("2019-09-18T10:00:00Z", dateTime),
+			confidence: NewTypedLiteral("0.9", decimal),
+		}),
+		NewAnnotatedStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("c"), nil, Metadata{
+			MetadataSource: NewNamedNode("file:///b.ttl"),
+			MetadataTimestamp: NewTypedLiteral("2020-01-01T10:00:00Z", dateTime),
+			confidence: NewTypedLiteral("0.5", decimal),
+		}),
+		NewStatement(NewNamedNode("a"), NewNamedNode("q"), NewLocalizedLiteral("A", "en"), nil),
+	}
+}
+
+
+func TestAnnotatedStatement(t *testing.T) {
+
+	metadata := Metadata{MetadataSource: NewNamedNode("file:///a.ttl")}
+	stmt := NewAnnotatedStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"), nil, metadata)
+	metadata[MetadataActivity] = NewNamedNode("job")
+	if len(stmt.Metadata()) != 1 || !MetadataOf(stmt)[MetadataSource].Equals(NewNamedNode("file:///a.ttl")) {
+		t.Errorf("NewAnnotatedStatement() expected a copy of the metadata but got %v", stmt.Metadata())
+	}
+	if !stmt.Equals(NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"), nil)) {
+		t.Errorf("Equals() expected metadata to be ignored")
+	}
+	if MetadataOf(NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"), nil)) != nil {
+		t.Errorf("MetadataOf() expected nil for plain statements")
+	}
+	if keys := (Metadata{"b": nil, "a": nil}).Keys(); len(keys) != 2 || keys[0] != "a" {
+		t.Errorf("Keys() expected sorted keys but got %v", keys)
+	}
+
+}
+
+
+func TestMetadataKnowledgeBase(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert(annotatedTestStatements())
+
+	// the metadata of the first insert is kept
+	kb.Insert([]Statement{NewAnnotatedStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"), nil, Metadata{MetadataSource: NewNamedNode("other")})})
+	stmts := kb.Statements()
+	if len(stmts) != 3 || !MetadataOf(stmts[0])[MetadataSource].Equals(NewNamedNode("file:///a.ttl")) || MetadataOf(stmts[2]) != nil {
+		t.Errorf("Insert() expected the metadata to be preserved but got %v", stmts)
+	}
+	kb.CopyGraph(kb.DefaultGraph(), NewNamedNode("g"))
+	if res := kb.Graph(NewNamedNode("g")).Statements(); len(res) != 3 || len(MetadataOf(res[1])) != 3 {
+		t.Errorf("CopyGraph() expected the metadata to be copied but got %v", res)
+	}
+
+	queries := map[string]Query{
+		"source": kb.Select().Graph(kb.DefaultGraph()).Metadata(NewNamedNode(MetadataSource), NewNamedNode("file:///b.ttl")),
+		"confidence": kb.Select().Graph(kb.DefaultGraph()).MetadataFilter(NewNamedNode("http://example.com/confidence"), GreaterOrEqualFilter, NewTypedLiteral("0.8", NewNamedNode(xsdNamespace + "decimal"))),
+		"timestamp": kb.Select().Graph(kb.DefaultGraph()).MetadataFilter(NewNamedNode(MetadataTimestamp), GreaterThanFilter, NewTypedLiteral("2019-12-31T00:00:00Z", NewNamedNode(xsdNamespace + "dateTime"))),
+		"unknown": kb.Select().Graph(kb.DefaultGraph()).Not().Metadata(NewNamedNode(MetadataActivity), NewNamedNode("job")),
+	}
+	expected := map[string][]string{
+		"source": {"c"},
+		"confidence": {"b"},
+		"timestamp": {"c"},
+		"unknown": {"b", "c", "A"},
+	}
+	for name, q := range queries {
+		res, err := q.ResultsContext(context.Background())
+		objects := []string{}
+		for _, r := range res {
+			objects = append(objects, r.Object().String())
+		}
+		if err != nil || strings.Join(objects, " ") != strings.Join(expected[name], " ") {
+			t.Errorf("%v: Results() expected %v but got %v (%v)", name, expected[name], objects, err)
+		}
+	}
+
+	if _, err := kb.Select().Metadata(nil, NewNamedNode("x")).ResultsContext(context.Background()); err == nil {
+		t.Errorf("Metadata() expected to fail without predicate")
+	}
+	p, err := kb.Select().Graph(NewNamedNode("g")).Metadata(NewNamedNode(MetadataSource), NewParameter("source")).Prepare()
+	if err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+	if res, err := p.Results(map[string]Node{"source": NewNamedNode("file:///a.ttl")}); err != nil || len(res) != 1 || len(p.Parameters()) != 1 {
+		t.Errorf("Results() expected to bind the parameter of the metadata but got %v (%v)", res, err)
+	}
+
+	expr, err := queries["confidence"].Expression()
+	if err != nil {
+		t.Fatalf("Expression() failed: %v", err)
+	}
+	encoded, err := MarshalExpression(expr)
+	if err != nil {
+		t.Fatalf("MarshalExpression() failed: %v", err)
+	}
+	if decoded, err := UnmarshalExpression(encoded); err != nil || decoded.String() != expr.String() {
+		t.Errorf("UnmarshalExpression() expected %v but got %v (%v)", expr, decoded, err)
+	}
+
+}
+
+
+func TestMetadataEncoding(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert(annotatedTestStatements())
+
+	buf := &bytes.Buffer{}
+	if err := WriteBinary(buf, kb, nil); err != nil {
+		t.Fatalf("WriteBinary() failed: %v", err)
+	}
+	loaded := NewKnowledgeBase("loaded")
+	if _, err := ReadBinary(buf, loaded); err != nil {
+		t.Fatalf("ReadBinary() failed: %v", err)
+	}
+	if stmts := loaded.Statements(); len(stmts) != 3 || len(MetadataOf(stmts[1])) != 3 || !MetadataOf(stmts[1])[MetadataSource].Equals(NewNamedNode("file:///b.ttl")) || MetadataOf(stmts[2]) != nil {
+		t.Errorf("ReadBinary() expected the metadata to be loaded but got %v", stmts)
+	}
+
+	log := NewMemoryChangeLog()
+	replayed := NewKnowledgeBase("replayed")
+	NewKnowledgeBaseWithOptions("logged", &KnowledgeBaseOptions{ChangeLog: log}).Insert(annotatedTestStatements())
+	if err := ReplayChanges(replayed, log, 0); err != nil {
+		t.Fatalf("ReplayChanges() failed: %v", err)
+	}
+	if stmts := replayed.Statements(); len(stmts) != 3 || len(MetadataOf(stmts[0])) != 3 {
+		t.Errorf("ReplayChanges() expected the metadata to be replayed but got %v", stmts)
+	}
+
+}
+
+
+func TestMetadataExport(t *testing.T) {
+
+	stmts := ReifyStatements(annotatedTestStatements())
+	if len(stmts) != 3 + 2 * 7 {
+		t.Fatalf("ReifyStatements() expected %v statements but got %v", 3 + 2 * 7, len(stmts))
+	}
+	if MetadataOf(stmts[0]) != nil || !stmts[0].Object().Equals(NewNamedNode("b")) {
+		t.Errorf("ReifyStatements() expected the statements without metadata first but got %v", stmts[0])
+	}
+	kb := NewKnowledgeBase("kb")
+	kb.Insert(stmts)
+	r := kb.Select().Predicate(NewNamedNode(rdfNamespace + "object")).Object(NewNamedNode("c")).Results()
+	if len(r) != 1 || len(kb.Select().Subject(r[0].Subject()).Results()) != 7 || !strings.HasPrefix(r[0].Subject().Iri(), "urn:semtools:statement:") {
+		t.Errorf("ReifyStatements() expected a reification of the statement but got %v", r)
+	}
+	if res := kb.Select().Subject(r[0].Subject()).Predicate(NewNamedNode(MetadataSource)).Results(); len(res) != 1 || !res[0].Object().Equals(NewNamedNode("file:///b.ttl")) {
+		t.Errorf("ReifyStatements() expected the source of the statement but got %v", res)
+	}
+
+	integer := NewNamedNode(xsdNamespace + "integer")
+	source := Metadata{MetadataSource: NewNamedNode("file:///a.ttl")}
+	reified := ReifyStatements([]Statement{
+		NewAnnotatedStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral(1, integer), nil, source),
+		NewAnnotatedStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("1", integer), nil, source),
+	})
+	if len(reified) != 2 + 2 * 5 || reified[2].Subject().Equals(reified[7].Subject()) {
+		t.Errorf("ReifyStatements() expected a reification per kind of value but got %v", reified)
+	}
+
+	parser := NewTurtleParser(&TurtleParserOptions{Annotations: true})
+	ttl, err := parser.Marshal(annotatedTestStatements())
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	expected := `<b> {| <http://example.com/confidence> "0.9"^^<http://www.w3.org/2001/XMLSchema#decimal> ; <http://www.w3.org/ns/prov#generatedAtTime> "2019-09-18T10:00:00Z"^^<http://www.w3.org/2001/XMLSchema#dateTime> ; <http://www.w3.org/ns/prov#wasDerivedFrom> <file:///a.ttl> |}`
+	if !strings.Contains(ttl, expected) || strings.Count(ttl, "{|") != 2 {
+		t.Errorf("Marshal() expected the annotations but got %v", ttl)
+	}
+
+}
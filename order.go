@@ -0,0 +1,126 @@
+package semtools
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+
+// Ordering describes the sort order of query results
+// by the node at a position.
+type Ordering struct {
+
+	// Position is the position of the node to order by.
+	Position Position
+
+	// Descending reverses the order.
+	Descending bool
+
+}
+
+// CompareNodes defines a total order of nodes similar to SPARQL,
+// it returns -1, 0 or 1. Missing nodes come first, followed by
+// named nodes ordered by iri and literals ordered by value where
+// the values are comparable and by lexical form, datatype and
+// language otherwise.
+func CompareNodes(a Node, b Node) int {
+	if c := compareOrdered(nodeRank(a) < nodeRank(b), nodeRank(a) > nodeRank(b)); c != 0 {
+		return c
+	}
+	switch av := a.(type) {
+	case NamedNode:
+		bv := b.(NamedNode)
+		return strings.Compare(av.Iri(), bv.Iri())
+	case LiteralNode:
+		bv := b.(LiteralNode)
+		if c, ok := CompareLiterals(av, bv); ok && c != 0 {
+			return c
+		}
+		if c := strings.Compare(av.String(), bv.String()); c != 0 {
+			return c
+		}
+		if c := strings.Compare(LiteralDatatype(av).Iri(), LiteralDatatype(bv).Iri()); c != 0 {
+			return c
+		}
+		return strings.Compare(literalLanguage(av), literalLanguage(bv))
+	}
+	return 0
+}
+
+// CompareStatements defines a total order of statements by comparing
+// subject, predicate, object and graph one after another.
+func CompareStatements(a Statement, b Statement) int {
+	for _, p := range []Position{SubjectPosition, PredicatePosition, ObjectPosition, GraphPosition} {
+		if c := CompareNodes(p.Of(a), p.Of(b)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareByOrderings compares two statements by the orderings,
+// falling back on CompareStatements for a total order.
+func compareByOrderings(a Statement, b Statement, orderings []Ordering) int {
+	for _, o := range orderings {
+		c := CompareNodes(o.Position.Of(a), o.Position.Of(b))
+		if o.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return CompareStatements(a, b)
+}
+
+func nodeRank(n Node) int {
+	switch n.(type) {
+	case nil:
+		return 0
+	case NamedNode:
+		return 1
+	case LiteralNode:
+		return 2
+	}
+	return 3
+}
+
+func literalLanguage(ln LiteralNode) string {
+	if l, ok := ln.(LocalizedLiteral); ok {
+		return l.Language()
+	}
+	return ""
+}
+
+
+// CursorOf creates an opaque cursor identifying the statement,
+// which can be used to continue query results after the statement
+// using Query.After().
+func CursorOf(stmt Statement) string {
+	nodes, err := statementToJSON(stmt)
+	if err != nil {
+		return ""
+	}
+	data, _ := json.Marshal(nodes)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// statementFromCursor restores the statement identified by
+// the cursor.
+func statementFromCursor(cursor string) (Statement, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor: %v", err)
+	}
+	encoded := []*nodeJSON{}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, fmt.Errorf("Invalid cursor: %v", cursor)
+	}
+	stmt, err := statementFromJSON(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor: %v", err)
+	}
+	return stmt, nil
+}
@@ -0,0 +1,131 @@
+package semtools
+
+import (
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestCompareNodes(t *testing.T) {
+
+	xsdInteger := NewNamedNode(xsdNamespace + "integer")
+
+	ordered := []Node{
+		nil,
+		NewNamedNode("a"),
+		NewNamedNode("b"),
+		NewTypedLiteral("2", xsdInteger),
+		NewTypedLiteral("10", xsdInteger),
+		NewLocalizedLiteral("x", "de"),
+		NewLocalizedLiteral("x", "en"),
+	}
+	for i := range ordered {
+		for j := range ordered {
+			expected := compareOrdered(i < j, i > j)
+			if c := CompareNodes(ordered[i], ordered[j]); c != expected {
+				t.Errorf("CompareNodes(%v, %v) expected %v but got %v", ordered[i], ordered[j], expected, c)
+			}
+		}
+	}
+
+}
+
+
+func TestCursor(t *testing.T) {
+
+	s := NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer")), nil)
+	r, err := statementFromCursor(CursorOf(s))
+	if err != nil || !r.Equals(s) {
+		t.Errorf("CursorOf() fails to restore statement, got %v (%v)", r, err)
+	}
+
+	if _, err := statementFromCursor("invalid"); err == nil {
+		t.Errorf("statementFromCursor() fails to reject invalid cursor")
+	}
+
+}
+
+
+func TestQueryOrderingAndPaging(t *testing.T) {
+
+	xsdInteger := NewNamedNode(xsdNamespace + "integer")
+	age := NewNamedNode("age")
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("max"), age, NewTypedLiteral("34", xsdInteger), nil),
+		NewStatement(NewNamedNode("mara"), age, NewTypedLiteral("8", xsdInteger), nil),
+		NewStatement(NewNamedNode("bill"), age, NewTypedLiteral("100", xsdInteger), nil),
+		NewStatement(NewNamedNode("bill"), NewNamedNode("knows"), NewNamedNode("max"), nil),
+	})
+
+	res := kb.Select().Predicate(age).OrderBy(ObjectPosition).Results()
+	if len(res) != 3 || res[0].Object().String() != "8" || res[2].Object().String() != "100" {
+		t.Errorf("OrderBy() fails to order literals by value: %v", res)
+	}
+
+	res = kb.Select().OrderByDescending(SubjectPosition).OrderBy(PredicatePosition).Results()
+	if len(res) != 4 || !res[0].Subject().Equals(NewNamedNode("max")) || !res[2].Predicate().Equals(age) {
+		t.Errorf("OrderByDescending() fails to order by multiple positions: %v", res)
+	}
+
+	res = kb.Select().OrderBy(SubjectPosition).Offset(1).Limit(2).Results()
+	if len(res) != 2 || !res[0].Subject().Equals(NewNamedNode("bill")) || !res[1].Subject().Equals(NewNamedNode("mara")) {
+		t.Errorf("Offset() and Limit() fail to page results: %v", res)
+	}
+	if idxs := kb.Select().Limit(0).ResultIndexes(); len(idxs) != 0 {
+		t.Errorf("Limit() fails to restrict result indexes")
+	}
+
+	// page through with cursors while inserting in between
+	page := kb.Select().Predicate(age).OrderBy(ObjectPosition).Limit(2).Results()
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("anna"), age, NewTypedLiteral("1", xsdInteger), nil),
+		NewStatement(NewNamedNode("zoe"), age, NewTypedLiteral("99", xsdInteger), nil),
+	})
+	page = kb.Select().Predicate(age).OrderBy(ObjectPosition).After(CursorOf(page[1])).Limit(2).Results()
+	if len(page) != 2 || page[0].Object().String() != "99" || page[1].Object().String() != "100" {
+		t.Errorf("After() fails to continue after cursor: %v", page)
+	}
+
+	if err := kb.Select().After("invalid").Err(); err == nil {
+		t.Errorf("After() fails to report invalid cursor")
+	}
+
+}
+
+
+func TestQueryDistinct(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("max"), NewNamedNode("knows"), NewNamedNode("mara"), NewNamedNode("g1")),
+		NewStatement(NewNamedNode("max"), NewNamedNode("knows"), NewNamedNode("bill"), NewNamedNode("g2")),
+		NewStatement(NewNamedNode("mara"), NewNamedNode("knows"), NewNamedNode("max"), NewNamedNode("g1")),
+		NewStatement(NewNamedNode("mara"), NewNamedNode("owns"), NewNamedNode("bill"), NewNamedNode("g1")),
+	})
+
+	if res := kb.Select().DistinctSubjects(); len(res) != 2 {
+		t.Errorf("DistinctSubjects() expected 2 subjects but got %v", res)
+	}
+	if res := kb.Select().DistinctPredicates(); len(res) != 2 {
+		t.Errorf("DistinctPredicates() expected 2 predicates but got %v", res)
+	}
+	if res := kb.Select().DistinctObjects(); len(res) != 3 {
+		t.Errorf("DistinctObjects() expected 3 objects but got %v", res)
+	}
+	if res := kb.Select().DistinctGraphs(); len(res) != 2 {
+		t.Errorf("DistinctGraphs() expected 2 graphs but got %v", res)
+	}
+	if res := kb.Select().OrderByDescending(ObjectPosition).Limit(1).DistinctObjects(); len(res) != 1 || !res[0].Equals(NewNamedNode("max")) {
+		t.Errorf("DistinctObjects() fails to apply ordering and limit: %v", res)
+	}
+
+}
@@ -0,0 +1,346 @@
+package semtools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NTriplesParserOptions are options that configure
+// the parser with some settings
+type NTriplesParserOptions struct {
+
+	// Quads configures the parser to work with N-Quads,
+	// ie. the graph of a statement is written as fourth
+	// term (if it has one) and accepted during Unmarshal.
+	Quads bool
+
+	// Terms is an optional dictionary the nodes created
+	// during Unmarshal are interned with.
+	Terms TermDictionary
+
+}
+
+// NTriplesParser is a entity compatible with Parser
+// that works with N-Triples (and N-Quads) content,
+// including quoted triples of N-Triples-star. Each
+// statement is written on a line of its own. Blank
+// nodes are named nodes with an iri of the form `_:label`.
+type NTriplesParser struct {
+
+	// options contains the runtime options to
+	// apply during parsing
+	options *NTriplesParserOptions
+
+}
+
+// NewNTriplesParser creates a new N-Triples parser with
+// the given options
+func NewNTriplesParser(opts *NTriplesParserOptions) *NTriplesParser {
+	// make sure things are initialized
+	if opts == nil {
+		opts = &NTriplesParserOptions{}
+	}
+	// create new parser
+	return &NTriplesParser{
+		options: opts,
+	}
+}
+
+// Marshal creates the N-Triples representation of the
+// statements, in the order they are given.
+func (p *NTriplesParser) Marshal(stmts []Statement) (string, error) {
+	var b strings.Builder
+	for _, stmt := range stmts {
+		nodes := []Node{stmt.Subject(), stmt.Predicate(), stmt.Object()}
+		if p.options.Quads && stmt.Graph() != nil {
+			nodes = append(nodes, stmt.Graph())
+		}
+		for _, n := range nodes {
+			s, err := p.marshalNode(n)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(s + " ")
+		}
+		b.WriteString(".\n")
+	}
+	return b.String(), nil
+}
+
+// Unmarshal creates statements from the given N-Triples
+// data. Literals without language or type are localized
+// literals of the language "default", as in the TurtleParser.
+func (p *NTriplesParser) Unmarshal(str string) ([]Statement, error) {
+	result := []Statement{}
+	for idx, line := range strings.Split(str, "\n") {
+		s := &ntScanner{str: line}
+		s.skipSpace()
+		if s.done() || s.peek() == '#' {
+			continue
+		}
+
+		nodes := []Node{}
+		for !s.done() && s.peek() != '.' {
+			n, err := p.unmarshalNode(s)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to unmarshal line %v: %v", idx + 1, err)
+			}
+			nodes = append(nodes, n)
+			s.skipSpace()
+		}
+		if s.done() {
+			return nil, fmt.Errorf("Unable to unmarshal line %v: missing '.'", idx + 1)
+		}
+		s.pos++
+		s.skipSpace()
+		if !s.done() && s.peek() != '#' {
+			return nil, fmt.Errorf("Unable to unmarshal line %v: unexpected '%v'", idx + 1, s.str[s.pos:])
+		}
+
+		if len(nodes) != 3 && (len(nodes) != 4 || !p.options.Quads) {
+			return nil, fmt.Errorf("Unable to unmarshal line %v: expected a statement but got %v terms", idx + 1, len(nodes))
+		}
+		stmt, err := p.statement(nodes)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to unmarshal line %v: %v", idx + 1, err)
+		}
+		result = append(result, stmt)
+	}
+	return result, nil
+}
+
+// statement creates the statement of the subject, predicate,
+// object and optional graph.
+func (p *NTriplesParser) statement(nodes []Node) (Statement, error) {
+	subject, sok := nodes[0].(NamedNode)
+	predicate, pok := nodes[1].(NamedNode)
+	if _, ok := nodes[1].(QuotedTriple); ok || !sok || !pok {
+		return nil, fmt.Errorf("subject and predicate have to be iris")
+	}
+	var graph NamedNode
+	if len(nodes) == 4 {
+		g, ok := nodes[3].(NamedNode)
+		if _, quoted := nodes[3].(QuotedTriple); !ok || quoted {
+			return nil, fmt.Errorf("graph has to be an iri")
+		}
+		graph = g
+	}
+	return NewStatement(subject, predicate, nodes[2], graph), nil
+}
+
+// marshalNode creates the N-Triples representation of the node.
+func (p *NTriplesParser) marshalNode(n Node) (string, error) {
+	switch v := n.(type) {
+	case QuotedTriple:
+		parts := []string{}
+		for _, qn := range []Node{v.Subject(), v.Predicate(), v.Object()} {
+			s, err := p.marshalNode(qn)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return "<< " + strings.Join(parts, " ") + " >>", nil
+	case Parameter:
+		return "", fmt.Errorf("Unable to marshal Node '%v'", n)
+	case NamedNode:
+		if strings.HasPrefix(v.Iri(), "_:") {
+			return v.Iri(), nil
+		}
+		return "<" + v.Iri() + ">", nil
+	case LocalizedLiteral:
+		if v.Language() == "" || v.Language() == "default" {
+			return marshalNTriplesString(v.String()), nil
+		}
+		return marshalNTriplesString(v.String()) + "@" + v.Language(), nil
+	case TypedLiteral:
+		if v.Type() == nil || v.Type().Iri() == xsdNamespace + "string" {
+			return marshalNTriplesString(v.String()), nil
+		}
+		return marshalNTriplesString(v.String()) + "^^<" + v.Type().Iri() + ">", nil
+	}
+	return "", fmt.Errorf("Unable to marshal Node '%v'", n)
+}
+
+// unmarshalNode reads the node at the position of the scanner.
+func (p *NTriplesParser) unmarshalNode(s *ntScanner) (Node, error) {
+	var node Node
+	switch {
+	case strings.HasPrefix(s.str[s.pos:], "<<"):
+		s.pos += 2
+		nodes := []Node{}
+		for s.skipSpace(); !strings.HasPrefix(s.str[s.pos:], ">>"); s.skipSpace() {
+			if s.done() || len(nodes) == 3 {
+				return nil, fmt.Errorf("missing '>>' of quoted triple")
+			}
+			n, err := p.unmarshalNode(s)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		}
+		s.pos += 2
+		if len(nodes) != 3 {
+			return nil, fmt.Errorf("expected a quoted triple but got %v terms", len(nodes))
+		}
+		stmt, err := p.statement(nodes)
+		if err != nil {
+			return nil, err
+		}
+		return NewQuotedTriple(stmt.Subject(), stmt.Predicate(), stmt.Object()), nil
+	case s.peek() == '<':
+		end := strings.IndexByte(s.str[s.pos:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("missing '>' of iri")
+		}
+		node = p.namedNode(s.str[s.pos + 1:s.pos + end])
+		s.pos += end + 1
+	case strings.HasPrefix(s.str[s.pos:], "_:"):
+		start := s.pos
+		for !s.done() && s.peek() != ' ' && s.peek() != '\t' && !strings.HasPrefix(s.str[s.pos:], ">>") {
+			s.pos++
+		}
+		// a trailing '.' terminates the statement
+		if s.str[s.pos - 1] == '.' {
+			s.pos--
+		}
+		node = p.namedNode(s.str[start:s.pos])
+	case s.peek() == '"':
+		value, err := s.literal()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(s.str[s.pos:], "^^<"):
+			end := strings.IndexByte(s.str[s.pos:], '>')
+			if end < 0 {
+				return nil, fmt.Errorf("missing '>' of datatype")
+			}
+			node = NewTypedLiteral(value, p.namedNode(s.str[s.pos + 3:s.pos + end]))
+			s.pos += end + 1
+		case !s.done() && s.peek() == '@':
+			start := s.pos + 1
+			for s.pos++; !s.done() && (isNTriplesLanguageChar(s.peek())); s.pos++ {
+			}
+			node = NewLocalizedLiteral(value, s.str[start:s.pos])
+		default:
+			node = NewLocalizedLiteral(value, "default")
+		}
+	default:
+		return nil, fmt.Errorf("unexpected '%v'", s.str[s.pos:])
+	}
+	if p.options.Terms != nil {
+		node = p.options.Terms.Intern(node)
+	}
+	return node, nil
+}
+
+// namedNode creates the named node with the iri, interned
+// if a term dictionary is configured.
+func (p *NTriplesParser) namedNode(iri string) NamedNode {
+	if p.options.Terms != nil {
+		return internNamedNode(p.options.Terms, NewNamedNode(iri))
+	}
+	return NewNamedNode(iri)
+}
+
+// marshalNTriplesString returns the escaped string including
+// the wrapping quotes, escaped as in canonical N-Triples.
+var ntStringEscapes = map[rune]string{'\b': "\\b", '\t': "\\t", '\n': "\\n", '\f': "\\f", '\r': "\\r", '"': "\\\"", '\\': "\\\\"}
+func marshalNTriplesString(str string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range str {
+		if escaped, ok := ntStringEscapes[r]; ok {
+			b.WriteString(escaped)
+		} else if r <= 0x1f || r == 0x7f {
+			fmt.Fprintf(&b, "\\u%04X", r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// isNTriplesLanguageChar returns if the character can be part
+// of a language tag.
+func isNTriplesLanguageChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+}
+
+
+
+// ntScanner reads the terms of a single line.
+type ntScanner struct {
+	str string
+	pos int
+}
+
+func (s *ntScanner) done() bool {
+	return s.pos >= len(s.str)
+}
+
+func (s *ntScanner) peek() byte {
+	return s.str[s.pos]
+}
+
+func (s *ntScanner) skipSpace() {
+	for !s.done() && (s.peek() == ' ' || s.peek() == '\t' || s.peek() == '\r') {
+		s.pos++
+	}
+}
+
+// literal reads the quoted string at the position, resolving
+// its escape sequences.
+func (s *ntScanner) literal() (string, error) {
+	var b strings.Builder
+	for s.pos++; !s.done(); s.pos++ {
+		c := s.peek()
+		if c == '"' {
+			s.pos++
+			return b.String(), nil
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		s.pos++
+		if s.done() {
+			break
+		}
+		switch s.peek() {
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case '"', '\'', '\\':
+			b.WriteByte(s.peek())
+		case 'u', 'U':
+			length := 4
+			if s.peek() == 'U' {
+				length = 8
+			}
+			if s.pos + length >= len(s.str) {
+				return "", fmt.Errorf("incomplete escape sequence")
+			}
+			r, err := strconv.ParseUint(s.str[s.pos + 1:s.pos + 1 + length], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", fmt.Errorf("invalid escape sequence '%v'", s.str[s.pos - 1:s.pos + 1 + length])
+			}
+			b.WriteRune(rune(r))
+			s.pos += length
+		default:
+			return "", fmt.Errorf("invalid escape sequence '\\%v'", string(s.peek()))
+		}
+	}
+	return "", fmt.Errorf("missing '\"' of literal")
+}
@@ -0,0 +1,101 @@
+package semtools
+
+import (
+	"strings"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestNTriplesParserUnmarshal(t *testing.T) {
+
+	p := NewNTriplesParser(nil)
+	stmts, err := p.Unmarshal(`# a comment
+<http://example.com/a> <http://example.com/p> "Hallo \"Welt\"\nä"@de-AT .
+_:b1 <http://example.com/p> "1"^^<http://www.w3.org/2001/XMLSchema#integer> . # trailing comment
+
+<< <http://example.com/a> <http://example.com/p> _:b1 >> <http://example.com/source> "plain" .
+<http://example.com/c> <http://example.com/says> <<<http://example.com/a> <http://example.com/p> << _:b1 <http://example.com/q> "x" >>>>.
+`)
+	if err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	expected := []Statement{
+		NewStatement(NewNamedNode("http://example.com/a"), NewNamedNode("http://example.com/p"), NewLocalizedLiteral("Hallo \"Welt\"\nä", "de-AT"), nil),
+		NewStatement(NewNamedNode("_:b1"), NewNamedNode("http://example.com/p"), NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer")), nil),
+		NewStatement(NewQuotedTriple(NewNamedNode("http://example.com/a"), NewNamedNode("http://example.com/p"), NewNamedNode("_:b1")), NewNamedNode("http://example.com/source"), NewLocalizedLiteral("plain", "default"), nil),
+		NewStatement(NewNamedNode("http://example.com/c"), NewNamedNode("http://example.com/says"), NewQuotedTriple(NewNamedNode("http://example.com/a"), NewNamedNode("http://example.com/p"), NewQuotedTriple(NewNamedNode("_:b1"), NewNamedNode("http://example.com/q"), NewLocalizedLiteral("x", "default"))), nil),
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("Unmarshal() expected %v statements but got %v", len(expected), stmts)
+	}
+	for idx, stmt := range stmts {
+		if !stmt.Equals(expected[idx]) {
+			t.Errorf("Unmarshal() expected %v but got %v", expected[idx], stmt)
+		}
+	}
+
+	for _, invalid := range []string{
+		`<a> <p> <b>`,
+		`<a> <p> <b> <g> .`,
+		`"a" <p> <b> .`,
+		`<a> << <a> <p> <b> >> <b> .`,
+		`<a> <p> << <a> <p> >> .`,
+		`<a> <p> "unterminated .`,
+		`<a> <p> "\x" .`,
+		`<a> <p> <b> . <c>`,
+	} {
+		if _, err := p.Unmarshal(invalid); err == nil {
+			t.Errorf("Unmarshal() expected to fail for %v", invalid)
+		}
+	}
+
+}
+
+
+func TestNTriplesParserMarshal(t *testing.T) {
+
+	stmts := []Statement{
+		NewStatement(NewNamedNode("http://example.com/a"), NewNamedNode("http://example.com/p"), NewLocalizedLiteral("line\n\"quoted\"", "default"), NewNamedNode("http://example.com/g")),
+		NewStatement(NewNamedNode("_:b1"), NewNamedNode("http://example.com/p"), NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer")), nil),
+		NewStatement(NewQuotedTriple(NewNamedNode("_:b1"), NewNamedNode("http://example.com/p"), NewLocalizedLiteral("A", "en")), NewNamedNode("http://example.com/source"), NewNamedNode("http://example.com/file"), NewNamedNode("http://example.com/g")),
+	}
+
+	triples, err := NewNTriplesParser(nil).Marshal(stmts)
+	expected := `<http://example.com/a> <http://example.com/p> "line\n\"quoted\"" .
+_:b1 <http://example.com/p> "1"^^<http://www.w3.org/2001/XMLSchema#integer> .
+<< _:b1 <http://example.com/p> "A"@en >> <http://example.com/source> <http://example.com/file> .
+`
+	if err != nil || triples != expected {
+		t.Errorf("Marshal() expected %v but got %v (%v)", expected, triples, err)
+	}
+
+	p := NewNTriplesParser(&NTriplesParserOptions{Quads: true, Terms: NewTermDictionary()})
+	quads, err := p.Marshal(stmts)
+	if err != nil || !strings.HasSuffix(strings.Split(quads, "\n")[2], `<http://example.com/file> <http://example.com/g> .`) {
+		t.Errorf("Marshal() expected the graphs of the statements but got %v (%v)", quads, err)
+	}
+	res, err := p.Unmarshal(quads)
+	if err != nil || len(res) != len(stmts) {
+		t.Fatalf("Unmarshal() expected %v statements but got %v (%v)", len(stmts), res, err)
+	}
+	for idx, stmt := range res {
+		if !stmt.Equals(stmts[idx]) {
+			t.Errorf("Unmarshal() expected %v but got %v", stmts[idx], stmt)
+		}
+	}
+	if res[1].Subject() != res[2].Subject().(QuotedTriple).Subject() {
+		t.Errorf("Unmarshal() expected interned nodes")
+	}
+	if _, err := p.Marshal([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewParameter("o"), nil)}); err == nil {
+		t.Errorf("Marshal() expected to fail for parameters")
+	}
+
+}
@@ -3,6 +3,7 @@ package semtools
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"sort"
 )
@@ -43,6 +44,15 @@ type TurtleParserOptions struct {
 	// to fallback on the first subject if no base tag is found.
 	FallbackToFirstSubjectForBaseIri bool
 
+	// Terms is an optional dictionary the nodes created
+	// during Unmarshal are interned with.
+	Terms TermDictionary
+
+	// Annotations will configure the Marshal function to
+	// write the metadata of annotated statements as RDF-star
+	// annotations, ie. `:s :p :o {| :source :file |} .`.
+	Annotations bool
+
 }
 
 // TurtleParser is a entity compatible with Parser
@@ -110,14 +120,37 @@ func (p *TurtleParser) Marshal(stmts []Statement) (string, error) {
 		}
 	}
 
+	// collect the metadata of the statements by their
+	// subject, predicate and object
+	annotations := map[string]Metadata{}
+	if p.options.Annotations {
+		for _, stmt := range stmts {
+			metadata := MetadataOf(stmt)
+			if metadata == nil {
+				continue
+			}
+			key := annotationKey(stmt.Subject().Iri(), stmt.Predicate().Iri(), stmt.Object())
+			if _, ok := annotations[key]; !ok {
+				annotations[key] = Metadata{}
+			}
+			for k, v := range metadata {
+				annotations[key][k] = v
+			}
+		}
+	}
+
 	// we'll only use the vertices as that's the information
 	// we store in ttl format.
 	// therefore we first order the vertices by subject
 	// and predicate
+	// the subjects are kept as well, as quoted triples
+	// can't be recreated from their iri
 	grouped := make(map[string]map[string][]Node)
+	subjects := make(map[string]NamedNode)
 	for _, v := range stmts {
 		if _, ok := grouped[v.Subject().Iri()]; !ok {
 			grouped[v.Subject().Iri()] = make(map[string][]Node)
+			subjects[v.Subject().Iri()] = v.Subject()
 		}
 		if _, ok := grouped[v.Subject().Iri()][v.Predicate().Iri()]; !ok {
 			grouped[v.Subject().Iri()][v.Predicate().Iri()] = make([]Node, 0)
@@ -141,7 +174,7 @@ func (p *TurtleParser) Marshal(stmts []Statement) (string, error) {
 		}
 
 		// add marshaled subject
-		ms, err := p.marshalNode(NewNamedNode(subjectIri), p.options.Substitute, ns)
+		ms, err := p.marshalNode(subjects[subjectIri], p.options.Substitute, ns)
 		if err != nil {
 			return "", err
 		}
@@ -198,6 +231,15 @@ func (p *TurtleParser) Marshal(stmts []Statement) (string, error) {
 				}
 				ttl = ttl + vs + " "
 
+				// add potential annotation
+				if metadata, ok := annotations[annotationKey(subjectIri, predicateIri, obj)]; ok {
+					as, err := p.marshalAnnotation(metadata, ns)
+					if err != nil {
+						return "", err
+					}
+					ttl = ttl + as + " "
+				}
+
 			}
 
 		}
@@ -238,75 +280,316 @@ func (p *TurtleParser) Unmarshal(str string) ([]Statement, error) {
 	var graph NamedNode
 	if baseIri != "" {
 		// set graph to be used in statements
-		graph = NewNamedNode(baseIri)
+		graph = p.namedNode(baseIri)
 		// add base iri as well to prefixes
 		ns.Set("", graph.Iri())
 	}
 
+	// replace quoted triples and annotations (RDF-star) by
+	// placeholders, as they would confuse the extraction
+	ttl_body, quoted, annotations, err := p.extractQuotedTriples(ttl_body, ns)
+	if err != nil {
+		return nil, err
+	}
+
 	// initialize result slice
 	result := []Statement{}
 
 	// extract statements to then parse into nodes and vertices
-	leadingIriMatcher := regexp.MustCompile(`^(a|<.*?>|\S*?:\S+?)\s+`)
 	for _, statement := range p.extractStatements(ttl_body) {
 
 		// extract subject of statement
-		sm := leadingIriMatcher.FindStringSubmatch(statement)
+		sm := ttlLeadingIriMatcher.FindStringSubmatch(statement)
 		if len(sm) != 2 {
 			return nil, fmt.Errorf("Unable to extract subject from statement: %v", statement)
 		}
 
 		// create named node for subject if not exist
 		subjIri := p.unmarshalIri(sm[1], ns)
-		subject := NewNamedNode(subjIri)
+		subject := p.namedNode(subjIri)
+		if qt, ok := quoted[subjIri]; ok {
+			subject = qt
+		}
 
-		// extract the substatements for the current subject
-		statement = strings.TrimSpace(leadingIriMatcher.ReplaceAllString(statement, ""))
-		for _, subStatement := range p.extractSubStatements(statement) {
+		// extract the predicates and objects for the current subject
+		statement = strings.TrimSpace(ttlLeadingIriMatcher.ReplaceAllString(statement, ""))
+		stmts, err := p.unmarshalPredicates(subject, statement, graph, ns, quoted, annotations)
+		if err != nil {
+			return nil, err
+		}
 
-			// extract predicate of sub statement
-			pm := leadingIriMatcher.FindStringSubmatch(subStatement)
-			if len(pm) != 2 {
-				return nil, fmt.Errorf("Unable to extract predicate from substatement: %v", subStatement)
+		// check if we have already the same statement in the results
+		for _, s := range stmts {
+			new := true
+			for _, r := range result {
+				if r.Equals(s) {
+					new = false
+					break;
+				}
+			}
+			if new {
+				result = append(result, s)
 			}
+		}
 
-			// create named node for predicate if not exist
-			predIri := p.unmarshalIri(pm[1], ns)
-			predicate := NewNamedNode(predIri)
+	}
 
-			// finally, let's parse the objects
-			// - first remove the leading predicate definition and trim whitespace again
-			subStatement = strings.TrimSpace(leadingIriMatcher.ReplaceAllString(subStatement, ""))
-			// - now go through all object strings, unmarshal them and add as vertice
-			for _, objectStr := range p.extractObjects(subStatement) {
 
-				// unmarshal the string into a node
-				object, err := p.unmarshalNode(objectStr, ns)
-				if err != nil {
-					return nil, fmt.Errorf("Unable to unmarshal object string: %v", objectStr)
+	return result, nil
+}
+
+// unmarshalPredicates creates the statements of the subject from
+// a statement without its leading subject, ie. `:p :o , :o2 ; :q :o3`.
+// Annotated objects are followed by the statements of their annotation,
+// or carry them as metadata if Annotations is set.
+var ttlLeadingIriMatcher = regexp.MustCompile(`^(a|<.*?>|\S*?:\S+?)\s+`)  // cache compilation of regex
+func (p *TurtleParser) unmarshalPredicates(subject NamedNode, str string, graph NamedNode, ns *Namespace, quoted map[string]QuotedTriple, annotations []string) ([]Statement, error) {
+
+	result := []Statement{}
+	for _, subStatement := range p.extractSubStatements(str) {
+
+		// extract predicate of sub statement
+		pm := ttlLeadingIriMatcher.FindStringSubmatch(subStatement)
+		if len(pm) != 2 {
+			return nil, fmt.Errorf("Unable to extract predicate from substatement: %v", subStatement)
+		}
+
+		// create named node for predicate if not exist
+		predIri := p.unmarshalIri(pm[1], ns)
+		predicate := p.namedNode(predIri)
+
+		// finally, let's parse the objects
+		// - first remove the leading predicate definition and trim whitespace again
+		subStatement = strings.TrimSpace(ttlLeadingIriMatcher.ReplaceAllString(subStatement, ""))
+		// - now go through all object strings, unmarshal them and add as vertice
+		for _, objectStr := range p.extractObjects(subStatement) {
+
+			// split off the marker of a potential annotation
+			annotation := -1
+			if idx := strings.Index(objectStr, ttlAnnotationMarker); idx >= 0 {
+				end := idx + 1 + strings.Index(objectStr[idx + 1:], ttlAnnotationMarker)
+				annotation, _ = strconv.Atoi(objectStr[idx + 1:end])
+				objectStr = objectStr[:idx] + objectStr[end + 1:]
+			}
+
+			// unmarshal the string into a node
+			object, err := p.unmarshalNode(objectStr, ns)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to unmarshal object string: %v", objectStr)
+			}
+			if n, ok := object.(NamedNode); ok && quoted[n.Iri()] != nil {
+				object = quoted[n.Iri()]
+			}
+			if p.options.Terms != nil {
+				object = p.options.Terms.Intern(object)
+			}
+			s := NewStatement(subject, predicate, object, graph)
+			if annotation < 0 {
+				result = append(result, s)
+				continue
+			}
+
+			// the annotation describes the quoted statement
+			qt := NewQuotedTriple(subject, predicate, object)
+			annotated, err := p.unmarshalPredicates(qt, annotations[annotation], graph, ns, quoted, annotations)
+			if err != nil {
+				return nil, err
+			}
+			if !p.options.Annotations {
+				result = append(append(result, s), annotated...)
+				continue
+			}
+			metadata := Metadata{}
+			nested := []Statement{}
+			for _, a := range annotated {
+				if a.Subject() == qt {
+					metadata[a.Predicate().Iri()] = a.Object()
+				} else {
+					nested = append(nested, a)
 				}
+			}
+			result = append(append(result, withMetadata(s, metadata)), nested...)
 
-				// check if we have already the same statemetn in the results
-				new := true
-				s := NewStatement(subject, predicate, object, graph)
-				for _, r := range result {
-					if r.Equals(s) {
-						new = false
-						break;
-					}
+		}
+
+	}
+	return result, nil
+
+}
+
+// extractQuotedTriples replaces the quoted triples (`<< :s :p :o >>`)
+// of the body by placeholder iris, which are returned with the
+// triples they stand for. Annotations (`:o {| :p :v |}`) are removed
+// from the body and returned, their index is appended to the annotated
+// object between two ttlAnnotationMarkers.
+const ttlAnnotationMarker = "\x00"
+const ttlQuotedPrefix = "urn:semtools:quoted:"
+func (p *TurtleParser) extractQuotedTriples(str string, ns *Namespace) (string, map[string]QuotedTriple, []string, error) {
+	// expects: `<< :a :b :c >> :source :file . :a :b :c {| :source :file |} .`
+
+	quoted := map[string]QuotedTriple{}
+	annotations := []string{}
+	if !strings.Contains(str, "<<") && !strings.Contains(str, "{|") {
+		return str, quoted, annotations, nil
+	}
+
+	// the innermost quoted triple or annotation is
+	// written to the last buffer
+	buffers := []*strings.Builder{{}}
+	kinds := []string{""}
+	indexes := []int{-1}
+	for idx := 0; idx < len(str); idx++ {
+		buf := buffers[len(buffers) - 1]
+		rest := str[idx:]
+		switch {
+
+		case rest[0] == '"':
+			// copy literals as they are
+			end := idx + 1
+			for end < len(str) && str[end] != '"' {
+				if str[end] == '\\' {
+					end++
 				}
-				if new {
-					result = append(result, s)
+				end++
+			}
+			if end >= len(str) {
+				return "", nil, nil, fmt.Errorf("Unable to find end of literal: %v", rest)
+			}
+			buf.WriteString(str[idx:end + 1])
+			idx = end
+
+		case strings.HasPrefix(rest, "<<") || strings.HasPrefix(rest, "{|"):
+			index := -1
+			if rest[0] == '{' {
+				// mark the annotated object
+				index = len(annotations)
+				annotations = append(annotations, "")
+				object := strings.TrimRight(buf.String(), " \t")
+				marker := ttlAnnotationMarker + strconv.Itoa(index) + ttlAnnotationMarker
+				if strings.HasSuffix(object, ">") {
+					object = object[:len(object) - 1] + marker + ">"
+				} else if strings.HasSuffix(object, "\"") {
+					object = object + "@default" + marker
+				} else {
+					object = object + marker
+				}
+				buf.Reset()
+				buf.WriteString(object)
+			}
+			buffers = append(buffers, &strings.Builder{})
+			kinds = append(kinds, rest[:2])
+			indexes = append(indexes, index)
+			idx++
+
+		case strings.HasPrefix(rest, ">>") && kinds[len(kinds) - 1] == "<<" || strings.HasPrefix(rest, "|}") && kinds[len(kinds) - 1] == "{|":
+			content := buf.String()
+			index := indexes[len(indexes) - 1]
+			buffers = buffers[:len(buffers) - 1]
+			kinds = kinds[:len(kinds) - 1]
+			indexes = indexes[:len(indexes) - 1]
+			if index >= 0 {
+				annotations[index] = content
+				buffers[len(buffers) - 1].WriteString(" ")
+			} else {
+				qt, err := p.unmarshalQuotedTriple(content, ns, quoted)
+				if err != nil {
+					return "", nil, nil, err
 				}
+				iri := ttlQuotedPrefix + strconv.Itoa(len(quoted))
+				quoted[iri] = qt
+				buffers[len(buffers) - 1].WriteString(" <" + iri + "> ")
+			}
+			idx++
 
+		case rest[0] == '<':
+			// copy iris as they are
+			end := strings.Index(rest, ">")
+			if end < 0 {
+				return "", nil, nil, fmt.Errorf("Unable to find end of iri: %v", rest)
 			}
+			buf.WriteString(rest[:end + 1])
+			idx += end
+
+		default:
+			buf.WriteByte(rest[0])
 
 		}
+	}
+	if len(buffers) > 1 {
+		return "", nil, nil, fmt.Errorf("Unable to find end of '%v' in ttl data", kinds[len(kinds) - 1])
+	}
+	return buffers[0].String(), quoted, annotations, nil
+
+}
 
+// unmarshalQuotedTriple creates the quoted triple from the
+// content of `<< ... >>`, nested quoted triples have to be
+// replaced by placeholders already.
+var ttlQuotedTokenMatcher = regexp.MustCompile(`"(\\.|[^"\\])*"\S*|\S+`)  // cache compilation of regex
+func (p *TurtleParser) unmarshalQuotedTriple(str string, ns *Namespace, quoted map[string]QuotedTriple) (QuotedTriple, error) {
+
+	tokens := ttlQuotedTokenMatcher.FindAllString(str, -1)
+	if len(tokens) != 3 {
+		return nil, fmt.Errorf("Unable to unmarshal quoted triple: << %v >>", strings.TrimSpace(str))
 	}
+	nodes := make([]Node, 3)
+	for idx, token := range tokens {
+		// like objects of statements, terms are literals in quotes,
+		// numbers, booleans, iris or prefixed names
+		literal := token[0] == '"' || ttlShorthandType(token) != ""
+		if !literal && token[0] != '<' && token != "a" && !strings.Contains(token, ":") {
+			return nil, fmt.Errorf("Unable to unmarshal quoted triple, unsupported term '%v': << %v >>", token, strings.TrimSpace(str))
+		}
+		if idx < 2 && literal {
+			return nil, fmt.Errorf("Unable to unmarshal quoted triple, literal '%v' as subject or predicate: << %v >>", token, strings.TrimSpace(str))
+		}
+		if !literal {
+			iri := p.unmarshalIri(token, ns)
+			if qt, ok := quoted[iri]; ok {
+				nodes[idx] = qt
+			} else {
+				nodes[idx] = p.namedNode(iri)
+			}
+			continue
+		}
+		n, err := p.unmarshalNode(token, ns)
+		if err != nil {
+			return nil, err
+		}
+		if p.options.Terms != nil {
+			n = p.options.Terms.Intern(n)
+		}
+		nodes[idx] = n
+	}
+	if _, ok := nodes[1].(QuotedTriple); ok {
+		return nil, fmt.Errorf("Unable to unmarshal quoted triple: << %v >>", strings.TrimSpace(str))
+	}
+	return NewQuotedTriple(nodes[0].(NamedNode), nodes[1].(NamedNode), nodes[2]), nil
 
+}
 
-	return result, nil
+// marshalAnnotation creates the RDF-star annotation of the
+// metadata, ie. `{| :source :file ; :confidence 0.8 |}`.
+func (p *TurtleParser) marshalAnnotation(metadata Metadata, ns *Namespace) (string, error) {
+	pairs := []string{}
+	for _, k := range metadata.Keys() {
+		ks, err := p.marshalNode(NewNamedNode(k), p.options.Substitute, ns)
+		if err != nil {
+			return "", err
+		}
+		vs, err := p.marshalNode(metadata[k], p.options.Substitute, ns)
+		if err != nil {
+			return "", err
+		}
+		pairs = append(pairs, ks + " " + vs)
+	}
+	return "{| " + strings.Join(pairs, " ; ") + " |}", nil
+}
+
+// annotationKey identifies the annotation of a statement within
+// Marshal.
+func annotationKey(subjectIri string, predicateIri string, object Node) string {
+	return subjectIri + " " + predicateIri + " " + formatNode(object)
 }
 
 // marshalNode creates the string representation of a single node
@@ -319,6 +602,21 @@ func (p *TurtleParser) marshalNode(n Node, substitute bool, ns *Namespace) (stri
 	// switch by type and marshal
 	switch n.(type) {
 
+	case QuotedTriple:
+
+		// quoted triples are written as `<< s p o >>`, their
+		// nodes may be quoted triples themselves
+		qt := n.(QuotedTriple)
+		parts := []string{}
+		for _, qn := range []Node{qt.Subject(), qt.Predicate(), qt.Object()} {
+			s, err := p.marshalNode(qn, substitute, ns)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return "<< " + strings.Join(parts, " ") + " >>", nil
+
 	case NamedNode:
 
 		// in case of named nodes, we have to substitute the
@@ -400,6 +698,15 @@ func (p *TurtleParser) marshalString(str string) string {
 
 }
 
+// namedNode creates the named node with the iri, interned
+// if a term dictionary is configured.
+func (p *TurtleParser) namedNode(iri string) NamedNode {
+	if p.options.Terms != nil {
+		return internNamedNode(p.options.Terms, NewNamedNode(iri))
+	}
+	return NewNamedNode(iri)
+}
+
 // unmarshalNode creates the node from the given string.
 // The string can be either a literal, or another iri,
 // the function will return the respective Node type.
@@ -432,6 +739,11 @@ func (p *TurtleParser) unmarshalNode(str string, ns *Namespace) (Node, error) {
 
 		}
 
+	} else if tp := ttlShorthandType(str); tp != "" {
+
+		// numbers and booleans can be written without quotes
+		return NewTypedLiteral(str, NewNamedNode(xsdNamespace + tp)), nil
+
 	} else {
 
 		// it's an iri so we return a named node
@@ -445,6 +757,26 @@ func (p *TurtleParser) unmarshalNode(str string, ns *Namespace) (Node, error) {
 
 }
 
+// ttlShorthandType returns the XSD type (without namespace) of
+// numbers and booleans written without quotes, ie. `42`, `4.2`,
+// `4.2e1` and `true`, or an empty string for other terms.
+var ttlIntegerMatcher = regexp.MustCompile(`^[+-]?[0-9]+$`)  // cache compilation of regex
+var ttlDecimalMatcher = regexp.MustCompile(`^[+-]?[0-9]*\.[0-9]+$`)
+var ttlDoubleMatcher = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)[eE][+-]?[0-9]+$`)
+func ttlShorthandType(str string) string {
+	switch {
+	case ttlIntegerMatcher.MatchString(str):
+		return "integer"
+	case ttlDecimalMatcher.MatchString(str):
+		return "decimal"
+	case ttlDoubleMatcher.MatchString(str):
+		return "double"
+	case str == "true" || str == "false":
+		return "boolean"
+	}
+	return ""
+}
+
 // unmarshalIri produces a fully qualified iri from the string
 // using the namespace.
 func (p *TurtleParser) unmarshalIri(str string, ns *Namespace) string {
@@ -626,8 +958,8 @@ func (p *TurtleParser) extractSubStatements(str string) []string {
 
 // extractObjects works no a statement (as recieved from the extractSubStatements,
 // WITHOUT the leading predicate in the substatement, so this has to be removed before!)
-// and returns a list of object strings. Each object string may be a literal, or another
-// iri.
+// and returns a list of object strings. Each object string may be a literal, a number,
+// a boolean, or another iri.
 var ttlLiteralMatcher = regexp.MustCompile(`\s*?"([\S\s]*?[^\\])*?"(((\^\^|@)(.*?))?)\s*?(,|$)`)  // cache compilation of regex
 var ttlIriMatcher = regexp.MustCompile(`\s*?(<.*?>|\S*?:\S+?)\s*?(,|$)`)
 func (p *TurtleParser) extractObjects(str string) []string {
@@ -655,6 +987,16 @@ func (p *TurtleParser) extractObjects(str string) []string {
 		objects = append(objects, match[0])
 	}
 
+	// extract numbers and booleans (the remaining terms, ignoring
+	// the marker of a potential annotation)
+	str = ttlIriMatcher.ReplaceAllString(str, "")
+	for _, term := range strings.Split(str, ",") {
+		term = strings.TrimSpace(term)
+		if ttlShorthandType(strings.Split(term, ttlAnnotationMarker)[0]) != "" {
+			objects = append(objects, term)
+		}
+	}
+
 	return objects
 
 }
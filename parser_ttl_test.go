@@ -3,6 +3,7 @@ package semtools
 import (
 	"testing"
 	"fmt"
+	"strings"
 	"github.com/sirupsen/logrus"
 )
 
@@ -140,6 +141,10 @@ func TestUnmarshalNode(t *testing.T) {
 	if err != nil || n.(TypedLiteral).Value() != "mystring" || n.(TypedLiteral).Type().Iri() != "http://www.w3.org/2001/XMLSchema#string" {
 		t.Errorf("unmarshalNode() go unexpected data")
 	}
+	n, err = p.unmarshalNode("-4.2e1", ns)
+	if err != nil || n.(TypedLiteral).Value() != "-4.2e1" || n.(TypedLiteral).Type().Iri() != "http://www.w3.org/2001/XMLSchema#double" {
+		t.Errorf("unmarshalNode() go unexpected data")
+	}
 	n, err = p.unmarshalNode("\"http://myresources:80/resources/file.py\"^^<http://www.w3.org/2001/XMLSchema#anyURI>", ns)
 	if err != nil || n.(TypedLiteral).Value() != "http://myresources:80/resources/file.py" || n.(TypedLiteral).Type().Iri() != "http://www.w3.org/2001/XMLSchema#anyURI" {
 		t.Errorf("unmarshalNode() go unexpected data")
@@ -283,6 +288,89 @@ func TestUnmarshal(t *testing.T) {
 
 }
 
+func TestUnmarshalQuotedTriples(t *testing.T) {
+	ttl_str := `@prefix ex: <http://www.test.de/test> .
+				<< ex:User1 ex:says "hi, \"there\""@en >> ex:certainty "0.8"^^<http://www.w3.org/2001/XMLSchema#decimal> .
+				ex:User2 ex:believes << ex:User1 ex:says << ex:User3 a ex:Thing >> >> .
+				ex:User1 ex:hasLastName ex:Mustermann {| ex:source ex:File ; ex:certainty "high" |} , "Muster" {| ex:source ex:Other |} .`
+
+	parser := NewTurtleParser(nil)
+	stmts, err := parser.Unmarshal(ttl_str)
+	if err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	ns := "http://www.test.de/test#"
+	said := NewQuotedTriple(NewNamedNode(ns + "User1"), NewNamedNode(ns + "says"), NewLocalizedLiteral("hi, \\\"there\\\"", "en"))
+	named := NewQuotedTriple(NewNamedNode(ns + "User1"), NewNamedNode(ns + "hasLastName"), NewNamedNode(ns + "Mustermann"))
+	expected := []Statement{
+		NewStatement(said, NewNamedNode(ns + "certainty"), NewTypedLiteral("0.8", NewNamedNode("http://www.w3.org/2001/XMLSchema#decimal")), nil),
+		NewStatement(NewNamedNode(ns + "User2"), NewNamedNode(ns + "believes"), NewQuotedTriple(NewNamedNode(ns + "User1"), NewNamedNode(ns + "says"), NewQuotedTriple(NewNamedNode(ns + "User3"), NewNamedNode(rdfNamespace + "type"), NewNamedNode(ns + "Thing"))), nil),
+		NewStatement(NewNamedNode(ns + "User1"), NewNamedNode(ns + "hasLastName"), NewLocalizedLiteral("Muster", "default"), nil),
+		NewStatement(NewQuotedTriple(NewNamedNode(ns + "User1"), NewNamedNode(ns + "hasLastName"), NewLocalizedLiteral("Muster", "default")), NewNamedNode(ns + "source"), NewNamedNode(ns + "Other"), nil),
+		NewStatement(NewNamedNode(ns + "User1"), NewNamedNode(ns + "hasLastName"), NewNamedNode(ns + "Mustermann"), nil),
+		NewStatement(named, NewNamedNode(ns + "source"), NewNamedNode(ns + "File"), nil),
+		NewStatement(named, NewNamedNode(ns + "certainty"), NewLocalizedLiteral("high", "default"), nil),
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("Unmarshal() expected %v statements but got %v", len(expected), stmts)
+	}
+	for idx, stmt := range stmts {
+		if !stmt.Equals(expected[idx]) {
+			t.Errorf("Unmarshal() expected %v but got %v", expected[idx], stmt)
+		}
+	}
+
+	// marshaled quoted triples can be unmarshaled again
+	ttl, err := parser.Marshal(stmts)
+	if err != nil || !strings.Contains(ttl, "<< <http://www.test.de/test#User1> <http://www.test.de/test#says> << <http://www.test.de/test#User3> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <http://www.test.de/test#Thing> >> >>") {
+		t.Errorf("Marshal() expected the quoted triples but got %v (%v)", ttl, err)
+	}
+	if res, err := parser.Unmarshal(ttl); err != nil || len(res) != len(stmts) {
+		t.Errorf("Unmarshal() expected %v statements but got %v (%v)", len(stmts), res, err)
+	}
+
+	// annotations are read as metadata if configured
+	parser = NewTurtleParser(&TurtleParserOptions{Annotations: true})
+	stmts, err = parser.Unmarshal(`<http://www.test.de/test#a> <http://www.test.de/test#p> <http://www.test.de/test#b> {| <http://www.w3.org/ns/prov#wasDerivedFrom> <file:///a.ttl> |} .`)
+	if err != nil || len(stmts) != 1 || !MetadataOf(stmts[0])[MetadataSource].Equals(NewNamedNode("file:///a.ttl")) {
+		t.Errorf("Unmarshal() expected the annotation as metadata but got %v (%v)", stmts, err)
+	}
+
+	// numbers and booleans can be written without quotes
+	stmts, err = parser.Unmarshal(`<< <a> <p> 42 >> <q> true . <a> <q> << <a> <p> -4.2 >> , << <a> <p> 4.2e1 >> , 7 {| <r> false |} .`)
+	if err != nil || len(stmts) != 4 {
+		t.Fatalf("Unmarshal() expected 4 statements with numbers and booleans but got %v (%v)", stmts, err)
+	}
+	xsd := func(tp string) NamedNode { return NewNamedNode(xsdNamespace + tp) }
+	expected = []Statement{
+		NewStatement(NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("42", xsd("integer"))), NewNamedNode("q"), NewTypedLiteral("true", xsd("boolean")), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("q"), NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("-4.2", xsd("decimal"))), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("q"), NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("4.2e1", xsd("double"))), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("q"), NewTypedLiteral("7", xsd("integer")), nil),
+	}
+	for idx, stmt := range expected {
+		if !stmts[idx].Equals(stmt) {
+			t.Errorf("Unmarshal() expected %v but got %v", stmt, stmts[idx])
+		}
+	}
+	if md := MetadataOf(stmts[3]); !md["r"].Equals(NewTypedLiteral("false", xsd("boolean"))) {
+		t.Errorf("Unmarshal() expected the boolean annotation but got %v", md)
+	}
+
+	for _, invalid := range []string{
+		`<a> <p> << <a> <p> >> .`,
+		`<a> <p> << <a> <p> <b> .`,
+		`<a> <p> <b> {| <q> <c> .`,
+		`<< 42 <p> <b> >> <q> <c> .`,
+		`<< <a> true <b> >> <q> <c> .`,
+	} {
+		if _, err := parser.Unmarshal(invalid); err == nil {
+			t.Errorf("Unmarshal() expected to fail for %v", invalid)
+		}
+	}
+
+}
+
 func TestExtractBaseIri(t *testing.T) {
 	valid := `@prefix : <http://www.test.de/test#> .@base <http://www.test.de/test> .
 			# http://www.test.de/test#User1
@@ -0,0 +1,228 @@
+package semtools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+
+// Patch is a sequence of additions and deletions of statements
+// that can be stored and transmitted in the RDF Patch format and
+// applied to a knowledge base, see NewPatch(), ReadPatch(),
+// WritePatch() and ApplyPatch().
+type Patch struct {
+
+	// Header holds the header entries of the patch, e.g. its
+	// "id" and the id of the "prev"ious patch.
+	Header map[string]Node
+
+	// Entries are the additions and deletions in the order
+	// they are applied.
+	Entries []PatchEntry
+
+}
+
+// PatchEntry is the addition or deletion of a statement.
+type PatchEntry struct {
+
+	// Delete is true for deletions and false for additions.
+	Delete bool
+
+	// Statement is the added or deleted statement. Deletions of
+	// statements without graph delete the statement from every
+	// graph.
+	Statement Statement
+
+}
+
+// NewPatch creates the patch of the change, which deletes the
+// removed statements before adding the added ones.
+func NewPatch(change Change) *Patch {
+	patch := &Patch{Header: map[string]Node{}, Entries: []PatchEntry{}}
+	for _, stmt := range change.Removed {
+		patch.Entries = append(patch.Entries, PatchEntry{Delete: true, Statement: stmt})
+	}
+	for _, stmt := range change.Added {
+		patch.Entries = append(patch.Entries, PatchEntry{Delete: false, Statement: stmt})
+	}
+	return patch
+}
+
+// PatchConflictError is returned by ApplyPatch() if the patch
+// doesn't fit the knowledge base.
+type PatchConflictError struct {
+
+	// Conflicts are the entries adding statements that exist
+	// already or deleting statements that don't exist.
+	Conflicts []PatchEntry
+
+}
+
+func (e *PatchConflictError) Error() string {
+	return fmt.Sprintf("Patch conflicts with the knowledge base in %v entries", len(e.Conflicts))
+}
+
+// ApplyPatch applies the entries of the patch to the knowledge base
+// in their order. The patch is only applied if none of its entries
+// conflicts with the knowledge base, ie. adds a statement that exists
+// already or deletes a statement that doesn't exist, otherwise a
+// PatchConflictError is returned. Statements added without graph are
+// added to the default graph of the knowledge base.
+func ApplyPatch(kb KnowledgeBase, patch *Patch) error {
+
+	// find conflicts, taking into account the entries
+	// applied before, graphs holds the graphs a triple
+	// exists in by their term keys
+	conflicts := []PatchEntry{}
+	triples := map[string]map[string]bool{}
+	for _, entry := range patch.Entries {
+		stmt := entry.Statement
+		if !entry.Delete && stmt.Graph() == nil {
+			stmt = withGraph([]Statement{stmt}, kb.DefaultGraph())[0]
+		}
+		key := statementKey(withGraph([]Statement{stmt}, nil)[0])
+		graphs, ok := triples[key]
+		if !ok {
+			graphs = map[string]bool{}
+			for _, r := range kb.Select().Subject(stmt.Subject()).Predicate(stmt.Predicate()).Object(stmt.Object()).Results() {
+				graphs[termKey(r.Graph())] = true
+			}
+			triples[key] = graphs
+		}
+
+		existing := graphs[termKey(stmt.Graph())]
+		if stmt.Graph() == nil {
+			// deletions without graph apply to every graph
+			for g, exists := range graphs {
+				existing = existing || exists
+				graphs[g] = false
+			}
+		}
+		if existing != entry.Delete {
+			conflicts = append(conflicts, entry)
+		}
+		graphs[termKey(stmt.Graph())] = !entry.Delete
+	}
+	if len(conflicts) > 0 {
+		return &PatchConflictError{Conflicts: conflicts}
+	}
+
+	// apply subsequent entries of the same kind at once
+	for start := 0; start < len(patch.Entries); {
+		stmts := []Statement{}
+		end := start
+		for ; end < len(patch.Entries) && patch.Entries[end].Delete == patch.Entries[start].Delete; end++ {
+			stmts = append(stmts, patch.Entries[end].Statement)
+		}
+		if patch.Entries[start].Delete {
+			kb.Delete(stmts)
+		} else {
+			kb.Insert(stmts)
+		}
+		start = end
+	}
+	return nil
+
+}
+
+// WritePatch writes the patch in the RDF Patch format, ie. its
+// header followed by a transaction of its entries. The nodes are
+// written as in N-Quads.
+func WritePatch(w io.Writer, patch *Patch) error {
+	p := NewNTriplesParser(&NTriplesParserOptions{Quads: true})
+	bw := bufio.NewWriter(w)
+
+	keys := []string{}
+	for k := range patch.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, err := p.marshalNode(patch.Header[k])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "H %v %v .\n", k, value)
+	}
+
+	bw.WriteString("TX .\n")
+	for _, entry := range patch.Entries {
+		line, err := p.Marshal([]Statement{entry.Statement})
+		if err != nil {
+			return err
+		}
+		if entry.Delete {
+			bw.WriteString("D " + line)
+		} else {
+			bw.WriteString("A " + line)
+		}
+	}
+	bw.WriteString("TC .\n")
+	return bw.Flush()
+}
+
+// ReadPatch reads a patch in the RDF Patch format. The entries of
+// aborted transactions are dropped, prefix entries are ignored as
+// the nodes have to be written with full iris.
+func ReadPatch(r io.Reader) (*Patch, error) {
+	p := NewNTriplesParser(&NTriplesParserOptions{Quads: true})
+	patch := &Patch{Header: map[string]Node{}, Entries: []PatchEntry{}}
+
+	// transaction is the index of the first entry of the
+	// current transaction or -1 outside of transactions
+	transaction := -1
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64 * 1024), 16 * 1024 * 1024)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "H":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("Unable to read patch, invalid header in line %v", number)
+			}
+			rest := strings.TrimSpace(line[1:])
+			s := &ntScanner{str: strings.TrimSpace(strings.TrimSuffix(rest[len(fields[1]):], "."))}
+			node, err := p.unmarshalNode(s)
+			if err != nil || !s.done() {
+				return nil, fmt.Errorf("Unable to read patch, invalid header in line %v", number)
+			}
+			patch.Header[fields[1]] = node
+		case "TX":
+			if transaction >= 0 {
+				return nil, fmt.Errorf("Unable to read patch, nested transaction in line %v", number)
+			}
+			transaction = len(patch.Entries)
+		case "TC", "TA":
+			if transaction < 0 {
+				return nil, fmt.Errorf("Unable to read patch, no transaction to end in line %v", number)
+			}
+			if fields[0] == "TA" {
+				patch.Entries = patch.Entries[:transaction]
+			}
+			transaction = -1
+		case "PA", "PD":
+		case "A", "D":
+			stmts, err := p.Unmarshal(line[1:])
+			if err != nil || len(stmts) != 1 {
+				return nil, fmt.Errorf("Unable to read patch, invalid statement in line %v: %v", number, err)
+			}
+			patch.Entries = append(patch.Entries, PatchEntry{Delete: fields[0] == "D", Statement: stmts[0]})
+		default:
+			return nil, fmt.Errorf("Unable to read patch, unknown entry '%v' in line %v", fields[0], number)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if transaction >= 0 {
+		return nil, fmt.Errorf("Unable to read patch, transaction is not committed")
+	}
+	return patch, nil
+}
@@ -0,0 +1,127 @@
+package semtools
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestPatch(t *testing.T) {
+
+	a := NewKnowledgeBase("a")
+	a.Insert([]Statement{
+		NewStatement(NewNamedNode("http://example.com/s"), NewNamedNode("http://example.com/p"), NewLocalizedLiteral("old", "en"), nil),
+		NewStatement(NewNamedNode("http://example.com/s"), NewNamedNode("http://example.com/q"), NewNamedNode("_:b1"), NewNamedNode("http://example.com/g")),
+	})
+	b := NewKnowledgeBase("b")
+	b.Insert([]Statement{
+		NewStatement(NewNamedNode("http://example.com/s"), NewNamedNode("http://example.com/p"), NewLocalizedLiteral("new", "en"), nil),
+		NewStatement(NewNamedNode("http://example.com/s"), NewNamedNode("http://example.com/q"), NewNamedNode("_:other"), NewNamedNode("http://example.com/g")),
+	})
+
+	patch := NewPatch(Diff(a, b))
+	patch.Header["id"] = NewNamedNode("urn:uuid:1")
+	buf := &bytes.Buffer{}
+	if err := WritePatch(buf, patch); err != nil {
+		t.Fatalf("WritePatch() failed: %v", err)
+	}
+	expected := `H id <urn:uuid:1> .
+TX .
+D <http://example.com/s> <http://example.com/p> "old"@en <default-graph> .
+A <http://example.com/s> <http://example.com/p> "new"@en <default-graph> .
+TC .
+`
+	if buf.String() != expected {
+		t.Errorf("WritePatch() expected %v but got %v", expected, buf.String())
+	}
+
+	read, err := ReadPatch(buf)
+	if err != nil {
+		t.Fatalf("ReadPatch() failed: %v", err)
+	}
+	if len(read.Entries) != 2 || !read.Entries[0].Delete || read.Entries[1].Delete || !read.Header["id"].Equals(NewNamedNode("urn:uuid:1")) {
+		t.Errorf("ReadPatch() expected the written patch but got %v", read)
+	}
+	if err := ApplyPatch(a, read); err != nil {
+		t.Fatalf("ApplyPatch() failed: %v", err)
+	}
+	if change := Diff(a, b); len(change.Added) != 0 || len(change.Removed) != 0 {
+		t.Errorf("ApplyPatch() expected the knowledge bases to be equal but got %v", change)
+	}
+
+	// applying the patch again conflicts in every entry
+	err = ApplyPatch(a, read)
+	if conflict, ok := err.(*PatchConflictError); !ok || len(conflict.Conflicts) != 2 {
+		t.Errorf("ApplyPatch() expected a conflict but got %v", err)
+	}
+	if res := a.Select().Object(NewLocalizedLiteral("new", "en")).Results(); len(res) != 1 {
+		t.Errorf("ApplyPatch() expected nothing to be applied but got %v", a.Statements())
+	}
+
+	// literals with values of different kinds are different
+	// statements, deleting one of them conflicts
+	integer := NewNamedNode(xsdNamespace + "integer")
+	c := NewKnowledgeBase("c")
+	c.Insert([]Statement{NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewTypedLiteral(1, integer), nil)})
+	err = ApplyPatch(c, &Patch{Entries: []PatchEntry{
+		{Statement: NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewTypedLiteral(1, integer), nil)},
+		{Statement: NewStatement(NewNamedNode("s"), NewNamedNode("p"), NewTypedLiteral("1", integer), nil), Delete: true},
+	}})
+	if conflict, ok := err.(*PatchConflictError); !ok || len(conflict.Conflicts) != 2 {
+		t.Errorf("ApplyPatch() expected conflicts for values of different kinds but got %v", err)
+	}
+
+}
+
+
+func TestReadPatch(t *testing.T) {
+
+	patch, err := ReadPatch(strings.NewReader(`# comment
+H id <urn:uuid:2> .
+H prev <urn:uuid:1> .
+PA ex <http://example.com/> .
+TX .
+A <http://example.com/a> <http://example.com/p> "x" .
+TA .
+TX .
+A <http://example.com/a> <http://example.com/p> "y" .
+D <http://example.com/a> <http://example.com/p> "y" .
+A _:b <http://example.com/p> << <http://example.com/a> <http://example.com/p> "z" >> <http://example.com/g> .
+TC .
+`))
+	if err != nil {
+		t.Fatalf("ReadPatch() failed: %v", err)
+	}
+	if len(patch.Header) != 2 || len(patch.Entries) != 3 || !patch.Entries[1].Delete || !patch.Entries[2].Statement.Graph().Equals(NewNamedNode("http://example.com/g")) {
+		t.Errorf("ReadPatch() expected the committed entries but got %v", patch)
+	}
+
+	// entries are checked in their order
+	kb := NewKnowledgeBase("kb")
+	if err := ApplyPatch(kb, patch); err != nil || len(kb.Statements()) != 1 {
+		t.Errorf("ApplyPatch() expected a single statement but got %v (%v)", kb.Statements(), err)
+	}
+
+	for _, invalid := range []string{
+		"TX .\nA <a> <p> <b> .\n",
+		"TC .\n",
+		"TX .\nTX .\n",
+		"A <a> <p> .\n",
+		"H id .\n",
+		"X <a> .\n",
+	} {
+		if _, err := ReadPatch(strings.NewReader(invalid)); err == nil {
+			t.Errorf("ReadPatch() expected to fail for %v", invalid)
+		}
+	}
+
+}
@@ -0,0 +1,345 @@
+package semtools
+
+import (
+	"strings"
+)
+
+
+// Path is a property path as known from SPARQL, describing
+// routes through the graph made up of the statements of a
+// knowledge base. Paths are created with the Path functions
+// (e.g. LinkPath, SequencePath) and evaluated using
+// EvaluatePath or EvaluatePathFrom.
+type Path interface {
+
+	// String returns the SPARQL syntax of the path.
+	String() string
+
+	// reachable returns the nodes reachable from the node
+	// following the path, or following the path backwards
+	// if inverse is set.
+	reachable(g *pathGraph, from Node, inverse bool) []Node
+
+}
+
+// NodePair is a pair of nodes connected by a path.
+type NodePair struct {
+	Subject Node
+	Object Node
+}
+
+// LinkPath matches statements with the predicate.
+func LinkPath(predicate NamedNode) Path {
+	return &linkPath{predicate: predicate}
+}
+
+// SequencePath matches the paths one after another.
+func SequencePath(paths ...Path) Path {
+	return &sequencePath{paths: paths}
+}
+
+// AlternativePath matches any of the paths.
+func AlternativePath(paths ...Path) Path {
+	return &alternativePath{paths: paths}
+}
+
+// InversePath matches the path from object to subject.
+func InversePath(path Path) Path {
+	return &inversePath{path: path}
+}
+
+// ZeroOrMorePath matches the path any number of times, including
+// not at all, which connects every node with itself.
+func ZeroOrMorePath(path Path) Path {
+	return &repeatPath{path: path, min: 0, unbounded: true}
+}
+
+// OneOrMorePath matches the path at least once.
+func OneOrMorePath(path Path) Path {
+	return &repeatPath{path: path, min: 1, unbounded: true}
+}
+
+// ZeroOrOnePath matches the path once or not at all.
+func ZeroOrOnePath(path Path) Path {
+	return &repeatPath{path: path, min: 0, unbounded: false}
+}
+
+// NegatedPath matches statements whose predicate is none of
+// the given predicates.
+func NegatedPath(predicates ...NamedNode) Path {
+	return &negatedPath{predicates: predicates}
+}
+
+// EvaluatePath returns all pairs of nodes within the knowledge
+// base that are connected by the path. Cycles are handled, every
+// pair is returned only once.
+func EvaluatePath(kb KnowledgeBase, path Path) []NodePair {
+	g := newPathGraph(kb.Statements())
+	res := []NodePair{}
+	for _, from := range g.nodes {
+		for _, to := range path.reachable(g, from, false) {
+			res = append(res, NodePair{Subject: from, Object: to})
+		}
+	}
+	return res
+}
+
+// EvaluatePathFrom returns the nodes that are reachable from
+// the node following the path.
+func EvaluatePathFrom(kb KnowledgeBase, path Path, from Node) []Node {
+	return path.reachable(newPathGraph(kb.Statements()), from, false)
+}
+
+// EvaluatePathTo returns the nodes from which the node is
+// reachable following the path.
+func EvaluatePathTo(kb KnowledgeBase, path Path, to Node) []Node {
+	return path.reachable(newPathGraph(kb.Statements()), to, true)
+}
+
+
+
+// pathEdge is a single predicate connection in the graph.
+type pathEdge struct {
+	predicate NamedNode
+	node Node
+}
+
+// pathGraph indexes statements by subject and object
+// for path evaluation.
+type pathGraph struct {
+	nodes []Node
+	forward map[string][]pathEdge
+	backward map[string][]pathEdge
+}
+
+func newPathGraph(stmts []Statement) *pathGraph {
+	g := &pathGraph{
+		nodes: []Node{},
+		forward: map[string][]pathEdge{},
+		backward: map[string][]pathEdge{},
+	}
+	seen := map[string]bool{}
+	addNode := func(n Node) {
+		if !seen[formatNode(n)] {
+			seen[formatNode(n)] = true
+			g.nodes = append(g.nodes, n)
+		}
+	}
+	for _, stmt := range stmts {
+		addNode(stmt.Subject())
+		addNode(stmt.Object())
+		sk, ok := formatNode(stmt.Subject()), formatNode(stmt.Object())
+		g.forward[sk] = append(g.forward[sk], pathEdge{predicate: stmt.Predicate(), node: stmt.Object()})
+		g.backward[ok] = append(g.backward[ok], pathEdge{predicate: stmt.Predicate(), node: stmt.Subject()})
+	}
+	return g
+}
+
+// edges returns the edges leaving the node in the direction.
+func (g *pathGraph) edges(from Node, inverse bool) []pathEdge {
+	if inverse {
+		return g.backward[formatNode(from)]
+	}
+	return g.forward[formatNode(from)]
+}
+
+// nodeSet collects unique nodes in order of addition.
+type nodeSet struct {
+	nodes []Node
+	seen map[string]bool
+}
+
+func newNodeSet() *nodeSet {
+	return &nodeSet{nodes: []Node{}, seen: map[string]bool{}}
+}
+
+// add adds the node and returns true if it wasn't contained yet.
+func (s *nodeSet) add(n Node) bool {
+	k := formatNode(n)
+	if s.seen[k] {
+		return false
+	}
+	s.seen[k] = true
+	s.nodes = append(s.nodes, n)
+	return true
+}
+
+
+
+type linkPath struct {
+	predicate NamedNode
+}
+
+func (p *linkPath) reachable(g *pathGraph, from Node, inverse bool) []Node {
+	res := newNodeSet()
+	for _, e := range g.edges(from, inverse) {
+		if e.predicate.Equals(p.predicate) {
+			res.add(e.node)
+		}
+	}
+	return res.nodes
+}
+
+func (p *linkPath) String() string {
+	return formatNode(p.predicate)
+}
+
+
+
+type sequencePath struct {
+	paths []Path
+}
+
+func (p *sequencePath) reachable(g *pathGraph, from Node, inverse bool) []Node {
+	current := []Node{from}
+	for idx := range p.paths {
+		// backwards the sequence is followed in reverse order
+		sub := p.paths[idx]
+		if inverse {
+			sub = p.paths[len(p.paths) - 1 - idx]
+		}
+		next := newNodeSet()
+		for _, n := range current {
+			for _, r := range sub.reachable(g, n, inverse) {
+				next.add(r)
+			}
+		}
+		current = next.nodes
+	}
+	return current
+}
+
+func (p *sequencePath) String() string {
+	return joinPaths(p.paths, "/")
+}
+
+
+
+type alternativePath struct {
+	paths []Path
+}
+
+func (p *alternativePath) reachable(g *pathGraph, from Node, inverse bool) []Node {
+	res := newNodeSet()
+	for _, sub := range p.paths {
+		for _, r := range sub.reachable(g, from, inverse) {
+			res.add(r)
+		}
+	}
+	return res.nodes
+}
+
+func (p *alternativePath) String() string {
+	return joinPaths(p.paths, "|")
+}
+
+
+
+type inversePath struct {
+	path Path
+}
+
+func (p *inversePath) reachable(g *pathGraph, from Node, inverse bool) []Node {
+	return p.path.reachable(g, from, !inverse)
+}
+
+func (p *inversePath) String() string {
+	return "^" + groupPath(p.path)
+}
+
+
+
+type repeatPath struct {
+	path Path
+	min int
+	unbounded bool
+}
+
+func (p *repeatPath) reachable(g *pathGraph, from Node, inverse bool) []Node {
+	res := newNodeSet()
+	if p.min == 0 {
+		res.add(from)
+	}
+
+	// breadth first search, the visited set takes
+	// care of cycles
+	visited := newNodeSet()
+	visited.add(from)
+	frontier := []Node{from}
+	for len(frontier) > 0 {
+		next := []Node{}
+		for _, n := range frontier {
+			for _, r := range p.path.reachable(g, n, inverse) {
+				res.add(r)
+				if visited.add(r) {
+					next = append(next, r)
+				}
+			}
+		}
+		if !p.unbounded {
+			break
+		}
+		frontier = next
+	}
+	return res.nodes
+}
+
+func (p *repeatPath) String() string {
+	if !p.unbounded {
+		return groupPath(p.path) + "?"
+	} else if p.min == 0 {
+		return groupPath(p.path) + "*"
+	}
+	return groupPath(p.path) + "+"
+}
+
+
+
+type negatedPath struct {
+	predicates []NamedNode
+}
+
+func (p *negatedPath) reachable(g *pathGraph, from Node, inverse bool) []Node {
+	res := newNodeSet()
+	for _, e := range g.edges(from, inverse) {
+		negated := false
+		for _, pred := range p.predicates {
+			if e.predicate.Equals(pred) {
+				negated = true
+				break
+			}
+		}
+		if !negated {
+			res.add(e.node)
+		}
+	}
+	return res.nodes
+}
+
+func (p *negatedPath) String() string {
+	strs := make([]string, len(p.predicates))
+	for idx, pred := range p.predicates {
+		strs[idx] = formatNode(pred)
+	}
+	return "!(" + strings.Join(strs, "|") + ")"
+}
+
+// joinPaths creates the parenthesized string of the paths
+// joined with the operator.
+func joinPaths(paths []Path, op string) string {
+	strs := make([]string, len(paths))
+	for idx, p := range paths {
+		strs[idx] = p.String()
+	}
+	return "(" + strings.Join(strs, op) + ")"
+}
+
+// groupPath wraps the string of a path in parenthesis
+// unless it is a single predicate.
+func groupPath(p Path) string {
+	switch p.(type) {
+	case *linkPath, *sequencePath, *alternativePath, *negatedPath:
+		return p.String()
+	}
+	return "(" + p.String() + ")"
+}
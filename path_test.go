@@ -0,0 +1,120 @@
+package semtools
+
+import (
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func pathTestKnowledgeBase() KnowledgeBase {
+
+	subClassOf := NewNamedNode("subClassOf")
+	label := NewNamedNode("label")
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("Dog"), subClassOf, NewNamedNode("Mammal"), nil),
+		NewStatement(NewNamedNode("Cat"), subClassOf, NewNamedNode("Mammal"), nil),
+		NewStatement(NewNamedNode("Mammal"), subClassOf, NewNamedNode("Animal"), nil),
+		NewStatement(NewNamedNode("Animal"), subClassOf, NewNamedNode("Thing"), nil),
+		// a cycle
+		NewStatement(NewNamedNode("Thing"), subClassOf, NewNamedNode("Animal"), nil),
+		NewStatement(NewNamedNode("Mammal"), label, NewLocalizedLiteral("Mammal", "en"), nil),
+	})
+	return kb
+
+}
+
+
+func nodeIris(nodes []Node) map[string]bool {
+
+	res := map[string]bool{}
+	for _, n := range nodes {
+		res[n.String()] = true
+	}
+	return res
+
+}
+
+
+func TestEvaluatePathFrom(t *testing.T) {
+
+	kb := pathTestKnowledgeBase()
+	subClassOf := LinkPath(NewNamedNode("subClassOf"))
+	label := NewNamedNode("label")
+
+	cases := []struct{
+		path Path
+		from string
+		expected []string
+	}{
+		{subClassOf, "Dog", []string{"Mammal"}},
+		{OneOrMorePath(subClassOf), "Dog", []string{"Mammal", "Animal", "Thing"}},
+		{ZeroOrMorePath(subClassOf), "Dog", []string{"Dog", "Mammal", "Animal", "Thing"}},
+		{OneOrMorePath(subClassOf), "Animal", []string{"Thing", "Animal"}},
+		{ZeroOrOnePath(subClassOf), "Dog", []string{"Dog", "Mammal"}},
+		{SequencePath(subClassOf, subClassOf), "Dog", []string{"Animal"}},
+		{SequencePath(subClassOf, InversePath(subClassOf)), "Dog", []string{"Dog", "Cat"}},
+		{AlternativePath(subClassOf, LinkPath(label)), "Mammal", []string{"Animal", "Mammal"}},
+		{NegatedPath(NewNamedNode("subClassOf")), "Mammal", []string{"Mammal"}},
+		{InversePath(OneOrMorePath(subClassOf)), "Mammal", []string{"Dog", "Cat"}},
+	}
+	for _, c := range cases {
+		res := nodeIris(EvaluatePathFrom(kb, c.path, NewNamedNode(c.from)))
+		if len(res) != len(c.expected) {
+			t.Errorf("EvaluatePathFrom(%v, %v) expected %v but got %v", c.path, c.from, c.expected, res)
+			continue
+		}
+		for _, e := range c.expected {
+			if !res[e] {
+				t.Errorf("EvaluatePathFrom(%v, %v) expected %v but got %v", c.path, c.from, c.expected, res)
+			}
+		}
+	}
+
+	res := nodeIris(EvaluatePathTo(kb, SequencePath(subClassOf, subClassOf), NewNamedNode("Animal")))
+	if len(res) != 3 || !res["Dog"] || !res["Cat"] || !res["Animal"] {
+		t.Errorf("EvaluatePathTo() returned unexpected nodes %v", res)
+	}
+
+}
+
+
+func TestEvaluatePath(t *testing.T) {
+
+	kb := pathTestKnowledgeBase()
+	subClassOf := LinkPath(NewNamedNode("subClassOf"))
+
+	if res := EvaluatePath(kb, subClassOf); len(res) != 5 {
+		t.Errorf("EvaluatePath() expected 5 pairs but got %v", res)
+	}
+	// Dog: 3, Cat: 3, Mammal: 2, Animal: 2, Thing: 2
+	if res := EvaluatePath(kb, OneOrMorePath(subClassOf)); len(res) != 12 {
+		t.Errorf("EvaluatePath() expected 12 pairs but got %v", res)
+	}
+	// additionally every of the 6 nodes reaches itself
+	if res := EvaluatePath(kb, ZeroOrMorePath(subClassOf)); len(res) != 16 {
+		t.Errorf("EvaluatePath() expected 16 pairs but got %v", res)
+	}
+
+}
+
+
+func TestPathString(t *testing.T) {
+
+	p := SequencePath(
+		ZeroOrMorePath(LinkPath(NewNamedNode("a"))),
+		InversePath(AlternativePath(LinkPath(NewNamedNode("b")), NegatedPath(NewNamedNode("c")))),
+	)
+	if p.String() != "(<a>*/^(<b>|!(<c>)))" {
+		t.Errorf("String() returned unexpected path syntax %v", p)
+	}
+
+}
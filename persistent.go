@@ -0,0 +1,409 @@
+package semtools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+
+// SyncPolicy controls when the write-ahead log of a file based
+// knowledge base is flushed to stable storage.
+type SyncPolicy string
+
+const (
+
+	// SyncAlways flushes every change before Insert() or Delete()
+	// return.
+	SyncAlways SyncPolicy = "always"
+
+	// SyncInterval flushes the changes periodically, a crash loses
+	// at most the changes of the last interval.
+	SyncInterval SyncPolicy = "interval"
+
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncPolicy = "never"
+
+)
+
+const (
+	defaultSyncInterval = time.Second
+	defaultSnapshotInterval = 10000
+)
+
+// Files within the directory of a file based knowledge base.
+const (
+	snapshotFileName = "snapshot.jsonl"
+	walFileName = "wal.log"
+)
+
+// PersistentKnowledgeBase is a knowledge base that keeps its
+// statements in durable storage.
+type PersistentKnowledgeBase interface {
+
+	KnowledgeBase
+
+	// Err returns the first error accessing the storage, as the
+	// methods of KnowledgeBase don't report errors.
+	Err() error
+
+	// Close flushes pending changes and releases the storage.
+	// Modifications after Close() are not persisted.
+	Close() error
+
+}
+
+// FileKnowledgeBase is a persistent knowledge base that keeps its
+// statements in memory, backed by a write-ahead log and snapshots.
+type FileKnowledgeBase interface {
+
+	PersistentKnowledgeBase
+
+	// Snapshot writes all statements to a new snapshot and drops
+	// the changes it contains from the write-ahead log.
+	Snapshot() error
+
+}
+
+// FileKnowledgeBaseOptions are options that configure a file
+// based knowledge base.
+type FileKnowledgeBaseOptions struct {
+
+	// KnowledgeBaseOptions configure the knowledge base, the
+	// ChangeLog is not supported as the write-ahead log takes
+	// its place.
+	KnowledgeBaseOptions
+
+	// Sync is the policy for flushing the write-ahead log.
+	// Defaults to SyncAlways.
+	Sync SyncPolicy
+
+	// SyncInterval is the interval of SyncInterval. Defaults
+	// to one second.
+	SyncInterval time.Duration
+
+	// SnapshotInterval is the number of changes after which a
+	// snapshot is written in the background. Defaults to 10000,
+	// negative values disable automatic snapshots.
+	SnapshotInterval int
+
+}
+
+// NewFileKnowledgeBase opens or creates the knowledge base stored
+// in the directory. Every change is appended to a write-ahead log
+// before Insert() or Delete() return, snapshots of the statements
+// keep the log short. On opening the last snapshot is loaded and
+// the changes of the log are replayed, changes left incomplete by
+// a crash are discarded.
+func NewFileKnowledgeBase(name string, dir string, opts *FileKnowledgeBaseOptions) (FileKnowledgeBase, error) {
+
+	// make sure things are initialized
+	if opts == nil {
+		opts = &FileKnowledgeBaseOptions{}
+	}
+	if opts.ChangeLog != nil {
+		return nil, fmt.Errorf("File knowledge bases don't support a ChangeLog")
+	}
+	policy := opts.Sync
+	if policy == "" {
+		policy = SyncAlways
+	}
+	if policy != SyncAlways && policy != SyncInterval && policy != SyncNever {
+		return nil, fmt.Errorf("Unknown sync policy '%v'", policy)
+	}
+	syncInterval := opts.SyncInterval
+	if syncInterval <= 0 {
+		syncInterval = defaultSyncInterval
+	}
+	snapshotInterval := opts.SnapshotInterval
+	if snapshotInterval == 0 {
+		snapshotInterval = defaultSnapshotInterval
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// recover from the snapshot and the log
+	kbOpts := opts.KnowledgeBaseOptions
+	kb := NewKnowledgeBaseWithOptions(name, &kbOpts).(*knowledgeBase)
+	sequence, err := readSnapshot(filepath.Join(dir, snapshotFileName), kb)
+	if err != nil {
+		return nil, err
+	}
+	log, err := NewFileChangeLog(filepath.Join(dir, walFileName), &FileChangeLogOptions{Sync: policy == SyncAlways})
+	if err != nil {
+		return nil, err
+	}
+	if err := ReplayChanges(kb, log, sequence + 1); err != nil {
+		log.Close()
+		return nil, err
+	}
+	wal := &writeAheadLog{fileChangeLog: log.(*fileChangeLog)}
+	kb.sequence = sequence
+	if last := wal.LastSequence(); last > sequence {
+		kb.sequence = last
+	}
+	kb.changeLog = wal
+
+	fkb := &fileKnowledgeBase{
+		knowledgeBase: kb,
+		dir: dir,
+		wal: wal,
+		snapshotSequence: sequence,
+		trigger: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	if snapshotInterval > 0 {
+		fkb.unlisten = kb.Listen(ChangeListenerFunc(func(change Change) {
+			if change.Sequence - atomic.LoadUint64(&fkb.snapshotSequence) >= uint64(snapshotInterval) {
+				select {
+				case fkb.trigger <- struct{}{}:
+				default:
+				}
+			}
+		}))
+	}
+	if policy != SyncInterval {
+		syncInterval = 0
+	}
+	fkb.wg.Add(1)
+	go fkb.run(syncInterval)
+	return fkb, nil
+
+}
+
+
+
+// firstError records the first of the errors reported
+// concurrently.
+type firstError struct {
+	mutex sync.Mutex
+	err error
+}
+
+func (e *firstError) record(err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *firstError) get() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.err
+}
+
+// writeAheadLog is the change log of a file based knowledge base,
+// recording the first error.
+type writeAheadLog struct {
+	*fileChangeLog
+	errs firstError
+}
+
+func (l *writeAheadLog) Append(change Change) error {
+	err := l.fileChangeLog.Append(change)
+	l.errs.record(err)
+	return err
+}
+
+
+
+type fileKnowledgeBase struct {
+	*knowledgeBase
+	dir string
+	wal *writeAheadLog
+	// snapshotMutex serializes snapshots and Close(),
+	// snapshotSequence is accessed atomically
+	snapshotMutex sync.Mutex
+	snapshotSequence uint64
+	closed bool
+	trigger chan struct{}
+	done chan struct{}
+	wg sync.WaitGroup
+	unlisten func()
+	once sync.Once
+}
+
+func (fkb *fileKnowledgeBase) Snapshot() error {
+	fkb.snapshotMutex.Lock()
+	defer fkb.snapshotMutex.Unlock()
+	if fkb.closed {
+		return fmt.Errorf("Knowledge base '%v' is closed", fkb.name)
+	}
+
+	// statements are never modified in place, so they can be
+	// written without holding the lock
+	fkb.mutex.RLock()
+	stmts, sequence := fkb.statements, fkb.sequence
+	fkb.mutex.RUnlock()
+	if err := writeSnapshot(filepath.Join(fkb.dir, snapshotFileName), sequence, stmts); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&fkb.snapshotSequence, sequence)
+
+	// no changes are appended while holding the read lock
+	fkb.mutex.RLock()
+	defer fkb.mutex.RUnlock()
+	return fkb.wal.compact(sequence)
+}
+
+func (fkb *fileKnowledgeBase) Err() error {
+	return fkb.wal.errs.get()
+}
+
+func (fkb *fileKnowledgeBase) Close() error {
+	var err error
+	fkb.once.Do(func() {
+		close(fkb.done)
+		fkb.wg.Wait()
+		if fkb.unlisten != nil {
+			fkb.unlisten()
+		}
+
+		fkb.snapshotMutex.Lock()
+		defer fkb.snapshotMutex.Unlock()
+		fkb.closed = true
+		err = fkb.wal.flush()
+		if cerr := fkb.wal.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// run flushes the log every interval, if any, and writes the
+// triggered snapshots until the knowledge base is closed.
+func (fkb *fileKnowledgeBase) run(interval time.Duration) {
+	defer fkb.wg.Done()
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-fkb.done:
+			return
+		case <-tick:
+			if err := fkb.wal.flush(); err != nil {
+				fkb.wal.errs.record(err)
+				GetLogger("knowledge-base").Errorf("Failed to flush the write-ahead log of '%v': %v", fkb.name, err)
+			}
+		case <-fkb.trigger:
+			if err := fkb.Snapshot(); err != nil {
+				GetLogger("knowledge-base").Errorf("Failed to write snapshot of '%v': %v", fkb.name, err)
+			}
+		}
+	}
+}
+
+
+
+// snapshotJSON is the first line of a snapshot, followed by one
+// line per statement.
+type snapshotJSON struct {
+	Sequence uint64 `json:"sequence"`
+}
+
+// writeSnapshot writes the statements to a new file which
+// atomically replaces the snapshot.
+func writeSnapshot(path string, sequence uint64, stmts []Statement) error {
+	tmp, err := os.OpenFile(path + ".tmp", os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	err = encoder.Encode(&snapshotJSON{Sequence: sequence})
+	for _, stmt := range stmts {
+		if err != nil {
+			break
+		}
+		var encoded []*nodeJSON
+		if encoded, err = statementToJSON(stmt); err == nil {
+			err = encoder.Encode(encoded)
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// readSnapshot inserts the statements of the snapshot into the
+// knowledge base and returns its sequence number, or 0 if there
+// is no snapshot.
+func readSnapshot(path string, kb KnowledgeBase) (uint64, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := &snapshotJSON{}
+	stmts := []Statement{}
+	for idx := 0; ; idx++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(bytes.TrimSpace(line)) == 0 {
+			break
+		} else if err == io.EOF {
+			return 0, fmt.Errorf("Snapshot '%v' is incomplete", path)
+		} else if err != nil {
+			return 0, err
+		}
+
+		if idx == 0 {
+			err = json.Unmarshal(line, header)
+		} else {
+			encoded := []*nodeJSON{}
+			if err = json.Unmarshal(line, &encoded); err == nil {
+				var stmt Statement
+				if stmt, err = statementFromJSON(encoded); err == nil {
+					stmts = append(stmts, stmt)
+				}
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("Invalid snapshot '%v' at line %v: %v", path, idx + 1, err)
+		}
+	}
+	kb.Insert(stmts)
+	return header.Sequence, nil
+}
+
+// syncDir flushes the entries of the directory, making renames
+// within it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,214 @@
+package semtools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestFileKnowledgeBase(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer")), nil)
+	b := NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewLocalizedLiteral("B", "en"), NewNamedNode("g"))
+	c := NewStatement(NewNamedNode("c"), NewNamedNode("q"), NewNamedNode("o"), nil)
+
+	kb, err := NewFileKnowledgeBase("kb", dir, &FileKnowledgeBaseOptions{SnapshotInterval: -1})
+	if err != nil {
+		t.Fatalf("NewFileKnowledgeBase() failed: %v", err)
+	}
+	kb.Insert([]Statement{a, b, b})
+	kb.Insert([]Statement{c})
+	kb.Delete([]Statement{a})
+	if err := kb.Close(); err != nil || kb.Err() != nil {
+		t.Fatalf("Close() failed: %v (%v)", err, kb.Err())
+	}
+
+	kb, err = NewFileKnowledgeBase("kb", dir, nil)
+	if err != nil {
+		t.Fatalf("NewFileKnowledgeBase() failed to reopen: %v", err)
+	}
+	defer kb.Close()
+	if stmts := kb.Statements(); len(stmts) != 2 || !stmts[0].Equals(b) || !stmts[1].Subject().Equals(NewNamedNode("c")) || !stmts[1].Graph().Equals(kb.DefaultGraph()) {
+		t.Errorf("Statements() expected the statements in order but got %v", stmts)
+	}
+	if kb.Sequence() != 3 {
+		t.Errorf("Sequence() expected 3 but got %v", kb.Sequence())
+	}
+	if res := kb.Select().Predicate(NewNamedNode("q")).Results(); len(res) != 1 {
+		t.Errorf("Select() expected 1 statement but got %v", res)
+	}
+
+	if _, err := NewFileKnowledgeBase("kb", dir, &FileKnowledgeBaseOptions{Sync: "sometimes"}); err == nil {
+		t.Errorf("NewFileKnowledgeBase() expected to fail for unknown sync policy")
+	}
+	if _, err := NewFileKnowledgeBase("kb", dir, &FileKnowledgeBaseOptions{KnowledgeBaseOptions: KnowledgeBaseOptions{ChangeLog: NewMemoryChangeLog()}}); err == nil {
+		t.Errorf("NewFileKnowledgeBase() expected to fail with a ChangeLog")
+	}
+
+}
+
+
+func TestFileKnowledgeBaseSnapshot(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wal := filepath.Join(dir, walFileName)
+
+	kb, err := NewFileKnowledgeBase("kb", dir, &FileKnowledgeBaseOptions{SnapshotInterval: -1, Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("NewFileKnowledgeBase() failed: %v", err)
+	}
+	kb.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	kb.Insert([]Statement{NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	if err := kb.Snapshot(); err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+	if info, err := os.Stat(wal); err != nil || info.Size() != 0 {
+		t.Errorf("Snapshot() expected to compact the write-ahead log but got %v (%v)", info, err)
+	}
+	kb.Delete([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("o"), kb.DefaultGraph())})
+	kb.Close()
+	if err := kb.Snapshot(); err == nil {
+		t.Errorf("Snapshot() expected to fail after Close()")
+	}
+
+	kb, err = NewFileKnowledgeBase("kb", dir, &FileKnowledgeBaseOptions{SnapshotInterval: 2, Sync: SyncInterval, SyncInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewFileKnowledgeBase() failed to reopen: %v", err)
+	}
+	defer kb.Close()
+	if stmts := kb.Statements(); len(stmts) != 1 || !stmts[0].Subject().Equals(NewNamedNode("b")) || kb.Sequence() != 3 {
+		t.Errorf("NewFileKnowledgeBase() expected snapshot and log to be recovered but got %v at %v", stmts, kb.Sequence())
+	}
+
+	// automatic snapshot after two changes
+	kb.Insert([]Statement{NewStatement(NewNamedNode("c"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	kb.Insert([]Statement{NewStatement(NewNamedNode("d"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	for idx := 0; idx < 200; idx++ {
+		if info, err := os.Stat(wal); err == nil && info.Size() == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info, err := os.Stat(wal); err != nil || info.Size() != 0 {
+		t.Errorf("Insert() expected to trigger a snapshot but got %v (%v)", info, err)
+	}
+
+}
+
+
+func TestFileKnowledgeBaseRecovery(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	wal := filepath.Join(dir, walFileName)
+	a := NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("o"), nil)
+	b := NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewNamedNode("o"), nil)
+
+	kb, err := NewFileKnowledgeBase("kb", dir, &FileKnowledgeBaseOptions{SnapshotInterval: -1})
+	if err != nil {
+		t.Fatalf("NewFileKnowledgeBase() failed: %v", err)
+	}
+	defer kb.Close()
+	kb.Insert([]Statement{a})
+	kb.Delete([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("o"), kb.DefaultGraph())})
+	kb.Insert([]Statement{b})
+
+	// crash after writing the snapshot but before compacting the log
+	// and in the middle of appending a change
+	log, err := ioutil.ReadFile(wal)
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	if err := kb.Snapshot(); err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+	log = append(log, []byte(`{"sequence": 4, "added": [[{"type": "iri", "val`)...)
+	if err := ioutil.WriteFile(wal, log, 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	recovered, err := NewFileKnowledgeBase("kb", dir, nil)
+	if err != nil {
+		t.Fatalf("NewFileKnowledgeBase() failed to recover: %v", err)
+	}
+	defer recovered.Close()
+	if stmts := recovered.Statements(); len(stmts) != 1 || !stmts[0].Subject().Equals(NewNamedNode("b")) || recovered.Sequence() != 3 {
+		t.Errorf("NewFileKnowledgeBase() expected the changes up to 3 to apply once but got %v at %v", stmts, recovered.Sequence())
+	}
+	recovered.Insert([]Statement{a})
+	if recovered.Sequence() != 4 || recovered.Err() != nil {
+		t.Errorf("Insert() expected to continue the sequence but got %v (%v)", recovered.Sequence(), recovered.Err())
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, snapshotFileName), []byte("{\"sequence\": 3}\n[{\"type\""), 0644)
+	if _, err := NewFileKnowledgeBase("kb", dir, nil); err == nil {
+		t.Errorf("NewFileKnowledgeBase() expected to fail for incomplete snapshot")
+	}
+
+}
+
+
+func TestFileKnowledgeBaseTypedLiterals(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	age := NewStatement(NewNamedNode("a"), NewNamedNode("age"), NewTypedLiteral(30, NewNamedNode(xsdNamespace + "integer")), nil)
+	active := NewStatement(NewNamedNode("a"), NewNamedNode("active"), NewTypedLiteral(true, NewNamedNode(xsdNamespace + "boolean")), nil)
+
+	kb, err := NewFileKnowledgeBase("kb", dir, &FileKnowledgeBaseOptions{SnapshotInterval: -1})
+	if err != nil {
+		t.Fatalf("NewFileKnowledgeBase() failed: %v", err)
+	}
+	kb.Insert([]Statement{age})
+	if err := kb.Snapshot(); err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+	kb.Insert([]Statement{active})
+	kb.Close()
+
+	// age is recovered from the snapshot, active from the log
+	kb, err = NewFileKnowledgeBase("kb", dir, &FileKnowledgeBaseOptions{SnapshotInterval: -1})
+	if err != nil {
+		t.Fatalf("NewFileKnowledgeBase() failed to reopen: %v", err)
+	}
+	defer kb.Close()
+	kb.Insert([]Statement{age, active})
+	if len(kb.Statements()) != 2 || kb.Sequence() != 2 {
+		t.Errorf("Insert() expected the recovered literals to be equal but got %v at %v", kb.Statements(), kb.Sequence())
+	}
+	if res := kb.Select().Object(NewTypedLiteral(30, NewNamedNode(xsdNamespace + "integer"))).Results(); len(res) != 1 {
+		t.Errorf("Select() expected the integer literal but got %v", res)
+	}
+	kb.Delete([]Statement{age, active})
+	if len(kb.Statements()) != 0 {
+		t.Errorf("Delete() expected to remove the recovered literals but got %v", kb.Statements())
+	}
+
+}
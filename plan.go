@@ -0,0 +1,325 @@
+package semtools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+
+// default selectivities used when no statistics are available
+const (
+	defaultPatternSelectivity = 0.1
+	defaultFilterSelectivity = 0.33
+	defaultSelectivity = 0.5
+)
+
+// Plan is the execution plan of a query. Candidate statements
+// are either retrieved via an index lookup or a full scan of
+// the bound knowledge base, afterwards the filter is evaluated
+// on every candidate.
+type Plan struct {
+
+	// Index is the pattern used to look up candidate statements
+	// from an IndexedKnowledgeBase, it is nil for full scans.
+	Index *PatternExpression
+
+	// Text is the text filter used to look up candidate statements
+	// from the full-text index of a TextIndexedKnowledgeBase, it is
+	// nil unless it is more selective than any index lookup.
+	Text *FilterExpression
+
+	// Filter is the optimized expression evaluated on every
+	// candidate, its operands are ordered by the optimizer.
+	Filter *PlanNode
+
+	// EstimatedCandidates is the estimated number of candidate
+	// statements retrieved by the index lookup or scan, it is 0
+	// when scanning a knowledge base without index.
+	EstimatedCandidates float64
+
+	// Candidates is the actual number of candidate statements
+	// evaluated during execution.
+	Candidates int
+
+	// base is the knowledge base used for index lookups.
+	base IndexedKnowledgeBase
+
+	// filtered is the knowledge base retrieving the candidates
+	// of the expression itself, if supported.
+	filtered FilteringKnowledgeBase
+	expr Expression
+
+	// matches are the statements found by the text filter,
+	// ordered by relevance.
+	matches []Statement
+
+}
+
+// PlanNode is a node of the filter of a plan. It wraps an
+// expression with its estimated selectivity and counts the
+// statements evaluated and matched during execution.
+type PlanNode struct {
+
+	// Expression is the expression of the node. For AND, OR and
+	// NOT expressions the operands are evaluated via Operands.
+	Expression Expression
+
+	// Operands are the plan nodes of the operands of AND, OR and
+	// NOT expressions, in the order they are evaluated.
+	Operands []*PlanNode
+
+	// Selectivity is the estimated fraction of statements that
+	// match the expression.
+	Selectivity float64
+
+	// EstimatedRows is the estimated number of matching statements
+	// of the whole knowledge base.
+	EstimatedRows float64
+
+	// Evaluated and Matched count the statements the node was
+	// evaluated on and matched during execution.
+	Evaluated int
+	Matched int
+
+}
+
+// newPlan creates the plan of the expression for the knowledge base,
+// which can be nil if the statements are provided otherwise. In that
+// case total is the number of statements the plan is executed on.
+// The size of knowledge bases without index is not estimated, as it
+// would require to read all statements before executing the plan.
+func newPlan(expr Expression, base KnowledgeBase, total int) *Plan {
+	e := &cardinalityEstimator{total: total, searches: map[string][]Statement{}}
+	if base != nil {
+		e.base, _ = base.(IndexedKnowledgeBase)
+		e.text, _ = base.(TextIndexedKnowledgeBase)
+		if e.base != nil {
+			e.total = e.base.Size()
+		}
+	}
+
+	p := &Plan{
+		Filter: e.plan(expr),
+		EstimatedCandidates: float64(e.total),
+		base: e.base,
+		expr: expr,
+	}
+	p.filtered, _ = base.(FilteringKnowledgeBase)
+
+	// choose the most selective pattern or text filter of the
+	// top level conjunction for an index lookup
+	operands := []Expression{expr}
+	if and, ok := expr.(*AndExpression); ok {
+		operands = and.Operands
+	}
+	for _, o := range operands {
+		switch v := o.(type) {
+		case *PatternExpression:
+			if e.base == nil {
+				continue
+			}
+			card := float64(e.base.Cardinality(v.Position, v.Node))
+			if (p.Index == nil && p.Text == nil) || card < p.EstimatedCandidates {
+				p.Index, p.Text, p.matches = v, nil, nil
+				p.EstimatedCandidates = card
+			}
+		case *FilterExpression:
+			matches, ok := e.search(v)
+			if ok && ((p.Index == nil && p.Text == nil) || float64(len(matches)) < p.EstimatedCandidates) {
+				p.Index, p.Text, p.matches = nil, v, matches
+				p.EstimatedCandidates = float64(len(matches))
+			}
+		}
+	}
+
+	return p
+}
+
+// candidates returns the statements the filter has to be
+// evaluated on, either from a filtering knowledge base, the
+// index or the scan function.
+func (p *Plan) candidates(scan func() StatementIterator) StatementIterator {
+	if p.filtered != nil {
+		return p.filtered.Filter(p.expr)
+	}
+	if p.Text != nil {
+		return NewSliceIterator(p.matches)
+	}
+	if p.Index != nil && p.base != nil {
+		return p.base.IterateLookup(p.Index.Position, p.Index.Node)
+	}
+	return scan()
+}
+
+// String returns the plan including the estimated and (after
+// execution) actual row counts.
+func (p *Plan) String() string {
+	lines := []string{}
+	if p.filtered != nil {
+		lines = append(lines, fmt.Sprintf("FILTERED SCAN (estimated %.0f, actual %v)", p.EstimatedCandidates, p.Candidates))
+	} else if p.Text != nil {
+		lines = append(lines, fmt.Sprintf("TEXT SEARCH %v (estimated %.0f, actual %v)", p.Text, p.EstimatedCandidates, p.Candidates))
+	} else if p.Index != nil {
+		lines = append(lines, fmt.Sprintf("INDEX LOOKUP %v (estimated %.0f, actual %v)", p.Index, p.EstimatedCandidates, p.Candidates))
+	} else {
+		lines = append(lines, fmt.Sprintf("FULL SCAN (estimated %.0f, actual %v)", p.EstimatedCandidates, p.Candidates))
+	}
+	lines = append(lines, "FILTER")
+	lines = p.Filter.lines(lines, "  ")
+	return strings.Join(lines, "\n")
+}
+
+func (n *PlanNode) Evaluate(stmt Statement) bool {
+	n.Evaluated++
+
+	res := false
+	switch n.Expression.(type) {
+	case *AndExpression:
+		res = true
+		for _, o := range n.Operands {
+			if !o.Evaluate(stmt) {
+				res = false
+				break
+			}
+		}
+	case *OrExpression:
+		for _, o := range n.Operands {
+			if o.Evaluate(stmt) {
+				res = true
+				break
+			}
+		}
+	case *NotExpression:
+		res = !n.Operands[0].Evaluate(stmt)
+	default:
+		res = n.Expression.Evaluate(stmt)
+	}
+
+	if res {
+		n.Matched++
+	}
+	return res
+}
+
+func (n *PlanNode) String() string {
+	return n.Expression.String()
+}
+
+// lines appends the lines of the node and its operands
+// using the indent.
+func (n *PlanNode) lines(lines []string, indent string) []string {
+	label := n.Expression.String()
+	switch n.Expression.(type) {
+	case *AndExpression:
+		label = "AND"
+	case *OrExpression:
+		label = "OR"
+	case *NotExpression:
+		label = "NOT"
+	}
+	lines = append(lines, fmt.Sprintf("%v%v (selectivity %.3f, estimated %.0f, actual %v of %v)",
+		indent, label, n.Selectivity, n.EstimatedRows, n.Matched, n.Evaluated))
+	for _, o := range n.Operands {
+		lines = o.lines(lines, indent + "  ")
+	}
+	return lines
+}
+
+
+
+// cardinalityEstimator estimates selectivities of expressions
+// using the statistics of a knowledge base if available.
+type cardinalityEstimator struct {
+	base IndexedKnowledgeBase
+	text TextIndexedKnowledgeBase
+	total int
+	// searches caches the matches of text filters
+	searches map[string][]Statement
+}
+
+// plan creates the plan node of the expression, ordering the
+// operands of conjunctions by ascending and of disjunctions by
+// descending selectivity, so evaluation can stop early.
+func (e *cardinalityEstimator) plan(expr Expression) *PlanNode {
+	n := &PlanNode{Expression: expr}
+
+	switch v := expr.(type) {
+	case *AndExpression:
+		n.Operands = e.planOperands(v.Operands)
+		sort.SliceStable(n.Operands, func(i, j int) bool {
+			return n.Operands[i].Selectivity < n.Operands[j].Selectivity
+		})
+		n.Selectivity = 1
+		for _, o := range n.Operands {
+			n.Selectivity *= o.Selectivity
+		}
+	case *OrExpression:
+		n.Operands = e.planOperands(v.Operands)
+		sort.SliceStable(n.Operands, func(i, j int) bool {
+			return n.Operands[i].Selectivity > n.Operands[j].Selectivity
+		})
+		miss := 1.0
+		for _, o := range n.Operands {
+			miss *= 1 - o.Selectivity
+		}
+		n.Selectivity = 1 - miss
+	case *NotExpression:
+		n.Operands = e.planOperands([]Expression{v.Operand})
+		n.Selectivity = 1 - n.Operands[0].Selectivity
+	case *TrueExpression:
+		n.Selectivity = 1
+	case *PatternExpression:
+		n.Selectivity = defaultPatternSelectivity
+		if e.base != nil {
+			n.Selectivity = 0
+			if e.total > 0 {
+				n.Selectivity = float64(e.base.Cardinality(v.Position, v.Node)) / float64(e.total)
+			}
+		}
+	case *FilterExpression:
+		n.Selectivity = defaultFilterSelectivity
+		if matches, ok := e.search(v); ok {
+			n.Selectivity = 0
+			if e.total > 0 {
+				n.Selectivity = float64(len(matches)) / float64(e.total)
+			}
+		}
+	default:
+		n.Selectivity = defaultSelectivity
+	}
+
+	n.EstimatedRows = n.Selectivity * float64(e.total)
+	return n
+}
+
+func (e *cardinalityEstimator) planOperands(operands []Expression) []*PlanNode {
+	res := make([]*PlanNode, len(operands))
+	for idx, o := range operands {
+		res[idx] = e.plan(o)
+	}
+	return res
+}
+
+// search returns the statements matching a text filter on
+// objects using the full-text index, if available.
+func (e *cardinalityEstimator) search(f *FilterExpression) ([]Statement, bool) {
+	if e.text == nil || f.Operator != TextFilter || f.Position != ObjectPosition || f.Argument == nil {
+		return nil, false
+	}
+	k := f.Argument.String()
+	if stmts, ok := e.searches[k]; ok {
+		return stmts, stmts != nil
+	}
+	matches, err := e.text.Search(k)
+	if err != nil {
+		e.searches[k] = nil
+		return nil, false
+	}
+	stmts := make([]Statement, len(matches))
+	for idx, m := range matches {
+		stmts[idx] = m.Statement
+	}
+	e.searches[k] = stmts
+	return stmts, true
+}
@@ -0,0 +1,129 @@
+package semtools
+
+import (
+	"strings"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func planTestKnowledgeBase() KnowledgeBase {
+
+	kb := NewKnowledgeBase("kb")
+	stmts := []Statement{}
+	for _, s := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		stmts = append(stmts, NewStatement(NewNamedNode(s), NewNamedNode("type"), NewNamedNode("Thing"), nil))
+		stmts = append(stmts, NewStatement(NewNamedNode(s), NewNamedNode("label"), NewLocalizedLiteral(s, "en"), nil))
+	}
+	stmts = append(stmts, NewStatement(NewNamedNode("a"), NewNamedNode("rare"), NewNamedNode("x"), nil))
+	kb.Insert(stmts)
+	return kb
+
+}
+
+
+func TestQueryPlan(t *testing.T) {
+
+	kb := planTestKnowledgeBase()
+
+	plan, err := kb.Select().
+		Predicate(NewNamedNode("type")).
+		ObjectContains("x").
+		Predicate(NewNamedNode("rare")).
+		Plan()
+	if err != nil {
+		t.Fatalf("Plan() returned unexpected error: %v", err)
+	}
+	if plan.Index == nil || !plan.Index.Node.Equals(NewNamedNode("rare")) || plan.EstimatedCandidates != 1 {
+		t.Errorf("Plan() fails to choose most selective index: %v", plan)
+	}
+	if len(plan.Filter.Operands) != 3 || plan.Filter.Operands[0].Expression.String() != "predicate = <rare>" {
+		t.Errorf("Plan() fails to order conjunction by selectivity: %v", plan)
+	}
+	if _, ok := plan.Filter.Operands[1].Expression.(*FilterExpression); !ok {
+		t.Errorf("Plan() expected filter to be evaluated second: %v", plan)
+	}
+
+	plan, _ = kb.Select().
+		Subject(NewNamedNode("a")).
+		Or().
+		Predicate(NewNamedNode("type")).
+		Plan()
+	if plan.Index != nil {
+		t.Errorf("Plan() expected full scan for disjunctions: %v", plan)
+	}
+	if plan.Filter.Operands[0].Expression.String() != "predicate = <type>" {
+		t.Errorf("Plan() fails to order disjunction by selectivity: %v", plan)
+	}
+
+	plan, _ = NewQuery().Subject(NewNamedNode("a")).Plan()
+	if plan.Index != nil || plan.Filter.Selectivity != defaultPatternSelectivity {
+		t.Errorf("Plan() fails to use defaults without knowledge base: %v", plan)
+	}
+
+	// knowledge bases without index are read only once
+	scanned := &scanCountingKnowledgeBase{KnowledgeBase: kb}
+	q := NewQuery().Bind(scanned).Subject(NewNamedNode("a"))
+	if plan, _ = q.Plan(); plan.Index != nil || plan.EstimatedCandidates != 0 || scanned.scans != 0 {
+		t.Errorf("Plan() expected an unestimated full scan without reading statements but got %v (%v scans)", plan, scanned.scans)
+	}
+	if res := q.Results(); len(res) != 3 || scanned.scans != 1 {
+		t.Errorf("Results() expected 3 statements from a single scan but got %v (%v scans)", res, scanned.scans)
+	}
+
+}
+
+
+// scanCountingKnowledgeBase hides the index of the wrapped
+// knowledge base and counts the reads of all statements.
+type scanCountingKnowledgeBase struct {
+	KnowledgeBase
+	scans int
+}
+
+func (kb *scanCountingKnowledgeBase) Statements() []Statement {
+	kb.scans++
+	return kb.KnowledgeBase.Statements()
+}
+
+func (kb *scanCountingKnowledgeBase) Iterate() StatementIterator {
+	kb.scans++
+	return kb.KnowledgeBase.Iterate()
+}
+
+
+func TestQueryExplain(t *testing.T) {
+
+	kb := planTestKnowledgeBase()
+
+	q := kb.Select().Subject(NewNamedNode("a")).Predicate(NewNamedNode("label"))
+	explain, err := q.Explain()
+	if err != nil {
+		t.Fatalf("Explain() returned unexpected error: %v", err)
+	}
+	lines := strings.Split(explain, "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Explain() returned unexpected plan:\n%v", explain)
+	}
+	if lines[0] != "INDEX LOOKUP subject = <a> (estimated 3, actual 3)" {
+		t.Errorf("Explain() returned unexpected access: %v", lines[0])
+	}
+	if !strings.HasSuffix(lines[2], "actual 1 of 3)") || !strings.Contains(lines[2], "estimated 1") {
+		t.Errorf("Explain() returned unexpected filter: %v", lines[2])
+	}
+	if len(q.Results()) != 1 {
+		t.Errorf("Results() fails to execute plan")
+	}
+
+	if _, err := kb.Select().Or().Explain(); err == nil {
+		t.Errorf("Explain() fails to report malformed query")
+	}
+
+}
@@ -0,0 +1,322 @@
+package semtools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+
+// Parameter is a placeholder node within a query, that is bound
+// to an actual node when executing the prepared query, see
+// Query.Prepare(). Parameters can be used wherever nodes are
+// expected, including filter arguments.
+type Parameter interface {
+
+	NamedNode
+
+	// Name returns the name of the parameter.
+	Name() string
+
+}
+
+// NewParameter creates a new parameter with the name.
+func NewParameter(name string) Parameter {
+	return &parameter{name: name}
+}
+
+// PreparedQuery is a query that was compiled once and can be
+// executed many times with different parameter values. Prepared
+// queries are immutable and safe for concurrent use.
+type PreparedQuery interface {
+
+	// Parameters returns the names of the parameters of the query.
+	Parameters() []string
+
+	// Expression returns the expression tree of the query, which
+	// contains the parameters as nodes.
+	Expression() Expression
+
+	// Results executes the query on the knowledge base it was
+	// prepared for, using the values of the parameters.
+	Results(params map[string]Node) ([]Statement, error)
+
+	// ResultsContext works like Results() but honours the context
+	// and limits, see Query.ResultsContext().
+	ResultsContext(ctx context.Context, params map[string]Node) ([]Statement, error)
+
+	// Iterate works like Results() but returns an iterator over
+	// the results.
+	Iterate(params map[string]Node) StatementIterator
+
+	// IterateContext works like Iterate() but honours the context
+	// and limits, see Query.ResultsContext().
+	IterateContext(ctx context.Context, params map[string]Node) StatementIterator
+
+	// Count returns the number of results using the values of the
+	// parameters, ignoring offset and limit.
+	Count(params map[string]Node) (int, error)
+
+}
+
+
+
+type parameter struct {
+	name string
+}
+
+func (p *parameter) Name() string {
+	return p.name
+}
+
+func (p *parameter) Iri() string {
+	return "?" + p.name
+}
+
+func (p *parameter) Equals(other interface{}) bool {
+	if v, ok := other.(Parameter); ok {
+		return p.Name() == v.Name()
+	}
+	return false
+}
+
+func (p *parameter) String() string {
+	return p.Iri()
+}
+
+
+
+type preparedQuery struct {
+	base KnowledgeBase
+	expr Expression
+	params []string
+	orderings []Ordering
+	limit int
+	offset int
+	after Statement
+	groupBy []Position
+	maxResults int
+	maxScanned int
+}
+
+// newPreparedQuery captures the expression and modifiers of the
+// root query for execution on the knowledge base.
+func newPreparedQuery(q *query, base KnowledgeBase) (*preparedQuery, error) {
+	expr, err := q.build()
+	if err != nil {
+		return nil, err
+	}
+	return &preparedQuery{
+		base: base,
+		expr: expr,
+		params: expressionParameters(expr),
+		orderings: append([]Ordering{}, q.orderings...),
+		limit: q.limit,
+		offset: q.offset,
+		after: q.after,
+		groupBy: append([]Position{}, q.groupBy...),
+		maxResults: q.maxResults,
+		maxScanned: q.maxScanned,
+	}, nil
+}
+
+func (p *preparedQuery) Parameters() []string {
+	return append([]string{}, p.params...)
+}
+
+func (p *preparedQuery) Expression() Expression {
+	return p.expr
+}
+
+func (p *preparedQuery) Results(params map[string]Node) ([]Statement, error) {
+	return p.ResultsContext(context.Background(), params)
+}
+
+func (p *preparedQuery) ResultsContext(ctx context.Context, params map[string]Node) ([]Statement, error) {
+	q, err := p.query(params)
+	if err != nil {
+		return nil, err
+	}
+	return q.ResultsContext(ctx)
+}
+
+func (p *preparedQuery) Iterate(params map[string]Node) StatementIterator {
+	return p.IterateContext(context.Background(), params)
+}
+
+func (p *preparedQuery) IterateContext(ctx context.Context, params map[string]Node) StatementIterator {
+	q, err := p.query(params)
+	if err != nil {
+		return &errorIterator{err: err}
+	}
+	return q.IterateContext(ctx)
+}
+
+func (p *preparedQuery) Count(params map[string]Node) (int, error) {
+	q, err := p.query(params)
+	if err != nil {
+		return 0, err
+	}
+	res, err := q.matches(context.Background(), false)
+	if err != nil {
+		return 0, err
+	}
+	return len(res), nil
+}
+
+// query creates a new query for a single execution with the
+// parameters bound to their values.
+func (p *preparedQuery) query(params map[string]Node) (*query, error) {
+	expr, err := bindParameters(p.expr, params)
+	if err != nil {
+		return nil, err
+	}
+	return &query{
+		base: p.base,
+		branches: [][]queryTerm{{}},
+		prepared: expr,
+		orderings: p.orderings,
+		limit: p.limit,
+		offset: p.offset,
+		after: p.after,
+		groupBy: p.groupBy,
+		maxResults: p.maxResults,
+		maxScanned: p.maxScanned,
+	}, nil
+}
+
+// key returns a string identifying the prepared query, used for
+// caching, and whether it can be cached. The expression is encoded
+// as JSON, which keeps the kinds of the values of typed literals.
+func (p *preparedQuery) key() (string, bool) {
+	expr, err := MarshalExpression(p.expr)
+	if err != nil {
+		return "", false
+	}
+	parts := []string{string(expr)}
+	for _, o := range p.orderings {
+		parts = append(parts, fmt.Sprintf("order %v %v", o.Position, o.Descending))
+	}
+	for _, g := range p.groupBy {
+		parts = append(parts, fmt.Sprintf("group %v", g))
+	}
+	if p.after != nil {
+		parts = append(parts, "after " + CursorOf(p.after))
+	}
+	parts = append(parts, fmt.Sprintf("limit %v offset %v max %v/%v", p.limit, p.offset, p.maxResults, p.maxScanned))
+	return strings.Join(parts, "\n"), true
+}
+
+
+
+// preparedQueryCache caches prepared queries by their key.
+type preparedQueryCache struct {
+	mutex sync.Mutex
+	queries map[string]PreparedQuery
+	size int
+}
+
+func newPreparedQueryCache(size int) *preparedQueryCache {
+	return &preparedQueryCache{queries: map[string]PreparedQuery{}, size: size}
+}
+
+// prepare returns the cached prepared query of the same shape
+// or prepares and caches the query for the knowledge base. When
+// the cache is full it is emptied, queries of expressions that
+// can't be encoded aren't cached.
+func (c *preparedQueryCache) prepare(q *query, base KnowledgeBase) (PreparedQuery, error) {
+	p, err := newPreparedQuery(q, base)
+	if err != nil {
+		return nil, err
+	}
+	k, ok := p.key()
+	if !ok {
+		return p, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if cached, ok := c.queries[k]; ok {
+		return cached, nil
+	}
+	if len(c.queries) >= c.size {
+		c.queries = map[string]PreparedQuery{}
+	}
+	c.queries[k] = p
+	return p, nil
+}
+
+
+
+// expressionParameters returns the sorted names of the parameters
+// used within the expression.
+func expressionParameters(expr Expression) []string {
+	names := map[string]bool{}
+	RewriteExpression(expr, func(e Expression) Expression {
+		var n Node
+		switch v := e.(type) {
+		case *PatternExpression:
+			n = v.Node
+		case *FilterExpression:
+			n = v.Argument
+		}
+		if p, ok := n.(Parameter); ok {
+			names[p.Name()] = true
+		}
+		return nil
+	})
+	res := []string{}
+	for n := range names {
+		res = append(res, n)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// bindParameters replaces the parameters within the expression
+// by their values, every parameter has to have a value.
+func bindParameters(expr Expression, params map[string]Node) (Expression, error) {
+	var err error
+	bound := RewriteExpression(expr, func(e Expression) Expression {
+		switch v := e.(type) {
+		case *PatternExpression:
+			p, ok := v.Node.(Parameter)
+			if !ok {
+				return nil
+			}
+			value, ok := params[p.Name()]
+			if !ok || value == nil {
+				err = fmt.Errorf("No value for parameter '%v'", p.Name())
+				return e
+			}
+			if _, ok := value.(NamedNode); !ok && v.Position != ObjectPosition {
+				err = fmt.Errorf("Parameter '%v' requires a named node as %v", p.Name(), v.Position)
+				return e
+			}
+			return &PatternExpression{Position: v.Position, Node: value}
+		case *FilterExpression:
+			p, ok := v.Argument.(Parameter)
+			if !ok {
+				return nil
+			}
+			value, ok := params[p.Name()]
+			if !ok || value == nil {
+				err = fmt.Errorf("No value for parameter '%v'", p.Name())
+				return e
+			}
+			f, ferr := NewFilterExpression(v.Position, v.Operator, value)
+			if ferr != nil {
+				err = ferr
+				return e
+			}
+			return f
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bound, nil
+}
@@ -0,0 +1,160 @@
+package semtools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestPreparedQuery(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	integer := NewNamedNode(xsdNamespace + "integer")
+	for i := 0; i < 10; i++ {
+		kb.Insert([]Statement{
+			NewStatement(NewNamedNode(fmt.Sprintf("s%v", i)), NewNamedNode("age"), NewTypedLiteral(fmt.Sprint(i * 10), integer), nil),
+			NewStatement(NewNamedNode(fmt.Sprintf("s%v", i)), NewNamedNode("name"), NewLocalizedLiteral(fmt.Sprintf("name%v", i), "en"), nil),
+		})
+	}
+
+	q := kb.Select().Subject(NewParameter("subject")).Predicate(NewNamedNode("age"))
+	if _, err := q.ResultsContext(context.Background()); err == nil {
+		t.Errorf("ResultsContext() expected to fail for unbound parameter")
+	}
+
+	p, err := q.Prepare()
+	if err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+	if ps := p.Parameters(); len(ps) != 1 || ps[0] != "subject" {
+		t.Errorf("Parameters() expected [subject] but got %v", ps)
+	}
+	if p.Expression().String() != "(subject = ?subject AND predicate = <age>)" {
+		t.Errorf("Expression() expected to contain parameter but got %v", p.Expression())
+	}
+
+	// the query can be changed without affecting the prepared one
+	q.Object(NewNamedNode("x"))
+
+	res, err := p.Results(map[string]Node{"subject": NewNamedNode("s3")})
+	if err != nil || len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("s3")) {
+		t.Errorf("Results() fails to bind parameter: %v (%v)", res, err)
+	}
+	if _, err := p.Results(map[string]Node{}); err == nil {
+		t.Errorf("Results() expected to fail for missing parameter")
+	}
+	if _, err := p.Results(map[string]Node{"subject": NewLocalizedLiteral("s3", "en")}); err == nil {
+		t.Errorf("Results() expected to fail for literal subject")
+	}
+
+	// filter arguments
+	p, err = kb.Select().
+		Predicate(NewNamedNode("age")).
+		Filter(ObjectPosition, GreaterOrEqualFilter, NewParameter("min")).
+		OrderByDescending(ObjectPosition).
+		Limit(2).
+		Prepare()
+	if err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+	res, err = p.Results(map[string]Node{"min": NewTypedLiteral("50", integer)})
+	if err != nil || len(res) != 2 || !res[0].Subject().Equals(NewNamedNode("s9")) {
+		t.Errorf("Results() fails to bind filter parameter: %v (%v)", res, err)
+	}
+	if n, err := p.Count(map[string]Node{"min": NewTypedLiteral("50", integer)}); err != nil || n != 5 {
+		t.Errorf("Count() expected 5 but got %v (%v)", n, err)
+	}
+	if _, err := p.Results(map[string]Node{"min": NewNamedNode("50")}); err == nil {
+		t.Errorf("Results() expected to fail for invalid filter argument")
+	}
+	it := p.Iterate(map[string]Node{})
+	if it.Next() || it.Err() == nil {
+		t.Errorf("Iterate() expected to fail for missing parameter")
+	}
+
+	// literals with values of different kinds are prepared separately
+	kinds := NewKnowledgeBase("kinds")
+	kinds.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral(1, integer), nil)})
+	for _, value := range []interface{}{1, "1"} {
+		p, err := kinds.Prepare(NewQuery().Object(NewTypedLiteral(value, integer)))
+		if err != nil {
+			t.Fatalf("Prepare() failed: %v", err)
+		}
+		if res, err := p.Results(nil); err != nil || (len(res) == 1) != (value == 1) {
+			t.Errorf("Results() expected only the integer literal to match but got %v for %#v (%v)", res, value, err)
+		}
+	}
+
+	if _, err := kb.Select().Group().Prepare(); err == nil {
+		t.Errorf("Prepare() expected to fail for malformed query")
+	}
+
+}
+
+
+func TestPreparedQueryConcurrency(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	for i := 0; i < 100; i++ {
+		kb.Insert([]Statement{
+			NewStatement(NewNamedNode(fmt.Sprintf("s%v", i)), NewNamedNode("p"), NewNamedNode("o"), nil),
+		})
+	}
+
+	p, err := kb.Prepare(NewQuery().Subject(NewParameter("s")))
+	if err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+	if c, _ := kb.Prepare(NewQuery().Subject(NewParameter("s"))); c != p {
+		t.Errorf("Prepare() expected to return cached query")
+	}
+	if c, _ := kb.Prepare(NewQuery().Subject(NewParameter("s")).Limit(1)); c == p {
+		t.Errorf("Prepare() expected to distinguish solution modifiers")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for w := 0; w < 10; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if w == 0 {
+					kb.Insert([]Statement{NewStatement(NewNamedNode(fmt.Sprintf("n%v", i)), NewNamedNode("p"), NewNamedNode("o"), nil)})
+					continue
+				}
+				s := NewNamedNode(fmt.Sprintf("s%v", i))
+				res, err := p.Results(map[string]Node{"s": s})
+				if err != nil || len(res) != 1 || !res[0].Subject().Equals(s) {
+					errs <- fmt.Errorf("unexpected results for %v: %v (%v)", s, res, err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Results() failed concurrently: %v", err)
+	}
+
+	view := kb.Graph(kb.DefaultGraph())
+	p, err = view.Prepare(NewQuery().Subject(NewParameter("s")))
+	if err != nil {
+		t.Fatalf("Prepare() of graph view failed: %v", err)
+	}
+	if res, _ := p.Results(map[string]Node{"s": NewNamedNode("n1")}); len(res) != 1 {
+		t.Errorf("Results() of graph view expected 1 statement but got %v", len(res))
+	}
+
+}
@@ -1,5 +1,13 @@
 package semtools
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // Query creates a query structure for matching a set
 // of statements either by providing the statments
 // directly or by binding to a knowledge base.
@@ -13,12 +21,22 @@ type Query interface {
 	// EndGroup closes an opened group.
 	EndGroup() Query
 
-	// Or combines the immediately preceeding and immediately
-	// following statement with a OR-operator. Using groups
-	// before and after combines the result of the groups
-	// as a whole.
+	// Or combines the preceeding and following operands with
+	// a OR-operator. Operands that are not separated by Or() are
+	// combined with AND, which takes precedence over OR, so
+	// a.b.Or().c is evaluated as (a AND b) OR c. Use groups to
+	// change the precedence.
 	Or() Query
 
+	// And combines the preceeding and following operands with
+	// a AND-operator. This is the default when no operator is
+	// given and only exists for readability.
+	And() Query
+
+	// Not negates the immediately following operand, which can
+	// be a single match or a whole group.
+	Not() Query
+
 	// Graph matches a given graph node in the statements.
 	Graph(node NamedNode) Query
 
@@ -31,6 +49,122 @@ type Query interface {
 	// Object matches a given object node in the statements.
 	Object(node Node) Query
 
+	// ObjectMatches matches literal objects whose lexical form
+	// matches the regular expression.
+	ObjectMatches(pattern string) Query
+
+	// ObjectContains matches literal objects whose lexical form
+	// contains the string.
+	ObjectContains(str string) Query
+
+	// ObjectStartsWith matches literal objects whose lexical form
+	// starts with the prefix.
+	ObjectStartsWith(prefix string) Query
+
+	// ObjectLessThan matches literal objects whose value is less
+	// than the given value, using XSD value semantics.
+	ObjectLessThan(value LiteralNode) Query
+
+	// ObjectLessOrEqual matches literal objects whose value is less
+	// than or equal to the given value, using XSD value semantics.
+	ObjectLessOrEqual(value LiteralNode) Query
+
+	// ObjectGreaterThan matches literal objects whose value is greater
+	// than the given value, using XSD value semantics.
+	ObjectGreaterThan(value LiteralNode) Query
+
+	// ObjectGreaterOrEqual matches literal objects whose value is greater
+	// than or equal to the given value, using XSD value semantics.
+	ObjectGreaterOrEqual(value LiteralNode) Query
+
+	// ObjectLanguage matches localized objects whose language matches
+	// the language range, e.g. "en" matches "en" and "en-US".
+	ObjectLanguage(languageRange string) Query
+
+	// ObjectDatatype matches literal objects of the given datatype.
+	ObjectDatatype(datatype NamedNode) Query
+
+	// ObjectText matches literal objects containing the words of
+	// the full-text search, see TextFilter. Queries bound to a
+	// TextIndexedKnowledgeBase use its index and return unordered
+	// results by descending relevance.
+	ObjectText(search string) Query
+
+	// Filter matches the node at the position using the filter
+	// operator and argument, see FilterExpression.
+	Filter(position Position, operator FilterOperator, argument Node) Query
+
+	// Metadata matches statements whose metadata value for the
+	// predicate equals the value, see AnnotatedStatement.
+	Metadata(predicate NamedNode, value Node) Query
+
+	// MetadataFilter matches statements whose metadata value for
+	// the predicate satisfies the filter operator and argument.
+	MetadataFilter(predicate NamedNode, operator FilterOperator, argument Node) Query
+
+	// Quoted matches statements whose node at the position is a
+	// quoted triple with the given subject, predicate and object,
+	// nil matches any node.
+	Quoted(position Position, subject NamedNode, predicate NamedNode, object Node) Query
+
+	// OrderBy sorts the results ascending by the node at the
+	// position. Multiple orderings are applied in the order they
+	// were added, ties are broken by the statements themselves.
+	OrderBy(position Position) Query
+
+	// OrderByDescending sorts the results descending by the node
+	// at the position, see OrderBy().
+	OrderByDescending(position Position) Query
+
+	// Limit restricts the number of results, a negative limit
+	// removes the restriction.
+	Limit(n int) Query
+
+	// Offset skips the first n results.
+	Offset(n int) Query
+
+	// After continues the ordered results after the statement
+	// identified by the cursor (see CursorOf). Unlike Offset(),
+	// paging with cursors is stable when statements are inserted
+	// or deleted between pages.
+	After(cursor string) Query
+
+	// DistinctSubjects returns the unique subjects of the results.
+	DistinctSubjects() []NamedNode
+
+	// DistinctPredicates returns the unique predicates of the results.
+	DistinctPredicates() []NamedNode
+
+	// DistinctObjects returns the unique objects of the results.
+	DistinctObjects() []Node
+
+	// DistinctGraphs returns the unique graphs of the results.
+	DistinctGraphs() []NamedNode
+
+	// GroupBy groups the results by the nodes at the positions
+	// for Aggregate().
+	GroupBy(positions ...Position) Query
+
+	// Aggregate computes the aggregates over the results of the
+	// bound knowledge base for every group, see GroupBy(). Offset
+	// and limit apply to the groups.
+	Aggregate(aggregates ...Aggregate) ([]AggregateResult, error)
+
+	// Count returns the number of results of the bound knowledge
+	// base, ignoring offset and limit.
+	Count() int
+
+	// MaxResults limits the number of statements the query may
+	// match before execution is aborted with a QueryLimitError,
+	// zero disables the limit. Unlike Limit() this guards against
+	// unexpectedly large results rather than paging them.
+	MaxResults(n int) Query
+
+	// MaxScanned limits the number of statements the query may
+	// evaluate before execution is aborted with a QueryLimitError,
+	// zero disables the limit.
+	MaxScanned(n int) Query
+
 	// Bind binds a knowledge base to the query and will allow
 	// the use of Result() and ResultIndexes()
 	Bind(base KnowledgeBase) Query
@@ -40,9 +174,26 @@ type Query interface {
 	Evaluate(stmt Statement) bool
 
 	// Results executes the query on the bound knowledge base
-	// returning the matched statements.
+	// returning the matched statements, ordered and paged if
+	// configured.
 	Results() []Statement
 
+	// ResultsContext works like Results() but stops execution when
+	// the context is done, returning the error of the context, and
+	// reports exceeded limits as QueryLimitError. Results() and the
+	// other methods without error return no results in these cases.
+	ResultsContext(ctx context.Context) ([]Statement, error)
+
+	// Iterate executes the query on the bound knowledge base and
+	// returns an iterator over the matched statements. Unless the
+	// results are ordered, statements are matched lazily while
+	// iterating.
+	Iterate() StatementIterator
+
+	// IterateContext works like Iterate() but honours the context
+	// and limits, see ResultsContext().
+	IterateContext(ctx context.Context) StatementIterator
+
 	// ResultsFrom works like Results() just that it takes
 	// the set of statements as a parameter rather then using
 	// the bound knowledge base.
@@ -52,11 +203,84 @@ type Query interface {
 	// returning the indexes of the matched statements.
 	ResultIndexes() []int
 
+	// ResultIndexesContext works like ResultIndexes() but honours
+	// the context and limits, see ResultsContext().
+	ResultIndexesContext(ctx context.Context) ([]int, error)
+
 	// ResultIndexesFrom works like ResultIndexes() just that it takes
 	// the set of statements as a parameter rather then using
 	// the bound knowledge base.
 	ResultIndexesFrom(stmts []Statement) []int
 
+	// Plan returns the execution plan of the query for the bound
+	// knowledge base. The optimizer reorders the expression using
+	// the cardinalities of an IndexedKnowledgeBase and chooses an
+	// index lookup over a full scan where possible.
+	Plan() (*Plan, error)
+
+	// Explain executes the query on the bound knowledge base and
+	// returns the plan including estimated and actual row counts.
+	Explain() (string, error)
+
+	// Expression returns the expression tree of the whole query
+	// or an error if the query is malformed, e.g. due to
+	// unbalanced groups or dangling operators.
+	Expression() (Expression, error)
+
+	// Err returns the error of a malformed query. Malformed
+	// queries won't match any statement.
+	Err() error
+
+	// Prepare compiles the query into a PreparedQuery for the
+	// bound knowledge base, which can be executed concurrently
+	// with different values for its parameters (see NewParameter).
+	// The query itself can be changed afterwards without affecting
+	// the prepared query.
+	Prepare() (PreparedQuery, error)
+
+	// String returns a readable version of the query including
+	// its solution modifiers, this is meant for display/logging.
+	String() string
+
+	// MarshalJSON encodes the expression tree and the solution
+	// modifiers of the query as JSON, see NewQueryFromJSON().
+	MarshalJSON() ([]byte, error)
+
+	// SPARQL returns the equivalent SPARQL SELECT query binding
+	// ?subject, ?predicate, ?object and ?graph. Parameters are
+	// written as $name variables. Queries using After() or GroupBy()
+	// can't be expressed in SPARQL, as the aggregates of the groups
+	// are not part of the query.
+	SPARQL() (string, error)
+
+}
+
+// contextCheckInterval is the number of statements evaluated
+// between checks of the execution context.
+const contextCheckInterval = 256
+
+// QueryLimit identifies an execution limit of a query.
+type QueryLimit string
+
+const (
+	ResultsLimit QueryLimit = "results"
+	ScannedLimit QueryLimit = "scanned"
+)
+
+// QueryLimitError is returned when a query exceeds one of its
+// execution limits, see MaxResults() and MaxScanned().
+type QueryLimitError struct {
+
+	// Limit is the limit that was exceeded.
+	Limit QueryLimit
+
+	// Max is the configured maximum of the limit.
+	Max int
+
+}
+
+func (e *QueryLimitError) Error() string {
+	return fmt.Sprintf("Query exceeded the maximum of %v %v statements", e.Max, e.Limit)
 }
 
 // NewQuery creates a new query object.
@@ -64,8 +288,8 @@ func NewQuery() Query {
 	return &query{
 		base: nil,
 		parent: nil,
-		query: []matcher{func(stmt Statement) bool {return true}},
-		nextOp: "and",
+		branches: [][]queryTerm{{}},
+		limit: -1,
 	}
 }
 
@@ -75,140 +299,826 @@ func NewQueryWithParent(parent Query) Query {
 	return &query{
 		base: nil,
 		parent: parent,
-		query: []matcher{func(stmt Statement) bool {return true}},
-		nextOp: "and",
+		branches: [][]queryTerm{{}},
+		limit: -1,
+		open: true,
 	}
 }
 
 
 
-type matcher = func (stmt Statement) bool
+// queryTerm is a single operand of a query, either
+// an expression or a (sub-)group.
+type queryTerm struct {
+	expr Expression
+	group *query
+	negate bool
+}
 
 type query struct {
 	base KnowledgeBase
 	parent Query
-	query []matcher
-	nextOp string
+	// branches are OR-ed together, the terms
+	// within a branch are AND-ed.
+	branches [][]queryTerm
+	negate bool
+	pendingOp string
+	open bool
+	err error
+	compiled Expression
+	// prepared replaces the terms of prepared queries
+	prepared Expression
+	// solution modifiers, only used on the root
+	orderings []Ordering
+	limit int
+	offset int
+	after Statement
+	groupBy []Position
+	// execution limits, only used on the root
+	maxResults int
+	maxScanned int
+	// exactGraphs disables the union default graph of the
+	// bound knowledge base, only used on the root
+	exactGraphs bool
 }
 
 
 func (q *query) Group() Query {
-	sq := NewQueryWithParent(q)
-	q.add(func(stmt Statement) bool {
-		return sq.Evaluate(stmt)
-	})
+	sq := NewQueryWithParent(q).(*query)
+	q.addTerm(queryTerm{group: sq})
 	return sq
 }
 
 func (q *query) EndGroup() Query {
-    if q.parent == nil {
-        return q
-    }
-    return q.parent;
+	if q.parent == nil {
+		q.fail(fmt.Errorf("EndGroup() without matching Group()"))
+		return q
+	}
+	q.open = false
+	q.invalidate()
+	return q.parent
 }
 
 func (q *query) Or() Query {
-	q.nextOp = "or"
+	if len(q.branches[len(q.branches) - 1]) == 0 || q.pendingOp != "" || q.negate {
+		q.fail(fmt.Errorf("Or() without preceeding operand"))
+		return q
+	}
+	q.branches = append(q.branches, []queryTerm{})
+	q.pendingOp = "or"
+	return q
+}
+
+func (q *query) And() Query {
+	if len(q.branches[len(q.branches) - 1]) == 0 || q.pendingOp != "" || q.negate {
+		q.fail(fmt.Errorf("And() without preceeding operand"))
+		return q
+	}
+	q.pendingOp = "and"
+	return q
+}
+
+func (q *query) Not() Query {
+	q.negate = !q.negate
 	return q
 }
 
 func (q *query) Graph(node NamedNode) Query {
-	q.add(func(stmt Statement) bool {
-		if stmt.Graph() == nil {
-			return node == nil
-		}
-		return stmt.Graph().Equals(node)  
-	})
+	q.add(&PatternExpression{Position: GraphPosition, Node: nodeOrNil(node)})
 	return q
 }
 
 func (q *query) Subject(node NamedNode) Query {
-	q.add(func(stmt Statement) bool {
-		return stmt.Subject().Equals(node)  
-	})
+	q.add(&PatternExpression{Position: SubjectPosition, Node: nodeOrNil(node)})
 	return q
 }
 
 func (q *query) Predicate(node NamedNode) Query {
-	q.add(func(stmt Statement) bool {
-		return stmt.Predicate().Equals(node)  
-	})
+	q.add(&PatternExpression{Position: PredicatePosition, Node: nodeOrNil(node)})
 	return q
 }
 
 func (q *query) Object(node Node) Query {
-	q.add(func(stmt Statement) bool {
-		return stmt.Object().Equals(node)  
-	})
+	q.add(&PatternExpression{Position: ObjectPosition, Node: node})
 	return q
 }
 
+func (q *query) ObjectMatches(pattern string) Query {
+	return q.Filter(ObjectPosition, RegexFilter, stringLiteral(pattern))
+}
+
+func (q *query) ObjectContains(str string) Query {
+	return q.Filter(ObjectPosition, ContainsFilter, stringLiteral(str))
+}
+
+func (q *query) ObjectStartsWith(prefix string) Query {
+	return q.Filter(ObjectPosition, PrefixFilter, stringLiteral(prefix))
+}
+
+func (q *query) ObjectLessThan(value LiteralNode) Query {
+	return q.Filter(ObjectPosition, LessThanFilter, value)
+}
+
+func (q *query) ObjectLessOrEqual(value LiteralNode) Query {
+	return q.Filter(ObjectPosition, LessOrEqualFilter, value)
+}
+
+func (q *query) ObjectGreaterThan(value LiteralNode) Query {
+	return q.Filter(ObjectPosition, GreaterThanFilter, value)
+}
+
+func (q *query) ObjectGreaterOrEqual(value LiteralNode) Query {
+	return q.Filter(ObjectPosition, GreaterOrEqualFilter, value)
+}
+
+func (q *query) ObjectLanguage(languageRange string) Query {
+	return q.Filter(ObjectPosition, LanguageFilter, stringLiteral(languageRange))
+}
+
+func (q *query) ObjectDatatype(datatype NamedNode) Query {
+	return q.Filter(ObjectPosition, DatatypeFilter, nodeOrNil(datatype))
+}
+
+func (q *query) ObjectText(search string) Query {
+	return q.Filter(ObjectPosition, TextFilter, stringLiteral(search))
+}
+
+func (q *query) Filter(position Position, operator FilterOperator, argument Node) Query {
+	expr, err := NewFilterExpression(position, operator, argument)
+	if err != nil {
+		q.fail(err)
+		return q
+	}
+	q.add(expr)
+	return q
+}
+
+func (q *query) Metadata(predicate NamedNode, value Node) Query {
+	if predicate == nil || value == nil {
+		q.fail(fmt.Errorf("Metadata requires a predicate and a value"))
+		return q
+	}
+	q.add(&MetadataExpression{Predicate: predicate, Expression: &PatternExpression{Position: ObjectPosition, Node: value}})
+	return q
+}
+
+func (q *query) MetadataFilter(predicate NamedNode, operator FilterOperator, argument Node) Query {
+	if predicate == nil {
+		q.fail(fmt.Errorf("Metadata filter '%v' requires a predicate", operator))
+		return q
+	}
+	expr, err := NewFilterExpression(ObjectPosition, operator, argument)
+	if err != nil {
+		q.fail(err)
+		return q
+	}
+	q.add(&MetadataExpression{Predicate: predicate, Expression: expr})
+	return q
+}
+
+func (q *query) Quoted(position Position, subject NamedNode, predicate NamedNode, object Node) Query {
+	patterns := []Expression{}
+	for idx, n := range []Node{nodeOrNil(subject), nodeOrNil(predicate), object} {
+		if n != nil {
+			patterns = append(patterns, &PatternExpression{Position: []Position{SubjectPosition, PredicatePosition, ObjectPosition}[idx], Node: n})
+		}
+	}
+	var expr Expression = &TrueExpression{}
+	if len(patterns) == 1 {
+		expr = patterns[0]
+	} else if len(patterns) > 1 {
+		expr = &AndExpression{Operands: patterns}
+	}
+	q.add(&QuotedExpression{Position: position, Expression: expr})
+	return q
+}
+
+func (q *query) OrderBy(position Position) Query {
+	r := q.root()
+	r.orderings = append(r.orderings, Ordering{Position: position})
+	return q
+}
+
+func (q *query) OrderByDescending(position Position) Query {
+	r := q.root()
+	r.orderings = append(r.orderings, Ordering{Position: position, Descending: true})
+	return q
+}
+
+func (q *query) Limit(n int) Query {
+	q.root().limit = n
+	return q
+}
+
+func (q *query) Offset(n int) Query {
+	if n < 0 {
+		n = 0
+	}
+	q.root().offset = n
+	return q
+}
+
+func (q *query) After(cursor string) Query {
+	stmt, err := statementFromCursor(cursor)
+	if err != nil {
+		q.fail(err)
+		return q
+	}
+	q.root().after = stmt
+	return q
+}
+
+func (q *query) DistinctSubjects() []NamedNode {
+	res := []NamedNode{}
+	for _, n := range q.distinct(SubjectPosition) {
+		res = append(res, n.(NamedNode))
+	}
+	return res
+}
+
+func (q *query) DistinctPredicates() []NamedNode {
+	res := []NamedNode{}
+	for _, n := range q.distinct(PredicatePosition) {
+		res = append(res, n.(NamedNode))
+	}
+	return res
+}
+
+func (q *query) DistinctObjects() []Node {
+	return q.distinct(ObjectPosition)
+}
+
+func (q *query) DistinctGraphs() []NamedNode {
+	res := []NamedNode{}
+	for _, n := range q.distinct(GraphPosition) {
+		res = append(res, n.(NamedNode))
+	}
+	return res
+}
+
+func (q *query) GroupBy(positions ...Position) Query {
+	r := q.root()
+	r.groupBy = append(r.groupBy, positions...)
+	return q
+}
+
+func (q *query) Aggregate(aggregates ...Aggregate) ([]AggregateResult, error) {
+	r := q.root()
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+	matched, err := r.matches(context.Background(), false)
+	if err != nil {
+		return nil, err
+	}
+	res, err := aggregate(matched, r.groupBy, aggregates)
+	if err != nil {
+		return nil, err
+	}
+	start, end := pageBounds(len(res), r.offset, r.limit)
+	return res[start:end], nil
+}
+
+func (q *query) Count() int {
+	matched, _ := q.root().matches(context.Background(), false)
+	return len(matched)
+}
+
 func (q *query) Bind(base KnowledgeBase) Query {
-	q.base = base
+	r := q.root()
+	r.base = base
+	r.invalidate()
 	return q
 }
 
 func (q *query) Evaluate(stmt Statement) bool {
-	for _, m := range q.query {
-		if !m(stmt) {
-			return false
-		}
+	expr, err := q.root().compile()
+	if err != nil {
+		return false
 	}
-	return true
+	return expr.Evaluate(stmt)
 }
 
 func (q *query) Results() []Statement {
-	stmts := []Statement{}
-	if q.base != nil {
-		stmts = q.base.Statements()
+	res, err := q.ResultsContext(context.Background())
+	if err != nil {
+		return []Statement{}
 	}
-	return q.ResultsFrom(stmts)
+	return res
+}
+
+func (q *query) ResultsContext(ctx context.Context) ([]Statement, error) {
+	return q.root().matches(ctx, true)
 }
 
 func (q *query) ResultsFrom(stmts []Statement) []Statement {
-	res := []Statement{}
-	for _, stmt := range stmts {
-		if q.Evaluate(stmt) {
-			res = append(res, stmt)
-		}
+	r := q.root()
+	plan, err := r.plan(nil)
+	if err != nil {
+		return []Statement{}
+	}
+	res, err := CollectStatements(r.iterate(context.Background(), plan, NewSliceIterator(stmts), true))
+	if err != nil {
+		return []Statement{}
 	}
 	return res
 }
 
 func (q *query) ResultIndexes() []int {
-	stmts := []Statement{}
-	if q.base != nil {
-		stmts = q.base.Statements()
+	res, err := q.ResultIndexesContext(context.Background())
+	if err != nil {
+		return []int{}
+	}
+	return res
+}
+
+func (q *query) ResultIndexesContext(ctx context.Context) ([]int, error) {
+	r := q.root()
+	plan, err := r.plan(nil)
+	if err != nil {
+		return nil, err
 	}
-	return q.ResultIndexesFrom(stmts)
+	return collectIndexes(r.iterate(ctx, plan, r.source(), true))
 }
 
 func (q *query) ResultIndexesFrom(stmts []Statement) []int {
-	res := []int{}
-	for idx, stmt := range stmts {
-		if q.Evaluate(stmt) {
-			res = append(res, idx)
-		}
+	r := q.root()
+	plan, err := r.plan(nil)
+	if err != nil {
+		return []int{}
+	}
+	res, err := collectIndexes(r.iterate(context.Background(), plan, NewSliceIterator(stmts), true))
+	if err != nil {
+		return []int{}
 	}
 	return res
 }
 
-func (q *query) add(qmatcher matcher) {
-	op := q.nextOp
-	q.nextOp = "and"
+func (q *query) Iterate() StatementIterator {
+	return q.IterateContext(context.Background())
+}
+
+func (q *query) IterateContext(ctx context.Context) StatementIterator {
+	r := q.root()
+	plan, err := r.plan(r.base)
+	if err != nil {
+		return &errorIterator{err: err}
+	}
+	return r.iterate(ctx, plan, plan.candidates(r.source), true)
+}
+
+func (q *query) MaxResults(n int) Query {
+	q.root().maxResults = n
+	return q
+}
+
+func (q *query) MaxScanned(n int) Query {
+	q.root().maxScanned = n
+	return q
+}
+
+func (q *query) Plan() (*Plan, error) {
+	return q.root().plan(q.root().base)
+}
+
+func (q *query) Explain() (string, error) {
+	r := q.root()
+	plan, err := r.plan(r.base)
+	if err != nil {
+		return "", err
+	}
+	if _, err := CollectStatements(r.iterate(context.Background(), plan, plan.candidates(r.source), true)); err != nil {
+		return plan.String(), err
+	}
+	return plan.String(), nil
+}
+
+func (q *query) Expression() (Expression, error) {
+	return q.root().build()
+}
+
+func (q *query) Err() error {
+	_, err := q.Expression()
+	return err
+}
+
+func (q *query) String() string {
+	r := q.root()
+	expr, err := r.build()
+	if err != nil {
+		return fmt.Sprintf("INVALID (%v)", err)
+	}
+
+	parts := []string{expr.String()}
+	if len(r.orderings) > 0 {
+		orderings := []string{}
+		for _, o := range r.orderings {
+			if o.Descending {
+				orderings = append(orderings, "DESC(" + o.Position.String() + ")")
+			} else {
+				orderings = append(orderings, o.Position.String())
+			}
+		}
+		parts = append(parts, "ORDER BY " + strings.Join(orderings, ", "))
+	}
+	if len(r.groupBy) > 0 {
+		groups := []string{}
+		for _, g := range r.groupBy {
+			groups = append(groups, g.String())
+		}
+		parts = append(parts, "GROUP BY " + strings.Join(groups, ", "))
+	}
+	if r.after != nil {
+		parts = append(parts, "AFTER " + CursorOf(r.after))
+	}
+	if r.limit >= 0 {
+		parts = append(parts, fmt.Sprintf("LIMIT %v", r.limit))
+	}
+	if r.offset > 0 {
+		parts = append(parts, fmt.Sprintf("OFFSET %v", r.offset))
+	}
+	if r.maxResults > 0 {
+		parts = append(parts, fmt.Sprintf("MAX RESULTS %v", r.maxResults))
+	}
+	if r.maxScanned > 0 {
+		parts = append(parts, fmt.Sprintf("MAX SCANNED %v", r.maxScanned))
+	}
+	return strings.Join(parts, " ")
+}
 
-	if op == "and" {
+func (q *query) MarshalJSON() ([]byte, error) {
+	qj, err := queryToJSON(q.root())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(qj)
+}
 
-		q.query = append(q.query, qmatcher)
+func (q *query) SPARQL() (string, error) {
+	return sparqlQuery(q.root())
+}
 
-	} else if op == "or" {
+func (q *query) Prepare() (PreparedQuery, error) {
+	r := q.root()
+	return newPreparedQuery(r, r.base)
+}
 
-		lidx := len(q.query) - 1
-		prev := q.query[lidx]
-		q.query[lidx] = func(stmt Statement) bool {
-			return prev(stmt) || qmatcher(stmt)
+// root returns the outermost query of the group hierarchy.
+func (q *query) root() *query {
+	r := q
+	for r.parent != nil {
+		p, ok := r.parent.(*query)
+		if !ok {
+			break
 		}
+		r = p
+	}
+	return r
+}
+
+// source returns an iterator over the statements of the
+// bound knowledge base.
+func (q *query) source() StatementIterator {
+	if q.base == nil {
+		return NewSliceIterator([]Statement{})
+	}
+	return q.base.Iterate()
+}
+
+// plan compiles the query into a plan for the knowledge base,
+// which is nil when executing on given statements.
+func (q *query) plan(base KnowledgeBase) (*Plan, error) {
+	expr, err := q.compile()
+	if err != nil {
+		return nil, err
+	}
+	return newPlan(expr, base, 0), nil
+}
+
+// matches executes the query on the bound knowledge base and
+// returns the matching statements.
+func (q *query) matches(ctx context.Context, paged bool) ([]Statement, error) {
+	plan, err := q.plan(q.base)
+	if err != nil {
+		return nil, err
+	}
+	return CollectStatements(q.iterate(ctx, plan, plan.candidates(q.source), paged))
+}
+
+// iterate creates the iterator that evaluates the plan on the
+// candidate statements.
+func (q *query) iterate(ctx context.Context, plan *Plan, candidates StatementIterator, paged bool) *queryIterator {
+	return &queryIterator{
+		ctx: ctx,
+		q: q,
+		plan: plan,
+		source: candidates,
+		paged: paged,
+	}
+}
+
 
+
+// queryIterator streams the results of a query. Without
+// ordering the candidates are evaluated lazily, otherwise
+// all matches are collected and sorted on the first call
+// of Next().
+type queryIterator struct {
+	ctx context.Context
+	q *query
+	plan *Plan
+	source StatementIterator
+	paged bool
+	current Statement
+	// position of the current statement within the candidates
+	position int
+	scanned int
+	matched int
+	skipped int
+	emitted int
+	sorted []positionedStatement
+	err error
+	closed bool
+}
+
+// positionedStatement is a statement with its position
+// within the candidates.
+type positionedStatement struct {
+	stmt Statement
+	position int
+}
+
+func (it *queryIterator) Next() bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+
+	// cursors require a total order, so results are
+	// sorted whenever one is used
+	if len(it.q.orderings) > 0 || it.q.after != nil {
+		if it.sorted == nil && !it.materialize() {
+			return false
+		}
+		if len(it.sorted) == 0 {
+			return false
+		}
+		it.current, it.position = it.sorted[0].stmt, it.sorted[0].position
+		it.sorted = it.sorted[1:]
+		return true
 	}
 
+	if it.paged && it.q.limit >= 0 && it.emitted >= it.q.limit {
+		return false
+	}
+	for {
+		stmt, position, ok := it.scan()
+		if !ok {
+			return false
+		}
+		if it.paged && it.skipped < it.q.offset {
+			it.skipped++
+			continue
+		}
+		it.current, it.position = stmt, position
+		it.emitted++
+		return true
+	}
+}
+
+func (it *queryIterator) Statement() Statement {
+	return it.current
+}
+
+func (it *queryIterator) Err() error {
+	return it.err
+}
+
+func (it *queryIterator) Close() error {
+	it.closed = true
+	it.sorted = nil
+	return it.source.Close()
+}
+
+// scan returns the next matching candidate and its position,
+// it stops when the context is done or a limit is exceeded.
+func (it *queryIterator) scan() (Statement, int, bool) {
+	q := it.q
+	for {
+		if it.scanned % contextCheckInterval == 0 {
+			if err := it.ctx.Err(); err != nil {
+				it.err = err
+				return nil, 0, false
+			}
+		}
+		if !it.source.Next() {
+			it.err = it.source.Err()
+			return nil, 0, false
+		}
+		if q.maxScanned > 0 && it.scanned >= q.maxScanned {
+			it.err = &QueryLimitError{Limit: ScannedLimit, Max: q.maxScanned}
+			return nil, 0, false
+		}
+		position := it.scanned
+		it.scanned++
+		it.plan.Candidates++
+
+		stmt := it.source.Statement()
+		if !it.plan.Filter.Evaluate(stmt) {
+			continue
+		}
+		if q.after != nil && compareByOrderings(stmt, q.after, q.orderings) <= 0 {
+			continue
+		}
+		if q.maxResults > 0 && it.matched >= q.maxResults {
+			it.err = &QueryLimitError{Limit: ResultsLimit, Max: q.maxResults}
+			return nil, 0, false
+		}
+		it.matched++
+		return stmt, position, true
+	}
+}
+
+// materialize collects, sorts and pages all matches.
+func (it *queryIterator) materialize() bool {
+	res := []positionedStatement{}
+	for {
+		stmt, position, ok := it.scan()
+		if !ok {
+			break
+		}
+		res = append(res, positionedStatement{stmt: stmt, position: position})
+	}
+	if it.err != nil {
+		return false
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return compareByOrderings(res[i].stmt, res[j].stmt, it.q.orderings) < 0
+	})
+	if it.paged {
+		start, end := pageBounds(len(res), it.q.offset, it.q.limit)
+		res = res[start:end]
+	}
+	it.sorted = res
+	return true
+}
+
+// collectIndexes reads the positions of all remaining results
+// from the iterator and closes it.
+func collectIndexes(it *queryIterator) ([]int, error) {
+	defer it.Close()
+	res := []int{}
+	for it.Next() {
+		res = append(res, it.position)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// distinct returns the unique nodes at the position within
+// the results, offset and limit apply to the unique nodes.
+func (q *query) distinct(position Position) []Node {
+	r := q.root()
+	res := []Node{}
+	seen := map[string]bool{}
+	matched, _ := r.matches(context.Background(), false)
+	for _, stmt := range matched {
+		n := position.Of(stmt)
+		if n == nil || seen[formatNode(n)] {
+			continue
+		}
+		seen[formatNode(n)] = true
+		res = append(res, n)
+	}
+	start, end := pageBounds(len(res), r.offset, r.limit)
+	return res[start:end]
+}
+
+// pageBounds returns the start and end index of the page
+// defined by offset and limit within a slice of the length.
+func pageBounds(length int, offset int, limit int) (int, int) {
+	if offset >= length {
+		return length, length
+	}
+	end := length
+	if limit >= 0 && offset + limit < length {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+// build creates the expression tree of the query
+// and its groups.
+func (q *query) build() (Expression, error) {
+	if q.prepared != nil {
+		return q.prepared, nil
+	}
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.open {
+		return nil, fmt.Errorf("Group() without matching EndGroup()")
+	}
+	if q.pendingOp != "" || q.negate {
+		return nil, fmt.Errorf("Operator without following operand")
+	}
+
+	branches := []Expression{}
+	for _, terms := range q.branches {
+		operands := []Expression{}
+		for _, t := range terms {
+			expr := t.expr
+			if t.group != nil {
+				var err error
+				if expr, err = t.group.build(); err != nil {
+					return nil, err
+				}
+			}
+			if t.negate {
+				expr = &NotExpression{Operand: expr}
+			}
+			operands = append(operands, expr)
+		}
+		if len(operands) == 1 {
+			branches = append(branches, operands[0])
+		} else if len(operands) > 1 {
+			branches = append(branches, &AndExpression{Operands: operands})
+		}
+	}
+
+	if len(branches) == 0 {
+		return &TrueExpression{}, nil
+	} else if len(branches) == 1 {
+		return branches[0], nil
+	}
+	return &OrExpression{Operands: branches}, nil
+}
+
+// compile creates the expression that is used for
+// evaluation, applying the semantics of the bound
+// knowledge base, and caches it until the query changes.
+func (q *query) compile() (Expression, error) {
+	if q.compiled != nil {
+		return q.compiled, nil
+	}
+	expr, err := q.build()
+	if err != nil {
+		return nil, err
+	}
+	if params := expressionParameters(expr); len(params) > 0 {
+		return nil, fmt.Errorf("No value for parameter '%v', use Prepare()", params[0])
+	}
+
+	// the default graph of a bound knowledge base
+	// in union mode matches any graph
+	if q.base != nil && q.base.UnionDefaultGraph() && !q.exactGraphs {
+		defaultGraph := q.base.DefaultGraph()
+		expr = RewriteExpression(expr, func(e Expression) Expression {
+			if p, ok := e.(*PatternExpression); ok && p.Position == GraphPosition && defaultGraph.Equals(p.Node) {
+				return &TrueExpression{}
+			}
+			return nil
+		})
+	}
+
+	q.compiled = expr
+	return expr, nil
+}
+
+// invalidate drops the cached compiled expression
+// of the whole query.
+func (q *query) invalidate() {
+	q.root().compiled = nil
+}
+
+// fail records the first error of the query on the root and
+// drops the compiled expression, so the error is reported.
+func (q *query) fail(err error) {
+	r := q.root()
+	if r.err == nil {
+		r.err = err
+	}
+	q.invalidate()
+}
+
+// stringLiteral creates a xsd:string literal used as
+// filter argument.
+func stringLiteral(str string) TypedLiteral {
+	return NewTypedLiteral(str, NewNamedNode(xsdNamespace + "string"))
+}
+
+func (q *query) add(expr Expression) {
+	q.addTerm(queryTerm{expr: expr})
+}
+
+func (q *query) addTerm(term queryTerm) {
+	term.negate = q.negate
+	q.negate = false
+	q.pendingOp = ""
+
+	lidx := len(q.branches) - 1
+	q.branches[lidx] = append(q.branches[lidx], term)
+	q.invalidate()
 }
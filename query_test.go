@@ -2,7 +2,10 @@ package semtools
 
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 	"github.com/sirupsen/logrus"
 )
 
@@ -77,4 +80,174 @@ func TestQuery(t *testing.T) {
 		t.Errorf("Expected results to contain 2 statements")
 	}
 
-}
\ No newline at end of file
+}
+
+func TestQueryBooleanLogic(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("max"), NewNamedNode("knows"), NewNamedNode("mara"), NewNamedNode("friends")),
+		NewStatement(NewNamedNode("mara"), NewNamedNode("knows"), NewNamedNode("max"), NewNamedNode("friends")),
+		NewStatement(NewNamedNode("bill"), NewNamedNode("knows"), NewNamedNode("max"), NewNamedNode("friends")),
+		NewStatement(NewNamedNode("mara"), NewNamedNode("owns"), NewNamedNode("bill"), NewNamedNode("friends")),
+	})
+
+	res := kb.Select().
+		Not().Subject(NewNamedNode("mara")).Results()
+	if len(res) != 2 {
+		t.Errorf("Not() expected 2 statements but got %v", len(res))
+	}
+
+	res = kb.Select().
+		Predicate(NewNamedNode("knows")).
+		And().
+		Not().Group().
+			Subject(NewNamedNode("max")).
+			Or().
+			Subject(NewNamedNode("bill")).
+		EndGroup().Results()
+	if len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("mara")) {
+		t.Errorf("Not() expected to negate groups")
+	}
+
+	// AND takes precedence over OR
+	res = kb.Select().
+		Subject(NewNamedNode("mara")).
+		Predicate(NewNamedNode("owns")).
+		Or().
+		Subject(NewNamedNode("max")).
+		Predicate(NewNamedNode("knows")).Results()
+	if len(res) != 2 {
+		t.Errorf("Or() expected 2 statements but got %v", len(res))
+	}
+
+	// Or() must not combine with an implicit always-true operand
+	res = kb.Select().
+		Or().
+		Subject(NewNamedNode("max")).Results()
+	if len(res) != 0 {
+		t.Errorf("Or() without preceeding operand expected to match nothing")
+	}
+
+}
+
+
+func TestQueryExpression(t *testing.T) {
+
+	expr, err := NewQuery().Expression()
+	if _, ok := expr.(*TrueExpression); err != nil || !ok {
+		t.Errorf("Expression() of empty query expected to be TRUE but got %v", expr)
+	}
+
+	expr, err = NewQuery().
+		Subject(NewNamedNode("a")).
+		Predicate(NewNamedNode("b")).
+		Or().
+		Not().Object(NewLocalizedLiteral("c", "en")).
+		Expression()
+	if err != nil {
+		t.Errorf("Expression() returned unexpected error: %v", err)
+	}
+	or, ok := expr.(*OrExpression)
+	if !ok || len(or.Operands) != 2 {
+		t.Fatalf("Expression() expected OR with two operands but got %v", expr)
+	}
+	if and, ok := or.Operands[0].(*AndExpression); !ok || len(and.Operands) != 2 {
+		t.Errorf("Expression() expected AND as first operand but got %v", or.Operands[0])
+	}
+	if not, ok := or.Operands[1].(*NotExpression); !ok || not.Operand.(*PatternExpression).Position != ObjectPosition {
+		t.Errorf("Expression() expected NOT as second operand but got %v", or.Operands[1])
+	}
+	if expr.String() != `((subject = <a> AND predicate = <b>) OR NOT object = "c"@en)` {
+		t.Errorf("Expression() has unexpected string representation: %v", expr)
+	}
+
+}
+
+
+func TestQueryErrors(t *testing.T) {
+
+	if err := NewQuery().Subject(NewNamedNode("a")).Err(); err != nil {
+		t.Errorf("Err() returned unexpected error: %v", err)
+	}
+
+	malformed := map[string]Query{
+		"unclosed group": NewQuery().Group().Subject(NewNamedNode("a")),
+		"unopened group": NewQuery().Subject(NewNamedNode("a")).EndGroup(),
+		"leading or": NewQuery().Or().Subject(NewNamedNode("a")),
+		"trailing or": NewQuery().Subject(NewNamedNode("a")).Or(),
+		"trailing not": NewQuery().Subject(NewNamedNode("a")).Not(),
+		"double operator": NewQuery().Subject(NewNamedNode("a")).And().Or().Subject(NewNamedNode("b")),
+	}
+	for name, q := range malformed {
+		if q.Err() == nil {
+			t.Errorf("Err() expected error for %v", name)
+		}
+		if len(q.ResultsFrom([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil)})) != 0 {
+			t.Errorf("ResultsFrom() expected no results for %v", name)
+		}
+	}
+
+	// errors after running the query are reported as well
+	kb := NewKnowledgeBase("kb")
+	kb.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil)})
+	q := kb.Select().Subject(NewNamedNode("a"))
+	if res, err := q.ResultsContext(context.Background()); err != nil || len(res) != 1 {
+		t.Fatalf("ResultsContext() expected 1 result but got %v (%v)", res, err)
+	}
+	if _, err := q.After("invalid").ResultsContext(context.Background()); err == nil {
+		t.Errorf("ResultsContext() expected to fail for an invalid cursor after running the query")
+	}
+
+}
+
+
+func TestQueryContext(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	stmts := []Statement{}
+	for i := 0; i < 1000; i++ {
+		stmts = append(stmts, NewStatement(NewNamedNode(fmt.Sprintf("s%v", i)), NewNamedNode("p"), NewNamedNode("o"), nil))
+	}
+	kb.Insert(stmts)
+
+	res, err := kb.Select().Predicate(NewNamedNode("p")).ResultsContext(context.Background())
+	if err != nil || len(res) != 1000 {
+		t.Errorf("ResultsContext() expected 1000 statements but got %v (%v)", len(res), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := kb.Select().Predicate(NewNamedNode("p")).ResultsContext(ctx); err != context.Canceled {
+		t.Errorf("ResultsContext() expected canceled error but got %v", err)
+	}
+	if _, err := kb.Select().ResultIndexesContext(ctx); err != context.Canceled {
+		t.Errorf("ResultIndexesContext() expected canceled error but got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := kb.Select().ResultsContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("ResultsContext() expected deadline error but got %v", err)
+	}
+
+	_, err = kb.Select().MaxResults(10).ResultsContext(context.Background())
+	if lerr, ok := err.(*QueryLimitError); !ok || lerr.Limit != ResultsLimit || lerr.Max != 10 {
+		t.Errorf("MaxResults() expected limit error but got %v", err)
+	}
+	if len(kb.Select().MaxResults(10).Results()) != 0 {
+		t.Errorf("Results() expected no results when exceeding MaxResults()")
+	}
+	if res, err := kb.Select().Subject(NewNamedNode("s1")).Or().Subject(NewNamedNode("s2")).MaxResults(2).ResultsContext(context.Background()); err != nil || len(res) != 2 {
+		t.Errorf("MaxResults() expected to allow results within limit but got %v (%v)", res, err)
+	}
+
+	_, err = kb.Select().Subject(NewNamedNode("s1")).Or().Subject(NewNamedNode("s2")).MaxScanned(100).ResultsContext(context.Background())
+	if lerr, ok := err.(*QueryLimitError); !ok || lerr.Limit != ScannedLimit {
+		t.Errorf("MaxScanned() expected limit error but got %v", err)
+	}
+	if res, err := kb.Select().Subject(NewNamedNode("s1")).MaxScanned(1).ResultsContext(context.Background()); err != nil || len(res) != 1 {
+		t.Errorf("MaxScanned() expected index lookups to scan only candidates but got %v (%v)", res, err)
+	}
+
+}
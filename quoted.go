@@ -0,0 +1,100 @@
+package semtools
+
+
+// QuotedTriple is a node quoting a triple (RDF-star), which allows
+// statements about statements. Quoted triples are named nodes, so
+// they can be used as subjects as well as objects, their iri is the
+// N-Triples-star form of the triple, ie. `<< <s> <p> <o> >>`.
+// Quoting a triple doesn't assert it.
+type QuotedTriple interface {
+
+	NamedNode
+
+	// Subject returns the subject of the quoted triple.
+	Subject() NamedNode
+
+	// Predicate returns the predicate of the quoted triple.
+	Predicate() NamedNode
+
+	// Object returns the object of the quoted triple.
+	Object() Node
+
+}
+
+// NewQuotedTriple creates a new quoted triple of the subject,
+// predicate and object.
+func NewQuotedTriple(subject NamedNode, predicate NamedNode, object Node) QuotedTriple {
+	return &quotedTriple{
+		subject: subject,
+		predicate: predicate,
+		object: object,
+	}
+}
+
+// QuotedTripleOf creates the quoted triple of the statement,
+// ignoring its graph.
+func QuotedTripleOf(stmt Statement) QuotedTriple {
+	return NewQuotedTriple(stmt.Subject(), stmt.Predicate(), stmt.Object())
+}
+
+
+
+// QuotedExpression matches statements whose node at the position is
+// a quoted triple matched by the expression. The expression is
+// evaluated on the quoted triple as a statement without graph.
+type QuotedExpression struct {
+
+	// Position is the position of the quoted triple.
+	Position Position
+
+	// Expression is evaluated on the quoted triple.
+	Expression Expression
+
+}
+
+func (e *QuotedExpression) Evaluate(stmt Statement) bool {
+	qt, ok := e.Position.Of(stmt).(QuotedTriple)
+	if !ok {
+		return false
+	}
+	return e.Expression.Evaluate(NewStatement(qt.Subject(), qt.Predicate(), qt.Object(), nil))
+}
+
+func (e *QuotedExpression) String() string {
+	return e.Position.String() + " quotes (" + e.Expression.String() + ")"
+}
+
+
+
+type quotedTriple struct {
+	subject NamedNode
+	predicate NamedNode
+	object Node
+}
+
+func (qt *quotedTriple) Iri() string {
+	return "<< " + formatNode(qt.subject) + " " + formatNode(qt.predicate) + " " + formatNode(qt.object) + " >>"
+}
+
+func (qt *quotedTriple) Subject() NamedNode {
+	return qt.subject
+}
+
+func (qt *quotedTriple) Predicate() NamedNode {
+	return qt.predicate
+}
+
+func (qt *quotedTriple) Object() Node {
+	return qt.object
+}
+
+func (qt *quotedTriple) Equals(other interface{}) bool {
+	if v, ok := other.(QuotedTriple); ok {
+		return qt.subject.Equals(v.Subject()) && qt.predicate.Equals(v.Predicate()) && qt.object.Equals(v.Object())
+	}
+	return false
+}
+
+func (qt *quotedTriple) String() string {
+	return qt.Iri()
+}
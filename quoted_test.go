@@ -0,0 +1,194 @@
+package semtools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func quotedTestStatements() []Statement {
+	claim := NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"))
+	nested := NewQuotedTriple(NewNamedNode("c"), NewNamedNode("says"), claim)
+	return []Statement{
+		NewStatement(claim, NewNamedNode("certainty"), NewTypedLiteral("0.8", NewNamedNode(xsdNamespace + "decimal")), nil),
+		NewStatement(claim, NewNamedNode("source"), NewNamedNode("file"), nil),
+		NewStatement(nested, NewNamedNode("source"), NewNamedNode("other"), nil),
+		NewStatement(NewNamedNode("d"), NewNamedNode("believes"), NewQuotedTriple(NewNamedNode("a"), NewNamedNode("q"), NewLocalizedLiteral("A", "en")), nil),
+	}
+}
+
+
+func TestQuotedTriple(t *testing.T) {
+
+	qt := NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewLocalizedLiteral("A", "en"))
+	if qt.Iri() != `<< <a> <p> "A"@en >>` || qt.String() != qt.Iri() {
+		t.Errorf("Iri() expected the N-Triples-star form but got %v", qt.Iri())
+	}
+	if !qt.Equals(QuotedTripleOf(NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewLocalizedLiteral("A", "en"), NewNamedNode("g")))) {
+		t.Errorf("Equals() expected quoted triples of the same nodes to be equal")
+	}
+	if qt.Equals(NewNamedNode(qt.Iri())) || NewNamedNode(qt.Iri()).Equals(qt) {
+		t.Errorf("Equals() expected quoted triples and named nodes to differ")
+	}
+	if qt.Equals(NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewLocalizedLiteral("A", "de"))) {
+		t.Errorf("Equals() expected quoted triples of different objects to differ")
+	}
+
+	terms := NewTermDictionary()
+	interned := terms.Intern(NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewLocalizedLiteral("A", "en"))).(QuotedTriple)
+	if terms.Intern(qt) != interned || interned.Subject() != terms.Intern(NewNamedNode("a")) || terms.Len() != 4 {
+		t.Errorf("Intern() expected the quoted triple and its nodes to be interned but got %v terms", terms.Len())
+	}
+
+}
+
+
+func TestQuotedTripleKnowledgeBase(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert(quotedTestStatements())
+	kb.Insert([]Statement{NewStatement(NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b")), NewNamedNode("source"), NewNamedNode("file"), nil)})
+	if len(kb.Statements()) != 4 {
+		t.Errorf("Insert() expected equal quoted triples to be merged but got %v", kb.Statements())
+	}
+
+	queries := map[string]Query{
+		"subject": kb.Select().Subject(NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"))),
+		"quoted subject": kb.Select().Quoted(SubjectPosition, NewNamedNode("a"), nil, nil),
+		"quoted object": kb.Select().Quoted(ObjectPosition, nil, NewNamedNode("q"), NewLocalizedLiteral("A", "en")),
+		"nested": kb.Select().Quoted(SubjectPosition, nil, nil, NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"))),
+		"any": kb.Select().Quoted(SubjectPosition, nil, nil, nil).Predicate(NewNamedNode("source")),
+		"none": kb.Select().Quoted(SubjectPosition, NewNamedNode("x"), nil, nil),
+	}
+	expected := map[string][]string{
+		"subject": {"0.8", "file"},
+		"quoted subject": {"0.8", "file"},
+		"quoted object": {`<< <a> <q> "A"@en >>`},
+		"nested": {"other"},
+		"any": {"file", "other"},
+		"none": {},
+	}
+	for name, q := range queries {
+		res, err := q.ResultsContext(context.Background())
+		objects := []string{}
+		for _, r := range res {
+			objects = append(objects, r.Object().String())
+		}
+		if err != nil || strings.Join(objects, " ") != strings.Join(expected[name], " ") {
+			t.Errorf("%v: Results() expected %v but got %v (%v)", name, expected[name], objects, err)
+		}
+	}
+
+	p, err := kb.Select().Quoted(SubjectPosition, NewParameter("s"), nil, nil).Prepare()
+	if err != nil {
+		t.Fatalf("Prepare() failed: %v", err)
+	}
+	if res, err := p.Results(map[string]Node{"s": NewNamedNode("c")}); err != nil || len(res) != 1 {
+		t.Errorf("Results() expected to bind the parameter of the quoted triple but got %v (%v)", res, err)
+	}
+
+}
+
+
+func TestQuotedTripleEncoding(t *testing.T) {
+
+	stmts := quotedTestStatements()
+	encodedNode, err := nodeToJSON(stmts[2].Subject())
+	if err != nil {
+		t.Fatalf("nodeToJSON() failed: %v", err)
+	}
+	data, err := json.Marshal(encodedNode)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	decodedNode := &nodeJSON{}
+	if err := json.Unmarshal(data, decodedNode); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if node, err := nodeFromJSON(decodedNode); err != nil || !stmts[2].Subject().Equals(node) {
+		t.Errorf("nodeFromJSON() expected %v but got %v (%v)", stmts[2].Subject(), node, err)
+	}
+
+	expr, err := NewKnowledgeBase("kb").Select().Quoted(ObjectPosition, NewNamedNode("a"), NewNamedNode("p"), nil).Expression()
+	if err != nil {
+		t.Fatalf("Expression() failed: %v", err)
+	}
+	encoded, err := MarshalExpression(expr)
+	if err != nil {
+		t.Fatalf("MarshalExpression() failed: %v", err)
+	}
+	if res, err := UnmarshalExpression(encoded); err != nil || res.String() != expr.String() {
+		t.Errorf("UnmarshalExpression() expected %v but got %v (%v)", expr, res, err)
+	}
+
+	kb := NewKnowledgeBase("kb")
+	kb.Insert(stmts)
+	buf := &bytes.Buffer{}
+	if err := WriteBinary(buf, kb, &BinaryOptions{Checksums: true}); err != nil {
+		t.Fatalf("WriteBinary() failed: %v", err)
+	}
+	loaded := NewKnowledgeBase("loaded")
+	if _, err := ReadBinary(buf, loaded); err != nil {
+		t.Fatalf("ReadBinary() failed: %v", err)
+	}
+	if len(loaded.Statements()) != len(stmts) {
+		t.Errorf("ReadBinary() expected %v statements but got %v", len(stmts), loaded.Statements())
+	}
+	for idx, stmt := range loaded.Statements() {
+		if expected := kb.Statements()[idx]; !stmt.Equals(expected) {
+			t.Errorf("ReadBinary() expected %v but got %v", expected, stmt)
+		}
+	}
+
+	if node, err := sparqlNode(stmts[2].Subject()); err != nil || node != "<< <c> <says> << <a> <p> <b> >> >>" {
+		t.Errorf("sparqlNode() expected the quoted triple but got %v (%v)", node, err)
+	}
+
+}
+
+
+func TestQuotedTripleStores(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	bolt, err := NewBoltKnowledgeBase("bolt", filepath.Join(dir, "kb.db"), &BoltKnowledgeBaseOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatalf("NewBoltKnowledgeBase() failed: %v", err)
+	}
+	defer bolt.Close()
+	db, cleanup := openTestDatabase(t)
+	defer cleanup()
+	sqlKB, err := NewSQLKnowledgeBase("sql", db, nil)
+	if err != nil {
+		t.Fatalf("NewSQLKnowledgeBase() failed: %v", err)
+	}
+
+	for _, kb := range []KnowledgeBase{bolt, sqlKB} {
+		kb.Insert(quotedTestStatements())
+		res := kb.Select().Subject(NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"))).Results()
+		if len(kb.Statements()) != 4 || len(res) != 2 {
+			t.Errorf("%v: Insert() expected the quoted triples to be stored but got %v", kb.Name(), kb.Statements())
+		}
+		if res := kb.Select().Quoted(ObjectPosition, NewNamedNode("a"), nil, nil).Results(); len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("d")) {
+			t.Errorf("%v: Quoted() expected the quoted object but got %v", kb.Name(), res)
+		}
+	}
+
+}
@@ -0,0 +1,195 @@
+package semtools
+
+import (
+	"fmt"
+	"strings"
+)
+
+
+// sparqlVariables are the variables bound to the positions of
+// the statements in generated SPARQL queries.
+var sparqlVariables = map[Position]string{
+	SubjectPosition: "?subject",
+	PredicatePosition: "?predicate",
+	ObjectPosition: "?object",
+	GraphPosition: "?graph",
+}
+
+// sparqlQuery creates the SPARQL SELECT query equivalent to the
+// root query. Parameters are written as $name variables, cursors
+// can't be expressed in SPARQL.
+func sparqlQuery(q *query) (string, error) {
+	if q.after != nil {
+		return "", fmt.Errorf("Cursors can't be expressed in SPARQL")
+	}
+	if len(q.groupBy) > 0 {
+		return "", fmt.Errorf("Grouped queries can't be expressed in SPARQL")
+	}
+	expr, err := q.build()
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{
+		"SELECT ?subject ?predicate ?object ?graph",
+		"WHERE {",
+		"  GRAPH ?graph { ?subject ?predicate ?object }",
+	}
+	if _, ok := expr.(*TrueExpression); !ok {
+		filter, err := sparqlExpression(expr)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, "  FILTER " + filter)
+	}
+	lines = append(lines, "}")
+
+	if len(q.orderings) > 0 {
+		orderings := []string{}
+		for _, o := range q.orderings {
+			if o.Descending {
+				orderings = append(orderings, "DESC(" + sparqlVariables[o.Position] + ")")
+			} else {
+				orderings = append(orderings, "ASC(" + sparqlVariables[o.Position] + ")")
+			}
+		}
+		lines = append(lines, "ORDER BY " + strings.Join(orderings, " "))
+	}
+	if q.limit >= 0 {
+		lines = append(lines, fmt.Sprintf("LIMIT %v", q.limit))
+	}
+	if q.offset > 0 {
+		lines = append(lines, fmt.Sprintf("OFFSET %v", q.offset))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// sparqlExpression creates the parenthesized SPARQL filter
+// expression of the expression.
+func sparqlExpression(expr Expression) (string, error) {
+	switch e := expr.(type) {
+	case *TrueExpression:
+		return "(true)", nil
+	case *PatternExpression:
+		v := sparqlVariables[e.Position]
+		switch n := e.Node.(type) {
+		case nil:
+			return "(!bound(" + v + "))", nil
+		case NamedNode:
+			node, err := sparqlNode(n)
+			return "(" + v + " = " + node + ")", err
+		default:
+			// literals are compared by term rather than value
+			node, err := sparqlNode(n)
+			return "(sameTerm(" + v + ", " + node + "))", err
+		}
+	case *FilterExpression:
+		return sparqlFilter(e)
+	case *AndExpression:
+		return sparqlOperands(e.Operands, " && ")
+	case *OrExpression:
+		return sparqlOperands(e.Operands, " || ")
+	case *NotExpression:
+		operand, err := sparqlExpression(e.Operand)
+		return "(!" + operand + ")", err
+	case *PlanNode:
+		return sparqlExpression(e.Expression)
+	}
+	return "", fmt.Errorf("Unable to express '%v' in SPARQL", expr)
+}
+
+func sparqlOperands(operands []Expression, op string) (string, error) {
+	if len(operands) == 0 {
+		return "(true)", nil
+	}
+	strs := make([]string, len(operands))
+	for idx, o := range operands {
+		var err error
+		if strs[idx], err = sparqlExpression(o); err != nil {
+			return "", err
+		}
+	}
+	return "(" + strings.Join(strs, op) + ")", nil
+}
+
+// sparqlFilter creates the SPARQL expression of a filter, string
+// functions are guarded as filters only match literals.
+func sparqlFilter(e *FilterExpression) (string, error) {
+	v := sparqlVariables[e.Position]
+	arg, err := sparqlNode(e.Argument)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := e.Argument.(LiteralNode); !ok {
+		if _, ok := e.Argument.(Parameter); !ok && e.Operator != DatatypeFilter {
+			// other arguments are used by their string
+			arg = sparqlString(e.Argument.String())
+		}
+	}
+	switch e.Operator {
+	case RegexFilter:
+		return "(isLiteral(" + v + ") && regex(str(" + v + "), " + arg + "))", nil
+	case ContainsFilter:
+		return "(isLiteral(" + v + ") && contains(str(" + v + "), " + arg + "))", nil
+	case PrefixFilter:
+		return "(isLiteral(" + v + ") && strstarts(str(" + v + "), " + arg + "))", nil
+	case LanguageFilter:
+		return "(langMatches(lang(" + v + "), " + arg + "))", nil
+	case DatatypeFilter:
+		return "(isLiteral(" + v + ") && datatype(" + v + ") = " + arg + ")", nil
+	case TextFilter:
+		return "", fmt.Errorf("Full-text filters can't be expressed in SPARQL")
+	case LessThanFilter, LessOrEqualFilter, GreaterThanFilter, GreaterOrEqualFilter:
+		return "(" + v + " " + string(e.Operator) + " " + arg + ")", nil
+	}
+	return "", fmt.Errorf("Unknown filter operator '%v'", e.Operator)
+}
+
+// sparqlNode creates the SPARQL term of the node.
+func sparqlNode(n Node) (string, error) {
+	switch v := n.(type) {
+	case Parameter:
+		for _, variable := range sparqlVariables {
+			if variable == "?" + v.Name() {
+				return "", fmt.Errorf("Parameter '%v' conflicts with a variable of the query", v.Name())
+			}
+		}
+		return "$" + v.Name(), nil
+	case QuotedTriple:
+		nodes := []string{}
+		for _, n := range []Node{v.Subject(), v.Predicate(), v.Object()} {
+			node, err := sparqlNode(n)
+			if err != nil {
+				return "", err
+			}
+			nodes = append(nodes, node)
+		}
+		return "<< " + strings.Join(nodes, " ") + " >>", nil
+	case NamedNode:
+		return "<" + v.Iri() + ">", nil
+	case LocalizedLiteral:
+		return sparqlString(v.String()) + "@" + v.Language(), nil
+	case TypedLiteral:
+		// xsd:string is the type of simple literals
+		if v.Type() == nil || v.Type().Iri() == xsdNamespace + "string" {
+			return sparqlString(v.String()), nil
+		}
+		return sparqlString(v.String()) + "^^<" + v.Type().Iri() + ">", nil
+	}
+	return "", fmt.Errorf("Unable to express Node '%v' in SPARQL", n)
+}
+
+// sparqlStringEscaper escapes the characters that are not
+// allowed in SPARQL string literals.
+var sparqlStringEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\"", "\\\"",
+	"\n", "\\n",
+	"\r", "\\r",
+	"\t", "\\t",
+)
+
+// sparqlString creates the quoted SPARQL string literal.
+func sparqlString(str string) string {
+	return "\"" + sparqlStringEscaper.Replace(str) + "\""
+}
@@ -0,0 +1,58 @@
+package semtools
+
+import (
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestQuerySPARQL(t *testing.T) {
+
+	q := NewQuery().
+		Subject(NewNamedNode("http://example.org/a")).
+		Group().ObjectLanguage("en").Or().Not().ObjectContains("say \"hi\"").EndGroup().
+		Or().
+		Filter(ObjectPosition, LessThanFilter, NewParameter("max")).
+		OrderBy(SubjectPosition).
+		OrderByDescending(ObjectPosition).
+		Limit(10).
+		Offset(5)
+
+	expected := "SELECT ?subject ?predicate ?object ?graph\n" +
+		"WHERE {\n" +
+		"  GRAPH ?graph { ?subject ?predicate ?object }\n" +
+		"  FILTER (((?subject = <http://example.org/a>) && ((langMatches(lang(?object), \"en\")) || (!(isLiteral(?object) && contains(str(?object), \"say \\\"hi\\\"\"))))) || (?object < $max))\n" +
+		"}\n" +
+		"ORDER BY ASC(?subject) DESC(?object)\n" +
+		"LIMIT 10\n" +
+		"OFFSET 5"
+	if str, err := q.SPARQL(); err != nil || str != expected {
+		t.Errorf("SPARQL() expected\n%v\nbut got\n%v (%v)", expected, str, err)
+	}
+
+	if str, _ := NewQuery().SPARQL(); str != "SELECT ?subject ?predicate ?object ?graph\nWHERE {\n  GRAPH ?graph { ?subject ?predicate ?object }\n}" {
+		t.Errorf("SPARQL() of empty query expected no filter but got %v", str)
+	}
+	if str, _ := NewQuery().Object(NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer"))).SPARQL(); str == "" {
+		t.Errorf("SPARQL() fails to express typed literals")
+	}
+
+	if _, err := NewQuery().Subject(NewParameter("object")).SPARQL(); err == nil {
+		t.Errorf("SPARQL() expected to fail for conflicting parameter")
+	}
+	stmt := NewStatement(NewNamedNode("a"), NewNamedNode("b"), NewNamedNode("c"), nil)
+	if _, err := NewQuery().OrderBy(SubjectPosition).After(CursorOf(stmt)).SPARQL(); err == nil {
+		t.Errorf("SPARQL() expected to fail for cursors")
+	}
+	if _, err := NewQuery().Predicate(NewNamedNode("b")).GroupBy(SubjectPosition).SPARQL(); err == nil {
+		t.Errorf("SPARQL() expected to fail for grouped queries")
+	}
+
+}
@@ -0,0 +1,857 @@
+package semtools
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+
+// sqlIteratorChunk is the number of statements iterators read
+// with a single query, so no connection is held in between.
+const sqlIteratorChunk = 1024
+
+// sqlTermCacheSize is the number of term ids and decoded terms
+// cached by a knowledge base stored in a SQL database.
+const sqlTermCacheSize = 65536
+
+// SQLDialect is the dialect of the SQL database of a knowledge base.
+type SQLDialect string
+
+const (
+
+	// SQLiteDialect is the dialect of SQLite 3.24 and later.
+	SQLiteDialect SQLDialect = "sqlite"
+
+	// PostgresDialect is the dialect of PostgreSQL 9.5 and later.
+	PostgresDialect SQLDialect = "postgres"
+
+)
+
+// sqlColumns are the columns of the quads table by position.
+var sqlColumns = map[Position]string{
+	SubjectPosition: "s",
+	PredicatePosition: "p",
+	ObjectPosition: "o",
+	GraphPosition: "g",
+}
+
+// sqlTablePrefix is the pattern of valid table prefixes.
+var sqlTablePrefix = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sqlStatementQuery selects the quads together with the encoded
+// terms and metadata, nil objects have the id 0 and no term.
+const sqlStatementQuery = "SELECT q.id, q.s, ts.encoded, q.p, tp.encoded, q.o, tob.encoded, q.g, tg.encoded, tm.encoded " +
+	"FROM {p}quads q " +
+	"JOIN {p}terms ts ON ts.id = q.s " +
+	"JOIN {p}terms tp ON tp.id = q.p " +
+	"LEFT JOIN {p}terms tob ON tob.id = q.o " +
+	"JOIN {p}terms tg ON tg.id = q.g " +
+	"LEFT JOIN {p}metadata tm ON tm.quad = q.id"
+
+// SQLKnowledgeBaseOptions are options that configure a knowledge
+// base stored in a SQL database.
+type SQLKnowledgeBaseOptions struct {
+
+	// KnowledgeBaseOptions configure the knowledge base, ChangeLog
+	// and FullTextIndex are not supported.
+	KnowledgeBaseOptions
+
+	// Dialect is the dialect of the database. Defaults to
+	// SQLiteDialect.
+	Dialect SQLDialect
+
+	// TablePrefix is prepended to the names of the tables and
+	// indexes. Defaults to "semtools_".
+	TablePrefix string
+
+}
+
+// NewSQLKnowledgeBase creates the knowledge base stored in the
+// database, creating its tables unless they exist: a dictionary of
+// the terms, the quads referencing them with indexes on all
+// positions, the metadata of annotated quads and the sequence of
+// changes. Queries are translated
+// into conditions on the quads where possible and evaluated on
+// the remaining candidates. The database is owned by the caller,
+// modifications by other processes are not reported to listeners.
+func NewSQLKnowledgeBase(name string, db *sql.DB, opts *SQLKnowledgeBaseOptions) (PersistentKnowledgeBase, error) {
+
+	// make sure things are initialized
+	if name == "" {
+		name = "kb"
+	}
+	if opts == nil {
+		opts = &SQLKnowledgeBaseOptions{}
+	}
+	if opts.ChangeLog != nil || opts.FullTextIndex {
+		return nil, fmt.Errorf("SQL knowledge bases don't support a ChangeLog or FullTextIndex")
+	}
+	dialect := opts.Dialect
+	if dialect == "" {
+		dialect = SQLiteDialect
+	}
+	if dialect != SQLiteDialect && dialect != PostgresDialect {
+		return nil, fmt.Errorf("Unknown SQL dialect '%v'", dialect)
+	}
+	prefix := opts.TablePrefix
+	if prefix == "" {
+		prefix = "semtools_"
+	}
+	if !sqlTablePrefix.MatchString(prefix) {
+		return nil, fmt.Errorf("Invalid table prefix '%v'", prefix)
+	}
+	defaultGraph := opts.DefaultGraph
+	if defaultGraph == nil {
+		defaultGraph = NewNamedNode("default-graph")
+	}
+
+	kb := &sqlKnowledgeBase{
+		name: name,
+		db: db,
+		dialect: dialect,
+		prefix: prefix,
+		defaultGraph: defaultGraph,
+		unionDefaultGraph: opts.UnionDefaultGraph,
+		prepared: newPreparedQueryCache(preparedQueryCacheSize),
+		ids: map[string]int64{},
+		terms: map[int64]Node{},
+	}
+	if err := kb.createSchema(); err != nil {
+		return nil, err
+	}
+	return kb, nil
+
+}
+
+
+
+// sqlExecutor runs statements on a database or within
+// a transaction.
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type sqlKnowledgeBase struct {
+	// mutex serializes modifications so their changes are
+	// delivered in order
+	mutex sync.Mutex
+	name string
+	db *sql.DB
+	dialect SQLDialect
+	prefix string
+	defaultGraph NamedNode
+	unionDefaultGraph bool
+	prepared *preparedQueryCache
+	observers observers
+	// termsMutex guards the caches of term ids and decoded
+	// terms, ids of committed terms never change
+	termsMutex sync.RWMutex
+	ids map[string]int64
+	terms map[int64]Node
+	errs firstError
+}
+
+func (kb *sqlKnowledgeBase) Name() string {
+	return kb.name
+}
+
+func (kb *sqlKnowledgeBase) Statements() []Statement {
+	return kb.collect(kb.Iterate())
+}
+
+func (kb *sqlKnowledgeBase) Iterate() StatementIterator {
+	return kb.scan("1 = 1", nil)
+}
+
+func (kb *sqlKnowledgeBase) Insert(stmts []Statement) {
+	kb.mutex.Lock()
+	change := Change{}
+	created := map[string]int64{}
+	err := kb.update(func(tx *sql.Tx) error {
+		change.Added = []Statement{}
+		for _, stmt := range stmts {
+
+			// make copy of statement and
+			// ensure graph is set
+			graph := stmt.Graph()
+			if graph == nil {
+				graph = kb.defaultGraph
+			}
+			s := NewStatement(stmt.Subject(), stmt.Predicate(), stmt.Object(), graph)
+
+			// insert only if not already existing
+			args := []interface{}{}
+			for _, p := range []Position{SubjectPosition, PredicatePosition, ObjectPosition, GraphPosition} {
+				id, _, err := kb.termID(tx, p.Of(s), created)
+				if err != nil {
+					return err
+				}
+				args = append(args, id)
+			}
+			res, err := tx.Exec(kb.sql("INSERT INTO {p}quads (s, p, o, g) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING"), args...)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				continue
+			}
+			if metadata := MetadataOf(stmt); metadata != nil {
+				encoded, err := metadataToJSON(metadata)
+				if err != nil {
+					return err
+				}
+				data, err := json.Marshal(encoded)
+				if err != nil {
+					return err
+				}
+				_, err = tx.Exec(kb.sql("INSERT INTO {p}metadata (quad, encoded) SELECT id, ? FROM {p}quads WHERE s = ? AND p = ? AND o = ? AND g = ?"),
+					append([]interface{}{string(data)}, args...)...)
+				if err != nil {
+					return err
+				}
+				s = withMetadata(s, metadata)
+			}
+			change.Added = append(change.Added, s)
+
+		}
+		return kb.nextSequence(tx, &change)
+	})
+	if err == nil {
+		for key, id := range created {
+			kb.cacheID(key, id)
+		}
+	}
+	kb.commit(change, err)
+}
+
+func (kb *sqlKnowledgeBase) Delete(stmts []Statement) {
+	kb.mutex.Lock()
+	change := Change{}
+	err := kb.update(func(tx *sql.Tx) error {
+		change.Removed = []Statement{}
+		for _, stmt := range stmts {
+
+			// match the statements of any graph
+			// unless the graph is set
+			positions := []Position{SubjectPosition, PredicatePosition, ObjectPosition}
+			if stmt.Graph() != nil {
+				positions = append(positions, GraphPosition)
+			}
+			conditions := []string{}
+			args := []interface{}{}
+			known := true
+			for _, p := range positions {
+				id, ok, err := kb.termID(tx, p.Of(stmt), nil)
+				if err != nil {
+					return err
+				}
+				known = known && ok
+				conditions = append(conditions, "q." + sqlColumns[p] + " = ?")
+				args = append(args, id)
+			}
+			if !known {
+				continue
+			}
+
+			// collect matches before removing them as the
+			// connection can't be used while reading rows
+			rows, err := tx.Query(kb.sql(sqlStatementQuery + " WHERE " + strings.Join(conditions, " AND ") + " ORDER BY q.id"), args...)
+			if err != nil {
+				return err
+			}
+			ids, matches, err := kb.readStatements(rows)
+			if err != nil {
+				return err
+			}
+			for idx, id := range ids {
+				if _, err := tx.Exec(kb.sql("DELETE FROM {p}metadata WHERE quad = ?"), id); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(kb.sql("DELETE FROM {p}quads WHERE id = ?"), id); err != nil {
+					return err
+				}
+				change.Removed = append(change.Removed, matches[idx])
+			}
+
+		}
+		return kb.nextSequence(tx, &change)
+	})
+	kb.commit(change, err)
+}
+
+// commit queues the change for the observers and releases the
+// mutex before delivering it, so changes are delivered in order
+// without holding the mutex.
+func (kb *sqlKnowledgeBase) commit(change Change, err error) {
+	if err != nil {
+		kb.mutex.Unlock()
+		kb.fail(err)
+		return
+	}
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		kb.mutex.Unlock()
+		return
+	}
+
+	kb.observers.enqueue(change)
+	kb.mutex.Unlock()
+	kb.observers.deliver()
+}
+
+func (kb *sqlKnowledgeBase) Listen(listener ChangeListener) func() {
+	return kb.observers.listen(listener)
+}
+
+func (kb *sqlKnowledgeBase) Sequence() uint64 {
+	var sequence int64
+	if err := kb.db.QueryRow(kb.sql("SELECT number FROM {p}meta WHERE name = 'sequence'")).Scan(&sequence); err != nil {
+		kb.fail(err)
+	}
+	return uint64(sequence)
+}
+
+func (kb *sqlKnowledgeBase) Subscribe(q Query, opts *SubscriptionOptions) (Subscription, error) {
+	s, err := newSubscription(q, kb, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// register and collect the initial results atomically
+	kb.mutex.Lock()
+	defer kb.mutex.Unlock()
+	candidates, err := CollectStatements(kb.Filter(s.expr))
+	if err != nil {
+		return nil, err
+	}
+	s.results = s.filter(candidates)
+	kb.observers.subscribe(s, kb.Sequence())
+	return s, nil
+}
+
+func (kb *sqlKnowledgeBase) Select() Query {
+	return NewQuery().Bind(kb)
+}
+
+func (kb *sqlKnowledgeBase) Prepare(q Query) (PreparedQuery, error) {
+	r, ok := q.(*query)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported query implementation %T", q)
+	}
+	return kb.prepared.prepare(r.root(), kb)
+}
+
+func (kb *sqlKnowledgeBase) Filter(expr Expression) StatementIterator {
+	condition, args, _ := kb.condition(expr)
+	return kb.scan(condition, args)
+}
+
+func (kb *sqlKnowledgeBase) Cardinality(position Position, node Node) int {
+	condition, args, _ := kb.condition(&PatternExpression{Position: position, Node: node})
+	var count int
+	if err := kb.db.QueryRow(kb.sql("SELECT COUNT(*) FROM {p}quads q WHERE " + condition), args...).Scan(&count); err != nil {
+		kb.fail(err)
+	}
+	return count
+}
+
+func (kb *sqlKnowledgeBase) Lookup(position Position, node Node) []Statement {
+	return kb.collect(kb.IterateLookup(position, node))
+}
+
+func (kb *sqlKnowledgeBase) IterateLookup(position Position, node Node) StatementIterator {
+	return kb.Filter(&PatternExpression{Position: position, Node: node})
+}
+
+func (kb *sqlKnowledgeBase) Size() int {
+	var size int
+	if err := kb.db.QueryRow(kb.sql("SELECT COUNT(*) FROM {p}quads")).Scan(&size); err != nil {
+		kb.fail(err)
+	}
+	return size
+}
+
+func (kb *sqlKnowledgeBase) DefaultGraph() NamedNode {
+	return kb.defaultGraph
+}
+
+func (kb *sqlKnowledgeBase) UnionDefaultGraph() bool {
+	return kb.unionDefaultGraph
+}
+
+func (kb *sqlKnowledgeBase) Graphs() []NamedNode {
+	graphs := []NamedNode{}
+	rows, err := kb.db.Query(kb.sql("SELECT q.g, t.encoded FROM {p}quads q JOIN {p}terms t ON t.id = q.g GROUP BY q.g, t.encoded ORDER BY MIN(q.id)"))
+	if err != nil {
+		kb.fail(err)
+		return graphs
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var encoded sql.NullString
+		if err := rows.Scan(&id, &encoded); err != nil {
+			kb.fail(err)
+			return graphs
+		}
+		node, err := kb.term(id, encoded)
+		if err != nil {
+			kb.fail(err)
+			return graphs
+		}
+		if graph, ok := node.(NamedNode); ok {
+			graphs = append(graphs, graph)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		kb.fail(err)
+	}
+	return graphs
+}
+
+func (kb *sqlKnowledgeBase) Graph(graph NamedNode) KnowledgeBase {
+	return &graphView{
+		base: kb,
+		graph: graphOrDefault(kb, graph),
+	}
+}
+
+func (kb *sqlKnowledgeBase) DropGraph(graph NamedNode) {
+	graph = graphOrDefault(kb, graph)
+	kb.Delete(kb.Lookup(GraphPosition, graph))
+}
+
+func (kb *sqlKnowledgeBase) CopyGraph(source NamedNode, target NamedNode) {
+	source, target = graphOrDefault(kb, source), graphOrDefault(kb, target)
+	if source.Equals(target) {
+		return
+	}
+	kb.DropGraph(target)
+	kb.AddGraph(source, target)
+}
+
+func (kb *sqlKnowledgeBase) MoveGraph(source NamedNode, target NamedNode) {
+	source, target = graphOrDefault(kb, source), graphOrDefault(kb, target)
+	if source.Equals(target) {
+		return
+	}
+	kb.CopyGraph(source, target)
+	kb.DropGraph(source)
+}
+
+func (kb *sqlKnowledgeBase) AddGraph(source NamedNode, target NamedNode) {
+	source, target = graphOrDefault(kb, source), graphOrDefault(kb, target)
+	kb.Insert(withGraph(kb.Lookup(GraphPosition, source), target))
+}
+
+func (kb *sqlKnowledgeBase) Err() error {
+	return kb.errs.get()
+}
+
+// Close does nothing as the database is owned by the caller.
+func (kb *sqlKnowledgeBase) Close() error {
+	return nil
+}
+
+// createSchema creates the tables and indexes unless they exist.
+func (kb *sqlKnowledgeBase) createSchema() error {
+	id := "INTEGER PRIMARY KEY"
+	if kb.dialect == PostgresDialect {
+		id = "BIGSERIAL PRIMARY KEY"
+	}
+	return kb.update(func(tx *sql.Tx) error {
+		for _, stmt := range []string{
+			"CREATE TABLE IF NOT EXISTS {p}terms (id " + id + ", term TEXT NOT NULL UNIQUE, kind TEXT NOT NULL, " +
+				"lexical TEXT NOT NULL, language TEXT NOT NULL, datatype TEXT NOT NULL, encoded TEXT NOT NULL)",
+			"CREATE TABLE IF NOT EXISTS {p}quads (id " + id + ", s BIGINT NOT NULL, p BIGINT NOT NULL, " +
+				"o BIGINT NOT NULL, g BIGINT NOT NULL, UNIQUE (s, p, o, g))",
+			"CREATE INDEX IF NOT EXISTS {p}quads_posg ON {p}quads (p, o, s, g)",
+			"CREATE INDEX IF NOT EXISTS {p}quads_ospg ON {p}quads (o, s, p, g)",
+			"CREATE INDEX IF NOT EXISTS {p}quads_gspo ON {p}quads (g, s, p, o)",
+			"CREATE TABLE IF NOT EXISTS {p}metadata (quad BIGINT PRIMARY KEY, encoded TEXT NOT NULL)",
+			"CREATE TABLE IF NOT EXISTS {p}meta (name TEXT PRIMARY KEY, number BIGINT NOT NULL)",
+			"INSERT INTO {p}meta (name, number) SELECT 'sequence', 0 WHERE NOT EXISTS (SELECT 1 FROM {p}meta WHERE name = 'sequence')",
+		} {
+			if _, err := tx.Exec(kb.sql(stmt)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sql prefixes the tables of the statement and converts the
+// placeholders for the dialect.
+func (kb *sqlKnowledgeBase) sql(stmt string) string {
+	stmt = strings.Replace(stmt, "{p}", kb.prefix, -1)
+	if kb.dialect != PostgresDialect {
+		return stmt
+	}
+	parts := strings.Split(stmt, "?")
+	for idx := range parts[1:] {
+		parts[idx + 1] = "$" + strconv.Itoa(idx + 1) + parts[idx + 1]
+	}
+	return strings.Join(parts, "")
+}
+
+// update runs the function within a transaction, which is
+// committed unless the function fails.
+func (kb *sqlKnowledgeBase) update(fn func(tx *sql.Tx) error) error {
+	tx, err := kb.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// nextSequence assigns the next sequence number to the change,
+// unless it is empty.
+func (kb *sqlKnowledgeBase) nextSequence(tx *sql.Tx, change *Change) error {
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(kb.sql("UPDATE {p}meta SET number = number + 1 WHERE name = 'sequence'")); err != nil {
+		return err
+	}
+	var sequence int64
+	if err := tx.QueryRow(kb.sql("SELECT number FROM {p}meta WHERE name = 'sequence'")).Scan(&sequence); err != nil {
+		return err
+	}
+	change.Sequence = uint64(sequence)
+	return nil
+}
+
+// fail records and logs an error accessing the database.
+func (kb *sqlKnowledgeBase) fail(err error) {
+	kb.errs.record(err)
+	GetLogger("knowledge-base").Errorf("Failed to access the database of '%v': %v", kb.name, err)
+}
+
+// collect reads the statements of the iterator, recording its
+// error.
+func (kb *sqlKnowledgeBase) collect(it StatementIterator) []Statement {
+	stmts, err := CollectStatements(it)
+	if err != nil {
+		kb.fail(err)
+		return []Statement{}
+	}
+	return stmts
+}
+
+// scan returns an iterator over the statements matching the
+// condition, in the order they were inserted.
+func (kb *sqlKnowledgeBase) scan(condition string, args []interface{}) StatementIterator {
+	return &sqlIterator{
+		kb: kb,
+		query: kb.sql(sqlStatementQuery + " WHERE q.id > ? AND " + condition + " ORDER BY q.id LIMIT " + strconv.Itoa(sqlIteratorChunk)),
+		args: args,
+	}
+}
+
+// termID returns the id of the node and whether it is known, nil
+// nodes have the id 0. Unknown nodes are added if created is set,
+// which collects their ids until the transaction is committed.
+func (kb *sqlKnowledgeBase) termID(ex sqlExecutor, node Node, created map[string]int64) (int64, bool, error) {
+	if node == nil {
+		return 0, true, nil
+	}
+	key := termKey(node)
+	if id, ok := created[key]; ok {
+		return id, true, nil
+	}
+	kb.termsMutex.RLock()
+	id, ok := kb.ids[key]
+	kb.termsMutex.RUnlock()
+	if ok {
+		return id, true, nil
+	}
+
+	err := ex.QueryRow(kb.sql("SELECT id FROM {p}terms WHERE term = ?"), key).Scan(&id)
+	if err == nil {
+		kb.cacheID(key, id)
+		return id, true, nil
+	} else if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+	if created == nil {
+		return 0, false, nil
+	}
+
+	encoded, err := nodeToJSON(node)
+	if err != nil {
+		return 0, false, err
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return 0, false, err
+	}
+	kind, lexical, language, datatype := "iri", "", "", ""
+	switch v := node.(type) {
+	case QuotedTriple:
+		kind, lexical = "triple", v.Iri()
+	case NamedNode:
+		lexical = v.Iri()
+	case LiteralNode:
+		kind, lexical, datatype = "literal", v.String(), LiteralDatatype(v).Iri()
+		if l, ok := v.(LocalizedLiteral); ok {
+			language = l.Language()
+		}
+	}
+	_, err = ex.Exec(kb.sql("INSERT INTO {p}terms (term, kind, lexical, language, datatype, encoded) VALUES (?, ?, ?, ?, ?, ?)"),
+		key, kind, lexical, language, datatype, string(data))
+	if err != nil {
+		return 0, false, err
+	}
+	if err := ex.QueryRow(kb.sql("SELECT id FROM {p}terms WHERE term = ?"), key).Scan(&id); err != nil {
+		return 0, false, err
+	}
+	created[key] = id
+	return id, true, nil
+}
+
+func (kb *sqlKnowledgeBase) cacheID(key string, id int64) {
+	kb.termsMutex.Lock()
+	defer kb.termsMutex.Unlock()
+	if len(kb.ids) >= sqlTermCacheSize {
+		kb.ids = map[string]int64{}
+	}
+	kb.ids[key] = id
+}
+
+// term decodes the term of the id.
+func (kb *sqlKnowledgeBase) term(id int64, encoded sql.NullString) (Node, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	kb.termsMutex.RLock()
+	node, ok := kb.terms[id]
+	kb.termsMutex.RUnlock()
+	if ok {
+		return node, nil
+	}
+
+	if !encoded.Valid {
+		return nil, fmt.Errorf("Unknown term %v", id)
+	}
+	nj := &nodeJSON{}
+	if err := json.Unmarshal([]byte(encoded.String), nj); err != nil {
+		return nil, err
+	}
+	node, err := nodeFromJSON(nj)
+	if err != nil {
+		return nil, err
+	}
+
+	kb.termsMutex.Lock()
+	defer kb.termsMutex.Unlock()
+	if len(kb.terms) >= sqlTermCacheSize {
+		kb.terms = map[int64]Node{}
+	}
+	kb.terms[id] = node
+	return node, nil
+}
+
+// readStatements decodes the rows of sqlStatementQuery and
+// closes them.
+func (kb *sqlKnowledgeBase) readStatements(rows *sql.Rows) ([]int64, []Statement, error) {
+	defer rows.Close()
+	ids := []int64{}
+	stmts := []Statement{}
+	for rows.Next() {
+		var id int64
+		var terms [4]int64
+		var encoded [4]sql.NullString
+		var metadata sql.NullString
+		err := rows.Scan(&id, &terms[0], &encoded[0], &terms[1], &encoded[1], &terms[2], &encoded[2], &terms[3], &encoded[3], &metadata)
+		if err != nil {
+			return nil, nil, err
+		}
+		nodes := make([]Node, 4)
+		for idx := range nodes {
+			if nodes[idx], err = kb.term(terms[idx], encoded[idx]); err != nil {
+				return nil, nil, err
+			}
+		}
+		subject, sok := nodes[SubjectPosition].(NamedNode)
+		predicate, pok := nodes[PredicatePosition].(NamedNode)
+		graph, gok := nodes[GraphPosition].(NamedNode)
+		if !sok || !pok || !gok {
+			return nil, nil, fmt.Errorf("Invalid statement of terms %v", terms)
+		}
+		stmt := NewStatement(subject, predicate, nodes[ObjectPosition], graph)
+		if metadata.Valid {
+			decoded := &nodeJSON{}
+			if err := json.Unmarshal([]byte(metadata.String), decoded); err != nil {
+				return nil, nil, err
+			}
+			m, err := metadataFromJSON(decoded)
+			if err != nil {
+				return nil, nil, err
+			}
+			stmt = withMetadata(stmt, m)
+		}
+		ids = append(ids, id)
+		stmts = append(stmts, stmt)
+	}
+	return ids, stmts, rows.Err()
+}
+
+// condition translates the expression into a condition on the
+// quads q that holds for at least all matching statements, it is
+// exact if it holds for the matching statements only. Expressions
+// that can't be translated are evaluated on the candidates.
+func (kb *sqlKnowledgeBase) condition(expr Expression) (string, []interface{}, bool) {
+	switch e := expr.(type) {
+	case *TrueExpression:
+		return "1 = 1", nil, true
+	case *PatternExpression:
+		column := "q." + sqlColumns[e.Position]
+		if e.Node == nil {
+			return column + " = 0", nil, true
+		}
+		return column + " = COALESCE((SELECT id FROM {p}terms WHERE term = ?), -1)", []interface{}{termKey(e.Node)}, true
+	case *FilterExpression:
+		return kb.filterCondition(e)
+	case *AndExpression:
+		return kb.operandsCondition(e.Operands, " AND ", "1 = 1")
+	case *OrExpression:
+		return kb.operandsCondition(e.Operands, " OR ", "1 = 0")
+	case *NotExpression:
+		// only the complement of exact conditions is exact
+		condition, args, exact := kb.condition(e.Operand)
+		if !exact {
+			return "1 = 1", nil, false
+		}
+		return "NOT " + condition, args, true
+	case *PlanNode:
+		return kb.condition(e.Expression)
+	}
+	return "1 = 1", nil, false
+}
+
+func (kb *sqlKnowledgeBase) operandsCondition(operands []Expression, op string, empty string) (string, []interface{}, bool) {
+	if len(operands) == 0 {
+		return empty, nil, true
+	}
+	conditions := []string{}
+	args := []interface{}{}
+	exact := true
+	for _, o := range operands {
+		condition, a, x := kb.condition(o)
+		conditions = append(conditions, condition)
+		args = append(args, a...)
+		exact = exact && x
+	}
+	return "(" + strings.Join(conditions, op) + ")", args, exact
+}
+
+// filterCondition translates the string and datatype filters into
+// conditions on the literals, others are evaluated on the candidates.
+func (kb *sqlKnowledgeBase) filterCondition(e *FilterExpression) (string, []interface{}, bool) {
+	if e.Argument == nil {
+		return "1 = 0", nil, true
+	}
+	literals := "q." + sqlColumns[e.Position] + " IN (SELECT id FROM {p}terms WHERE kind = 'literal' AND "
+	arg := e.Argument.String()
+	switch e.Operator {
+	case ContainsFilter:
+		if kb.dialect == PostgresDialect {
+			return literals + "strpos(lexical, ?) > 0)", []interface{}{arg}, true
+		}
+		return literals + "instr(lexical, ?) > 0)", []interface{}{arg}, true
+	case PrefixFilter:
+		return literals + "substr(lexical, 1, length(?)) = ?)", []interface{}{arg, arg}, true
+	case DatatypeFilter:
+		datatype, ok := e.Argument.(NamedNode)
+		if !ok {
+			return "1 = 0", nil, true
+		}
+		return literals + "datatype = ?)", []interface{}{datatype.Iri()}, true
+	case LanguageFilter:
+		if strings.Contains(arg, "*") {
+			break
+		}
+		language := strings.ToLower(arg)
+		return literals + "(lower(language) = ? OR lower(language) LIKE ?))", []interface{}{language, language + "-%"}, false
+	}
+	return "1 = 1", nil, false
+}
+
+
+
+// sqlIterator reads the statements matching a condition in
+// chunks, continuing after the last id read.
+type sqlIterator struct {
+	kb *sqlKnowledgeBase
+	query string
+	args []interface{}
+	last int64
+	done bool
+	buffer []Statement
+	current Statement
+	err error
+	closed bool
+}
+
+func (it *sqlIterator) Next() bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+	if len(it.buffer) == 0 && !it.done {
+		if it.err = it.read(); it.err != nil {
+			return false
+		}
+	}
+	if len(it.buffer) == 0 {
+		it.current = nil
+		return false
+	}
+	it.current, it.buffer = it.buffer[0], it.buffer[1:]
+	return true
+}
+
+func (it *sqlIterator) Statement() Statement {
+	return it.current
+}
+
+func (it *sqlIterator) Err() error {
+	return it.err
+}
+
+func (it *sqlIterator) Close() error {
+	it.closed = true
+	it.buffer = nil
+	return nil
+}
+
+// read queries the next chunk of statements.
+func (it *sqlIterator) read() error {
+	rows, err := it.kb.db.Query(it.query, append([]interface{}{it.last}, it.args...)...)
+	if err != nil {
+		return err
+	}
+	ids, stmts, err := it.kb.readStatements(rows)
+	if err != nil {
+		return err
+	}
+	if len(ids) < sqlIteratorChunk {
+		it.done = true
+	}
+	if len(ids) > 0 {
+		it.last = ids[len(ids) - 1]
+	}
+	it.buffer = stmts
+	return nil
+}
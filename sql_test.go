@@ -0,0 +1,289 @@
+package semtools
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func openTestDatabase(t *testing.T) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "semtools")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	db, err := sql.Open("sqlite", filepath.Join(dir, "kb.sqlite"))
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	// avoid busy errors of concurrent connections
+	db.SetMaxOpenConns(1)
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+
+func TestSQLKnowledgeBase(t *testing.T) {
+
+	db, cleanup := openTestDatabase(t)
+	defer cleanup()
+
+	kb, err := NewSQLKnowledgeBase("kb", db, nil)
+	if err != nil {
+		t.Fatalf("NewSQLKnowledgeBase() failed: %v", err)
+	}
+	indexed := kb.(IndexedKnowledgeBase)
+	changes := []Change{}
+	kb.Listen(ChangeListenerFunc(func(change Change) {
+		changes = append(changes, change)
+	}))
+
+	a := NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer")), nil)
+	b := NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewLocalizedLiteral("B", "en"), NewNamedNode("g"))
+	c := NewStatement(NewNamedNode("a"), NewNamedNode("q"), NewNamedNode("b"), NewNamedNode("g"))
+	kb.Insert([]Statement{a, b, b, c})
+	kb.Insert([]Statement{a})
+	if stmts := kb.Statements(); len(stmts) != 3 || !stmts[1].Equals(b) || len(changes) != 1 || len(changes[0].Added) != 3 || kb.Sequence() != 1 {
+		t.Errorf("Insert() expected 3 statements in order in one change but got %v (%v)", stmts, changes)
+	}
+	if indexed.Cardinality(SubjectPosition, NewNamedNode("a")) != 2 || indexed.Cardinality(GraphPosition, NewNamedNode("g")) != 2 || indexed.Cardinality(SubjectPosition, NewNamedNode("x")) != 0 {
+		t.Errorf("Cardinality() returns unexpected counts")
+	}
+	if graphs := kb.Graphs(); len(graphs) != 2 || !graphs[0].Equals(kb.DefaultGraph()) {
+		t.Errorf("Graphs() expected 2 graphs in order but got %v", graphs)
+	}
+
+	// deleting without graph matches all graphs
+	kb.Delete([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("q"), NewNamedNode("b"), nil)})
+	kb.Delete([]Statement{NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewLocalizedLiteral("B", "en"), NewNamedNode("h"))})
+	if indexed.Size() != 2 || len(changes) != 2 || len(changes[1].Removed) != 1 || !changes[1].Removed[0].Equals(c) {
+		t.Errorf("Delete() expected to remove one statement but got %v (%v)", kb.Statements(), changes)
+	}
+
+	kb.MoveGraph(NewNamedNode("g"), NewNamedNode("h"))
+	if res := kb.Graph(NewNamedNode("h")).Statements(); len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("b")) || len(kb.Graph(NewNamedNode("g")).Statements()) != 0 {
+		t.Errorf("MoveGraph() expected the statement in the target graph but got %v", res)
+	}
+	if kb.Err() != nil {
+		t.Errorf("Err() expected no error but got %v", kb.Err())
+	}
+
+	// the tables are reused
+	kb, err = NewSQLKnowledgeBase("kb", db, nil)
+	if err != nil {
+		t.Fatalf("NewSQLKnowledgeBase() failed to reopen: %v", err)
+	}
+	if stmts := kb.Statements(); len(stmts) != 2 || kb.Sequence() != 4 {
+		t.Errorf("NewSQLKnowledgeBase() expected 2 statements at 4 but got %v at %v", stmts, kb.Sequence())
+	}
+	if res := kb.Select().Object(NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer"))).Results(); len(res) != 1 || !res[0].Graph().Equals(kb.DefaultGraph()) {
+		t.Errorf("Select() expected the typed literal in the default graph but got %v", res)
+	}
+	kb.AddGraph(nil, NewNamedNode("i"))
+	if res := kb.Graph(NewNamedNode("i")).Statements(); len(res) != 1 || len(kb.Graph(nil).Statements()) != 1 {
+		t.Errorf("AddGraph() expected the statement of the default graph for nil but got %v", res)
+	}
+	if other, err := NewSQLKnowledgeBase("other", db, &SQLKnowledgeBaseOptions{TablePrefix: "other_"}); err != nil || len(other.Statements()) != 0 {
+		t.Errorf("NewSQLKnowledgeBase() expected separate tables for the prefix (%v)", err)
+	}
+
+	if _, err := NewSQLKnowledgeBase("kb", db, &SQLKnowledgeBaseOptions{TablePrefix: "x; DROP TABLE"}); err == nil {
+		t.Errorf("NewSQLKnowledgeBase() expected to fail for invalid prefix")
+	}
+	if _, err := NewSQLKnowledgeBase("kb", db, &SQLKnowledgeBaseOptions{Dialect: "oracle"}); err == nil {
+		t.Errorf("NewSQLKnowledgeBase() expected to fail for unknown dialect")
+	}
+
+}
+
+
+func TestSQLKnowledgeBaseQueries(t *testing.T) {
+
+	db, cleanup := openTestDatabase(t)
+	defer cleanup()
+
+	kb, err := NewSQLKnowledgeBase("kb", db, nil)
+	if err != nil {
+		t.Fatalf("NewSQLKnowledgeBase() failed: %v", err)
+	}
+	reference := NewKnowledgeBase("reference")
+
+	// more statements than fit into a chunk of an iterator
+	stmts := []Statement{}
+	for idx := 0; idx < 1500; idx++ {
+		stmts = append(stmts,
+			NewStatement(NewNamedNode(fmt.Sprintf("s%v", idx)), NewNamedNode(fmt.Sprintf("p%v", idx % 7)), NewTypedLiteral(fmt.Sprintf("%v", idx), NewNamedNode(xsdNamespace + "integer")), nil),
+			NewStatement(NewNamedNode(fmt.Sprintf("s%v", idx)), NewNamedNode("label"), NewLocalizedLiteral(fmt.Sprintf("label %v", idx), []string{"en", "en-GB", "de"}[idx % 3]), NewNamedNode(fmt.Sprintf("g%v", idx % 3))),
+		)
+	}
+	kb.Insert(stmts)
+	reference.Insert(stmts)
+
+	queries := map[string]Query{
+		"all": NewQuery(),
+		"subject": NewQuery().Subject(NewNamedNode("s42")),
+		"comparison": NewQuery().Predicate(NewNamedNode("p3")).ObjectGreaterThan(NewTypedLiteral("1000", NewNamedNode(xsdNamespace + "integer"))),
+		"prefix": NewQuery().Graph(NewNamedNode("g1")).ObjectStartsWith("label 12"),
+		"contains": NewQuery().ObjectContains("bel 99"),
+		"language": NewQuery().ObjectLanguage("en").ObjectContains("14"),
+		"datatype": NewQuery().ObjectDatatype(NewNamedNode(xsdNamespace + "integer")).Not().ObjectStartsWith("1"),
+		"or": NewQuery().Subject(NewNamedNode("s1")).Or().Object(NewLocalizedLiteral("label 7", "en")),
+		"not": NewQuery().Predicate(NewNamedNode("label")).Not().Group().Graph(NewNamedNode("g0")).Or().ObjectMatches("5$").EndGroup(),
+		"unknown": NewQuery().Predicate(NewNamedNode("unknown")),
+		"not unknown": NewQuery().Not().Predicate(NewNamedNode("unknown")),
+	}
+	for name, q := range queries {
+		expected := q.Bind(reference).Results()
+		actual := q.Bind(kb).Results()
+		if len(expected) == 0 && name != "unknown" {
+			t.Errorf("%v: Results() expected matches of the reference", name)
+		}
+		if fmt.Sprint(sortedStatementKeys(expected)) != fmt.Sprint(sortedStatementKeys(actual)) {
+			t.Errorf("%v: Results() expected %v statements but got %v", name, len(expected), len(actual))
+		}
+	}
+
+	// exact conditions are evaluated by the database
+	q := NewQuery().ObjectStartsWith("label 14").Not().Graph(NewNamedNode("g2"))
+	expected := fmt.Sprintf("FILTERED SCAN (estimated 3000, actual %v)", q.Bind(reference).Count())
+	if explain, err := q.Bind(kb).Explain(); err != nil || !strings.HasPrefix(explain, expected) {
+		t.Errorf("Explain() expected a filtered scan of the matches but got %v (%v)", explain, err)
+	}
+	if res := kb.Select().Predicate(NewNamedNode("label")).OrderByDescending(ObjectPosition).Limit(2).Results(); len(res) != 2 || res[0].Object().String() != "label 999" {
+		t.Errorf("Select() expected ordered results but got %v", res)
+	}
+
+	sub, err := kb.Subscribe(NewQuery().Subject(NewNamedNode("s42")), nil)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	defer sub.Close()
+	if len(sub.Results()) != 2 {
+		t.Errorf("Subscribe() expected 2 initial results but got %v", sub.Results())
+	}
+	kb.DropGraph(NewNamedNode("g0"))
+	if change := <-sub.Changes(); len(change.Removed) != 1 {
+		t.Errorf("Changes() expected the label to be removed but got %v", change)
+	}
+	if size := kb.(IndexedKnowledgeBase).Size(); size != 3000 - 500 {
+		t.Errorf("DropGraph() expected %v statements but got %v", 3000 - 500, size)
+	}
+
+}
+
+
+func TestSQLKnowledgeBaseTypedLiterals(t *testing.T) {
+
+	db, cleanup := openTestDatabase(t)
+	defer cleanup()
+
+	kb, err := NewSQLKnowledgeBase("kb", db, nil)
+	if err != nil {
+		t.Fatalf("NewSQLKnowledgeBase() failed: %v", err)
+	}
+	integer := NewNamedNode(xsdNamespace + "integer")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), NewNamedNode("age"), NewTypedLiteral(30, integer), nil),
+		NewStatement(NewNamedNode("b"), NewNamedNode("age"), NewTypedLiteral("30", integer), nil),
+		NewStatement(NewNamedNode("a"), NewNamedNode("active"), NewTypedLiteral(true, NewNamedNode(xsdNamespace + "boolean")), nil),
+	})
+
+	// values of different kinds are different terms
+	if res := kb.Select().Object(NewTypedLiteral(30, integer)).Results(); len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("a")) {
+		t.Errorf("Select() expected the integer literal but got %v", res)
+	}
+	if res := kb.Select().Object(NewTypedLiteral("30", integer)).Results(); len(res) != 1 || !res[0].Subject().Equals(NewNamedNode("b")) {
+		t.Errorf("Select() expected the string literal but got %v", res)
+	}
+	if res := kb.Select().Predicate(NewNamedNode("age")).ObjectGreaterThan(NewTypedLiteral(20, integer)).Results(); len(res) != 2 {
+		t.Errorf("Select() expected both ages to be compared by value but got %v", res)
+	}
+
+	// including values within nested quoted triples
+	nested := func(value interface{}) Statement {
+		inner := NewQuotedTriple(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral(value, integer))
+		return NewStatement(NewQuotedTriple(inner, NewNamedNode("p"), NewNamedNode("a")), NewNamedNode("q"), NewNamedNode("b"), nil)
+	}
+	kb.Insert([]Statement{nested(1), nested("1")})
+	if res := kb.Select().Predicate(NewNamedNode("q")).Results(); len(res) != 2 {
+		t.Errorf("Insert() expected quoted triples with values of different kinds but got %v", res)
+	}
+	kb.Delete([]Statement{nested(1), nested("1")})
+
+	// a new knowledge base on the tables decodes the stored terms
+	kb, err = NewSQLKnowledgeBase("kb", db, nil)
+	if err != nil {
+		t.Fatalf("NewSQLKnowledgeBase() failed to reopen: %v", err)
+	}
+	if res := kb.Select().Object(NewTypedLiteral(true, NewNamedNode(xsdNamespace + "boolean"))).Results(); len(res) != 1 || res[0].Object().(TypedLiteral).Value() != true {
+		t.Errorf("Select() expected the boolean literal but got %v", res)
+	}
+	kb.Delete([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("age"), NewTypedLiteral(30, integer), nil)})
+	if stmts := kb.Statements(); len(stmts) != 2 {
+		t.Errorf("Delete() expected 2 remaining statements but got %v", stmts)
+	}
+
+}
+
+
+func TestSQLKnowledgeBaseMetadata(t *testing.T) {
+
+	db, cleanup := openTestDatabase(t)
+	defer cleanup()
+
+	kb, err := NewSQLKnowledgeBase("kb", db, nil)
+	if err != nil {
+		t.Fatalf("NewSQLKnowledgeBase() failed: %v", err)
+	}
+	changes := []Change{}
+	kb.Listen(ChangeListenerFunc(func(change Change) {
+		changes = append(changes, change)
+	}))
+	kb.Insert(annotatedTestStatements())
+
+	// the metadata of the first insert is kept
+	kb.Insert([]Statement{NewAnnotatedStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"), nil, Metadata{MetadataSource: NewNamedNode("other")})})
+	if len(changes) != 1 || len(MetadataOf(changes[0].Added[0])) != 3 {
+		t.Errorf("Insert() expected the added statements with metadata but got %v", changes)
+	}
+	if stmts := kb.Statements(); len(stmts) != 3 || !MetadataOf(stmts[0])[MetadataSource].Equals(NewNamedNode("file:///a.ttl")) || MetadataOf(stmts[2]) != nil {
+		t.Errorf("Statements() expected the metadata to be preserved but got %v", stmts)
+	}
+
+	// a new knowledge base on the tables reads the metadata
+	kb, err = NewSQLKnowledgeBase("kb", db, nil)
+	if err != nil {
+		t.Fatalf("NewSQLKnowledgeBase() failed to reopen: %v", err)
+	}
+	if res := kb.Select().Metadata(NewNamedNode(MetadataSource), NewNamedNode("file:///b.ttl")).Results(); len(res) != 1 || !res[0].Object().Equals(NewNamedNode("c")) {
+		t.Errorf("Select() expected the statement by its metadata but got %v", res)
+	}
+	kb.CopyGraph(kb.DefaultGraph(), NewNamedNode("g"))
+	if res := kb.Graph(NewNamedNode("g")).Statements(); len(res) != 3 || len(MetadataOf(res[1])) != 3 {
+		t.Errorf("CopyGraph() expected the metadata to be copied but got %v", res)
+	}
+
+	// deleting removes the metadata
+	b := NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("b"), nil)
+	kb.Delete([]Statement{b})
+	kb.Insert([]Statement{b})
+	if res := kb.Select().Object(NewNamedNode("b")).Results(); len(res) != 1 || MetadataOf(res[0]) != nil {
+		t.Errorf("Delete() expected to remove the metadata but got %v", res)
+	}
+
+}
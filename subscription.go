@@ -0,0 +1,173 @@
+package semtools
+
+import (
+	"fmt"
+	"sync"
+)
+
+
+// defaultSubscriptionBuffer is the number of changes buffered
+// by a subscription unless configured otherwise.
+const defaultSubscriptionBuffer = 16
+
+// ResultChange is an incremental change of the results of a
+// subscribed query, caused by a single Insert() or Delete().
+type ResultChange struct {
+
+	// Added are the statements that started matching the query.
+	Added []Statement
+
+	// Removed are the statements that stopped matching the query.
+	Removed []Statement
+
+}
+
+// SubscriptionOptions are options that configure a
+// subscription.
+type SubscriptionOptions struct {
+
+	// Buffer is the number of changes buffered by the channel of
+	// the subscription. Once it is full Insert() and Delete() block
+	// until the subscriber catches up or closes the subscription.
+	// Defaults to 16.
+	Buffer int
+
+}
+
+// Subscription delivers the changes of the results of a query
+// whenever Insert() or Delete() change them, see Subscribe().
+//
+// Usage
+//
+//     sub, err := kb.Subscribe(NewQuery().Predicate(node), nil)
+//     defer sub.Close()
+//     for change := range sub.Changes() {
+//         ...
+//     }
+type Subscription interface {
+
+	// Results returns the results of the query at the time the
+	// subscription was created, the changes apply on top of them.
+	Results() []Statement
+
+	// Changes returns the channel delivering the changes in the
+	// order of the modifications, it is closed by Close().
+	Changes() <-chan ResultChange
+
+	// Close ends the subscription, releasing modifications that
+	// are blocked on delivering changes to it.
+	Close()
+
+}
+
+
+
+type subscription struct {
+	expr Expression
+	results []Statement
+	// sequence is the number of the last change contained
+	// in the results
+	sequence uint64
+	changes chan ResultChange
+	done chan struct{}
+	once sync.Once
+	// mutex serializes sending changes and closing the channel
+	mutex sync.Mutex
+	closed bool
+	unsubscribe func(*subscription)
+}
+
+// subscribedExpression returns the expression of the query to
+// subscribe to. Solution modifiers are not supported as changes
+// of ordered or paged results aren't incremental.
+func subscribedExpression(q Query) (Expression, error) {
+	r, ok := q.(*query)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported query implementation %T", q)
+	}
+	r = r.root()
+	if len(r.orderings) > 0 || r.after != nil || r.limit >= 0 || r.offset > 0 {
+		return nil, fmt.Errorf("Subscriptions don't support orderings, cursors, offset or limit")
+	}
+	return r.build()
+}
+
+// newSubscription creates the subscription of the query
+// evaluated with the semantics of the knowledge base.
+func newSubscription(q Query, base KnowledgeBase, opts *SubscriptionOptions) (*subscription, error) {
+	expr, err := subscribedExpression(q)
+	if err != nil {
+		return nil, err
+	}
+	sq := newExpressionQuery(expr)
+	sq.exactGraphs = q.(*query).root().exactGraphs
+	expr, err = sq.Bind(base).(*query).compile()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts == nil {
+		opts = &SubscriptionOptions{}
+	}
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = defaultSubscriptionBuffer
+	}
+	return &subscription{
+		expr: expr,
+		results: []Statement{},
+		changes: make(chan ResultChange, buffer),
+		done: make(chan struct{}),
+	}, nil
+}
+
+func (s *subscription) Results() []Statement {
+	return s.results
+}
+
+func (s *subscription) Changes() <-chan ResultChange {
+	return s.changes
+}
+
+func (s *subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.unsubscribe(s)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.closed = true
+		close(s.changes)
+	})
+}
+
+// deliver sends the matching statements of the change unless the
+// results contain it already, blocking until the change is received
+// or the subscription is closed.
+func (s *subscription) deliver(c Change) {
+	if c.Sequence <= s.sequence {
+		return
+	}
+	change := ResultChange{Added: s.filter(c.Added), Removed: s.filter(c.Removed)}
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.changes <- change:
+	case <-s.done:
+	}
+}
+
+func (s *subscription) filter(stmts []Statement) []Statement {
+	res := []Statement{}
+	for _, stmt := range stmts {
+		if s.expr.Evaluate(stmt) {
+			res = append(res, stmt)
+		}
+	}
+	return res
+}
@@ -0,0 +1,193 @@
+package semtools
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestSubscription(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	label := NewNamedNode("label")
+	a := NewStatement(NewNamedNode("a"), label, NewLocalizedLiteral("A", "en"), nil)
+	b := NewStatement(NewNamedNode("b"), label, NewLocalizedLiteral("B", "en"), nil)
+	c := NewStatement(NewNamedNode("c"), NewNamedNode("other"), NewNamedNode("x"), nil)
+	kb.Insert([]Statement{a})
+
+	sub, err := kb.Subscribe(NewQuery().Predicate(label), nil)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	if len(sub.Results()) != 1 {
+		t.Errorf("Results() expected initial result but got %v", sub.Results())
+	}
+
+	kb.Insert([]Statement{a, b, c})
+	change := <-sub.Changes()
+	if len(change.Added) != 1 || !change.Added[0].Equals(NewStatement(b.Subject(), b.Predicate(), b.Object(), kb.DefaultGraph())) || len(change.Removed) != 0 {
+		t.Errorf("Changes() expected only the new match to be added but got %v", change)
+	}
+
+	// changes that don't affect the results are not delivered
+	kb.Delete([]Statement{c})
+	kb.Delete([]Statement{a})
+	change = <-sub.Changes()
+	if len(change.Added) != 0 || len(change.Removed) != 1 || !change.Removed[0].Subject().Equals(NewNamedNode("a")) {
+		t.Errorf("Changes() expected the removed match but got %v", change)
+	}
+
+	sub.Close()
+	if _, ok := <-sub.Changes(); ok {
+		t.Errorf("Changes() expected to be closed after Close()")
+	}
+	sub.Close()
+
+	if _, err := kb.Subscribe(NewQuery().Limit(1), nil); err == nil {
+		t.Errorf("Subscribe() expected to fail for paged queries")
+	}
+	if _, err := kb.Subscribe(NewQuery().Group(), nil); err == nil {
+		t.Errorf("Subscribe() expected to fail for malformed queries")
+	}
+
+}
+
+
+func TestSubscriptionBackPressure(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	graph := NewNamedNode("g")
+	sub, err := kb.Graph(graph).Subscribe(NewQuery(), &SubscriptionOptions{Buffer: 1})
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+
+	kb.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	kb.Graph(graph).Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+
+	// the buffer is full, further modifications block
+	done := make(chan bool)
+	go func() {
+		kb.Graph(graph).Insert([]Statement{NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+		done <- true
+	}()
+	select {
+	case <-done:
+		t.Errorf("Insert() expected to block while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// readers are not blocked
+	if len(kb.Statements()) != 3 {
+		t.Errorf("Statements() expected 3 statements but got %v", len(kb.Statements()))
+	}
+
+	if change := <-sub.Changes(); len(change.Added) != 1 || !change.Added[0].Graph().Equals(graph) {
+		t.Errorf("Changes() expected only changes of the graph but got %v", change)
+	}
+	<-done
+	if change := <-sub.Changes(); len(change.Added) != 1 || !change.Added[0].Subject().Equals(NewNamedNode("b")) {
+		t.Errorf("Changes() expected the blocked change but got %v", change)
+	}
+
+	// closing releases blocked modifications
+	kb.Graph(graph).Insert([]Statement{NewStatement(NewNamedNode("c"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+	go func() {
+		kb.Graph(graph).Insert([]Statement{NewStatement(NewNamedNode("d"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+		done <- true
+	}()
+	time.Sleep(10 * time.Millisecond)
+	sub.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Close() expected to release blocked modifications")
+	}
+
+}
+
+
+func TestSubscriptionConcurrentWriters(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	sub, err := kb.Subscribe(NewQuery(), &SubscriptionOptions{Buffer: 1})
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+
+	// the subscriber reads the knowledge base while draining the changes
+	received := make(chan int)
+	go func() {
+		count := 0
+		for change := range sub.Changes() {
+			// let the writers fill the buffer and wait for the lock
+			time.Sleep(time.Millisecond)
+			kb.Statements()
+			kb.Select().Subject(change.Added[0].Subject()).Results()
+			count++
+			if count == 40 {
+				received <- count
+			}
+		}
+	}()
+
+	for w := 0; w < 4; w++ {
+		go func(w int) {
+			for i := 0; i < 10; i++ {
+				kb.Insert([]Statement{NewStatement(NewNamedNode(fmt.Sprintf("s%v-%v", w, i)), NewNamedNode("p"), NewNamedNode("o"), nil)})
+			}
+		}(w)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Changes() expected all changes of concurrent writers without a deadlock")
+	}
+	sub.Close()
+
+}
+
+
+func TestSubscriptionCloseInListener(t *testing.T) {
+
+	kb := NewKnowledgeBase("kb")
+	sub, err := kb.Subscribe(NewQuery(), nil)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	calls := 0
+	var unlisten func()
+	unlisten = kb.Listen(ChangeListenerFunc(func(change Change) {
+		calls++
+		sub.Close()
+		unlisten()
+	}))
+
+	done := make(chan bool)
+	go func() {
+		kb.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+		kb.Insert([]Statement{NewStatement(NewNamedNode("b"), NewNamedNode("p"), NewNamedNode("o"), nil)})
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Insert() expected listeners to close subscriptions without a deadlock")
+	}
+	if calls != 1 {
+		t.Errorf("Listen() expected the listener to be removed but got %v calls", calls)
+	}
+	if _, ok := <-sub.Changes(); ok {
+		t.Errorf("Close() expected the changes to be closed")
+	}
+
+}
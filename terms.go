@@ -0,0 +1,263 @@
+package semtools
+
+import (
+	"sync"
+)
+
+
+// TermID is the compact identifier of a term within a
+// TermDictionary. The zero id is reserved for nil nodes.
+type TermID uint32
+
+// TermDictionary interns nodes, ie. maps equal nodes to a
+// single shared instance and a compact integer id. Interned
+// nodes of the same dictionary are compared by their ids.
+// Terms are never removed from a dictionary, so it grows
+// with every distinct node it encodes.
+//
+// Usage
+//
+//     terms := NewTermDictionary()
+//     kb := NewKnowledgeBaseWithOptions("kb", &KnowledgeBaseOptions{Terms: terms})
+//     parser := NewTurtleParser(&TurtleParserOptions{Terms: terms})
+//     id := terms.Encode(NewNamedNode("http://example.com/a"))
+//     node := terms.Decode(id)
+type TermDictionary interface {
+
+	// Encode returns the id of the node, adding it to the
+	// dictionary if it isn't known yet.
+	Encode(node Node) TermID
+
+	// ID returns the id of the node and if it is known,
+	// without adding it to the dictionary.
+	ID(node Node) (TermID, bool)
+
+	// Decode returns the interned node of the id or nil
+	// if the id is unknown.
+	Decode(id TermID) Node
+
+	// Intern returns the shared instance of the node,
+	// adding it to the dictionary if it isn't known yet.
+	// Interned nodes keep only the information of the
+	// node interfaces.
+	Intern(node Node) Node
+
+	// Len returns the number of terms in the dictionary.
+	Len() int
+
+}
+
+// NewTermDictionary creates a new empty term dictionary that
+// is safe for concurrent use.
+func NewTermDictionary() TermDictionary {
+	return &termDictionary{
+		nodes: []Node{},
+		ids: map[string][]TermID{},
+	}
+}
+
+// internNamedNode interns the named node, keeping the node
+// if the dictionary returns something else.
+func internNamedNode(terms TermDictionary, node NamedNode) NamedNode {
+	if node == nil {
+		return nil
+	}
+	if n, ok := terms.Intern(node).(NamedNode); ok {
+		return n
+	}
+	return node
+}
+
+// internStatement creates a copy of the statement in the
+// given graph with all nodes (including the values of its
+// metadata) interned.
+func internStatement(terms TermDictionary, stmt Statement, graph NamedNode) Statement {
+	s := NewStatement(
+		internNamedNode(terms, stmt.Subject()),
+		internNamedNode(terms, stmt.Predicate()),
+		terms.Intern(stmt.Object()),
+		internNamedNode(terms, graph),
+	)
+	metadata := MetadataOf(stmt)
+	if metadata == nil {
+		return s
+	}
+	interned := Metadata{}
+	for k, v := range metadata {
+		interned[k] = terms.Intern(v)
+	}
+	return withMetadata(s, interned)
+}
+
+
+
+// internedTerm is implemented by the interned nodes of
+// a termDictionary.
+type internedTerm interface {
+	term() (*termDictionary, TermID)
+}
+
+type termDictionary struct {
+	// mutex guards nodes and ids, nodes holds the
+	// interned node of id n at index n-1 and ids the
+	// candidate ids by formatted node.
+	mutex sync.RWMutex
+	nodes []Node
+	ids map[string][]TermID
+}
+
+func (d *termDictionary) Encode(node Node) TermID {
+	if id, ok := d.ID(node); ok {
+		return id
+	}
+
+	// the type of a literal and the nodes of a quoted triple
+	// are interned first, so they are shared as well
+	var typeNode NamedNode
+	switch v := node.(type) {
+	case TypedLiteral:
+		typeNode = internNamedNode(d, v.Type())
+	case QuotedTriple:
+		node = NewQuotedTriple(internNamedNode(d, v.Subject()), internNamedNode(d, v.Predicate()), d.Intern(v.Object()))
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	key := formatNode(node)
+	if id, ok := d.find(key, node); ok {
+		return id
+	}
+	id := TermID(len(d.nodes) + 1)
+	d.nodes = append(d.nodes, d.wrap(node, id, typeNode))
+	d.ids[key] = append(d.ids[key], id)
+	return id
+}
+
+func (d *termDictionary) ID(node Node) (TermID, bool) {
+	if node == nil {
+		return 0, true
+	}
+	if t, ok := node.(internedTerm); ok {
+		if terms, id := t.term(); terms == d {
+			return id, true
+		}
+	}
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.find(formatNode(node), node)
+}
+
+func (d *termDictionary) Decode(id TermID) Node {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if id == 0 || int(id) > len(d.nodes) {
+		return nil
+	}
+	return d.nodes[id - 1]
+}
+
+func (d *termDictionary) Intern(node Node) Node {
+	if node == nil {
+		return nil
+	}
+	return d.Decode(d.Encode(node))
+}
+
+func (d *termDictionary) Len() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return len(d.nodes)
+}
+
+// find returns the id of the node among the candidates of
+// the key, it requires the mutex to be held.
+func (d *termDictionary) find(key string, node Node) (TermID, bool) {
+	for _, id := range d.ids[key] {
+		if d.nodes[id - 1].Equals(node) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// wrap creates the interned node for the given node, nodes
+// of unknown types (and parameters and quoted triples, which
+// consist of interned nodes) are kept as they are.
+func (d *termDictionary) wrap(node Node, id TermID, typeNode NamedNode) Node {
+	switch v := node.(type) {
+	case Parameter, QuotedTriple:
+		return node
+	case NamedNode:
+		return &internedNamedNode{namedNode{iri: v.Iri()}, d, id}
+	case LocalizedLiteral:
+		if value, ok := v.Value().(string); ok {
+			return &internedLocalizedLiteral{localizedLiteral{value: value, language: v.Language()}, d, id}
+		}
+	case TypedLiteral:
+		return &internedTypedLiteral{typedLiteral{value: v.Value(), typeNode: typeNode}, d, id}
+	}
+	return node
+}
+
+
+
+type internedNamedNode struct {
+	namedNode
+	terms *termDictionary
+	id TermID
+}
+
+func (n *internedNamedNode) term() (*termDictionary, TermID) {
+	return n.terms, n.id
+}
+
+func (n *internedNamedNode) Equals(other interface{}) bool {
+	if o, ok := other.(internedTerm); ok {
+		if terms, id := o.term(); terms == n.terms {
+			return id == n.id
+		}
+	}
+	return n.namedNode.Equals(other)
+}
+
+
+
+type internedLocalizedLiteral struct {
+	localizedLiteral
+	terms *termDictionary
+	id TermID
+}
+
+func (n *internedLocalizedLiteral) term() (*termDictionary, TermID) {
+	return n.terms, n.id
+}
+
+func (n *internedLocalizedLiteral) Equals(other interface{}) bool {
+	if o, ok := other.(internedTerm); ok {
+		if terms, id := o.term(); terms == n.terms {
+			return id == n.id
+		}
+	}
+	return n.localizedLiteral.Equals(other)
+}
+
+
+
+type internedTypedLiteral struct {
+	typedLiteral
+	terms *termDictionary
+	id TermID
+}
+
+func (n *internedTypedLiteral) term() (*termDictionary, TermID) {
+	return n.terms, n.id
+}
+
+func (n *internedTypedLiteral) Equals(other interface{}) bool {
+	if o, ok := other.(internedTerm); ok {
+		if terms, id := o.term(); terms == n.terms {
+			return id == n.id
+		}
+	}
+	return n.typedLiteral.Equals(other)
+}
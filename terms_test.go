@@ -0,0 +1,138 @@
+package semtools
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestTermDictionary(t *testing.T) {
+
+	terms := NewTermDictionary()
+	integer := NewNamedNode(xsdNamespace + "integer")
+
+	a := terms.Encode(NewNamedNode("a"))
+	if a == 0 || terms.Encode(NewNamedNode("a")) != a || terms.Len() != 1 {
+		t.Errorf("Encode() expected the same id for equal nodes but got %v (%v terms)", a, terms.Len())
+	}
+	if node := terms.Decode(a); node == nil || !node.Equals(NewNamedNode("a")) {
+		t.Errorf("Decode() expected the named node but got %v", node)
+	}
+	if node := terms.Decode(42); node != nil {
+		t.Errorf("Decode() expected nil for an unknown id but got %v", node)
+	}
+	if id, ok := terms.ID(NewNamedNode("b")); ok || terms.Len() != 1 {
+		t.Errorf("ID() expected unknown node not to be added but got %v", id)
+	}
+	if id, ok := terms.ID(nil); !ok || id != 0 || terms.Encode(nil) != 0 || terms.Intern(nil) != nil {
+		t.Errorf("ID() expected 0 for nil but got %v", id)
+	}
+
+	// literals are distinguished by their values and types
+	nodes := []Node{
+		NewTypedLiteral("1", integer),
+		NewTypedLiteral(1, integer),
+		NewTypedLiteral("1", nil),
+		NewLocalizedLiteral("1", "en"),
+		NewLocalizedLiteral("1", "de"),
+		NewNamedNode("1"),
+	}
+	ids := map[TermID]bool{}
+	for _, node := range nodes {
+		ids[terms.Encode(node)] = true
+		if id, ok := terms.ID(node); !ok || !terms.Decode(id).Equals(node) {
+			t.Errorf("ID() expected the id of %v but got %v", node, id)
+		}
+	}
+	if len(ids) != len(nodes) || terms.Len() != len(nodes) + 2 {
+		t.Errorf("Encode() expected distinct ids for distinct nodes but got %v (%v terms)", ids, terms.Len())
+	}
+
+	// interned nodes are shared and equal to uninterned nodes
+	lit := terms.Intern(NewTypedLiteral("1", NewNamedNode(xsdNamespace + "integer"))).(TypedLiteral)
+	if lit != terms.Intern(NewTypedLiteral("1", integer)) || lit.Type() != terms.Intern(integer) {
+		t.Errorf("Intern() expected shared instances")
+	}
+	if !lit.Equals(NewTypedLiteral("1", integer)) || !NewTypedLiteral("1", integer).Equals(lit) || lit.Equals(NewTypedLiteral(1, integer)) {
+		t.Errorf("Equals() expected interned literals to compare to other literals")
+	}
+	if other := NewTermDictionary().Intern(lit); other == lit || !other.Equals(lit) {
+		t.Errorf("Intern() expected an equal node of another dictionary")
+	}
+	p := NewParameter("x")
+	if terms.Intern(p) != p {
+		t.Errorf("Intern() expected parameters to be kept")
+	}
+
+}
+
+
+func TestTermDictionaryConcurrency(t *testing.T) {
+
+	terms := NewTermDictionary()
+	wg := sync.WaitGroup{}
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := 0; idx < 100; idx++ {
+				node := NewNamedNode(fmt.Sprintf("n%v", idx))
+				if !terms.Decode(terms.Encode(node)).Equals(node) {
+					t.Errorf("Decode() expected %v", node)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if terms.Len() != 100 {
+		t.Errorf("Encode() expected 100 terms but got %v", terms.Len())
+	}
+
+}
+
+
+func TestTermDictionaryKnowledgeBase(t *testing.T) {
+
+	terms := NewTermDictionary()
+	parser := NewTurtleParser(&TurtleParserOptions{Terms: terms})
+	stmts, err := parser.Unmarshal(`
+		@base <http://example.com/> .
+		<http://example.com/a> <http://example.com/p> "A"@en, <http://example.com/b> .
+		<http://example.com/b> <http://example.com/p> "A"@en, <http://example.com/a> .`)
+	if err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if len(stmts) != 4 || stmts[0].Predicate() != stmts[2].Predicate() || stmts[0].Object() != stmts[2].Object() || stmts[1].Object() != stmts[2].Subject() {
+		t.Errorf("Unmarshal() expected interned nodes but got %v", stmts)
+	}
+
+	kb := NewKnowledgeBaseWithOptions("kb", &KnowledgeBaseOptions{Terms: terms})
+	size := terms.Len()
+	kb.Insert(stmts)
+	kb.Insert([]Statement{NewStatement(NewNamedNode("http://example.com/c"), NewNamedNode("http://example.com/p"), NewLocalizedLiteral("A", "en"), nil)})
+	res := kb.Select().Object(NewLocalizedLiteral("A", "en")).Results()
+	if len(res) != 3 || res[2].Object() != stmts[0].Object() || !res[2].Graph().Equals(kb.DefaultGraph()) {
+		t.Errorf("Insert() expected statements with interned nodes but got %v", res)
+	}
+	if terms.Len() != size + 2 {
+		t.Errorf("Insert() expected the new subject and default graph to be interned but got %v terms", terms.Len() - size)
+	}
+	if indexed := kb.(IndexedKnowledgeBase); indexed.Cardinality(PredicatePosition, NewNamedNode("http://example.com/p")) != 5 || indexed.Cardinality(ObjectPosition, NewNamedNode("http://example.com/x")) != 0 {
+		t.Errorf("Cardinality() returns unexpected counts")
+	}
+
+	kb.Delete([]Statement{NewStatement(NewNamedNode("http://example.com/a"), NewNamedNode("http://example.com/p"), NewLocalizedLiteral("A", "en"), nil)})
+	if kb.(IndexedKnowledgeBase).Size() != 4 || terms.Len() != size + 2 {
+		t.Errorf("Delete() expected 4 statements and the terms to be kept but got %v", kb.Statements())
+	}
+
+}
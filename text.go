@@ -0,0 +1,400 @@
+package semtools
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+
+// BM25 parameters used for relevance scoring.
+const (
+	textScoreK1 = 1.2
+	textScoreB = 0.75
+)
+
+// TextMatch is a statement matched by a full-text search
+// together with its relevance score.
+type TextMatch struct {
+
+	// Statement is the matched statement.
+	Statement Statement
+
+	// Score is the relevance of the statement for the search,
+	// higher scores are more relevant.
+	Score float64
+
+}
+
+// textClause is a single word or phrase of a full-text search,
+// all clauses of a search have to match. For prefix clauses the
+// last token is matched as prefix of the words.
+type textClause struct {
+	tokens []string
+	prefix bool
+}
+
+// parseTextSearch parses a full-text search made up of words,
+// "quoted phrases" and prefixes ending with *. Words containing
+// punctuation are matched as phrases.
+func parseTextSearch(search string) ([]textClause, error) {
+	clauses := []textClause{}
+	add := func(str string) {
+		prefix := strings.HasSuffix(strings.TrimSpace(str), "*")
+		if tokens := tokenizeText(str); len(tokens) > 0 {
+			clauses = append(clauses, textClause{tokens: tokens, prefix: prefix})
+		}
+	}
+
+	for idx, part := range strings.Split(search, "\"") {
+		// odd parts are within quotes
+		if idx % 2 == 1 {
+			add(part)
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			add(word)
+		}
+	}
+
+	if len(clauses) == 0 {
+		return nil, fmt.Errorf("Full-text search '%v' contains no words", search)
+	}
+	return clauses, nil
+}
+
+// tokenizeText splits the text into lower case words.
+func tokenizeText(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// analyzedText is the tokenized and stemmed lexical form of
+// a literal.
+type analyzedText struct {
+	language string
+	tokens []string
+	stems []string
+}
+
+func analyzeText(ln LiteralNode) *analyzedText {
+	t := &analyzedText{
+		language: textLanguage(ln),
+		tokens: tokenizeText(ln.String()),
+	}
+	t.stems = make([]string, len(t.tokens))
+	for idx, token := range t.tokens {
+		t.stems[idx] = stemText(t.language, token)
+	}
+	return t
+}
+
+// frequency returns the number of occurrences of the clause
+// within the text.
+func (t *analyzedText) frequency(c textClause) int {
+	stems := make([]string, len(c.tokens))
+	for idx, token := range c.tokens {
+		stems[idx] = stemText(t.language, token)
+	}
+
+	count := 0
+	for pos := 0; pos + len(c.tokens) <= len(t.tokens); pos++ {
+		matched := true
+		for idx := range c.tokens {
+			if c.prefix && idx == len(c.tokens) - 1 {
+				matched = strings.HasPrefix(t.tokens[pos + idx], c.tokens[idx])
+			} else {
+				matched = t.stems[pos + idx] == stems[idx]
+			}
+			if !matched {
+				break
+			}
+		}
+		if matched {
+			count++
+		}
+	}
+	return count
+}
+
+// matchesText returns true if the literal matches all clauses.
+func matchesText(ln LiteralNode, clauses []textClause) bool {
+	t := analyzeText(ln)
+	for _, c := range clauses {
+		if t.frequency(c) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+
+
+// textIndex is an inverted index over the literal objects of
+// statements. Words are indexed by their stem within the language
+// of the literal and by their lower case form for prefixes.
+type textIndex struct {
+	documents map[Statement]*analyzedText
+	stems map[string]map[Statement]bool
+	tokens map[string]map[Statement]bool
+	languages map[string]int
+	length int
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		documents: map[Statement]*analyzedText{},
+		stems: map[string]map[Statement]bool{},
+		tokens: map[string]map[Statement]bool{},
+		languages: map[string]int{},
+	}
+}
+
+func (ti *textIndex) add(stmt Statement) {
+	ln, ok := stmt.Object().(LiteralNode)
+	if !ok {
+		return
+	}
+	t := analyzeText(ln)
+	ti.documents[stmt] = t
+	ti.languages[t.language]++
+	ti.length += len(t.tokens)
+	for idx, token := range t.tokens {
+		addPosting(ti.stems, t.language + ":" + t.stems[idx], stmt)
+		addPosting(ti.tokens, token, stmt)
+	}
+}
+
+func (ti *textIndex) remove(stmt Statement) {
+	t, ok := ti.documents[stmt]
+	if !ok {
+		return
+	}
+	delete(ti.documents, stmt)
+	if ti.languages[t.language]--; ti.languages[t.language] == 0 {
+		delete(ti.languages, t.language)
+	}
+	ti.length -= len(t.tokens)
+	for idx, token := range t.tokens {
+		removePosting(ti.stems, t.language + ":" + t.stems[idx], stmt)
+		removePosting(ti.tokens, token, stmt)
+	}
+}
+
+func addPosting(postings map[string]map[Statement]bool, key string, stmt Statement) {
+	if postings[key] == nil {
+		postings[key] = map[Statement]bool{}
+	}
+	postings[key][stmt] = true
+}
+
+func removePosting(postings map[string]map[Statement]bool, key string, stmt Statement) {
+	delete(postings[key], stmt)
+	if len(postings[key]) == 0 {
+		delete(postings, key)
+	}
+}
+
+// candidates returns the statements that possibly match
+// the clause, phrases are verified during scoring.
+func (ti *textIndex) candidates(c textClause) map[Statement]bool {
+	res := map[Statement]bool{}
+	if c.prefix && len(c.tokens) == 1 {
+		for token, stmts := range ti.tokens {
+			if strings.HasPrefix(token, c.tokens[0]) {
+				for stmt := range stmts {
+					res[stmt] = true
+				}
+			}
+		}
+		return res
+	}
+	for language := range ti.languages {
+		for stmt := range ti.stems[language + ":" + stemText(language, c.tokens[0])] {
+			res[stmt] = true
+		}
+	}
+	return res
+}
+
+// search returns the statements matching all clauses ordered
+// by descending relevance, scored using BM25.
+func (ti *textIndex) search(clauses []textClause) []TextMatch {
+	candidates := make([]map[Statement]bool, len(clauses))
+	for idx, c := range clauses {
+		candidates[idx] = ti.candidates(c)
+	}
+
+	total := float64(len(ti.documents))
+	average := 0.0
+	if total > 0 {
+		average = float64(ti.length) / total
+	}
+
+	res := []TextMatch{}
+	for stmt := range candidates[0] {
+		t := ti.documents[stmt]
+		score := 0.0
+		for idx, c := range clauses {
+			tf := 0.0
+			if candidates[idx][stmt] {
+				tf = float64(t.frequency(c))
+			}
+			if tf == 0 {
+				score = -1
+				break
+			}
+			df := float64(len(candidates[idx]))
+			idf := math.Log(1 + (total - df + 0.5) / (df + 0.5))
+			norm := 1 - textScoreB
+			if average > 0 {
+				norm += textScoreB * float64(len(t.tokens)) / average
+			}
+			score += idf * tf * (textScoreK1 + 1) / (tf + textScoreK1 * norm)
+		}
+		if score >= 0 {
+			res = append(res, TextMatch{Statement: stmt, Score: score})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return CompareStatements(res[i].Statement, res[j].Statement) < 0
+	})
+	return res
+}
+
+
+
+// textStemmers are the stemmers of the supported languages,
+// literals of other languages are matched by their words.
+var textStemmers = map[string]func(string) string{
+	"en": stemEnglish,
+	"de": stemGerman,
+	"fr": stemFrench,
+	"es": stemSpanish,
+}
+
+// textLanguage returns the primary language of a localized
+// literal if it is supported by a stemmer.
+func textLanguage(ln LiteralNode) string {
+	l, ok := ln.(LocalizedLiteral)
+	if !ok {
+		return ""
+	}
+	language := strings.ToLower(l.Language())
+	if idx := strings.Index(language, "-"); idx >= 0 {
+		language = language[:idx]
+	}
+	if _, ok := textStemmers[language]; !ok {
+		return ""
+	}
+	return language
+}
+
+// stemText reduces the lower case word to its stem using the
+// stemmer of the language.
+func stemText(language string, word string) string {
+	if stem, ok := textStemmers[language]; ok {
+		return stem(word)
+	}
+	return word
+}
+
+// minStemLength is the minimal number of characters that
+// remain after removing a suffix.
+const minStemLength = 3
+
+// suffixRule replaces a suffix of a word.
+type suffixRule struct {
+	suffix string
+	replacement string
+}
+
+// stemSuffix applies the first matching rule to the word,
+// returning the stem and the matched suffix.
+func stemSuffix(word string, rules []suffixRule) (string, string) {
+	for _, r := range rules {
+		if !strings.HasSuffix(word, r.suffix) {
+			continue
+		}
+		stem := word[:len(word) - len(r.suffix)] + r.replacement
+		if utf8.RuneCountInString(stem) < minStemLength {
+			continue
+		}
+		return stem, r.suffix
+	}
+	return word, ""
+}
+
+var englishSuffixes = []suffixRule{
+	{"ational", "ate"}, {"ization", "ize"}, {"fulness", "ful"}, {"ousness", "ous"},
+	{"iveness", "ive"}, {"tional", "tion"}, {"ingly", ""}, {"sses", "ss"}, {"edly", ""},
+	{"ies", "y"}, {"ing", ""}, {"ss", "ss"}, {"ed", ""}, {"ly", ""}, {"s", ""},
+}
+
+// stemEnglish is a light stemmer removing common inflectional
+// and derivational suffixes.
+func stemEnglish(word string) string {
+	stem, suffix := stemSuffix(word, englishSuffixes)
+	// running -> runn -> run
+	if suffix == "ing" || suffix == "ed" {
+		n := len(stem)
+		if n > minStemLength && stem[n - 1] == stem[n - 2] && !strings.ContainsRune("aeiouylsz", rune(stem[n - 1])) {
+			stem = stem[:n - 1]
+		}
+	}
+	return stem
+}
+
+var germanUmlauts = strings.NewReplacer("ä", "a", "ö", "o", "ü", "u", "ß", "ss")
+
+var germanSuffixes = []suffixRule{
+	{"ern", ""}, {"em", ""}, {"en", ""}, {"er", ""}, {"es", ""}, {"e", ""}, {"s", ""},
+}
+
+// germanSEndings are the letters that may precede an
+// inflectional s.
+const germanSEndings = "bdfghklmnrt"
+
+// stemGerman is a light stemmer normalizing umlauts and removing
+// inflectional suffixes.
+func stemGerman(word string) string {
+	word = germanUmlauts.Replace(word)
+	stem, suffix := stemSuffix(word, germanSuffixes)
+	if suffix == "s" && !strings.ContainsRune(germanSEndings, rune(stem[len(stem) - 1])) {
+		return word
+	}
+	return stem
+}
+
+var frenchSuffixes = []suffixRule{
+	{"ements", ""}, {"ations", ""}, {"ement", ""}, {"ation", ""}, {"euses", ""},
+	{"ments", ""}, {"euse", ""}, {"eaux", "eau"}, {"ment", ""}, {"aux", "al"},
+	{"es", ""}, {"s", ""}, {"x", ""}, {"e", ""},
+}
+
+// stemFrench is a light stemmer removing plurals, feminine forms
+// and common suffixes.
+func stemFrench(word string) string {
+	stem, _ := stemSuffix(word, frenchSuffixes)
+	return stem
+}
+
+var spanishSuffixes = []suffixRule{
+	{"aciones", ""}, {"ación", ""}, {"acion", ""}, {"mente", ""}, {"es", ""},
+	{"os", ""}, {"as", ""}, {"s", ""}, {"a", ""}, {"o", ""}, {"e", ""},
+}
+
+// stemSpanish is a light stemmer removing plurals, gender and
+// common suffixes.
+func stemSpanish(word string) string {
+	stem, _ := stemSuffix(word, spanishSuffixes)
+	return stem
+}
@@ -0,0 +1,134 @@
+package semtools
+
+import (
+	"strings"
+	"testing"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+func TestTextAnalysis(t *testing.T) {
+
+	if tokens := tokenizeText("Hello, World! 42 times"); strings.Join(tokens, "|") != "hello|world|42|times" {
+		t.Errorf("tokenizeText() returned unexpected tokens %v", tokens)
+	}
+
+	for _, c := range []struct{ language, word, stem string }{
+		{"en", "running", "run"},
+		{"en", "runs", "run"},
+		{"en", "libraries", "library"},
+		{"en", "class", "class"},
+		{"en", "is", "is"},
+		{"de", "häuser", "haus"},
+		{"de", "hauses", "haus"},
+		{"de", "haus", "haus"},
+		{"de", "tags", "tag"},
+		{"fr", "chevaux", "cheval"},
+		{"fr", "maisons", "maison"},
+		{"es", "casas", "cas"},
+		{"es", "casa", "cas"},
+		{"", "running", "running"},
+	} {
+		if stem := stemText(c.language, c.word); stem != c.stem {
+			t.Errorf("stemText(%v, %v) expected %v but got %v", c.language, c.word, c.stem, stem)
+		}
+	}
+
+	clauses, err := parseTextSearch(`red "big house" ca*`)
+	if err != nil || len(clauses) != 3 || len(clauses[1].tokens) != 2 || !clauses[2].prefix {
+		t.Errorf("parseTextSearch() returned unexpected clauses %v (%v)", clauses, err)
+	}
+	if _, err := parseTextSearch(` "" * `); err == nil {
+		t.Errorf("parseTextSearch() expected to fail without words")
+	}
+
+	ln := NewLocalizedLiteral("The big red houses of the city", "en-GB")
+	for search, expected := range map[string]bool{
+		"house": true,
+		"Houses red": true,
+		`"big red house"`: true,
+		`"red big"`: false,
+		"cit*": true,
+		`"red hou*"`: true,
+		"car": false,
+	} {
+		clauses, _ := parseTextSearch(search)
+		if matchesText(ln, clauses) != expected {
+			t.Errorf("matchesText() of %v expected %v", search, expected)
+		}
+	}
+
+}
+
+
+func TestKnowledgeBaseSearch(t *testing.T) {
+
+	kb := NewKnowledgeBaseWithOptions("kb", &KnowledgeBaseOptions{FullTextIndex: true})
+	label := NewNamedNode("label")
+	kb.Insert([]Statement{
+		NewStatement(NewNamedNode("a"), label, NewLocalizedLiteral("Running shoes for running", "en"), nil),
+		NewStatement(NewNamedNode("b"), label, NewLocalizedLiteral("Shoes and socks for a long run in the evening", "en"), nil),
+		NewStatement(NewNamedNode("c"), label, NewLocalizedLiteral("Rote Häuser", "de"), nil),
+		NewStatement(NewNamedNode("d"), label, NewNamedNode("running"), nil),
+		NewStatement(NewNamedNode("e"), label, NewTypedLiteral("runner", NewNamedNode(xsdNamespace + "string")), nil),
+	})
+
+	matches, err := kb.(TextIndexedKnowledgeBase).Search("run")
+	if err != nil || len(matches) != 2 {
+		t.Fatalf("Search() expected 2 matches but got %v (%v)", matches, err)
+	}
+	if !matches[0].Statement.Subject().Equals(NewNamedNode("a")) || matches[0].Score <= matches[1].Score {
+		t.Errorf("Search() expected the more relevant statement first but got %v", matches)
+	}
+	if matches, _ := kb.(TextIndexedKnowledgeBase).Search("haus"); len(matches) != 1 {
+		t.Errorf("Search() expected language aware stemming but got %v", matches)
+	}
+	if matches, _ := kb.(TextIndexedKnowledgeBase).Search("runn*"); len(matches) != 2 {
+		t.Errorf("Search() expected 2 prefix matches but got %v", matches)
+	}
+	if matches, _ := kb.(TextIndexedKnowledgeBase).Search(`"long run" shoes`); len(matches) != 1 {
+		t.Errorf("Search() expected 1 phrase match but got %v", matches)
+	}
+
+	// queries use the index
+	q := kb.Select().Predicate(label).ObjectText("shoes")
+	if plan, _ := q.Plan(); plan.Text == nil {
+		t.Errorf("Plan() expected to use the full-text index")
+	}
+	if res := q.Results(); len(res) != 2 || !res[0].Subject().Equals(NewNamedNode("a")) {
+		t.Errorf("Results() expected results by relevance but got %v", res)
+	}
+	if str, _ := q.Explain(); !strings.HasPrefix(str, `TEXT SEARCH text(object, "shoes"^^<http://www.w3.org/2001/XMLSchema#string>) (estimated 2, actual 2)`) {
+		t.Errorf("Explain() expected text search but got %v", str)
+	}
+
+	// the index is kept in sync
+	kb.Delete([]Statement{NewStatement(NewNamedNode("b"), label, NewLocalizedLiteral("Shoes and socks for a long run in the evening", "en"), nil)})
+	if matches, _ := kb.(TextIndexedKnowledgeBase).Search("shoes"); len(matches) != 1 {
+		t.Errorf("Search() expected 1 match after Delete() but got %v", matches)
+	}
+	if matches, _ := kb.(TextIndexedKnowledgeBase).Search("socks"); len(matches) != 0 {
+		t.Errorf("Search() expected no match after Delete() but got %v", matches)
+	}
+
+	// without index the filter is evaluated on every statement
+	plain := NewKnowledgeBase("plain")
+	plain.Insert(kb.Statements())
+	if _, err := plain.(TextIndexedKnowledgeBase).Search("shoes"); err == nil {
+		t.Errorf("Search() expected to fail without index")
+	}
+	if res := plain.Select().ObjectText("shoes").Results(); len(res) != 1 {
+		t.Errorf("Results() expected 1 match without index but got %v", res)
+	}
+	if q := NewQuery().ObjectText(" "); q.Err() == nil {
+		t.Errorf("ObjectText() expected to fail without words")
+	}
+
+}
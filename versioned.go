@@ -0,0 +1,493 @@
+package semtools
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+
+// Revision is a recorded change of a versioned knowledge base.
+type Revision struct {
+
+	// Number is the number of the revision, ie. the sequence
+	// number of the change.
+	Number uint64
+
+	// Time is the time the change was made at.
+	Time time.Time
+
+	// Added are the statements inserted by the change.
+	Added []Statement
+
+	// Removed are the statements deleted by the change.
+	Removed []Statement
+
+}
+
+// VersionedKnowledgeBase is a knowledge base that records every
+// change as a revision, so the statements of past revisions can be
+// looked at. Revision 0 is the empty knowledge base, every change
+// creates the revision of its sequence number.
+type VersionedKnowledgeBase interface {
+
+	KnowledgeBase
+
+	// Revisions returns the revisions that are kept, oldest first.
+	Revisions() []Revision
+
+	// At returns a read-only knowledge base of the statements at
+	// the revision.
+	At(revision uint64) (KnowledgeBase, error)
+
+	// AsOf returns a read-only knowledge base of the statements at
+	// the time, ie. at the last revision made before or at it.
+	AsOf(t time.Time) (KnowledgeBase, error)
+
+	// Tag names the revision, tags can't be moved to another
+	// revision.
+	Tag(name string, revision uint64) error
+
+	// Untag removes the tag.
+	Untag(name string)
+
+	// Tags returns the revisions by their tags.
+	Tags() map[string]uint64
+
+	// AtTag returns a read-only knowledge base of the statements at
+	// the tagged revision.
+	AtTag(name string) (KnowledgeBase, error)
+
+	// DiffRevisions returns the statements that have to be added and
+	// removed to get from the statements of one revision to the ones
+	// of the other.
+	DiffRevisions(from uint64, to uint64) (Change, error)
+
+	// Compact drops the revisions up to the given one, which can't
+	// be looked at afterwards unless they are tagged.
+	Compact(revision uint64) error
+
+}
+
+// VersionedKnowledgeBaseOptions are options that configure a
+// versioned knowledge base.
+type VersionedKnowledgeBaseOptions struct {
+
+	// KnowledgeBaseOptions configure the knowledge base, the
+	// ChangeLog receives the changes as well.
+	KnowledgeBaseOptions
+
+	// MaxRevisions is the number of revisions that are kept,
+	// older ones are compacted automatically. Defaults to 0,
+	// which keeps all revisions.
+	MaxRevisions int
+
+	// Clock returns the time of new revisions. Defaults to
+	// time.Now.
+	Clock func() time.Time
+
+}
+
+// NewVersionedKnowledgeBase creates a new versioned knowledge
+// base with the given name.
+func NewVersionedKnowledgeBase(name string) VersionedKnowledgeBase {
+	return NewVersionedKnowledgeBaseWithOptions(name, nil)
+}
+
+// NewVersionedKnowledgeBaseWithOptions creates a new versioned
+// knowledge base with the given name and options. The revisions
+// are kept in memory, past revisions are rebuilt from the closest
+// of the current statements and the oldest revision kept.
+//
+// Usage
+//
+//     kb := NewVersionedKnowledgeBase("kb")
+//     kb.Insert(stmts)
+//     err := kb.Tag("audit-2020", kb.Sequence())
+//     past, err := kb.AsOf(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+func NewVersionedKnowledgeBaseWithOptions(name string, opts *VersionedKnowledgeBaseOptions) VersionedKnowledgeBase {
+
+	// make sure things are initialized
+	if opts == nil {
+		opts = &VersionedKnowledgeBaseOptions{}
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+
+	history := &revisionHistory{
+		log: opts.ChangeLog,
+		clock: clock,
+		maxRevisions: opts.MaxRevisions,
+		revisions: []Revision{},
+		tags: map[string]uint64{},
+		pinned: map[uint64][]Statement{},
+	}
+	kbOpts := opts.KnowledgeBaseOptions
+	kbOpts.ChangeLog = history
+	kb := NewKnowledgeBaseWithOptions(name, &kbOpts).(*knowledgeBase)
+	history.kb = kb
+	history.base = kb.sequence
+	history.baseKnowledgeBase = history.scratch(name, nil)
+	return &versionedKnowledgeBase{knowledgeBase: kb, history: history}
+
+}
+
+
+
+type versionedKnowledgeBase struct {
+	*knowledgeBase
+	history *revisionHistory
+}
+
+func (vkb *versionedKnowledgeBase) Revisions() []Revision {
+	vkb.history.mutex.Lock()
+	defer vkb.history.mutex.Unlock()
+	return append([]Revision{}, vkb.history.revisions...)
+}
+
+func (vkb *versionedKnowledgeBase) At(revision uint64) (KnowledgeBase, error) {
+	stmts, err := vkb.statementsAt(revision)
+	if err != nil {
+		return nil, err
+	}
+	return vkb.view(revision, stmts), nil
+}
+
+func (vkb *versionedKnowledgeBase) AsOf(t time.Time) (KnowledgeBase, error) {
+	// the read lock keeps the revisions in line with the statements
+	vkb.mutex.RLock()
+	defer vkb.mutex.RUnlock()
+	vkb.history.mutex.Lock()
+	defer vkb.history.mutex.Unlock()
+
+	h := vkb.history
+	revision := h.base
+	if t.Before(h.baseTime) {
+		return nil, fmt.Errorf("Revisions of '%v' before '%v' are compacted", vkb.name, h.baseTime)
+	}
+	for _, r := range h.revisions {
+		if r.Time.After(t) {
+			break
+		}
+		revision = r.Number
+	}
+	stmts, err := h.statementsAt(revision, vkb.statements)
+	if err != nil {
+		return nil, err
+	}
+	return vkb.view(revision, stmts), nil
+}
+
+func (vkb *versionedKnowledgeBase) Tag(name string, revision uint64) error {
+	if name == "" {
+		return fmt.Errorf("Tag of '%v' has to have a name", vkb.name)
+	}
+	vkb.mutex.RLock()
+	defer vkb.mutex.RUnlock()
+	vkb.history.mutex.Lock()
+	defer vkb.history.mutex.Unlock()
+
+	h := vkb.history
+	if existing, ok := h.tags[name]; ok {
+		if existing == revision {
+			return nil
+		}
+		return fmt.Errorf("Tag '%v' of '%v' exists already", name, vkb.name)
+	}
+	if revision > vkb.sequence {
+		return fmt.Errorf("Revision %v of '%v' doesn't exist", revision, vkb.name)
+	}
+	if _, ok := h.pinned[revision]; revision < h.base && !ok {
+		return fmt.Errorf("Revision %v of '%v' is compacted", revision, vkb.name)
+	}
+	h.tags[name] = revision
+	return nil
+}
+
+func (vkb *versionedKnowledgeBase) Untag(name string) {
+	vkb.history.mutex.Lock()
+	defer vkb.history.mutex.Unlock()
+
+	h := vkb.history
+	revision, ok := h.tags[name]
+	if !ok {
+		return
+	}
+	delete(h.tags, name)
+	for _, r := range h.tags {
+		if r == revision {
+			return
+		}
+	}
+	delete(h.pinned, revision)
+}
+
+func (vkb *versionedKnowledgeBase) Tags() map[string]uint64 {
+	vkb.history.mutex.Lock()
+	defer vkb.history.mutex.Unlock()
+	tags := map[string]uint64{}
+	for name, revision := range vkb.history.tags {
+		tags[name] = revision
+	}
+	return tags
+}
+
+func (vkb *versionedKnowledgeBase) AtTag(name string) (KnowledgeBase, error) {
+	revision, ok := vkb.Tags()[name]
+	if !ok {
+		return nil, fmt.Errorf("Tag '%v' of '%v' doesn't exist", name, vkb.name)
+	}
+	return vkb.At(revision)
+}
+
+func (vkb *versionedKnowledgeBase) DiffRevisions(from uint64, to uint64) (Change, error) {
+	fromStmts, err := vkb.statementsAt(from)
+	if err != nil {
+		return Change{}, err
+	}
+	toStmts, err := vkb.statementsAt(to)
+	if err != nil {
+		return Change{}, err
+	}
+
+	// blank nodes keep their labels within the knowledge base,
+	// so the statements are compared as they are
+	change := compareStatements(fromStmts, toStmts)
+	change.Sequence = to
+	return change, nil
+}
+
+func (vkb *versionedKnowledgeBase) Compact(revision uint64) error {
+	vkb.history.mutex.Lock()
+	defer vkb.history.mutex.Unlock()
+	return vkb.history.compact(revision)
+}
+
+// statementsAt returns the statements at the revision.
+func (vkb *versionedKnowledgeBase) statementsAt(revision uint64) ([]Statement, error) {
+	vkb.mutex.RLock()
+	defer vkb.mutex.RUnlock()
+	vkb.history.mutex.Lock()
+	defer vkb.history.mutex.Unlock()
+	return vkb.history.statementsAt(revision, vkb.statements)
+}
+
+// view creates the read-only knowledge base of the statements
+// of the revision.
+func (vkb *versionedKnowledgeBase) view(revision uint64, stmts []Statement) KnowledgeBase {
+	kb := vkb.history.scratch(fmt.Sprintf("%v@%v", vkb.name, revision), stmts)
+	kb.sequence = revision
+	return &revisionView{knowledgeBase: kb}
+}
+
+
+
+// revisionHistory records the changes of a versioned knowledge
+// base as its change log. The statements at base are kept in a
+// knowledge base compacted revisions are applied to, later
+// revisions are rebuilt from them or the current statements.
+// Appends happen while the knowledge base is locked for writing,
+// so the lock of the knowledge base has to be acquired first.
+type revisionHistory struct {
+	mutex sync.Mutex
+	kb *knowledgeBase
+	log ChangeLog
+	clock func() time.Time
+	maxRevisions int
+	base uint64
+	baseTime time.Time
+	baseKnowledgeBase *knowledgeBase
+	revisions []Revision
+	tags map[string]uint64
+	// pinned holds the statements of compacted tagged revisions
+	pinned map[uint64][]Statement
+}
+
+func (h *revisionHistory) Append(change Change) error {
+	h.mutex.Lock()
+	h.revisions = append(h.revisions, Revision{
+		Number: change.Sequence,
+		Time: h.clock(),
+		Added: change.Added,
+		Removed: change.Removed,
+	})
+	if h.maxRevisions > 0 && len(h.revisions) > h.maxRevisions {
+		h.compact(h.revisions[len(h.revisions) - h.maxRevisions - 1].Number)
+	}
+	h.mutex.Unlock()
+
+	if h.log != nil {
+		return h.log.Append(change)
+	}
+	return nil
+}
+
+func (h *revisionHistory) LastSequence() uint64 {
+	if h.log != nil {
+		return h.log.LastSequence()
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.base + uint64(len(h.revisions))
+}
+
+func (h *revisionHistory) Replay(from uint64, fn func(change Change) error) error {
+	if h.log != nil {
+		return h.log.Replay(from, fn)
+	}
+	h.mutex.Lock()
+	revisions := h.revisions
+	h.mutex.Unlock()
+	for _, r := range revisions {
+		if r.Number < from {
+			continue
+		}
+		if err := fn(Change{Sequence: r.Number, Added: r.Added, Removed: r.Removed}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *revisionHistory) Close() error {
+	if h.log != nil {
+		return h.log.Close()
+	}
+	return nil
+}
+
+// statementsAt returns the statements at the revision, rebuilt
+// from the base or the current statements, whichever needs fewer
+// changes.
+func (h *revisionHistory) statementsAt(revision uint64, current []Statement) ([]Statement, error) {
+	last := h.base + uint64(len(h.revisions))
+	if revision > last {
+		return nil, fmt.Errorf("Revision %v of '%v' doesn't exist", revision, h.kb.name)
+	}
+	if stmts, ok := h.pinned[revision]; ok {
+		return stmts, nil
+	}
+	if revision < h.base {
+		return nil, fmt.Errorf("Revision %v of '%v' is compacted", revision, h.kb.name)
+	}
+	if revision == last {
+		return current, nil
+	}
+
+	idx := int(revision - h.base)
+	forward, backward := 0, 0
+	for i, r := range h.revisions {
+		if i < idx {
+			forward += len(r.Added) + len(r.Removed)
+		} else {
+			backward += len(r.Added) + len(r.Removed)
+		}
+	}
+	if forward <= backward {
+		kb := h.scratch(h.kb.name, h.baseKnowledgeBase.statements)
+		for _, r := range h.revisions[:idx] {
+			kb.Delete(r.Removed)
+			kb.Insert(r.Added)
+		}
+		return kb.statements, nil
+	}
+	kb := h.scratch(h.kb.name, current)
+	for i := len(h.revisions) - 1; i >= idx; i-- {
+		kb.Delete(h.revisions[i].Added)
+		kb.Insert(h.revisions[i].Removed)
+	}
+	return kb.statements, nil
+}
+
+// compact applies the revisions up to the given one to the base,
+// keeping the statements of tagged revisions.
+func (h *revisionHistory) compact(revision uint64) error {
+	last := h.base + uint64(len(h.revisions))
+	if revision > last {
+		return fmt.Errorf("Revision %v of '%v' doesn't exist", revision, h.kb.name)
+	}
+	if revision <= h.base {
+		return nil
+	}
+
+	tagged := map[uint64]bool{}
+	for _, r := range h.tags {
+		tagged[r] = true
+	}
+	// statements are replaced on modifications, so the pinned
+	// statements aren't modified by later revisions
+	kb := h.baseKnowledgeBase
+	if tagged[h.base] {
+		h.pinned[h.base] = kb.statements
+	}
+	idx := int(revision - h.base)
+	for _, r := range h.revisions[:idx] {
+		kb.Delete(r.Removed)
+		kb.Insert(r.Added)
+		if tagged[r.Number] && r.Number < revision {
+			h.pinned[r.Number] = kb.statements
+		}
+	}
+	h.base = revision
+	h.baseTime = h.revisions[idx - 1].Time
+	h.revisions = append([]Revision{}, h.revisions[idx:]...)
+	GetLogger("knowledge-base").Debugf("Compacted the revisions of '%v' up to %v", h.kb.name, revision)
+	return nil
+}
+
+// scratch creates an unversioned knowledge base of the statements
+// with the settings of the versioned one.
+func (h *revisionHistory) scratch(name string, stmts []Statement) *knowledgeBase {
+	kb := NewKnowledgeBaseWithOptions(name, &KnowledgeBaseOptions{
+		DefaultGraph: h.kb.defaultGraph,
+		UnionDefaultGraph: h.kb.unionDefaultGraph,
+		Terms: h.kb.terms,
+	}).(*knowledgeBase)
+	kb.Insert(stmts)
+	return kb
+}
+
+
+
+// revisionView is the read-only knowledge base of the statements
+// of a past revision, modifications are ignored.
+type revisionView struct {
+	*knowledgeBase
+}
+
+func (v *revisionView) Insert(stmts []Statement) {
+	v.readOnly()
+}
+
+func (v *revisionView) Delete(stmts []Statement) {
+	v.readOnly()
+}
+
+func (v *revisionView) Graph(graph NamedNode) KnowledgeBase {
+	return &graphView{
+		base: v,
+		graph: graph,
+	}
+}
+
+func (v *revisionView) DropGraph(graph NamedNode) {
+	v.readOnly()
+}
+
+func (v *revisionView) CopyGraph(source NamedNode, target NamedNode) {
+	v.readOnly()
+}
+
+func (v *revisionView) MoveGraph(source NamedNode, target NamedNode) {
+	v.readOnly()
+}
+
+func (v *revisionView) AddGraph(source NamedNode, target NamedNode) {
+	v.readOnly()
+}
+
+func (v *revisionView) readOnly() {
+	GetLogger("knowledge-base").Errorf("Knowledge base '%v' is read-only, modification is ignored", v.name)
+}
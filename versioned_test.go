@@ -0,0 +1,252 @@
+package semtools
+
+import (
+	"testing"
+	"time"
+	"github.com/sirupsen/logrus"
+)
+
+
+func init() {
+
+	logrus.SetLevel(logrus.DebugLevel)
+
+}
+
+
+// versionedTestKnowledgeBase creates a versioned knowledge base with
+// a clock advancing a minute per revision and four revisions:
+// insert a, insert b, delete a, insert c.
+func versionedTestKnowledgeBase(opts *VersionedKnowledgeBaseOptions) (VersionedKnowledgeBase, time.Time) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	if opts == nil {
+		opts = &VersionedKnowledgeBaseOptions{}
+	}
+	opts.Clock = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	kb := NewVersionedKnowledgeBaseWithOptions("kb", opts)
+	kb.Insert([]Statement{versionedTestStatement("a")})
+	kb.Insert([]Statement{versionedTestStatement("b")})
+	kb.Delete([]Statement{versionedTestStatement("a")})
+	kb.Insert([]Statement{versionedTestStatement("c")})
+	return kb, start
+}
+
+func versionedTestStatement(subject string) Statement {
+	return NewStatement(NewNamedNode(subject), NewNamedNode("p"), NewLocalizedLiteral(subject, "en"), nil)
+}
+
+func versionedTestSubjects(kb KnowledgeBase) string {
+	subjects := ""
+	for _, stmt := range kb.Statements() {
+		subjects += stmt.Subject().Iri()
+	}
+	return subjects
+}
+
+
+func TestVersionedKnowledgeBaseAt(t *testing.T) {
+
+	kb, start := versionedTestKnowledgeBase(nil)
+	if revisions := kb.Revisions(); len(revisions) != 4 || revisions[2].Number != 3 || len(revisions[2].Removed) != 1 || !revisions[2].Time.Equal(start.Add(3 * time.Minute)) {
+		t.Errorf("Revisions() expected 4 revisions but got %v", revisions)
+	}
+
+	expected := []string{"", "a", "ab", "b", "bc"}
+	for revision, subjects := range expected {
+		view, err := kb.At(uint64(revision))
+		if err != nil {
+			t.Fatalf("At() failed: %v", err)
+		}
+		if versionedTestSubjects(view) != subjects || view.Sequence() != uint64(revision) {
+			t.Errorf("At(%v) expected %v but got %v", revision, subjects, view.Statements())
+		}
+		if res := view.Select().Subject(NewNamedNode("a")).Results(); (len(res) == 1) != (revision == 1 || revision == 2) {
+			t.Errorf("At(%v) expected queries on the revision but got %v", revision, res)
+		}
+	}
+	if _, err := kb.At(5); err == nil {
+		t.Errorf("At() expected an error for a future revision")
+	}
+
+	times := map[time.Duration]string{0: "", 30 * time.Second: "", 2 * time.Minute: "ab", 150 * time.Second: "ab", time.Hour: "bc"}
+	for offset, subjects := range times {
+		view, err := kb.AsOf(start.Add(offset))
+		if err != nil || versionedTestSubjects(view) != subjects {
+			t.Errorf("AsOf(%v) expected %v but got %v (%v)", offset, subjects, view, err)
+		}
+	}
+
+}
+
+
+func TestVersionedKnowledgeBaseReadOnly(t *testing.T) {
+
+	kb, _ := versionedTestKnowledgeBase(nil)
+	view, err := kb.At(2)
+	if err != nil {
+		t.Fatalf("At() failed: %v", err)
+	}
+	view.Insert([]Statement{versionedTestStatement("d")})
+	view.Delete([]Statement{versionedTestStatement("a")})
+	view.Graph(kb.DefaultGraph()).Insert([]Statement{versionedTestStatement("e")})
+	view.DropGraph(kb.DefaultGraph())
+	if versionedTestSubjects(view) != "ab" || versionedTestSubjects(kb) != "bc" || kb.Sequence() != 4 {
+		t.Errorf("Insert() expected the view to be read-only but got %v", view.Statements())
+	}
+
+}
+
+
+func TestVersionedKnowledgeBaseTags(t *testing.T) {
+
+	kb, _ := versionedTestKnowledgeBase(nil)
+	if err := kb.Tag("release", 2); err != nil {
+		t.Fatalf("Tag() failed: %v", err)
+	}
+	if err := kb.Tag("release", 2); err != nil {
+		t.Errorf("Tag() expected tagging the same revision again to succeed but got %v", err)
+	}
+	if err := kb.Tag("release", 3); err == nil {
+		t.Errorf("Tag() expected an error for moving a tag")
+	}
+	if err := kb.Tag("future", 9); err == nil {
+		t.Errorf("Tag() expected an error for a future revision")
+	}
+	if view, err := kb.AtTag("release"); err != nil || versionedTestSubjects(view) != "ab" {
+		t.Errorf("AtTag() expected ab but got %v (%v)", view, err)
+	}
+	if _, err := kb.AtTag("unknown"); err == nil {
+		t.Errorf("AtTag() expected an error for an unknown tag")
+	}
+	kb.Untag("release")
+	if tags := kb.Tags(); len(tags) != 0 {
+		t.Errorf("Untag() expected no tags but got %v", tags)
+	}
+
+}
+
+
+func TestVersionedKnowledgeBaseDiffRevisions(t *testing.T) {
+
+	kb, _ := versionedTestKnowledgeBase(nil)
+	change, err := kb.DiffRevisions(1, 4)
+	if err != nil {
+		t.Fatalf("DiffRevisions() failed: %v", err)
+	}
+	if len(change.Added) != 2 || len(change.Removed) != 1 || change.Sequence != 4 {
+		t.Errorf("DiffRevisions() expected 2 added and 1 removed statements but got %v", change)
+	}
+	if !change.Removed[0].Subject().Equals(NewNamedNode("a")) || !change.Added[0].Subject().Equals(NewNamedNode("b")) || !change.Added[1].Subject().Equals(NewNamedNode("c")) {
+		t.Errorf("DiffRevisions() expected to add b and c and remove a but got %v", change)
+	}
+
+	reverse, err := kb.DiffRevisions(4, 1)
+	if err != nil || len(reverse.Added) != 1 || len(reverse.Removed) != 2 {
+		t.Errorf("DiffRevisions() expected the reverse change but got %v (%v)", reverse, err)
+	}
+
+	// literals with values of different kinds differ
+	integer := NewNamedNode(xsdNamespace + "integer")
+	kinds := NewVersionedKnowledgeBase("kinds")
+	kinds.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral(1, integer), nil)})
+	kinds.Insert([]Statement{NewStatement(NewNamedNode("a"), NewNamedNode("p"), NewTypedLiteral("1", integer), nil)})
+	if change, err := kinds.DiffRevisions(1, 2); err != nil || len(change.Added) != 1 || len(change.Removed) != 0 {
+		t.Errorf("DiffRevisions() expected the literal of the other kind to be added but got %v (%v)", change, err)
+	}
+
+	// the change can be applied as patch to the earlier revision
+	replica := NewKnowledgeBase("replica")
+	view, _ := kb.At(1)
+	replica.Insert(view.Statements())
+	if err := ApplyPatch(replica, NewPatch(change)); err != nil || versionedTestSubjects(replica) != "bc" {
+		t.Errorf("ApplyPatch() expected bc but got %v (%v)", replica.Statements(), err)
+	}
+
+}
+
+
+func TestVersionedKnowledgeBaseCompact(t *testing.T) {
+
+	kb, start := versionedTestKnowledgeBase(nil)
+	if err := kb.Tag("first", 1); err != nil {
+		t.Fatalf("Tag() failed: %v", err)
+	}
+	if err := kb.Compact(3); err != nil {
+		t.Fatalf("Compact() failed: %v", err)
+	}
+	if revisions := kb.Revisions(); len(revisions) != 1 || revisions[0].Number != 4 {
+		t.Errorf("Compact() expected to keep revision 4 but got %v", revisions)
+	}
+	if _, err := kb.At(2); err == nil {
+		t.Errorf("At() expected an error for a compacted revision")
+	}
+	if view, err := kb.At(1); err != nil || versionedTestSubjects(view) != "a" {
+		t.Errorf("At() expected the tagged revision to be kept but got %v (%v)", view, err)
+	}
+	if view, err := kb.At(3); err != nil || versionedTestSubjects(view) != "b" {
+		t.Errorf("At() expected b but got %v (%v)", view, err)
+	}
+	if _, err := kb.AsOf(start.Add(2 * time.Minute)); err == nil {
+		t.Errorf("AsOf() expected an error for a compacted time")
+	}
+	if view, err := kb.AsOf(start.Add(3 * time.Minute)); err != nil || versionedTestSubjects(view) != "b" {
+		t.Errorf("AsOf() expected b but got %v (%v)", view, err)
+	}
+	if err := kb.Tag("second", 2); err == nil {
+		t.Errorf("Tag() expected an error for a compacted revision")
+	}
+	if err := kb.Compact(9); err == nil {
+		t.Errorf("Compact() expected an error for a future revision")
+	}
+
+	kb.Untag("first")
+	if _, err := kb.At(1); err == nil {
+		t.Errorf("At() expected an error for an untagged compacted revision")
+	}
+
+}
+
+
+func TestVersionedKnowledgeBaseMaxRevisions(t *testing.T) {
+
+	log := NewMemoryChangeLog()
+	kb, _ := versionedTestKnowledgeBase(&VersionedKnowledgeBaseOptions{
+		KnowledgeBaseOptions: KnowledgeBaseOptions{ChangeLog: log},
+		MaxRevisions: 2,
+	})
+	if revisions := kb.Revisions(); len(revisions) != 2 || revisions[0].Number != 3 {
+		t.Errorf("Insert() expected to keep 2 revisions but got %v", revisions)
+	}
+	if view, err := kb.At(2); err != nil || versionedTestSubjects(view) != "ab" {
+		t.Errorf("At() expected ab but got %v (%v)", view, err)
+	}
+	if _, err := kb.At(1); err == nil {
+		t.Errorf("At() expected an error for a compacted revision")
+	}
+	if log.LastSequence() != 4 {
+		t.Errorf("ChangeLog expected to receive the changes but got %v", log.LastSequence())
+	}
+
+	// the base is kept up to date, tagged revisions aren't
+	// changed by compacting later ones
+	if err := kb.Tag("third", 3); err != nil {
+		t.Fatalf("Tag() failed: %v", err)
+	}
+	kb.Delete([]Statement{versionedTestStatement("b")})
+	kb.Insert([]Statement{versionedTestStatement("d")})
+	kb.Delete([]Statement{versionedTestStatement("c")})
+	if revisions := kb.Revisions(); len(revisions) != 2 || revisions[0].Number != 6 {
+		t.Errorf("Insert() expected to keep 2 revisions but got %v", revisions)
+	}
+	expected := map[uint64]string{3: "b", 5: "c", 6: "cd", 7: "d"}
+	for revision, subjects := range expected {
+		if view, err := kb.At(revision); err != nil || versionedTestSubjects(view) != subjects {
+			t.Errorf("At(%v) expected %v but got %v (%v)", revision, subjects, view, err)
+		}
+	}
+
+}